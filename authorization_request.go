@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AuthorizationRequestExpiry is how long the user has to complete the login of an authorization request
+const AuthorizationRequestExpiry = time.Hour
+
+// AuthorizationRequest is an authorization request validated by the authorization endpoint. The hosted login pages
+// only pass on its ID, so that the parameters cannot be changed after the client, pushed request or request object
+// was checked.
+type AuthorizationRequest struct {
+	Id           string
+	ClientId     string
+	RedirectUri  string
+	ResponseType string
+	ResponseMode string
+	Scope        string
+	State        string
+	Nonce        string
+	Prompt       string
+	ExpiresAt    time.Time
+}
+
+// storeAuthorizationRequest keeps a validated authorization request for the steps of the login, setting its ID
+func storeAuthorizationRequest(request AuthorizationRequest) AuthorizationRequest {
+	// Forget requests once they expired
+	now := time.Now()
+	for id, stored := range AppContext.AuthorizationRequests {
+		if now.After(stored.ExpiresAt) {
+			delete(AppContext.AuthorizationRequests, id)
+		}
+	}
+
+	request.Id = generateRandomToken()
+	request.ExpiresAt = now.Add(AuthorizationRequestExpiry)
+	AppContext.AuthorizationRequests[request.Id] = request
+	return request
+}
+
+// findAuthorizationRequest returns the authorization request with the ID, unless it expired
+func findAuthorizationRequest(id string) (AuthorizationRequest, bool) {
+	request, exists := AppContext.AuthorizationRequests[id]
+	if !exists || time.Now().After(request.ExpiresAt) {
+		return AuthorizationRequest{}, false
+	}
+	return request, true
+}
+
+// authorizationRequestParams returns the parameters the hosted pages pass on to return to the login of the request
+func authorizationRequestParams(request AuthorizationRequest) url.Values {
+	if request.Id == "" {
+		return url.Values{}
+	}
+	return url.Values{"authorization_request": {request.Id}}
+}
+
+// authorizationRequestLoginUrl returns the URL of the login form of the request, if there is one
+func authorizationRequestLoginUrl(request AuthorizationRequest) string {
+	if request.Id == "" {
+		return ""
+	}
+	return "/oauth2/authorize?" + authorizationRequestParams(request).Encode()
+}
+
+// findReturnAuthorizationRequest finds the authorization request a page outside of the login, like signing up,
+// returns to, along with its client. Pages opened without one, or after it expired, do not return to a login.
+func findReturnAuthorizationRequest(values url.Values) (AuthorizationRequest, *IdpClient) {
+	request, exists := findAuthorizationRequest(values.Get("authorization_request"))
+	if !exists {
+		return AuthorizationRequest{}, nil
+	}
+	client := FindClientByRedirectUri(request.ClientId, request.RedirectUri)
+	if client == nil {
+		return AuthorizationRequest{}, nil
+	}
+	return request, client
+}
+
+// renderExpiredAuthorizationRequestPage rejects a hosted page request whose authorization request is unknown or expired
+func renderExpiredAuthorizationRequestPage(w http.ResponseWriter) {
+	renderOAuth2ErrorPage(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "The login has expired, please start over from the application")
+}
+
+// renderLoginSessionExpired asks the user to log in again after a step of the login form expired, as long as the
+// authorization request the form was submitted with is still valid
+func renderLoginSessionExpired(w http.ResponseWriter, r *http.Request, message string) {
+	request, exists := findAuthorizationRequest(r.Form.Get("authorization_request"))
+	if !exists {
+		renderExpiredAuthorizationRequestPage(w)
+		return
+	}
+	renderLoginForm(w, loginFormData{
+		Error:         message,
+		Request:       request,
+		ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+	})
+}
+
+// completeAuthorizationRequest sends the authorization response for the request, which cannot be used again
+func completeAuthorizationRequest(w http.ResponseWriter, r *http.Request, foundUser *IdpUser, foundClient *IdpClient, request AuthorizationRequest, scope string, amr []string) {
+	delete(AppContext.AuthorizationRequests, request.Id)
+	redirectWithAuthorizationResponse(w, r, foundUser, foundClient, request.RedirectUri, scope, request.State, request.Nonce, request.ResponseType, request.ResponseMode, amr)
+}
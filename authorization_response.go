@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Values of response_type, which combine to the response types of the implicit and hybrid flows
+const (
+	ResponseTypeCode    = "code"
+	ResponseTypeToken   = "token"
+	ResponseTypeIdToken = "id_token"
+)
+
+// responseTypeOrder is the order the values of a response type are normalized to
+var responseTypeOrder = []string{ResponseTypeCode, ResponseTypeIdToken, ResponseTypeToken}
+
+// normalizeResponseType orders the space separated values of a response type, since their order does not matter. An
+// empty response type is the authorization code flow.
+func normalizeResponseType(responseType string) string {
+	values := strings.Fields(responseType)
+	if len(values) == 0 {
+		return ResponseTypeCode
+	}
+	slices.SortFunc(values, func(a, b string) int {
+		return slices.Index(responseTypeOrder, a) - slices.Index(responseTypeOrder, b)
+	})
+	return strings.Join(slices.Compact(values), " ")
+}
+
+// responseTypeIncludes reports whether the response type returns the value, e.g. an ID token
+func responseTypeIncludes(responseType string, value string) bool {
+	return slices.Contains(strings.Fields(responseType), value)
+}
+
+// clientResponseTypes returns the response types the client may use, only the authorization code flow by default
+func clientResponseTypes(client *IdpClient) []string {
+	if len(client.ResponseTypes) == 0 {
+		return []string{ResponseTypeCode}
+	}
+	responseTypes := []string{}
+	for _, responseType := range client.ResponseTypes {
+		responseTypes = append(responseTypes, normalizeResponseType(responseType))
+	}
+	return responseTypes
+}
+
+// checkResponseType validates the response type of an authorization request for the client, returning the error code
+// and description if it cannot be used
+func checkResponseType(client *IdpClient, responseType string, nonce string) (string, string) {
+	normalized := normalizeResponseType(responseType)
+	if !slices.Contains(OAuth2ResponseTypes, normalized) {
+		return OAuth2ErrorUnsupportedResponseType, "response_type must be one of: " + strings.Join(OAuth2ResponseTypes, ", ")
+	}
+	if !slices.Contains(clientResponseTypes(client), normalized) {
+		return OAuth2ErrorUnauthorizedClient, "The client is not allowed to use response_type '" + normalized + "'"
+	}
+
+	// ID tokens returned from the authorization endpoint must be bound to the request, see OpenID Connect Core 3.2.2.1
+	if responseTypeIncludes(normalized, ResponseTypeIdToken) && nonce == "" {
+		return OAuth2ErrorInvalidRequest, "nonce is required when the response type includes id_token"
+	}
+	return "", ""
+}
+
+// tokenHash returns the at_hash or c_hash of a token, the left half of its SHA-256 hash as the ID token is signed with
+// RS256, see OpenID Connect Core 3.3.2.11
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(hash[:len(hash)/2])
+}
+
+// redirectWithAuthorizationResponse issues the authorization code and tokens of the response type for the user and
+// redirects back to the client
+func redirectWithAuthorizationResponse(w http.ResponseWriter, r *http.Request, foundUser *IdpUser, foundClient *IdpClient, redirectURI string, scope string, state string, nonce string, responseType string, responseMode string, amr []string) {
+	// The response type and mode are passed through the login form, so they are checked again
+	if errorCode, description := checkResponseType(foundClient, responseType, nonce); errorCode != "" {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, errorCode, description)
+		return
+	}
+	if errorCode, description := checkResponseMode(responseType, responseMode); errorCode != "" {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, errorCode, description)
+		return
+	}
+	responseType = normalizeResponseType(responseType)
+
+	params := url.Values{}
+	idTokenClaims := jwt.MapClaims{}
+	if responseTypeIncludes(responseType, ResponseTypeCode) {
+		code := uuid.NewString()
+
+		// Store pending authorization
+		AppContext.OauthPendingAuthCodes[code] = OauthPendingAuthorization{
+			Code:        code,
+			UserId:      foundUser.Id,
+			ClientId:    foundClient.Id,
+			RedirectUri: redirectURI,
+			Nonce:       nonce,
+			Scopes:      scope,
+			ExpiresAt:   time.Now().Add(10 * time.Minute), // 10 minute expiry
+			Amr:         amr,
+		}
+		params.Set("code", code)
+		idTokenClaims["c_hash"] = tokenHash(code)
+	}
+
+	if responseTypeIncludes(responseType, ResponseTypeToken) {
+		accessToken, err := generateAccessToken(r, foundUser, foundClient, scope)
+		if err != nil {
+			redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, OAuth2ErrorServerError, "Failed to generate access token")
+			return
+		}
+		params.Set("access_token", accessToken)
+		params.Set("token_type", "Bearer")
+		params.Set("expires_in", strconv.Itoa(int(clientAccessTokenLifetime(foundClient).Seconds())))
+		idTokenClaims["at_hash"] = tokenHash(accessToken)
+	}
+
+	if responseTypeIncludes(responseType, ResponseTypeIdToken) {
+		idToken, err := generateIdentityTokenWithClaims(r, foundUser, foundClient, scope, nonce, amr, idTokenClaims)
+		if err != nil {
+			redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, OAuth2ErrorServerError, "Failed to generate ID token")
+			return
+		}
+		params.Set("id_token", idToken)
+	}
+
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	runPostHook(AppConfig.Hooks.PostAuthentication, newLifecycleHookEvent(HookPostAuthentication, HookSourceOAuth2, foundUser, foundClient))
+
+	redirectWithParams(w, r, foundClient, redirectURI, responseType, responseMode, params)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	ClaimTypeString     = "string"
+	ClaimTypeInt        = "int"
+	ClaimTypeFloat      = "float"
+	ClaimTypeBool       = "bool"
+	ClaimTypeStringList = "string_list"
+	ClaimTypeJson       = "json"
+)
+
+// claimTemplateParams are the request parameters available to claim templates. Credentials, codes and assertions are
+// left out, so a mapping cannot copy them into a token.
+var claimTemplateParams = []string{
+	"client_id",
+	"redirect_uri",
+	"response_type",
+	"response_mode",
+	"scope",
+	"state",
+	"nonce",
+	"prompt",
+	"acr_values",
+	"ui_locales",
+	"login_hint",
+	"grant_type",
+	"username",
+}
+
+// ClaimMapping describes how the value of a single claim is produced.
+//
+// In configuration it can be written as a plain string, which is either an attribute path
+// (e.g. "email" or "address.city") or a Go template when it contains "{{". The object form
+// allows a constant value and an explicit type conversion.
+type ClaimMapping struct {
+	Attribute string      `json:"attribute,omitempty"`
+	Template  string      `json:"template,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Type      string      `json:"type,omitempty"`
+}
+
+type claimMappingObject ClaimMapping
+
+func (m *ClaimMapping) fromString(s string) {
+	if strings.Contains(s, "{{") {
+		*m = ClaimMapping{Template: s}
+	} else {
+		*m = ClaimMapping{Attribute: s}
+	}
+}
+
+func (m *ClaimMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		m.fromString(s)
+		return nil
+	}
+	var obj claimMappingObject
+	if err := unmarshal(&obj); err != nil {
+		return err
+	}
+	*m = ClaimMapping(obj)
+	return nil
+}
+
+func (m *ClaimMapping) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		m.fromString(s)
+		return nil
+	}
+	var obj claimMappingObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*m = ClaimMapping(obj)
+	return nil
+}
+
+func (m ClaimMapping) MarshalJSON() ([]byte, error) {
+	if m.Type == "" && m.Value == nil {
+		if m.Template == "" {
+			return json.Marshal(m.Attribute)
+		}
+		if m.Attribute == "" {
+			return json.Marshal(m.Template)
+		}
+	}
+	return json.Marshal(claimMappingObject(m))
+}
+
+// lookupAttribute finds an attribute by name, or by a dot-separated path into nested attributes
+func lookupAttribute(attributes map[string]interface{}, path string) (interface{}, bool) {
+	if value, exists := attributes[path]; exists {
+		return value, true
+	}
+
+	var current interface{} = attributes
+	for _, part := range strings.Split(path, ".") {
+		nested, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = nested[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+var claimTemplateFuncs = template.FuncMap{
+	"get": func(attributes map[string]interface{}, path string) interface{} {
+		if value, exists := lookupAttribute(attributes, path); exists {
+			return value
+		}
+		return ""
+	},
+	"default": func(fallback interface{}, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"has": func(list []string, item string) bool {
+		for _, v := range list {
+			if v == item {
+				return true
+			}
+		}
+		return false
+	},
+	"split": func(sep string, s string) []string { return strings.Split(s, sep) },
+	"join":  func(sep string, list []string) string { return strings.Join(list, sep) },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"toJson": func(value interface{}) (string, error) {
+		b, err := json.Marshal(value)
+		return string(b), err
+	},
+}
+
+// claimTemplateData builds the data available to claim templates
+func claimTemplateData(r *http.Request, user *IdpUser, client *IdpClient, scopes string) map[string]interface{} {
+	attributes := user.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":         user.Id,
+			"username":   user.Username,
+			"attributes": attributes,
+			"groups":     user.Groups,
+		},
+		"attributes": attributes,
+		"client": map[string]interface{}{
+			"id":       client.Id,
+			"audience": client.Audience,
+		},
+		"scopes":  strings.Fields(scopes),
+		"request": map[string]interface{}{},
+	}
+
+	if r != nil {
+		params := map[string]interface{}{}
+		query := r.URL.Query()
+		for _, key := range claimTemplateParams {
+			if query.Has(key) {
+				params[key] = query.Get(key)
+			} else if r.Form.Has(key) {
+				params[key] = r.Form.Get(key)
+			}
+		}
+		data["request"] = map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"host":        r.Host,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+			"params":      params,
+		}
+	}
+
+	return data
+}
+
+// convertClaimValue converts a claim value to the given claim type
+func convertClaimValue(value interface{}, claimType string) (interface{}, error) {
+	switch claimType {
+	case "":
+		return value, nil
+	case ClaimTypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(value), nil
+	case ClaimTypeInt:
+		switch v := value.(type) {
+		case int, int64, uint64:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		default:
+			return strconv.ParseInt(strings.TrimSpace(fmt.Sprint(v)), 10, 64)
+		}
+	case ClaimTypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		default:
+			return strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(v)), 64)
+		}
+	case ClaimTypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(fmt.Sprint(value)))
+	case ClaimTypeStringList:
+		list := []string{}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				list = append(list, fmt.Sprint(item))
+			}
+		case []string:
+			list = append(list, v...)
+		default:
+			for _, item := range strings.Split(fmt.Sprint(v), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+		}
+		return list, nil
+	case ClaimTypeJson:
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("unknown claim type %q", claimType)
+	}
+}
+
+// evaluateClaimMapping produces the value of a claim, reporting false if the claim should be omitted
+func evaluateClaimMapping(mapping ClaimMapping, data map[string]interface{}) (interface{}, bool, error) {
+	var value interface{}
+
+	switch {
+	case mapping.Value != nil:
+		value = mapping.Value
+	case mapping.Template != "":
+		tmpl, err := template.New("claim").Funcs(claimTemplateFuncs).Option("missingkey=error").Parse(mapping.Template)
+		if err != nil {
+			return nil, false, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, false, err
+		}
+		if buf.Len() == 0 {
+			return nil, false, nil
+		}
+		value = buf.String()
+	default:
+		attributes, _ := data["attributes"].(map[string]interface{})
+		attributeValue, exists := lookupAttribute(attributes, mapping.Attribute)
+		if !exists {
+			return nil, false, nil
+		}
+		value = attributeValue
+	}
+
+	converted, err := convertClaimValue(value, mapping.Type)
+	if err != nil {
+		return nil, false, err
+	}
+	return converted, true, nil
+}
+
+// applyClaimMappings evaluates each claim mapping and sets the resulting claims. Claims that cannot be
+// evaluated are omitted and the error is logged.
+func applyClaimMappings(claims map[string]interface{}, mappings map[string]ClaimMapping, data map[string]interface{}) {
+	for claimName, mapping := range mappings {
+		value, ok, err := evaluateClaimMapping(mapping, data)
+		if err != nil {
+			log.Printf("Failed to evaluate claim %q: %v", claimName, err)
+			continue
+		}
+		if ok {
+			claims[claimName] = value
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token endpoint client authentication methods, see OpenID Connect Core 9
+const (
+	ClientAuthMethodSecretBasic   = "client_secret_basic"
+	ClientAuthMethodSecretPost    = "client_secret_post"
+	ClientAuthMethodSecretJwt     = "client_secret_jwt"
+	ClientAuthMethodPrivateKeyJwt = "private_key_jwt"
+	ClientAuthMethodNone          = "none"
+)
+
+// ClientAssertionTypeJwtBearer is the only client_assertion_type, see RFC 7523
+const ClientAssertionTypeJwtBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientAuthMethods are the authentication methods clients can register
+var ClientAuthMethods = []string{
+	ClientAuthMethodSecretBasic,
+	ClientAuthMethodSecretPost,
+	ClientAuthMethodSecretJwt,
+	ClientAuthMethodPrivateKeyJwt,
+	ClientAuthMethodNone,
+}
+
+// Algorithms client assertions can be signed with, using the client secret or the client's keys
+var (
+	ClientSecretJwtAlgorithms  = []string{"HS256", "HS384", "HS512"}
+	PrivateKeyJwtAlgorithms    = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+	ClientAssertionAlgorithms  = append(slices.Clone(ClientSecretJwtAlgorithms), PrivateKeyJwtAlgorithms...)
+	clientJwksHttpClient       = &http.Client{Timeout: 5 * time.Second}
+	clientJwksCacheLifetime    = 5 * time.Minute
+	clientAssertionMaxLifetime = 10 * time.Minute
+)
+
+var (
+	ErrInvalidClientCredentials    = errors.New("Invalid client credentials")
+	ErrMultipleClientAuthMethods   = errors.New("Only one client authentication method may be used")
+	ErrInvalidClientAssertionType  = errors.New("client_assertion_type must be '" + ClientAssertionTypeJwtBearer + "'")
+	ErrInvalidClientAssertion      = errors.New("Invalid client assertion")
+	ErrClientAssertionReplayed     = errors.New("The client assertion was already used")
+	ErrClientAssertionLifetime     = errors.New("The client assertion expires too far in the future")
+	ErrNoClientJwks                = errors.New("The client has no JWKS registered")
+	ErrClientJwkNotFound           = errors.New("No matching key found in the client's JWKS")
+	ErrUnsupportedClientJwk        = errors.New("Unsupported key in the client's JWKS")
+	ErrClientAuthMethodNotAllowed  = errors.New("The client is not allowed to use this authentication method")
+	ErrClientAuthenticationMissing = errors.New("Client authentication is required")
+	ErrJwksAndJwksUri              = errors.New("jwks and jwks_uri cannot both be set")
+	ErrPrivateKeyJwtWithoutJwks    = errors.New("private_key_jwt requires jwks or jwks_uri")
+)
+
+// clientAuthMethods returns the authentication methods the client may use. Clients that have not registered one
+// authenticate with their secret, sent either way, or are public clients without one.
+func clientAuthMethods(client *IdpClient) []string {
+	if client.TokenEndpointAuthMethod != "" {
+		return []string{client.TokenEndpointAuthMethod}
+	}
+	if client.Secret != "" {
+		return []string{ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost}
+	}
+	return []string{ClientAuthMethodNone}
+}
+
+// authenticateClient authenticates the client calling the token endpoint with the method it used
+func authenticateClient(r *http.Request) (*IdpClient, error) {
+	basicId, basicSecret, hasBasic := r.BasicAuth()
+	formId := r.Form.Get("client_id")
+	formSecret := r.Form.Get("client_secret")
+	assertion := r.Form.Get("client_assertion")
+
+	used := 0
+	for _, present := range []bool{hasBasic, formSecret != "", assertion != ""} {
+		if present {
+			used++
+		}
+	}
+	if used > 1 {
+		return nil, ErrMultipleClientAuthMethods
+	}
+
+	var method, clientId string
+	switch {
+	case hasBasic:
+		// The credentials are form-encoded before they are put into the header
+		var err error
+		if clientId, err = url.QueryUnescape(basicId); err != nil {
+			return nil, ErrInvalidClientCredentials
+		}
+		if basicSecret, err = url.QueryUnescape(basicSecret); err != nil {
+			return nil, ErrInvalidClientCredentials
+		}
+		method = ClientAuthMethodSecretBasic
+	case formSecret != "":
+		clientId = formId
+		method = ClientAuthMethodSecretPost
+	case assertion != "":
+		if r.Form.Get("client_assertion_type") != ClientAssertionTypeJwtBearer {
+			return nil, ErrInvalidClientAssertionType
+		}
+		unverified, _, err := jwt.NewParser().ParseUnverified(assertion, jwt.MapClaims{})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidClientAssertion, err)
+		}
+		clientId, _ = unverified.Claims.(jwt.MapClaims)["sub"].(string)
+		if alg, _ := unverified.Header["alg"].(string); slices.Contains(ClientSecretJwtAlgorithms, alg) {
+			method = ClientAuthMethodSecretJwt
+		} else {
+			method = ClientAuthMethodPrivateKeyJwt
+		}
+	default:
+		clientId = formId
+		method = ClientAuthMethodNone
+	}
+
+	// A client_id sent along has to name the authenticated client
+	if clientId == "" {
+		return nil, ErrClientAuthenticationMissing
+	}
+	if formId != "" && formId != clientId {
+		return nil, ErrInvalidClientCredentials
+	}
+
+	client := FindClientById(clientId)
+	if client == nil {
+		return nil, ErrInvalidClientCredentials
+	}
+	if !slices.Contains(clientAuthMethods(client), method) {
+		return nil, ErrClientAuthMethodNotAllowed
+	}
+
+	switch method {
+	case ClientAuthMethodSecretBasic:
+		if !clientSecretMatches(client, basicSecret) {
+			return nil, ErrInvalidClientCredentials
+		}
+	case ClientAuthMethodSecretPost:
+		if !clientSecretMatches(client, formSecret) {
+			return nil, ErrInvalidClientCredentials
+		}
+	case ClientAuthMethodSecretJwt, ClientAuthMethodPrivateKeyJwt:
+		if err := verifyClientAssertion(client, method, assertion); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// writeClientAuthenticationError rejects a request whose client could not be authenticated. Malformed credentials are
+// an invalid request, other failures an invalid client.
+func writeClientAuthenticationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMultipleClientAuthMethods) || errors.Is(err, ErrInvalidClientAssertionType) {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, err.Error())
+		return
+	}
+	writeOAuth2Error(w, http.StatusUnauthorized, OAuth2ErrorInvalidClient, err.Error())
+}
+
+// clientSecretMatches compares the secret in constant time
+func clientSecretMatches(client *IdpClient, secret string) bool {
+	return client.Secret != "" && subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) == 1
+}
+
+// verifyClientAssertion validates a client assertion JWT, see RFC 7523 section 3. Each assertion is accepted once.
+func verifyClientAssertion(client *IdpClient, method string, assertion string) error {
+	algorithms := PrivateKeyJwtAlgorithms
+	if method == ClientAuthMethodSecretJwt {
+		algorithms = ClientSecretJwtAlgorithms
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(algorithms),
+		jwt.WithIssuer(client.Id),
+		jwt.WithSubject(client.Id),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		if method == ClientAuthMethodSecretJwt {
+			if client.Secret == "" {
+				return nil, ErrInvalidClientCredentials
+			}
+			return []byte(client.Secret), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return findClientPublicKey(client, kid, token.Method.Alg())
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClientAssertion, err)
+	}
+
+	// The audience is the token endpoint, the pushed authorization request endpoint, or the issuer
+	audience, _ := claims.GetAudience()
+	tokenEndpoint := AppConfig.BaseUrl + "/oauth2/token"
+	parEndpoint := AppConfig.BaseUrl + "/oauth2/par"
+	if !slices.Contains(audience, tokenEndpoint) && !slices.Contains(audience, parEndpoint) && !slices.Contains(audience, AppConfig.Issuer) {
+		return fmt.Errorf("%w: aud must be %s", ErrInvalidClientAssertion, tokenEndpoint)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("%w: jti is required", ErrInvalidClientAssertion)
+	}
+	expiresAt, _ := claims.GetExpirationTime()
+	if time.Until(expiresAt.Time) > clientAssertionMaxLifetime {
+		return ErrClientAssertionLifetime
+	}
+
+	// Forget assertions once they expired, they cannot be replayed after that
+	now := time.Now()
+	for key, expiry := range AppContext.UsedClientAssertions {
+		if now.After(expiry) {
+			delete(AppContext.UsedClientAssertions, key)
+		}
+	}
+	key := client.Id + ":" + jti
+	if _, used := AppContext.UsedClientAssertions[key]; used {
+		return ErrClientAssertionReplayed
+	}
+	AppContext.UsedClientAssertions[key] = expiresAt.Time.Add(30 * time.Second)
+	return nil
+}
+
+// validateClientKeys checks the keys a client registers for its authentication method
+func validateClientKeys(method string, jwks *ClientJwks, jwksUri string) error {
+	if jwks != nil && jwksUri != "" {
+		return ErrJwksAndJwksUri
+	}
+	if jwks != nil {
+		for _, key := range jwks.Keys {
+			if _, err := parseClientJwk(key); err != nil {
+				return err
+			}
+		}
+	}
+	if jwksUri != "" {
+		if parsed, err := url.Parse(jwksUri); err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("Invalid jwks_uri %q", jwksUri)
+		}
+	}
+	if method == ClientAuthMethodPrivateKeyJwt && jwks == nil && jwksUri == "" {
+		return ErrPrivateKeyJwtWithoutJwks
+	}
+	return nil
+}
+
+// clientJwks returns the client's registered keys, or the keys of its jwks_uri, which are cached for a few minutes
+// unless refresh is set. It reports whether the keys came from the cache.
+func clientJwks(client *IdpClient, refresh bool) ([]ClientJwk, bool, error) {
+	if client.Jwks != nil {
+		return client.Jwks.Keys, false, nil
+	}
+	if client.JwksUri == "" {
+		return nil, false, ErrNoClientJwks
+	}
+
+	cached, exists := AppContext.ClientJwksCache[client.Id]
+	if !refresh && exists && cached.JwksUri == client.JwksUri && time.Since(cached.FetchedAt) < clientJwksCacheLifetime {
+		return cached.Keys, true, nil
+	}
+
+	keys, err := fetchClientJwks(client.JwksUri)
+	if err != nil {
+		return nil, false, err
+	}
+	AppContext.ClientJwksCache[client.Id] = CachedClientJwks{JwksUri: client.JwksUri, Keys: keys, FetchedAt: time.Now()}
+	return keys, false, nil
+}
+
+// fetchClientJwks fetches the keys published at a client's jwks_uri
+func fetchClientJwks(jwksUri string) ([]ClientJwk, error) {
+	response, err := clientJwksHttpClient.Get(jwksUri)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch the client's JWKS: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch the client's JWKS: status %d", response.StatusCode)
+	}
+
+	var jwks ClientJwks
+	if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("Failed to parse the client's JWKS: %v", err)
+	}
+	return jwks.Keys, nil
+}
+
+// findClientPublicKey returns the client's signing key with the key ID, or its only key of the algorithm's type. Cached
+// keys of a jwks_uri are fetched again if none matches, as the client may have rotated its keys.
+func findClientPublicKey(client *IdpClient, kid string, alg string) (crypto.PublicKey, error) {
+	keys, cached, err := clientJwks(client, false)
+	if err != nil {
+		return nil, err
+	}
+
+	kty := "RSA"
+	if strings.HasPrefix(alg, "ES") {
+		kty = "EC"
+	}
+
+	candidates := matchingClientJwks(keys, kid, kty)
+	if len(candidates) != 1 && cached {
+		if keys, _, err = clientJwks(client, true); err != nil {
+			return nil, err
+		}
+		candidates = matchingClientJwks(keys, kid, kty)
+	}
+	if len(candidates) != 1 {
+		return nil, ErrClientJwkNotFound
+	}
+	return parseClientJwk(candidates[0])
+}
+
+// matchingClientJwks returns the signing keys with the key ID, or without one, the keys of the key type
+func matchingClientJwks(keys []ClientJwk, kid string, kty string) []ClientJwk {
+	var candidates []ClientJwk
+	for _, key := range keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid != "" && key.Kid == kid || kid == "" && key.Kty == kty {
+			candidates = append(candidates, key)
+		}
+	}
+	return candidates
+}
+
+// parseClientJwk decodes an RSA or EC public key
+func parseClientJwk(key ClientJwk) (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, errN := decodeBase64Url(key.N)
+		e, errE := decodeBase64Url(key.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+			return nil, ErrUnsupportedClientJwk
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedClientJwk
+		}
+		x, errX := decodeBase64Url(key.X)
+		y, errY := decodeBase64Url(key.Y)
+		if errX != nil || errY != nil {
+			return nil, ErrUnsupportedClientJwk
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, ErrUnsupportedClientJwk
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// FindClientById returns a pointer to a client in AppContext.Clients if found
+func FindClientById(id string) *IdpClient {
+	for i, c := range AppContext.Clients {
+		if c.Id == id {
+			return &AppContext.Clients[i]
+		}
+	}
+	return nil
+}
+
+// FindClientIndexById returns the index and a pointer to a client in AppContext.Clients, or -1 and nil if not found
+func FindClientIndexById(id string) (int, *IdpClient) {
+	for i := range AppContext.Clients {
+		if AppContext.Clients[i].Id == id {
+			return i, &AppContext.Clients[i]
+		}
+	}
+	return -1, nil
+}
+
+// RemoveClientAt removes a client along with the refresh tokens and authorization codes issued to it
+func RemoveClientAt(index int) {
+	clientId := AppContext.Clients[index].Id
+	AppContext.Clients = slices.Delete(AppContext.Clients, index, index+1)
+	for token, issued := range AppContext.RefreshTokens {
+		if issued.ClientId == clientId {
+			delete(AppContext.RefreshTokens, token)
+		}
+	}
+	for code, authCode := range AppContext.OauthPendingAuthCodes {
+		if authCode.ClientId == clientId {
+			delete(AppContext.OauthPendingAuthCodes, code)
+		}
+	}
+}
+
+// redactClient returns a copy of the client without its secret, for the admin API
+func redactClient(client IdpClient) IdpClient {
+	client.Secret = ""
+	return client
+}
+
+// validateClient checks the settings of a client created or updated with the admin API
+func validateClient(client *IdpClient) error {
+	if err := validateRedirectUris(clientRedirectUris(client)); err != nil {
+		return err
+	}
+	if client.TokenEndpointAuthMethod != "" && !slices.Contains(ClientAuthMethods, client.TokenEndpointAuthMethod) {
+		return fmt.Errorf("Unsupported token_endpoint_auth_method %q", client.TokenEndpointAuthMethod)
+	}
+	if clientUsesSecret(client) && client.Secret == "" && client.TokenEndpointAuthMethod != "" {
+		return fmt.Errorf("%s requires a secret", client.TokenEndpointAuthMethod)
+	}
+	if err := validateResponseTypes(client.ResponseTypes); err != nil {
+		return err
+	}
+	if err := validateRequestUris(client.RequestUris); err != nil {
+		return err
+	}
+	return validateClientKeys(client.TokenEndpointAuthMethod, client.Jwks, client.JwksUri)
+}
+
+// clientUsesSecret reports whether the client authenticates with its secret
+func clientUsesSecret(client *IdpClient) bool {
+	for _, method := range clientAuthMethods(client) {
+		if method == ClientAuthMethodSecretBasic || method == ClientAuthMethodSecretPost || method == ClientAuthMethodSecretJwt {
+			return true
+		}
+	}
+	return false
+}
+
+// FindClientByRedirectUri returns a pointer to the client if found and the redirect URI is registered for it
+func FindClientByRedirectUri(id string, redirectUri string) *IdpClient {
+	client := FindClientById(id)
+	if client == nil || !slices.Contains(clientRedirectUris(client), redirectUri) {
+		return nil
+	}
+	return client
+}
+
+// clientRedirectUris returns the redirect URIs registered for the client
+func clientRedirectUris(client *IdpClient) []string {
+	uris := slices.Clone(client.RedirectUris)
+	if client.RedirectUri != "" && !slices.Contains(uris, client.RedirectUri) {
+		uris = append([]string{client.RedirectUri}, uris...)
+	}
+	return uris
+}
+
+// clientDefaultScopes returns the client's default scopes, or the given fallback if the client does not override them
+func clientDefaultScopes(client *IdpClient, fallback string) string {
+	if client != nil && client.DefaultScopes != "" {
+		return client.DefaultScopes
+	}
+	return fallback
+}
+
+// clientAccessTokenLifetime returns the access token lifetime for the client, falling back to the global setting
+func clientAccessTokenLifetime(client *IdpClient) time.Duration {
+	seconds := AppConfig.AccessTokenExpirationSeconds
+	if client != nil && client.AccessTokenExpirationSeconds > 0 {
+		seconds = client.AccessTokenExpirationSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// clientIdentityTokenLifetime returns the identity token lifetime for the client, falling back to the global setting
+func clientIdentityTokenLifetime(client *IdpClient) time.Duration {
+	seconds := AppConfig.IdentityTokenExpirationSeconds
+	if client != nil && client.IdentityTokenExpirationSeconds > 0 {
+		seconds = client.IdentityTokenExpirationSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// clientRefreshTokenLifetime returns the refresh token lifetime for the client, falling back to the global setting
+func clientRefreshTokenLifetime(client *IdpClient) time.Duration {
+	seconds := AppConfig.RefreshTokenExpirationSeconds
+	if client != nil && client.RefreshTokenExpirationSeconds > 0 {
+		seconds = client.RefreshTokenExpirationSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// clientAccessTokenClaims returns the access token claim mapping for the client, falling back to the global mapping
+func clientAccessTokenClaims(client *IdpClient) map[string]ClaimMapping {
+	if client != nil && client.MapAccessTokenClaims != nil {
+		return client.MapAccessTokenClaims
+	}
+	return AppConfig.MapAccessTokenClaims
+}
+
+// clientIdentityTokenClaims returns the identity token claim mapping for the client, falling back to the global mapping
+func clientIdentityTokenClaims(client *IdpClient) map[string]ClaimMapping {
+	if client != nil && client.MapIdentityTokenClaims != nil {
+		return client.MapIdentityTokenClaims
+	}
+	return AppConfig.MapIdentityTokenClaims
+}
+
+// clientUserinfoClaims returns the userinfo claim mapping for the client, falling back to the global mapping
+func clientUserinfoClaims(client *IdpClient) map[string]ClaimMapping {
+	if client != nil && client.MapUserinfoClaims != nil {
+		return client.MapUserinfoClaims
+	}
+	return AppConfig.MapUserinfoClaims
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// ClientMetadata is the client metadata of Dynamic Client Registration, see RFC 7591 section 2
+type ClientMetadata struct {
+	RedirectUris               []string    `json:"redirect_uris"`
+	TokenEndpointAuthMethod    string      `json:"token_endpoint_auth_method"`
+	GrantTypes                 []string    `json:"grant_types"`
+	ResponseTypes              []string    `json:"response_types"`
+	ClientName                 string      `json:"client_name,omitempty"`
+	Scope                      string      `json:"scope,omitempty"`
+	Jwks                       *ClientJwks `json:"jwks,omitempty"`
+	JwksUri                    string      `json:"jwks_uri,omitempty"`
+	RequirePushedAuthorization bool        `json:"require_pushed_authorization_requests,omitempty"`
+	RequestUris                []string    `json:"request_uris,omitempty"`
+}
+
+// ClientUpdateRequest replaces the metadata of a registered client, see RFC 7592 section 2.2
+type ClientUpdateRequest struct {
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	ClientMetadata
+}
+
+type ClientRegistrationResponse struct {
+	ClientId                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIdIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token"`
+	RegistrationClientUri   string `json:"registration_client_uri"`
+	ClientMetadata
+}
+
+var (
+	ErrNoRedirectUris        = errors.New("At least one redirect_uri is required")
+	ErrCodeGrantMismatch     = errors.New("The code response type requires the authorization_code grant type, and the other way around")
+	ErrImplicitGrantMismatch = errors.New("The token and id_token response types require the implicit grant type, and the other way around")
+)
+
+// Schemes that would run script instead of loading the redirect URI
+var unsafeRedirectSchemes = []string{"javascript", "data", "vbscript"}
+
+// validateRedirectUris checks that redirect URIs are absolute, hierarchical and have no fragment or unsafe scheme
+func validateRedirectUris(uris []string) error {
+	if len(uris) == 0 {
+		return ErrNoRedirectUris
+	}
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" || parsed.Fragment != "" || parsed.Opaque != "" || parsed.Host == "" && parsed.Path == "" {
+			return fmt.Errorf("Invalid redirect_uri %q", uri)
+		}
+		if slices.Contains(unsafeRedirectSchemes, parsed.Scheme) {
+			return fmt.Errorf("Invalid redirect_uri %q", uri)
+		}
+	}
+	return nil
+}
+
+// validateResponseTypes checks that the authorization endpoint supports the response types
+func validateResponseTypes(responseTypes []string) error {
+	for _, responseType := range responseTypes {
+		if !slices.Contains(OAuth2ResponseTypes, normalizeResponseType(responseType)) {
+			return fmt.Errorf("Unsupported response_type %q", responseType)
+		}
+	}
+	return nil
+}
+
+// validateClientMetadata checks the metadata of a client, filling in the defaults of RFC 7591
+func validateClientMetadata(metadata *ClientMetadata) error {
+	if metadata.TokenEndpointAuthMethod == "" {
+		metadata.TokenEndpointAuthMethod = ClientAuthMethodSecretBasic
+	}
+	if !slices.Contains(ClientAuthMethods, metadata.TokenEndpointAuthMethod) {
+		return fmt.Errorf("Unsupported token_endpoint_auth_method %q", metadata.TokenEndpointAuthMethod)
+	}
+
+	if len(metadata.GrantTypes) == 0 {
+		metadata.GrantTypes = []string{"authorization_code"}
+	}
+	for _, grantType := range metadata.GrantTypes {
+		if !slices.Contains(OAuth2GrantTypes, grantType) {
+			return fmt.Errorf("Unsupported grant_type %q", grantType)
+		}
+	}
+	if len(metadata.ResponseTypes) == 0 {
+		metadata.ResponseTypes = []string{"code"}
+	}
+	if err := validateResponseTypes(metadata.ResponseTypes); err != nil {
+		return err
+	}
+
+	// Response types returning a code or tokens need the grant types they belong to, see RFC 7591 section 2.1
+	usesCode, usesImplicit := false, false
+	for _, responseType := range metadata.ResponseTypes {
+		usesCode = usesCode || responseTypeIncludes(responseType, ResponseTypeCode)
+		usesImplicit = usesImplicit || responseTypeIncludes(responseType, ResponseTypeToken) || responseTypeIncludes(responseType, ResponseTypeIdToken)
+	}
+	if usesCode != slices.Contains(metadata.GrantTypes, "authorization_code") {
+		return ErrCodeGrantMismatch
+	}
+	if usesImplicit != slices.Contains(metadata.GrantTypes, "implicit") {
+		return ErrImplicitGrantMismatch
+	}
+	if err := validateRequestUris(metadata.RequestUris); err != nil {
+		return err
+	}
+
+	return validateClientKeys(metadata.TokenEndpointAuthMethod, metadata.Jwks, metadata.JwksUri)
+}
+
+// checkClientMetadata reports whether the client metadata is valid, writing the error code of RFC 7591 otherwise
+func checkClientMetadata(w http.ResponseWriter, metadata *ClientMetadata) bool {
+	if err := validateRedirectUris(metadata.RedirectUris); err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRedirectUri, err.Error())
+		return false
+	}
+	if err := validateClientMetadata(metadata); err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidClientMetadata, err.Error())
+		return false
+	}
+	return true
+}
+
+// applyClientMetadata updates the client with validated metadata. Clients authenticating with a secret get one if
+// they do not have one yet, other clients have none.
+func applyClientMetadata(client *IdpClient, metadata ClientMetadata) {
+	client.RedirectUri = metadata.RedirectUris[0]
+	client.RedirectUris = metadata.RedirectUris
+	client.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+	client.GrantTypes = metadata.GrantTypes
+	client.ResponseTypes = metadata.ResponseTypes
+	client.ClientName = metadata.ClientName
+	client.DefaultScopes = metadata.Scope
+	client.Jwks = metadata.Jwks
+	client.JwksUri = metadata.JwksUri
+	client.RequirePushedAuthorization = metadata.RequirePushedAuthorization
+	client.RequestUris = metadata.RequestUris
+
+	switch metadata.TokenEndpointAuthMethod {
+	case ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost, ClientAuthMethodSecretJwt:
+		if client.Secret == "" {
+			client.Secret = generateRandomToken()
+		}
+	default:
+		client.Secret = ""
+	}
+}
+
+// clientRegistrationResponse returns the registered client's information, including its credentials
+func clientRegistrationResponse(client *IdpClient) ClientRegistrationResponse {
+	return ClientRegistrationResponse{
+		ClientId:                client.Id,
+		ClientSecret:            client.Secret,
+		ClientIdIssuedAt:        client.ClientIdIssuedAt,
+		ClientSecretExpiresAt:   0,
+		RegistrationAccessToken: client.RegistrationAccessToken,
+		RegistrationClientUri:   AppConfig.BaseUrl + "/oauth2/register/" + url.PathEscape(client.Id),
+		ClientMetadata: ClientMetadata{
+			RedirectUris:               clientRedirectUris(client),
+			TokenEndpointAuthMethod:    client.TokenEndpointAuthMethod,
+			GrantTypes:                 client.GrantTypes,
+			ResponseTypes:              client.ResponseTypes,
+			ClientName:                 client.ClientName,
+			Scope:                      client.DefaultScopes,
+			Jwks:                       client.Jwks,
+			JwksUri:                    client.JwksUri,
+			RequirePushedAuthorization: client.RequirePushedAuthorization,
+			RequestUris:                client.RequestUris,
+		},
+	}
+}
+
+// bearerTokenMatches compares the request's bearer token with the expected token in constant time
+func bearerTokenMatches(r *http.Request, expected string) bool {
+	token, err := extractTokenFromHeader(r)
+	return err == nil && expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// findRegisteredClient returns the dynamically registered client the request's registration access token was issued
+// for, writing an error if there is none. Unknown clients are rejected like wrong tokens, see RFC 7592 section 2.
+func findRegisteredClient(w http.ResponseWriter, r *http.Request) (int, *IdpClient) {
+	clientId := mux.Vars(r)["id"]
+	for i := range AppContext.Clients {
+		client := &AppContext.Clients[i]
+		if client.Id == clientId && bearerTokenMatches(r, client.RegistrationAccessToken) {
+			return i, client
+		}
+	}
+
+	writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid registration access token")
+	return -1, nil
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CognitoUserStatusConfirmed           = "CONFIRMED"
+	CognitoUserStatusForceChangePassword = "FORCE_CHANGE_PASSWORD"
+	CognitoUserStatusUnconfirmed         = "UNCONFIRMED"
+	CognitoListUsersMaxLimit             = 60
+)
+
+// Message actions of AdminCreateUser
+const (
+	CognitoMessageActionResend   = "RESEND"
+	CognitoMessageActionSuppress = "SUPPRESS"
+)
+
+// Matches ListUsers filters like `email = "alice@example.com"` or `username ^= "al"`
+var cognitoFilterPattern = regexp.MustCompile(`^\s*([\w:]+)\s*(\^?=)\s*"(.*)"\s*$`)
+
+type CognitoAdminUserRequest struct {
+	UserPoolId string `json:"UserPoolId"`
+	Username   string `json:"Username"`
+}
+
+type CognitoAdminCreateUserRequest struct {
+	UserPoolId        string             `json:"UserPoolId"`
+	Username          string             `json:"Username"`
+	UserAttributes    []CognitoAttribute `json:"UserAttributes"`
+	TemporaryPassword string             `json:"TemporaryPassword"`
+	MessageAction     string             `json:"MessageAction"`
+}
+
+type CognitoAdminUpdateUserAttributesRequest struct {
+	UserPoolId     string             `json:"UserPoolId"`
+	Username       string             `json:"Username"`
+	UserAttributes []CognitoAttribute `json:"UserAttributes"`
+}
+
+type CognitoAdminDeleteUserAttributesRequest struct {
+	UserPoolId         string   `json:"UserPoolId"`
+	Username           string   `json:"Username"`
+	UserAttributeNames []string `json:"UserAttributeNames"`
+}
+
+type CognitoAdminSetUserPasswordRequest struct {
+	UserPoolId string `json:"UserPoolId"`
+	Username   string `json:"Username"`
+	Password   string `json:"Password"`
+	Permanent  bool   `json:"Permanent"`
+}
+
+type CognitoListUsersRequest struct {
+	UserPoolId      string   `json:"UserPoolId"`
+	Filter          string   `json:"Filter"`
+	Limit           int      `json:"Limit"`
+	PaginationToken string   `json:"PaginationToken"`
+	AttributesToGet []string `json:"AttributesToGet"`
+}
+
+type CognitoAdminGroupRequest struct {
+	UserPoolId string `json:"UserPoolId"`
+	Username   string `json:"Username"`
+	GroupName  string `json:"GroupName"`
+}
+
+type CognitoUserType struct {
+	Username   string             `json:"Username"`
+	Attributes []CognitoAttribute `json:"Attributes"`
+	Enabled    bool               `json:"Enabled"`
+	UserStatus string             `json:"UserStatus"`
+}
+
+type CognitoAdminGetUserResponse struct {
+	Username       string             `json:"Username"`
+	UserAttributes []CognitoAttribute `json:"UserAttributes"`
+	Enabled        bool               `json:"Enabled"`
+	UserStatus     string             `json:"UserStatus"`
+}
+
+type CognitoListUsersResponse struct {
+	Users           []CognitoUserType `json:"Users"`
+	PaginationToken string            `json:"PaginationToken,omitempty"`
+}
+
+type CognitoGroupType struct {
+	GroupName  string `json:"GroupName"`
+	UserPoolId string `json:"UserPoolId,omitempty"`
+}
+
+type CognitoAdminListGroupsForUserResponse struct {
+	Groups []CognitoGroupType `json:"Groups"`
+}
+
+// cognitoUserStatus returns the Cognito status of the user's account
+func cognitoUserStatus(user *IdpUser) string {
+	if user.Unconfirmed {
+		return CognitoUserStatusUnconfirmed
+	}
+	if passwordChangeRequired(user) {
+		return CognitoUserStatusForceChangePassword
+	}
+	return CognitoUserStatusConfirmed
+}
+
+func newCognitoUserType(user *IdpUser) CognitoUserType {
+	return CognitoUserType{
+		Username:   user.Username,
+		Attributes: userAttributesToCognito(user),
+		Enabled:    !user.Disabled,
+		UserStatus: cognitoUserStatus(user),
+	}
+}
+
+// cognitoAttributeValue converts a Cognito attribute value to the value stored in the user's attributes.
+// Verification flags are stored as booleans, like in the configuration file.
+func cognitoAttributeValue(name string, value string) interface{} {
+	if strings.HasSuffix(name, "_verified") {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// cognitoApplyAttributes sets the attributes on the user, writing an error response if one cannot be modified
+func cognitoApplyAttributes(w http.ResponseWriter, user *IdpUser, attributes []CognitoAttribute) bool {
+	for _, attribute := range attributes {
+		if attribute.Name == "" || attribute.Name == "sub" {
+			writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, fmt.Sprintf("Cannot modify the non-mutable attribute %q", attribute.Name))
+			return false
+		}
+	}
+
+	if user.Attributes == nil {
+		user.Attributes = map[string]interface{}{}
+	}
+	for _, attribute := range attributes {
+		user.Attributes[attribute.Name] = cognitoAttributeValue(attribute.Name, attribute.Value)
+	}
+	return true
+}
+
+// cognitoFindUser looks up a user by username or sub, writing an error response if it does not exist
+func cognitoFindUser(w http.ResponseWriter, username string) (int, *IdpUser) {
+	if username == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter Username")
+		return -1, nil
+	}
+	for i, u := range AppContext.Users {
+		if u.Username == username {
+			return i, &AppContext.Users[i]
+		}
+	}
+	if index, user := FindUserIndexById(username); user != nil {
+		return index, user
+	}
+	writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+	return -1, nil
+}
+
+// cognitoFilterValue returns the value of a user property that ListUsers can filter on
+func cognitoFilterValue(user *IdpUser, name string) string {
+	switch name {
+	case "username":
+		return user.Username
+	case "sub":
+		return user.Id
+	case "status":
+		if user.Disabled {
+			return "Disabled"
+		}
+		return "Enabled"
+	case "cognito:user_status":
+		return cognitoUserStatus(user)
+	}
+
+	for _, attribute := range userAttributesToCognito(user) {
+		if attribute.Name == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+func cognitoAdminCreateUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminCreateUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	switch req.MessageAction {
+	case "", CognitoMessageActionSuppress:
+	case CognitoMessageActionResend:
+		cognitoResendInvitation(w, req)
+		return
+	default:
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Invalid MessageAction")
+		return
+	}
+
+	if req.Username == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter Username")
+		return
+	}
+	if FindUserByUsername(req.Username) != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUsernameExists, "User account already exists")
+		return
+	}
+
+	password := req.TemporaryPassword
+	if password == "" {
+		password = generateRandomToken()
+	} else if err := validateNewPassword(nil, password); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+
+	// Users created by an administrator have to choose their own password on first login
+	newUser := IdpUser{
+		Id:                  uuid.NewString(),
+		Username:            req.Username,
+		ForcePasswordChange: true,
+	}
+	if err := updateUserPassword(&newUser, password); err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+	if !cognitoApplyAttributes(w, &newUser, req.UserAttributes) {
+		return
+	}
+	if req.MessageAction != CognitoMessageActionSuppress && userEmail(&newUser) == "" && userPhoneNumber(&newUser) == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "User has no email address or phone number to send the invitation to")
+		return
+	}
+
+	// Let the pre sign-up hook deny creating the user
+	if err := runPreHook(AppConfig.Hooks.PreSignUp, newLifecycleHookEvent(HookPreSignUp, HookSourceCognito, &newUser, nil)); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserLambdaValidation, fmt.Sprintf("PreSignUp failed with error %s.", err.Error()))
+		return
+	}
+
+	AppContext.Users = append(AppContext.Users, newUser)
+
+	runPostHook(AppConfig.Hooks.PostConfirmation, newLifecycleHookEvent(HookPostConfirmation, HookSourceCognito, &newUser, nil))
+
+	if req.MessageAction != CognitoMessageActionSuppress {
+		sendInvitation(&newUser, password)
+	}
+
+	writeCognitoJSON(w, map[string]interface{}{
+		"User": newCognitoUserType(&newUser),
+	})
+}
+
+// cognitoResendInvitation sends a user who has not changed their temporary password yet a new invitation, with a new
+// temporary password
+func cognitoResendInvitation(w http.ResponseWriter, req CognitoAdminCreateUserRequest) {
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+	if !user.ForcePasswordChange {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUnsupportedUserState, "User account has already changed its temporary password")
+		return
+	}
+	if userEmail(user) == "" && userPhoneNumber(user) == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "User has no email address or phone number to send the invitation to")
+		return
+	}
+
+	password := req.TemporaryPassword
+	if password == "" {
+		password = generateRandomToken()
+	} else if err := validateNewPassword(nil, password); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+	if err := updateUserPassword(user, password); err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+
+	sendInvitation(user, password)
+	writeCognitoJSON(w, map[string]interface{}{
+		"User": newCognitoUserType(user),
+	})
+}
+
+// sendInvitation sends a user created by an administrator their username and temporary password, by email or, for
+// users without an email address, by text message
+func sendInvitation(user *IdpUser, password string) {
+	body := fmt.Sprintf("Your username is %s and temporary password is %s", user.Username, password)
+	if email := userEmail(user); email != "" {
+		sendMail(email, "Your temporary password", fmt.Sprintf("Hello %s,\n\n%s\n", user.Username, body))
+		return
+	}
+	sendSms(userPhoneNumber(user), body)
+}
+
+func cognitoAdminDeleteUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	index, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	RemoveUserAt(index)
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminGetUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	writeCognitoJSON(w, CognitoAdminGetUserResponse{
+		Username:       user.Username,
+		UserAttributes: userAttributesToCognito(user),
+		Enabled:        !user.Disabled,
+		UserStatus:     cognitoUserStatus(user),
+	})
+}
+
+func cognitoAdminUpdateUserAttributes(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUpdateUserAttributesRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	if !cognitoApplyAttributes(w, user, req.UserAttributes) {
+		return
+	}
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminDeleteUserAttributes(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminDeleteUserAttributesRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	for _, name := range req.UserAttributeNames {
+		delete(user.Attributes, name)
+	}
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminDisableUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	user.Disabled = true
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminEnableUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	user.Disabled = false
+	resetFailedLogins(user)
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminSetUserPassword(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminSetUserPasswordRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	if req.Password == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter Password")
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	if err := validateNewPassword(user, req.Password); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+
+	// A temporary password has to be changed on the next login
+	var err error
+	if req.Permanent {
+		err = setUserPassword(user, req.Password)
+	} else if err = updateUserPassword(user, req.Password); err == nil {
+		user.ForcePasswordChange = true
+	}
+	if err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoListUsers(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoListUsersRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	var filterName, filterOp, filterValue string
+	if strings.TrimSpace(req.Filter) != "" {
+		match := cognitoFilterPattern.FindStringSubmatch(req.Filter)
+		if match == nil {
+			writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Error while parsing filter.")
+			return
+		}
+		filterName, filterOp, filterValue = match[1], match[2], match[3]
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > CognitoListUsersMaxLimit {
+		limit = CognitoListUsersMaxLimit
+	}
+
+	offset := 0
+	if req.PaginationToken != "" {
+		var err error
+		offset, err = strconv.Atoi(req.PaginationToken)
+		if err != nil || offset < 0 {
+			writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Invalid PaginationToken")
+			return
+		}
+	}
+
+	matches := []*IdpUser{}
+	for i := range AppContext.Users {
+		user := &AppContext.Users[i]
+		if filterName != "" {
+			value := cognitoFilterValue(user, filterName)
+			if filterOp == "=" && value != filterValue {
+				continue
+			}
+			if filterOp == "^=" && !strings.HasPrefix(value, filterValue) {
+				continue
+			}
+		}
+		matches = append(matches, user)
+	}
+
+	response := CognitoListUsersResponse{Users: []CognitoUserType{}}
+	for i := offset; i < len(matches) && i < offset+limit; i++ {
+		userType := newCognitoUserType(matches[i])
+
+		// Only return the requested attributes
+		if req.AttributesToGet != nil {
+			attributes := []CognitoAttribute{}
+			for _, attribute := range userType.Attributes {
+				for _, name := range req.AttributesToGet {
+					if attribute.Name == name {
+						attributes = append(attributes, attribute)
+					}
+				}
+			}
+			userType.Attributes = attributes
+		}
+
+		response.Users = append(response.Users, userType)
+	}
+	if offset+limit < len(matches) {
+		response.PaginationToken = strconv.Itoa(offset + limit)
+	}
+
+	writeCognitoJSON(w, response)
+}
+
+func cognitoAdminAddUserToGroup(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminGroupRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	if req.GroupName == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter GroupName")
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	for _, group := range user.Groups {
+		if group == req.GroupName {
+			writeCognitoJSON(w, map[string]interface{}{})
+			return
+		}
+	}
+	user.Groups = append(user.Groups, req.GroupName)
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminRemoveUserFromGroup(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminGroupRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	if req.GroupName == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter GroupName")
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	groups := []string{}
+	for _, group := range user.Groups {
+		if group != req.GroupName {
+			groups = append(groups, group)
+		}
+	}
+	user.Groups = groups
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func cognitoAdminListGroupsForUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAdminUserRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	response := CognitoAdminListGroupsForUserResponse{Groups: []CognitoGroupType{}}
+	for _, group := range user.Groups {
+		response.Groups = append(response.Groups, CognitoGroupType{GroupName: group, UserPoolId: req.UserPoolId})
+	}
+	writeCognitoJSON(w, response)
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	CognitoAuthFlowUserPassword = "USER_PASSWORD_AUTH"
+	CognitoAuthFlowRefreshToken = "REFRESH_TOKEN_AUTH"
+	CognitoAuthFlowRefresh      = "REFRESH_TOKEN"
+	CognitoAuthFlowCustom       = "CUSTOM_AUTH"
+	CognitoAuthFlowUserSrp      = "USER_SRP_AUTH"
+)
+
+type CognitoInitiateAuthRequest struct {
+	AuthFlow       string            `json:"AuthFlow"`
+	ClientId       string            `json:"ClientId"`
+	AuthParameters map[string]string `json:"AuthParameters"`
+	ClientMetadata map[string]string `json:"ClientMetadata,omitempty"`
+}
+
+type CognitoRespondToAuthChallengeRequest struct {
+	ChallengeName      string            `json:"ChallengeName"`
+	ClientId           string            `json:"ClientId"`
+	Session            string            `json:"Session"`
+	ChallengeResponses map[string]string `json:"ChallengeResponses"`
+	ClientMetadata     map[string]string `json:"ClientMetadata,omitempty"`
+}
+
+type CognitoAuthenticationResult struct {
+	AccessToken  string `json:"AccessToken"`
+	ExpiresIn    int    `json:"ExpiresIn"`
+	IdToken      string `json:"IdToken"`
+	RefreshToken string `json:"RefreshToken,omitempty"`
+	TokenType    string `json:"TokenType"`
+}
+
+type CognitoAuthResponse struct {
+	AuthenticationResult *CognitoAuthenticationResult `json:"AuthenticationResult,omitempty"`
+	ChallengeName        string                       `json:"ChallengeName,omitempty"`
+	ChallengeParameters  map[string]string            `json:"ChallengeParameters"`
+	Session              string                       `json:"Session,omitempty"`
+}
+
+type CognitoAccessTokenRequest struct {
+	AccessToken string `json:"AccessToken"`
+}
+
+type CognitoAttribute struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type CognitoGetUserResponse struct {
+	Username       string             `json:"Username"`
+	UserAttributes []CognitoAttribute `json:"UserAttributes"`
+}
+
+// cognitoSecretHash computes the SECRET_HASH Cognito expects from clients with a secret
+func cognitoSecretHash(client *IdpClient, username string) string {
+	mac := hmac.New(sha256.New, []byte(client.Secret))
+	mac.Write([]byte(username + client.Id))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCognitoSecretHash checks the SECRET_HASH against any of the given usernames, if the client has a secret
+func verifyCognitoSecretHash(client *IdpClient, secretHash string, usernames ...string) bool {
+	if client.Secret == "" {
+		return true
+	}
+	for _, username := range usernames {
+		expected := cognitoSecretHash(client, username)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(secretHash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// userAttributesToCognito converts user attributes to Cognito's list of string name/value pairs
+func userAttributesToCognito(user *IdpUser) []CognitoAttribute {
+	names := make([]string, 0, len(user.Attributes))
+	for name := range user.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := []CognitoAttribute{{Name: "sub", Value: user.Id}}
+	for _, name := range names {
+		var value string
+		switch v := user.Attributes[name].(type) {
+		case string:
+			value = v
+		default:
+			b, _ := json.Marshal(v)
+			value = string(b)
+		}
+		attributes = append(attributes, CognitoAttribute{Name: name, Value: value})
+	}
+	return attributes
+}
+
+// cognitoFindClient looks up the client of a Cognito request, writing an error response if it does not exist
+func cognitoFindClient(w http.ResponseWriter, clientId string) *IdpClient {
+	if clientId == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter ClientId")
+		return nil
+	}
+	client := FindClientById(clientId)
+	if client == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoResourceNotFound, fmt.Sprintf("User pool client %s does not exist.", clientId))
+		return nil
+	}
+	return client
+}
+
+// cognitoStartChallenge stores a pending login and responds with the challenge the user has to answer. The
+// authentication methods are those the user already completed.
+func cognitoStartChallenge(w http.ResponseWriter, user *IdpUser, client *IdpClient, challengeName string, amr []string) {
+	session := generateRandomToken()
+	storePendingLogin(session, PendingLogin{
+		UserId:            user.Id,
+		ClientId:          client.Id,
+		IssueRefreshToken: true,
+		Scopes:            clientDefaultScopes(client, AppConfig.CognitoApi.DefaultScopes),
+		CreatedAt:         time.Now(),
+		ChallengeName:     challengeName,
+		Amr:               amr,
+	})
+
+	challengeParameters := map[string]string{
+		"USERNAME":        user.Username,
+		"USER_ID_FOR_SRP": user.Username,
+	}
+	if challengeName == ChallengeNameNewPassword {
+		// Clients show the current attributes and let the user fill in required ones
+		attributes := map[string]string{}
+		for _, attribute := range userAttributesToCognito(user) {
+			if attribute.Name != "sub" {
+				attributes[attribute.Name] = attribute.Value
+			}
+		}
+		userAttributes, _ := json.Marshal(attributes)
+		challengeParameters["userAttributes"] = string(userAttributes)
+		challengeParameters["requiredAttributes"] = "[]"
+	}
+	if challengeName == ChallengeNameMfaSetup {
+		challengeParameters["MFAS_CAN_SETUP"] = `["SOFTWARE_TOKEN_MFA"]`
+	}
+
+	writeCognitoJSON(w, CognitoAuthResponse{
+		ChallengeName:       challengeName,
+		ChallengeParameters: challengeParameters,
+		Session:             session,
+	})
+}
+
+// cognitoContinueLogin continues a login after the user's password was verified, starting the next challenge the
+// user has to answer or issuing tokens. Logins that already answered their challenge only have to change the password.
+func cognitoContinueLogin(w http.ResponseWriter, r *http.Request, user *IdpUser, client *IdpClient, scopes string, amr []string, challengeAnswered bool) {
+	// Users that have to change their password do so before answering their challenge
+	if passwordChangeRequired(user) {
+		cognitoStartChallenge(w, user, client, ChallengeNameNewPassword, amr)
+		return
+	}
+
+	// Users with a configured challenge, or that have to set up MFA, do so before receiving tokens
+	if challenge, ok := loginChallengeName(user, client); ok && !challengeAnswered {
+		cognitoStartChallenge(w, user, client, challenge, amr)
+		return
+	}
+
+	cognitoIssueTokens(w, r, user, client, scopes, true, amr)
+	runPostHook(AppConfig.Hooks.PostAuthentication, newLifecycleHookEvent(HookPostAuthentication, HookSourceCognito, user, client))
+}
+
+// cognitoIssueTokens generates tokens for the user and responds with the authentication result
+func cognitoIssueTokens(w http.ResponseWriter, r *http.Request, user *IdpUser, client *IdpClient, scopes string, withRefreshToken bool, amr []string) {
+	accessToken, err := generateAccessToken(r, user, client, scopes)
+	if err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, "Failed to generate access token")
+		return
+	}
+
+	identityToken, err := generateIdentityToken(r, user, client, scopes, "", amr)
+	if err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, "Failed to generate identity token")
+		return
+	}
+
+	result := &CognitoAuthenticationResult{
+		AccessToken: accessToken,
+		ExpiresIn:   int(clientAccessTokenLifetime(client).Seconds()),
+		IdToken:     identityToken,
+		TokenType:   "Bearer",
+	}
+	if withRefreshToken {
+		result.RefreshToken = issueRefreshToken(user, client, scopes, amr)
+	}
+
+	writeCognitoJSON(w, CognitoAuthResponse{
+		AuthenticationResult: result,
+		ChallengeParameters:  map[string]string{},
+	})
+}
+
+// cognitoAuthenticateUser validates the username and password of an auth flow, writing an error response on failure
+func cognitoAuthenticateUser(w http.ResponseWriter, client *IdpClient, params map[string]string, requirePassword bool) *IdpUser {
+	username := params["USERNAME"]
+	if username == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter USERNAME")
+		return nil
+	}
+	password, hasPassword := params["PASSWORD"]
+	if requirePassword && !hasPassword {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter PASSWORD")
+		return nil
+	}
+
+	if !verifyCognitoSecretHash(client, params["SECRET_HASH"], username) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, fmt.Sprintf("Unable to verify secret hash for client %s", client.Id))
+		return nil
+	}
+
+	user := FindUserByUsername(username)
+	if user == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+		return nil
+	}
+
+	if userLocked(user) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Password attempts exceeded")
+		return nil
+	}
+
+	if hasPassword && checkUserLogin(user, password) != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Incorrect username or password.")
+		return nil
+	}
+
+	if user.Disabled {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "User is disabled.")
+		return nil
+	}
+
+	if user.Unconfirmed {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotConfirmed, "User is not confirmed.")
+		return nil
+	}
+
+	// Let the pre authentication hook deny the login
+	if err := runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceCognito, user, client)); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserLambdaValidation, fmt.Sprintf("PreAuthentication failed with error %s.", err.Error()))
+		return nil
+	}
+
+	return user
+}
+
+func cognitoInitiateAuth(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoInitiateAuthRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	client := cognitoFindClient(w, req.ClientId)
+	if client == nil {
+		return
+	}
+
+	if req.AuthParameters == nil {
+		req.AuthParameters = map[string]string{}
+	}
+
+	switch req.AuthFlow {
+	case CognitoAuthFlowUserPassword:
+		user := cognitoAuthenticateUser(w, client, req.AuthParameters, true)
+		if user == nil {
+			return
+		}
+		cognitoContinueLogin(w, r, user, client, clientDefaultScopes(client, AppConfig.CognitoApi.DefaultScopes), []string{AmrPassword}, false)
+
+	case CognitoAuthFlowUserSrp:
+		user := cognitoAuthenticateUser(w, client, req.AuthParameters, false)
+		if user == nil {
+			return
+		}
+		cognitoStartSrpChallenge(w, user, client, req.AuthParameters["SRP_A"])
+
+	case CognitoAuthFlowCustom:
+		// Custom auth verifies the password with SRP, or with the PASSWORD parameter, before the challenge
+		withSrp := req.AuthParameters["CHALLENGE_NAME"] == ChallengeNameSrpA
+		user := cognitoAuthenticateUser(w, client, req.AuthParameters, !withSrp)
+		if user == nil {
+			return
+		}
+		if !hasLoginChallenge(user) {
+			writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Custom authentication is not configured for the user.")
+			return
+		}
+
+		if withSrp {
+			cognitoStartSrpChallenge(w, user, client, req.AuthParameters["SRP_A"])
+			return
+		}
+		cognitoContinueLogin(w, r, user, client, clientDefaultScopes(client, AppConfig.CognitoApi.DefaultScopes), []string{AmrPassword}, false)
+
+	case CognitoAuthFlowRefreshToken, CognitoAuthFlowRefresh:
+		cognitoRefreshTokenAuth(w, r, client, req.AuthParameters)
+
+	default:
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, fmt.Sprintf("Unsupported AuthFlow: %s", req.AuthFlow))
+	}
+}
+
+func cognitoRefreshTokenAuth(w http.ResponseWriter, r *http.Request, client *IdpClient, params map[string]string) {
+	refreshTokenValue := params["REFRESH_TOKEN"]
+	if refreshTokenValue == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter REFRESH_TOKEN")
+		return
+	}
+
+	refreshToken, exists := AppContext.RefreshTokens[refreshTokenValue]
+	if !exists || refreshToken.ClientId != client.Id {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid Refresh Token")
+		return
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		delete(AppContext.RefreshTokens, refreshTokenValue)
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Refresh Token has expired")
+		return
+	}
+
+	_, user := FindUserIndexById(refreshToken.UserId)
+	if user == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+		return
+	}
+
+	if !verifyCognitoSecretHash(client, params["SECRET_HASH"], user.Username, user.Id) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, fmt.Sprintf("Unable to verify secret hash for client %s", client.Id))
+		return
+	}
+
+	if user.Disabled {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "User is disabled.")
+		return
+	}
+
+	// Cognito does not rotate refresh tokens
+	cognitoIssueTokens(w, r, user, client, refreshToken.Scopes, false, refreshToken.Amr)
+}
+
+func cognitoRespondToAuthChallenge(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoRespondToAuthChallengeRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	client := cognitoFindClient(w, req.ClientId)
+	if client == nil {
+		return
+	}
+
+	if req.ChallengeResponses == nil {
+		req.ChallengeResponses = map[string]string{}
+	}
+
+	pendingLogin, exists := AppContext.PendingLogins[req.Session]
+	if !exists || pendingLogin.ClientId != client.Id || pendingLogin.ChallengeName == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid session for the user.")
+		return
+	}
+
+	if time.Since(pendingLogin.CreatedAt) > ChallengeExpiry {
+		delete(AppContext.PendingLogins, req.Session)
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid session for the user, session is expired.")
+		return
+	}
+
+	if req.ChallengeName != pendingLogin.ChallengeName {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, fmt.Sprintf("Expected challenge %s", pendingLogin.ChallengeName))
+		return
+	}
+
+	_, user := FindUserIndexById(pendingLogin.UserId)
+	if user == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+		return
+	}
+
+	if !verifyCognitoSecretHash(client, req.ChallengeResponses["SECRET_HASH"], user.Username) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, fmt.Sprintf("Unable to verify secret hash for client %s", client.Id))
+		return
+	}
+
+	switch pendingLogin.ChallengeName {
+	case ChallengeNamePasswordVerifier:
+		cognitoRespondToPasswordVerifier(w, r, req, pendingLogin, user, client)
+		return
+	case ChallengeNameNewPassword:
+		cognitoRespondToNewPasswordRequired(w, r, req, pendingLogin, user, client)
+		return
+	case ChallengeNameMfaSetup:
+		cognitoRespondToMfaSetup(w, r, req, pendingLogin, user, client)
+		return
+	}
+
+	var answer string
+	switch pendingLogin.ChallengeName {
+	case ChallengeNameSoftwareTokenMfa:
+		answer = req.ChallengeResponses["SOFTWARE_TOKEN_MFA_CODE"]
+	default:
+		answer = req.ChallengeResponses["ANSWER"]
+	}
+
+	// Validate challenge response, limiting the number of attempts per session
+	if !validateChallengeResponse(user, answer) {
+		pendingLogin.FailedAttempts++
+		if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+			delete(AppContext.PendingLogins, req.Session)
+			writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Too many failed attempts.")
+			return
+		}
+		AppContext.PendingLogins[req.Session] = pendingLogin
+		writeCognitoError(w, http.StatusBadRequest, CognitoCodeMismatch, "Invalid code or auth state for the user.")
+		return
+	}
+
+	delete(AppContext.PendingLogins, req.Session)
+
+	cognitoContinueLogin(w, r, user, client, pendingLogin.Scopes, completedAuthenticationMethods(pendingLogin.Amr, pendingLogin.ChallengeName), true)
+}
+
+// cognitoRespondToNewPasswordRequired sets the new password of a user that has to change it and continues the login
+func cognitoRespondToNewPasswordRequired(w http.ResponseWriter, r *http.Request, req CognitoRespondToAuthChallengeRequest, pendingLogin PendingLogin, user *IdpUser, client *IdpClient) {
+	newPassword := req.ChallengeResponses["NEW_PASSWORD"]
+	if newPassword == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter NEW_PASSWORD")
+		return
+	}
+	if err := validateNewPassword(user, newPassword); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+
+	// Clients send required attributes as "userAttributes.<name>", server managed attributes are ignored
+	attributes := []CognitoAttribute{}
+	for name, value := range req.ChallengeResponses {
+		name, ok := strings.CutPrefix(name, "userAttributes.")
+		if ok && !serverManagedAttribute(name) {
+			attributes = append(attributes, CognitoAttribute{Name: name, Value: value})
+		}
+	}
+	if !cognitoApplyAttributes(w, user, attributes) {
+		return
+	}
+
+	delete(AppContext.PendingLogins, req.Session)
+	if err := setUserPassword(user, newPassword); err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+
+	cognitoContinueLogin(w, r, user, client, pendingLogin.Scopes, pendingLogin.Amr, false)
+}
+
+// cognitoAuthenticateAccessToken validates the access token of a Cognito request, writing an error response on failure
+func cognitoAuthenticateAccessToken(w http.ResponseWriter, accessToken string) (*jwt.Token, *IdpUser) {
+	token, err := validateAccessToken(accessToken)
+	if err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Access Token has been revoked")
+		} else {
+			writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid Access Token")
+		}
+		return nil, nil
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["token_use"] != TokenUseAccess {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid Access Token")
+		return nil, nil
+	}
+
+	userId, _ := claims["sub"].(string)
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+		return nil, nil
+	}
+
+	return token, user
+}
+
+func cognitoGetUser(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAccessTokenRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	_, user := cognitoAuthenticateAccessToken(w, req.AccessToken)
+	if user == nil {
+		return
+	}
+
+	writeCognitoJSON(w, CognitoGetUserResponse{
+		Username:       user.Username,
+		UserAttributes: userAttributesToCognito(user),
+	})
+}
+
+func cognitoGlobalSignOut(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAccessTokenRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	token, user := cognitoAuthenticateAccessToken(w, req.AccessToken)
+	if user == nil {
+		return
+	}
+
+	revokeRefreshTokens(user.Id)
+	revokeAccessTokens(token)
+
+	writeCognitoJSON(w, map[string]interface{}{})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type CognitoForgotPasswordRequest struct {
+	ClientId   string `json:"ClientId"`
+	SecretHash string `json:"SecretHash"`
+	Username   string `json:"Username"`
+}
+
+type CognitoConfirmForgotPasswordRequest struct {
+	ClientId         string `json:"ClientId"`
+	SecretHash       string `json:"SecretHash"`
+	Username         string `json:"Username"`
+	ConfirmationCode string `json:"ConfirmationCode"`
+	Password         string `json:"Password"`
+}
+
+// cognitoForgotPasswordClient finds the client of a password reset action and checks that password reset is enabled,
+// writing an error response on failure
+func cognitoForgotPasswordClient(w http.ResponseWriter, clientId string, secretHash string, username string) *IdpClient {
+	client := cognitoFindClient(w, clientId)
+	if client == nil {
+		return nil
+	}
+	if !verifyCognitoSecretHash(client, secretHash, username) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, fmt.Sprintf("Unable to verify secret hash for client %s", client.Id))
+		return nil
+	}
+	if !*AppConfig.PasswordReset.Enabled {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Password reset is not permitted for this user pool")
+		return nil
+	}
+	return client
+}
+
+func cognitoForgotPassword(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoForgotPasswordRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	if cognitoForgotPasswordClient(w, req.ClientId, req.SecretHash, req.Username) == nil {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	switch err := checkPasswordResetAllowed(user); err {
+	case nil:
+	case ErrUserNotConfirmed, ErrNoEmailAddress:
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Cannot reset password for the user as there is no registered/verified email or phone_number")
+		return
+	default:
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "User is disabled.")
+		return
+	}
+
+	sendPasswordResetCode(user, nil)
+
+	writeCognitoJSON(w, map[string]interface{}{
+		"CodeDeliveryDetails": newCognitoCodeDeliveryDetails(user),
+	})
+}
+
+func cognitoConfirmForgotPassword(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoConfirmForgotPasswordRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	if cognitoForgotPasswordClient(w, req.ClientId, req.SecretHash, req.Username) == nil {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	switch err := checkPasswordResetCode(user, req.ConfirmationCode); err {
+	case nil:
+	case ErrExpiredResetCode:
+		writeCognitoError(w, http.StatusBadRequest, CognitoExpiredCode, "Invalid code provided, please request a code again.")
+		return
+	default:
+		writeCognitoError(w, http.StatusBadRequest, CognitoCodeMismatch, "Invalid verification code provided, please try again.")
+		return
+	}
+	if err := validateNewPassword(user, req.Password); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+
+	if err := resetUserPassword(user, req.Password); err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+
+	writeCognitoJSON(w, map[string]interface{}{})
+}
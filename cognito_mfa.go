@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+type CognitoAssociateSoftwareTokenRequest struct {
+	AccessToken string `json:"AccessToken"`
+	Session     string `json:"Session"`
+}
+
+type CognitoAssociateSoftwareTokenResponse struct {
+	SecretCode string `json:"SecretCode"`
+	Session    string `json:"Session,omitempty"`
+}
+
+type CognitoVerifySoftwareTokenRequest struct {
+	AccessToken        string `json:"AccessToken"`
+	Session            string `json:"Session"`
+	UserCode           string `json:"UserCode"`
+	FriendlyDeviceName string `json:"FriendlyDeviceName"`
+}
+
+type CognitoVerifySoftwareTokenResponse struct {
+	Status  string `json:"Status"`
+	Session string `json:"Session,omitempty"`
+}
+
+// cognitoSoftwareTokenUser finds the user of a software token action, who is either signed in or sets up MFA during
+// a login, writing an error response on failure
+func cognitoSoftwareTokenUser(w http.ResponseWriter, accessToken string, session string) *IdpUser {
+	if session == "" {
+		_, user := cognitoAuthenticateAccessToken(w, accessToken)
+		return user
+	}
+
+	pendingLogin, exists := AppContext.PendingLogins[session]
+	if !exists || pendingLogin.ChallengeName != ChallengeNameMfaSetup {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid session for the user.")
+		return nil
+	}
+	if time.Since(pendingLogin.CreatedAt) > ChallengeExpiry {
+		delete(AppContext.PendingLogins, session)
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid session for the user, session is expired.")
+		return nil
+	}
+
+	_, user := FindUserIndexById(pendingLogin.UserId)
+	if user == nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserNotFound, "User does not exist.")
+	}
+	return user
+}
+
+func cognitoAssociateSoftwareToken(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoAssociateSoftwareTokenRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	user := cognitoSoftwareTokenUser(w, req.AccessToken, req.Session)
+	if user == nil {
+		return
+	}
+
+	enrollment, err := startTotpEnrollment(user)
+	if err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+
+	writeCognitoJSON(w, CognitoAssociateSoftwareTokenResponse{
+		SecretCode: enrollment.Secret,
+		Session:    req.Session,
+	})
+}
+
+func cognitoVerifySoftwareToken(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoVerifySoftwareTokenRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	user := cognitoSoftwareTokenUser(w, req.AccessToken, req.Session)
+	if user == nil {
+		return
+	}
+
+	if !verifyTotpEnrollment(user, req.UserCode) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoEnableSoftwareTokenMfa, "Code mismatch and fail enable Software Token MFA mode")
+		return
+	}
+
+	writeCognitoJSON(w, CognitoVerifySoftwareTokenResponse{
+		Status:  "SUCCESS",
+		Session: req.Session,
+	})
+}
+
+// cognitoRespondToMfaSetup completes the login of a user that verified their new software token
+func cognitoRespondToMfaSetup(w http.ResponseWriter, r *http.Request, req CognitoRespondToAuthChallengeRequest, pendingLogin PendingLogin, user *IdpUser, client *IdpClient) {
+	if !totpEnabled(user) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "MFA setup is not complete, verify a software token first")
+		return
+	}
+
+	delete(AppContext.PendingLogins, req.Session)
+
+	cognitoContinueLogin(w, r, user, client, pendingLogin.Scopes, completedAuthenticationMethods(pendingLogin.Amr, pendingLogin.ChallengeName), true)
+}
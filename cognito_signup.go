@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type CognitoSignUpRequest struct {
+	ClientId       string             `json:"ClientId"`
+	SecretHash     string             `json:"SecretHash"`
+	Username       string             `json:"Username"`
+	Password       string             `json:"Password"`
+	UserAttributes []CognitoAttribute `json:"UserAttributes"`
+}
+
+type CognitoConfirmSignUpRequest struct {
+	ClientId         string `json:"ClientId"`
+	SecretHash       string `json:"SecretHash"`
+	Username         string `json:"Username"`
+	ConfirmationCode string `json:"ConfirmationCode"`
+}
+
+type CognitoResendConfirmationCodeRequest struct {
+	ClientId   string `json:"ClientId"`
+	SecretHash string `json:"SecretHash"`
+	Username   string `json:"Username"`
+}
+
+type CognitoCodeDeliveryDetails struct {
+	AttributeName  string `json:"AttributeName"`
+	DeliveryMedium string `json:"DeliveryMedium"`
+	Destination    string `json:"Destination"`
+}
+
+type CognitoSignUpResponse struct {
+	UserConfirmed       bool                        `json:"UserConfirmed"`
+	UserSub             string                      `json:"UserSub"`
+	CodeDeliveryDetails *CognitoCodeDeliveryDetails `json:"CodeDeliveryDetails,omitempty"`
+}
+
+func newCognitoCodeDeliveryDetails(user *IdpUser) *CognitoCodeDeliveryDetails {
+	return &CognitoCodeDeliveryDetails{
+		AttributeName:  "email",
+		DeliveryMedium: "EMAIL",
+		Destination:    maskEmail(userEmail(user)),
+	}
+}
+
+// cognitoSignUpClient finds the client of a sign-up action and checks that sign-up is enabled, writing an error
+// response on failure
+func cognitoSignUpClient(w http.ResponseWriter, clientId string, secretHash string, username string) *IdpClient {
+	client := cognitoFindClient(w, clientId)
+	if client == nil {
+		return nil
+	}
+	if !verifyCognitoSecretHash(client, secretHash, username) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, fmt.Sprintf("Unable to verify secret hash for client %s", client.Id))
+		return nil
+	}
+	if !*AppConfig.SignUp.Enabled {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "SignUp is not permitted for this user pool")
+		return nil
+	}
+	return client
+}
+
+func cognitoSignUp(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoSignUpRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	client := cognitoSignUpClient(w, req.ClientId, req.SecretHash, req.Username)
+	if client == nil {
+		return
+	}
+
+	if req.Username == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter Username")
+		return
+	}
+	if FindUserByUsername(req.Username) != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUsernameExists, "User already exists")
+		return
+	}
+	if err := validateNewPassword(nil, req.Password); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidPassword, fmt.Sprintf("Password does not conform to policy: %s", err.Error()))
+		return
+	}
+
+	var attributesUser IdpUser
+	if !cognitoApplyAttributes(w, &attributesUser, req.UserAttributes) {
+		return
+	}
+	if err := validateSignUpEmail(attributesUser.Attributes); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, err.Error())
+		return
+	}
+
+	newUser, err := newSignUpUser(req.Username, req.Password, attributesUser.Attributes)
+	if err != nil {
+		writeCognitoError(w, http.StatusInternalServerError, CognitoInternalError, err.Error())
+		return
+	}
+
+	// Let the pre sign-up hook deny creating the user
+	if err := runPreHook(AppConfig.Hooks.PreSignUp, newLifecycleHookEvent(HookPreSignUp, HookSourceCognito, &newUser, client)); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUserLambdaValidation, fmt.Sprintf("PreSignUp failed with error %s.", err.Error()))
+		return
+	}
+
+	user := addSignUpUser(newUser, HookSourceCognito, client, nil)
+
+	response := CognitoSignUpResponse{
+		UserConfirmed: !user.Unconfirmed,
+		UserSub:       user.Id,
+	}
+	if user.Unconfirmed {
+		response.CodeDeliveryDetails = newCognitoCodeDeliveryDetails(user)
+	}
+	writeCognitoJSON(w, response)
+}
+
+func cognitoConfirmSignUp(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoConfirmSignUpRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	client := cognitoSignUpClient(w, req.ClientId, req.SecretHash, req.Username)
+	if client == nil {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	switch err := confirmUser(user, req.ConfirmationCode, HookSourceCognito, client); err {
+	case nil:
+		writeCognitoJSON(w, map[string]interface{}{})
+	case ErrUserAlreadyConfirmed:
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "User cannot be confirmed. Current status is CONFIRMED")
+	case ErrExpiredConfirmationCode:
+		writeCognitoError(w, http.StatusBadRequest, CognitoExpiredCode, "Invalid code provided, please request a code again.")
+	default:
+		writeCognitoError(w, http.StatusBadRequest, CognitoCodeMismatch, "Invalid verification code provided, please try again.")
+	}
+}
+
+func cognitoResendConfirmationCode(w http.ResponseWriter, r *http.Request, body []byte) {
+	var req CognitoResendConfirmationCodeRequest
+	if !decodeCognitoRequest(w, body, &req) {
+		return
+	}
+
+	client := cognitoSignUpClient(w, req.ClientId, req.SecretHash, req.Username)
+	if client == nil {
+		return
+	}
+
+	_, user := cognitoFindUser(w, req.Username)
+	if user == nil {
+		return
+	}
+
+	if !user.Unconfirmed {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "User is already confirmed.")
+		return
+	}
+	if userEmail(user) == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "User has no email address.")
+		return
+	}
+
+	sendConfirmationCode(user, nil)
+
+	writeCognitoJSON(w, map[string]interface{}{
+		"CodeDeliveryDetails": newCognitoCodeDeliveryDetails(user),
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeNamePasswordVerifier = "PASSWORD_VERIFIER"
+	ChallengeNameSrpA             = "SRP_A"
+)
+
+// cognitoUserPoolName returns the pool name part of the user pool ID, which Cognito clients use when hashing passwords
+func cognitoUserPoolName() string {
+	poolId := AppConfig.CognitoApi.UserPoolId
+	if i := strings.Index(poolId, "_"); i >= 0 {
+		return poolId[i+1:]
+	}
+	return poolId
+}
+
+// newSrpCredentials computes the SRP verifier of a password with a fresh salt
+func newSrpCredentials(username string, password string) *SrpCredentials {
+	salt := srpRandomInt(16)
+	return &SrpCredentials{
+		UserIdForSrp: username,
+		Salt:         salt,
+		Verifier:     srpVerifier(srpPrivateKey(cognitoUserPoolName(), username, password, salt)),
+	}
+}
+
+// cognitoStartSrpChallenge computes the server's SRP values for the user and responds with a PASSWORD_VERIFIER challenge
+func cognitoStartSrpChallenge(w http.ResponseWriter, user *IdpUser, client *IdpClient, srpA string) {
+	if srpA == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter SRP_A")
+		return
+	}
+	A, ok := new(big.Int).SetString(srpA, 16)
+	if !ok || new(big.Int).Mod(A, srpN).Sign() == 0 {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Invalid SRP_A")
+		return
+	}
+
+	// Users with a plain text password in the configuration get a verifier with a fresh salt for every login, the
+	// verifier of a hashed password is only known once the password has been set at runtime
+	credentials := user.SrpCredentials
+	if credentials == nil {
+		if isPasswordHash(user.Password) {
+			writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "SRP authentication is not available for users with a hashed password, use USER_PASSWORD_AUTH")
+			return
+		}
+		credentials = newSrpCredentials(user.Username, user.Password)
+	}
+	verifier := credentials.Verifier
+
+	var b, B *big.Int
+	for {
+		b = srpRandomInt(32)
+		B = srpServerPublicKey(verifier, b)
+		if B.Sign() != 0 && srpScramblingParameter(A, B).Sign() != 0 {
+			break
+		}
+	}
+
+	secretBlock := make([]byte, 64)
+	if _, err := rand.Read(secretBlock); err != nil {
+		panic(err)
+	}
+
+	session := generateRandomToken()
+	storePendingLogin(session, PendingLogin{
+		UserId:            user.Id,
+		ClientId:          client.Id,
+		IssueRefreshToken: true,
+		Scopes:            clientDefaultScopes(client, AppConfig.CognitoApi.DefaultScopes),
+		CreatedAt:         time.Now(),
+		ChallengeName:     ChallengeNamePasswordVerifier,
+		Srp: &SrpSession{
+			A:            A,
+			B:            B,
+			SmallB:       b,
+			Verifier:     verifier,
+			SecretBlock:  secretBlock,
+			UserIdForSrp: credentials.UserIdForSrp,
+		},
+	})
+
+	writeCognitoJSON(w, CognitoAuthResponse{
+		ChallengeName: ChallengeNamePasswordVerifier,
+		ChallengeParameters: map[string]string{
+			"SALT":            credentials.Salt.Text(16),
+			"SRP_B":           B.Text(16),
+			"SECRET_BLOCK":    base64.StdEncoding.EncodeToString(secretBlock),
+			"USERNAME":        user.Username,
+			"USER_ID_FOR_SRP": credentials.UserIdForSrp,
+		},
+		Session: session,
+	})
+}
+
+// cognitoRespondToPasswordVerifier checks the client's password claim signature and continues the login
+func cognitoRespondToPasswordVerifier(w http.ResponseWriter, r *http.Request, req CognitoRespondToAuthChallengeRequest, pendingLogin PendingLogin, user *IdpUser, client *IdpClient) {
+	// The session can only be used for a single password claim
+	delete(AppContext.PendingLogins, req.Session)
+
+	srp := pendingLogin.Srp
+	responses := req.ChallengeResponses
+
+	timestamp := responses["TIMESTAMP"]
+	if timestamp == "" {
+		writeCognitoError(w, http.StatusBadRequest, CognitoInvalidParameter, "Missing required parameter TIMESTAMP")
+		return
+	}
+
+	secretBlock, err := base64.StdEncoding.DecodeString(responses["PASSWORD_CLAIM_SECRET_BLOCK"])
+	if err != nil || !hmac.Equal(secretBlock, srp.SecretBlock) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Invalid session for the user.")
+		return
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(responses["PASSWORD_CLAIM_SIGNATURE"])
+	if err != nil {
+		recordFailedLogin(user)
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Incorrect username or password.")
+		return
+	}
+
+	u := srpScramblingParameter(srp.A, srp.B)
+	S := srpServerSecret(srp.A, srp.Verifier, u, srp.SmallB)
+	key := srpAuthenticationKey(S, u)
+	expected := srpPasswordClaimSignature(key, cognitoUserPoolName(), srp.UserIdForSrp, srp.SecretBlock, timestamp)
+	if !hmac.Equal(signature, expected) {
+		recordFailedLogin(user)
+		writeCognitoError(w, http.StatusBadRequest, CognitoNotAuthorized, "Incorrect username or password.")
+		return
+	}
+	resetFailedLogins(user)
+
+	// The password is verified, continue with the next challenge if there is one
+	cognitoContinueLogin(w, r, user, client, pendingLogin.Scopes, []string{AmrPassword}, false)
+}
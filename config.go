@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -62,6 +65,11 @@ func LoadConfig() *IdpConfig {
 		config.AccessTokenExpirationSeconds = 900
 	}
 
+	// Set default identity token expiration if not provided (same as access tokens)
+	if config.IdentityTokenExpirationSeconds == 0 {
+		config.IdentityTokenExpirationSeconds = config.AccessTokenExpirationSeconds
+	}
+
 	// Set default refresh token expiration if not provided (1 day)
 	if config.RefreshTokenExpirationSeconds == 0 {
 		config.RefreshTokenExpirationSeconds = 86400
@@ -84,6 +92,10 @@ func LoadConfig() *IdpConfig {
 	if config.OAuth2.DefaultScopes == "" {
 		config.OAuth2.DefaultScopes = "openid profile"
 	}
+	if config.OAuth2.RequireConsent == nil {
+		falseVal := false
+		config.OAuth2.RequireConsent = &falseVal
+	}
 
 	// Set default LoginApi configuration
 	if config.LoginApi.Enabled == nil {
@@ -93,6 +105,130 @@ func LoadConfig() *IdpConfig {
 	if config.LoginApi.DefaultScopes == "" {
 		config.LoginApi.DefaultScopes = "openid profile"
 	}
+	if config.LoginApi.MaxChallengeAttempts == 0 {
+		config.LoginApi.MaxChallengeAttempts = 3
+	}
+
+	// Set default CognitoApi configuration, which is opt-in as it exposes unauthenticated admin actions
+	if config.CognitoApi.Enabled == nil {
+		falseVal := false
+		config.CognitoApi.Enabled = &falseVal
+	}
+	if config.CognitoApi.DefaultScopes == "" {
+		config.CognitoApi.DefaultScopes = "aws.cognito.signin.user.admin"
+	}
+	if config.CognitoApi.UserPoolId == "" {
+		config.CognitoApi.UserPoolId = "local_localidp"
+	}
+
+	// Set default lockout duration (15 minutes)
+	if config.Lockout.DurationSeconds == 0 {
+		config.Lockout.DurationSeconds = 900
+	}
+
+	// Set default algorithm for hashing passwords set at runtime
+	if config.PasswordHashAlgorithm == "" {
+		config.PasswordHashAlgorithm = PasswordHashBcrypt
+	}
+	if !slices.Contains(PasswordHashAlgorithms, config.PasswordHashAlgorithm) {
+		log.Printf("Unsupported password_hash_algorithm %q, using %s", config.PasswordHashAlgorithm, PasswordHashBcrypt)
+		config.PasswordHashAlgorithm = PasswordHashBcrypt
+	}
+
+	// Set default SignUp configuration
+	if config.SignUp.Enabled == nil {
+		falseVal := false
+		config.SignUp.Enabled = &falseVal
+	}
+	if config.SignUp.RequireVerification == nil {
+		trueVal := true
+		config.SignUp.RequireVerification = &trueVal
+	}
+	if config.SignUp.CodeExpirationSeconds == 0 {
+		config.SignUp.CodeExpirationSeconds = 86400
+	}
+
+	// Set default PasswordReset configuration
+	if config.PasswordReset.Enabled == nil {
+		trueVal := true
+		config.PasswordReset.Enabled = &trueVal
+	}
+	if config.PasswordReset.CodeExpirationSeconds == 0 {
+		config.PasswordReset.CodeExpirationSeconds = 3600
+	}
+
+	// Set default Passwordless configuration
+	if config.Passwordless.Enabled == nil {
+		falseVal := false
+		config.Passwordless.Enabled = &falseVal
+	}
+	if config.Passwordless.CodeExpirationSeconds == 0 {
+		config.Passwordless.CodeExpirationSeconds = 300
+	}
+	if config.Passwordless.MagicLink == nil {
+		trueVal := true
+		config.Passwordless.MagicLink = &trueVal
+	}
+
+	// Set default WebAuthn configuration, with the base URL's host as relying party
+	if config.Webauthn.Enabled == nil {
+		falseVal := false
+		config.Webauthn.Enabled = &falseVal
+	}
+	if baseUrl, err := url.Parse(config.BaseUrl); err == nil {
+		if config.Webauthn.RpId == "" {
+			config.Webauthn.RpId = baseUrl.Hostname()
+		}
+		if len(config.Webauthn.Origins) == 0 {
+			config.Webauthn.Origins = []string{baseUrl.Scheme + "://" + baseUrl.Host}
+		}
+	}
+	if config.Webauthn.RpName == "" {
+		config.Webauthn.RpName = "Local IdP"
+	}
+	if config.Webauthn.UserVerification == "" {
+		config.Webauthn.UserVerification = WebauthnUserVerificationPreferred
+	}
+	if config.Webauthn.TimeoutSeconds == 0 {
+		config.Webauthn.TimeoutSeconds = 300
+	}
+
+	// Set default ClientRegistration configuration
+	if config.ClientRegistration.Enabled == nil {
+		falseVal := false
+		config.ClientRegistration.Enabled = &falseVal
+	}
+
+	// Set default Mail configuration
+	if config.Mail.From == "" {
+		config.Mail.From = "no-reply@localhost"
+	}
+	if config.Mail.Smtp != nil && config.Mail.Smtp.Port == 0 {
+		config.Mail.Smtp.Port = 25
+	}
+
+	// Passwords of configured users count as changed when the server starts. Users whose challenge cannot be answered
+	// cannot complete a login.
+	now := time.Now()
+	for i := range config.Users {
+		if config.Users[i].PasswordChangedAt == nil {
+			config.Users[i].PasswordChangedAt = &now
+		}
+		if err := validateUserChallenge(&config.Users[i]); err != nil {
+			log.Printf("%v for user %s, the user cannot answer login challenges", err, config.Users[i].Id)
+		}
+	}
+
+	// Clients with an unsupported token endpoint auth method cannot authenticate, unsupported response types are never
+	// accepted
+	for _, client := range config.Clients {
+		if client.TokenEndpointAuthMethod != "" && !slices.Contains(ClientAuthMethods, client.TokenEndpointAuthMethod) {
+			log.Printf("Unsupported token_endpoint_auth_method %q for client %s", client.TokenEndpointAuthMethod, client.Id)
+		}
+		if err := validateResponseTypes(client.ResponseTypes); err != nil {
+			log.Printf("%v for client %s", err, client.Id)
+		}
+	}
 
 	return config
 }
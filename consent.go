@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// ChallengeNameConsent is the step of an OAuth2 login in which the user approves the requested scopes
+const ChallengeNameConsent = "CONSENT"
+
+// scopeOpenId is always granted, it is what makes the login an OpenID Connect login
+const scopeOpenId = "openid"
+
+// clientRequiresConsent reports whether users approve the scopes the client requests, falling back to the global
+// setting
+func clientRequiresConsent(client *IdpClient) bool {
+	if client != nil && client.RequireConsent != nil {
+		return *client.RequireConsent
+	}
+	return *AppConfig.OAuth2.RequireConsent
+}
+
+// promptIncludes reports whether the space separated prompt parameter contains the value
+func promptIncludes(prompt string, value string) bool {
+	return slices.Contains(strings.Fields(prompt), value)
+}
+
+// findConsentGrant returns the user's remembered grant for the client if found
+func findConsentGrant(user *IdpUser, clientId string) *ConsentGrant {
+	for i, grant := range user.Consents {
+		if grant.ClientId == clientId {
+			return &user.Consents[i]
+		}
+	}
+	return nil
+}
+
+// consentRequired reports whether the user has to approve the scopes before the client receives them. Users are asked
+// again for scopes they did not grant yet, or whenever the client sends prompt=consent.
+func consentRequired(user *IdpUser, client *IdpClient, scope string, prompt string) bool {
+	if !clientRequiresConsent(client) {
+		return false
+	}
+	if promptIncludes(prompt, "consent") {
+		return true
+	}
+
+	grant := findConsentGrant(user, client.Id)
+	if grant == nil {
+		return true
+	}
+	for _, s := range strings.Fields(scope) {
+		if s != scopeOpenId && !slices.Contains(grant.Scopes, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvedScopes returns the requested scopes the user approved, in the requested order
+func approvedScopes(requested string, approved []string) string {
+	scopes := []string{}
+	for _, s := range strings.Fields(requested) {
+		if s == scopeOpenId || slices.Contains(approved, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// rememberConsent adds the scopes to the user's grant for the client
+func rememberConsent(user *IdpUser, clientId string, scope string) {
+	grant := findConsentGrant(user, clientId)
+	if grant == nil {
+		user.Consents = append(user.Consents, ConsentGrant{ClientId: clientId})
+		grant = &user.Consents[len(user.Consents)-1]
+	}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(grant.Scopes, s) {
+			grant.Scopes = append(grant.Scopes, s)
+		}
+	}
+	grant.GrantedAt = time.Now()
+}
+
+// revokeConsent removes the user's grant for the client along with the refresh tokens issued to the client for them,
+// reporting whether there was a grant
+func revokeConsent(user *IdpUser, clientId string) bool {
+	index := slices.IndexFunc(user.Consents, func(grant ConsentGrant) bool {
+		return grant.ClientId == clientId
+	})
+	if index < 0 {
+		return false
+	}
+
+	user.Consents = slices.Delete(user.Consents, index, index+1)
+	for token, issued := range AppContext.RefreshTokens {
+		if issued.UserId == user.Id && issued.ClientId == clientId {
+			delete(AppContext.RefreshTokens, token)
+		}
+	}
+	return true
+}
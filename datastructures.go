@@ -1,46 +1,281 @@
 package main
 
-import "crypto/rsa"
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"time"
+)
 
 type IdpUser struct {
-	Id         string                 `json:"id"`
-	Username   string                 `json:"username"`
-	Password   string                 `json:"password,omitempty"`
-	Disabled   bool                   `json:"disabled"`
-	Attributes map[string]interface{} `json:"attributes"`
+	Id                  string                 `json:"id"`
+	Username            string                 `json:"username"`
+	Password            string                 `json:"password,omitempty"`
+	Disabled            bool                   `json:"disabled"`
+	Attributes          map[string]interface{} `json:"attributes"`
+	ChallengeType       string                 `json:"challenge_type,omitempty"`
+	ChallengeCode       string                 `json:"challenge_code,omitempty"`
+	TotpSecret          string                 `json:"totp_secret,omitempty"`
+	PendingTotpSecret   string                 `json:"-"`
+	MfaRequired         bool                   `json:"mfa_required,omitempty"`
+	Groups              []string               `json:"groups,omitempty"`
+	ForcePasswordChange bool                   `json:"force_password_change,omitempty"`
+	PasswordChangedAt   *time.Time             `json:"password_changed_at,omitempty"`
+	PasswordHistory     []string               `json:"-"`
+	FailedLoginAttempts int                    `json:"failed_login_attempts,omitempty"`
+	LockedUntil         *time.Time             `json:"locked_until,omitempty"`
+	SrpCredentials      *SrpCredentials        `json:"-"`
+	Unconfirmed         bool                   `json:"unconfirmed,omitempty"`
+	ConfirmationCode    string                 `json:"-"`
+	ConfirmationExpires *time.Time             `json:"-"`
+	ConfirmationFailed  int                    `json:"-"`
+	ResetCode           string                 `json:"-"`
+	ResetCodeExpires    *time.Time             `json:"-"`
+	ResetCodeFailed     int                    `json:"-"`
+	WebauthnCredentials []WebauthnCredential   `json:"webauthn_credentials,omitempty"`
+	PendingWebauthn     *WebauthnSession       `json:"-"`
+	Consents            []ConsentGrant         `json:"consents,omitempty"`
+}
+
+// ConsentGrant is a user's remembered approval of scopes requested by a client
+type ConsentGrant struct {
+	ClientId  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// WebauthnCredential is a passkey registered by a user. The public key is a base64url encoded COSE key.
+type WebauthnCredential struct {
+	Id             string     `json:"id"`
+	PublicKey      string     `json:"public_key"`
+	Algorithm      int        `json:"algorithm"`
+	SignCount      uint32     `json:"sign_count"`
+	Transports     []string   `json:"transports,omitempty"`
+	BackupEligible bool       `json:"backup_eligible,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
 }
 
 type IdpClient struct {
-	Id          string `json:"id"`
-	Secret      string `json:"secret"`
-	RedirectUri string `json:"redirect_uri"`
-	Audience    string `json:"audience"`
+	Id                             string                  `json:"id"`
+	Secret                         string                  `json:"secret,omitempty"`
+	RedirectUri                    string                  `json:"redirect_uri"`
+	RedirectUris                   []string                `json:"redirect_uris,omitempty"`
+	Audience                       string                  `json:"audience"`
+	DefaultScopes                  string                  `json:"default_scopes,omitempty"`
+	AccessTokenExpirationSeconds   int                     `json:"access_token_expiration_seconds,omitempty"`
+	IdentityTokenExpirationSeconds int                     `json:"identity_token_expiration_seconds,omitempty"`
+	RefreshTokenExpirationSeconds  int                     `json:"refresh_token_expiration_seconds,omitempty"`
+	MapAccessTokenClaims           map[string]ClaimMapping `json:"map_access_token_claims,omitempty"`
+	MapIdentityTokenClaims         map[string]ClaimMapping `json:"map_identity_token_claims,omitempty"`
+	MapUserinfoClaims              map[string]ClaimMapping `json:"map_userinfo_claims,omitempty"`
+	MfaRequired                    bool                    `json:"mfa_required,omitempty"`
+	RequireConsent                 *bool                   `json:"require_consent,omitempty"`
+	TokenEndpointAuthMethod        string                  `json:"token_endpoint_auth_method,omitempty"`
+	Jwks                           *ClientJwks             `json:"jwks,omitempty"`
+	JwksUri                        string                  `json:"jwks_uri,omitempty"`
+	ClientName                     string                  `json:"client_name,omitempty"`
+	GrantTypes                     []string                `json:"grant_types,omitempty"`
+	ResponseTypes                  []string                `json:"response_types,omitempty"`
+	RequirePushedAuthorization     bool                    `json:"require_pushed_authorization_requests,omitempty"`
+	RequestUris                    []string                `json:"request_uris,omitempty"`
+	RegistrationAccessToken        string                  `json:"-"`
+	ClientIdIssuedAt               int64                   `json:"-"`
+}
+
+// ClientJwks holds the public keys a client signs its client assertions with
+type ClientJwks struct {
+	Keys []ClientJwk `json:"keys"`
+}
+
+type ClientJwk struct {
+	Kid string `json:"kid,omitempty"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
 }
 
 type OAuth2Config struct {
 	Enabled                 *bool  `json:"enabled,omitempty"`
 	RequireChallengeOnLogin *bool  `json:"require_challenge_on_login,omitempty"`
 	DefaultScopes           string `json:"default_scopes,omitempty"`
+	RequireConsent          *bool  `json:"require_consent,omitempty"`
 }
 
 type LoginApiConfig struct {
+	Enabled              *bool  `json:"enabled,omitempty"`
+	DefaultScopes        string `json:"default_scopes,omitempty"`
+	MaxChallengeAttempts int    `json:"max_challenge_attempts,omitempty"`
+}
+
+type CognitoApiConfig struct {
 	Enabled       *bool  `json:"enabled,omitempty"`
 	DefaultScopes string `json:"default_scopes,omitempty"`
+	UserPoolId    string `json:"user_pool_id,omitempty"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength        int  `json:"min_length,omitempty"`
+	RequireUppercase bool `json:"require_uppercase,omitempty"`
+	RequireLowercase bool `json:"require_lowercase,omitempty"`
+	RequireNumbers   bool `json:"require_numbers,omitempty"`
+	RequireSymbols   bool `json:"require_symbols,omitempty"`
+	HistorySize      int  `json:"history_size,omitempty"`
+	MaxAgeDays       int  `json:"max_age_days,omitempty"`
+}
+
+type LockoutConfig struct {
+	MaxFailedAttempts int `json:"max_failed_attempts,omitempty"`
+	DurationSeconds   int `json:"duration_seconds,omitempty"`
+}
+
+type SignUpConfig struct {
+	Enabled               *bool `json:"enabled,omitempty"`
+	RequireVerification   *bool `json:"require_verification,omitempty"`
+	CodeExpirationSeconds int   `json:"code_expiration_seconds,omitempty"`
+}
+
+type PasswordResetConfig struct {
+	Enabled               *bool `json:"enabled,omitempty"`
+	CodeExpirationSeconds int   `json:"code_expiration_seconds,omitempty"`
+}
+
+type PasswordlessConfig struct {
+	Enabled               *bool `json:"enabled,omitempty"`
+	CodeExpirationSeconds int   `json:"code_expiration_seconds,omitempty"`
+	MagicLink             *bool `json:"magic_link,omitempty"`
+}
+
+type RegistrationConfig struct {
+	Enabled            *bool  `json:"enabled,omitempty"`
+	InitialAccessToken string `json:"initial_access_token,omitempty"`
+}
+
+type WebauthnConfig struct {
+	Enabled          *bool    `json:"enabled,omitempty"`
+	RpId             string   `json:"rp_id,omitempty"`
+	RpName           string   `json:"rp_name,omitempty"`
+	Origins          []string `json:"origins,omitempty"`
+	UserVerification string   `json:"user_verification,omitempty"`
+	TimeoutSeconds   int      `json:"timeout_seconds,omitempty"`
+}
+
+type MailConfig struct {
+	From string      `json:"from,omitempty"`
+	Smtp *SmtpConfig `json:"smtp,omitempty"`
+}
+
+type SmtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type MailMessage struct {
+	Id        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SmsMessage struct {
+	Id        string    `json:"id"`
+	To        string    `json:"to"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookConfig struct {
+	Url       string            `json:"url"`
+	TimeoutMs int               `json:"timeout_ms,omitempty"`
+	FailOpen  bool              `json:"fail_open,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+type HooksConfig struct {
+	PreSignUp          *WebhookConfig `json:"pre_sign_up,omitempty"`
+	PostConfirmation   *WebhookConfig `json:"post_confirmation,omitempty"`
+	PreAuthentication  *WebhookConfig `json:"pre_authentication,omitempty"`
+	PostAuthentication *WebhookConfig `json:"post_authentication,omitempty"`
+	PreTokenGeneration *WebhookConfig `json:"pre_token_generation,omitempty"`
 }
 
 type IdpConfig struct {
-	Port                          int               `json:"port"`
-	Issuer                        string            `json:"issuer,omitempty"`
-	BaseUrl                       string            `json:"base_url,omitempty"`
-	AccessTokenExpirationSeconds  int               `json:"access_token_expiration_seconds,omitempty"`
-	RefreshTokenExpirationSeconds int               `json:"refresh_token_expiration_seconds,omitempty"`
-	AllowedOrigins                string            `json:"allowed_origins,omitempty"`
-	OAuth2                        OAuth2Config      `json:"oauth2,omitempty"`
-	LoginApi                      LoginApiConfig    `json:"login_api,omitempty"`
-	MapAccessTokenClaims          map[string]string `json:"map_access_token_claims,omitempty"`
-	MapIdentityTokenClaims        map[string]string `json:"map_identity_token_claims,omitempty"`
-	Users                         []IdpUser         `json:"users"`
-	Clients                       []IdpClient       `json:"clients"`
+	Port                           int                     `json:"port"`
+	Issuer                         string                  `json:"issuer,omitempty"`
+	BaseUrl                        string                  `json:"base_url,omitempty"`
+	AccessTokenExpirationSeconds   int                     `json:"access_token_expiration_seconds,omitempty"`
+	IdentityTokenExpirationSeconds int                     `json:"identity_token_expiration_seconds,omitempty"`
+	RefreshTokenExpirationSeconds  int                     `json:"refresh_token_expiration_seconds,omitempty"`
+	AllowedOrigins                 string                  `json:"allowed_origins,omitempty"`
+	OAuth2                         OAuth2Config            `json:"oauth2,omitempty"`
+	LoginApi                       LoginApiConfig          `json:"login_api,omitempty"`
+	CognitoApi                     CognitoApiConfig        `json:"cognito_api,omitempty"`
+	MapAccessTokenClaims           map[string]ClaimMapping `json:"map_access_token_claims,omitempty"`
+	MapIdentityTokenClaims         map[string]ClaimMapping `json:"map_identity_token_claims,omitempty"`
+	MapUserinfoClaims              map[string]ClaimMapping `json:"map_userinfo_claims,omitempty"`
+	Hooks                          HooksConfig             `json:"hooks,omitempty"`
+	PasswordPolicy                 PasswordPolicyConfig    `json:"password_policy,omitempty"`
+	Lockout                        LockoutConfig           `json:"lockout,omitempty"`
+	PasswordHashAlgorithm          string                  `json:"password_hash_algorithm,omitempty"`
+	SignUp                         SignUpConfig            `json:"sign_up,omitempty"`
+	PasswordReset                  PasswordResetConfig     `json:"password_reset,omitempty"`
+	Passwordless                   PasswordlessConfig      `json:"passwordless,omitempty"`
+	Webauthn                       WebauthnConfig          `json:"webauthn,omitempty"`
+	ClientRegistration             RegistrationConfig      `json:"client_registration,omitempty"`
+	Mail                           MailConfig              `json:"mail,omitempty"`
+	Users                          []IdpUser               `json:"users"`
+	Clients                        []IdpClient             `json:"clients"`
+}
+
+type SignUpRequest struct {
+	Username   string                 `json:"username"`
+	Password   string                 `json:"password"`
+	Attributes map[string]interface{} `json:"attributes"`
+	ClientId   string                 `json:"client_id,omitempty"`
+}
+
+type SignUpResponse struct {
+	UserId                  string `json:"user_id"`
+	Username                string `json:"username"`
+	Confirmed               bool   `json:"confirmed"`
+	CodeDeliveryDestination string `json:"code_delivery_destination,omitempty"`
+}
+
+type ConfirmSignUpRequest struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
+
+type ResendConfirmationCodeRequest struct {
+	Username string `json:"username"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordRequest struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type VerifyTotpRequest struct {
+	Code string `json:"code"`
+}
+
+type VerifyWebauthnRegistrationRequest struct {
+	Credential json.RawMessage `json:"credential"`
+	Name       string          `json:"name,omitempty"`
 }
 
 type IdpInitLoginRequest struct {
@@ -49,15 +284,28 @@ type IdpInitLoginRequest struct {
 	ClientId          string `json:"client_id"`
 	IssueRefreshToken bool   `json:"issue_refresh_token"`
 	Scopes            string `json:"scopes,omitempty"`
+	Delivery          string `json:"delivery,omitempty"`
 }
 
 type IdpInitLoginResponse struct {
-	ChallengeId string `json:"challenge_id"`
+	ChallengeId             string                  `json:"challenge_id"`
+	ChallengeType           string                  `json:"challenge_type"`
+	TotpSetup               *TotpEnrollment         `json:"totp_setup,omitempty"`
+	WebauthnOptions         *WebauthnRequestOptions `json:"webauthn_options,omitempty"`
+	CodeDeliveryDestination string                  `json:"code_delivery_destination,omitempty"`
+}
+
+type IdpInitWebauthnLoginRequest struct {
+	Username          string `json:"username,omitempty"`
+	ClientId          string `json:"client_id"`
+	IssueRefreshToken bool   `json:"issue_refresh_token"`
+	Scopes            string `json:"scopes,omitempty"`
 }
 
 type IdpCompleteLoginRequest struct {
-	ChallengeId   string `json:"challenge_id"`
-	ChallengeData string `json:"challenge_data"`
+	ChallengeId   string          `json:"challenge_id"`
+	ChallengeData string          `json:"challenge_data"`
+	Credential    json.RawMessage `json:"credential,omitempty"`
 }
 
 type IdpCompleteLoginResponse struct {
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func DELETE_clients_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientId := vars["id"]
+
+	index, _ := FindClientIndexById(clientId)
+	if index == -1 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Client not found"})
+		return
+	}
+
+	RemoveClientAt(index)
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Client deleted"})
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"net/http"
+)
+
+func DELETE_mail(w http.ResponseWriter, r *http.Request) {
+	AppContext.Mailbox = []MailMessage{}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Mailbox cleared"})
+}
@@ -0,0 +1,15 @@
+package main
+
+import "net/http"
+
+// DELETE_oauth2_register_id removes a registered client along with the tokens issued to it, see RFC 7592 section 2.3
+func DELETE_oauth2_register_id(w http.ResponseWriter, r *http.Request) {
+	index, client := findRegisteredClient(w, r)
+	if client == nil {
+		return
+	}
+
+	RemoveClientAt(index)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"net/http"
+)
+
+func DELETE_sms(w http.ResponseWriter, r *http.Request) {
+	AppContext.SmsInbox = []SmsMessage{}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "SMS inbox cleared"})
+}
@@ -16,9 +16,7 @@ func DELETE_users_id(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Remove user by swapping with last element and truncating
-	AppContext.Users[index] = AppContext.Users[len(AppContext.Users)-1]
-	AppContext.Users = AppContext.Users[:len(AppContext.Users)-1]
+	RemoveUserAt(index)
 
 	writeJSON(w, http.StatusOK, map[string]string{"message": "User deleted"})
 }
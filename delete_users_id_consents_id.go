@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func DELETE_users_id_consents_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+	clientId := vars["clientId"]
+
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	// Revoking the grant also revokes the client's refresh tokens for the user
+	if !revokeConsent(user, clientId) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Consent not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
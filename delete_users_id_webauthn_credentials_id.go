@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+func DELETE_users_id_webauthn_credentials_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+	credentialId := vars["credentialId"]
+
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	index := slices.IndexFunc(user.WebauthnCredentials, func(credential WebauthnCredential) bool {
+		return credential.Id == credentialId
+	})
+	if index < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Passkey not found"})
+		return
+	}
+
+	user.WebauthnCredentials = slices.Delete(user.WebauthnCredentials, index, index+1)
+	w.WriteHeader(http.StatusNoContent)
+}
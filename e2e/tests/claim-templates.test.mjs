@@ -0,0 +1,161 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+function decodePayload(token) {
+    const parts = token.split('.');
+    return JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+}
+
+describe('claim-templates', () => {
+
+    const client = new IdpClient('http://localhost:8088');
+
+    before(async () => {
+        await launchSnapshot('claim-templates');
+        await waitAvailable('http://localhost:8088');
+    });
+
+    after(async () => {
+        await teardownSnapshot('claim-templates');
+    });
+
+    async function login(username, password, scopes = 'openid profile email') {
+        const respInit = await client.loginInit({
+            username,
+            password,
+            client_id: 'client1',
+            scopes,
+        });
+        return await client.loginComplete({
+            challenge_id: respInit.challenge_id,
+            challenge_data: 'XXXXXX',
+        });
+    }
+
+    describe('Access token claims', () => {
+
+        it('Should keep plain attribute mappings working', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload).to.have.property('email', 'jane@example.com');
+        });
+
+        it('Should resolve nested attribute paths', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload).to.have.property('city', 'Budapest');
+        });
+
+        it('Should convert comma separated strings to lists', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload.roles).to.deep.equal(['admin', 'editor']);
+        });
+
+        it('Should include constant values', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload).to.have.property('tenant', 'acme');
+        });
+
+        it('Should render templates over client and scopes', async () => {
+            const respComplete = await login('jane', 'password1', 'openid profile');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload).to.have.property('aud_hint', 'client1:2');
+        });
+
+        it('Should convert values to booleans and integers', async () => {
+            const janeTokens = await login('jane', 'password1');
+            const janePayload = decodePayload(janeTokens.access_token);
+            expect(janePayload).to.have.property('is_admin', true);
+            expect(janePayload).to.have.property('level', 3);
+
+            const johnTokens = await login('john', 'password2');
+            const johnPayload = decodePayload(johnTokens.access_token);
+            expect(johnPayload).to.have.property('is_admin', false);
+            expect(johnPayload.roles).to.deep.equal(['viewer']);
+        });
+
+        it('Should omit claims for missing attributes', async () => {
+            const respComplete = await login('john', 'password2');
+            const payload = decodePayload(respComplete.access_token);
+            expect(payload).to.not.have.property('city');
+            expect(payload).to.not.have.property('level');
+        });
+    });
+
+    describe('Request parameter claims', () => {
+
+        it('Should expose request parameters but not secrets', async () => {
+            const login = await client.oauth2AuthorizeSubmit({
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+                response_type: 'code',
+                scope: 'openid',
+                username: 'jane',
+                password: 'password1',
+            });
+            const code = new URL(login.headers.get('location')).searchParams.get('code');
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code,
+                client_id: 'client1',
+                client_secret: 'super_secret',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+            const payload = decodePayload(tokens.access_token);
+            expect(payload).to.have.property('grant', 'authorization_code');
+            expect(payload).to.not.have.property('leaked_secret');
+            expect(payload).to.not.have.property('leaked_code');
+        });
+    });
+
+    describe('Identity token claims', () => {
+
+        it('Should concatenate attributes with templates', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.identity_token);
+            expect(payload).to.have.property('name', 'Jane Doe');
+        });
+
+        it('Should omit template claims referencing missing attributes', async () => {
+            const respComplete = await login('john', 'password2');
+            const payload = decodePayload(respComplete.identity_token);
+            expect(payload).to.not.have.property('name');
+        });
+
+        it('Should produce objects from JSON templates', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.identity_token);
+            expect(payload.address).to.deep.equal({ city: 'Budapest', country: 'HU' });
+        });
+
+        it('Should fall back with the default function', async () => {
+            const respComplete = await login('jane', 'password1');
+            const payload = decodePayload(respComplete.identity_token);
+            expect(payload).to.have.property('nickname', 'jane');
+        });
+    });
+
+    describe('UserInfo claims', () => {
+
+        it('GET /userinfo should return mapped claims only', async () => {
+            const respComplete = await login('jane', 'password1');
+            const userinfo = await client.getUserinfo(respComplete.access_token);
+
+            expect(userinfo).to.have.property('sub', '1');
+            expect(userinfo).to.have.property('email', 'jane@example.com');
+            expect(userinfo).to.have.property('name', 'Jane Doe');
+            expect(userinfo).to.have.property('scope_email', 'yes');
+            expect(userinfo).to.not.have.property('roles_csv');
+            expect(userinfo).to.not.have.property('given_name');
+        });
+
+        it('GET /userinfo should evaluate templates over the token scopes', async () => {
+            const respComplete = await login('jane', 'password1', 'openid profile');
+            const userinfo = await client.getUserinfo(respComplete.access_token);
+
+            expect(userinfo).to.not.have.property('scope_email');
+        });
+    });
+});
@@ -0,0 +1,163 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('client-admin', () => {
+
+    const baseUrl = 'http://localhost:8106';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('client-admin');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('client-admin');
+    });
+
+    function authorizePage(clientId, redirectUri) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams({ client_id: clientId, redirect_uri: redirectUri, response_type: 'code' })}`);
+    }
+
+    async function loginAndExchange(clientId, redirectUri, secret) {
+        const login = await client.oauth2AuthorizeSubmit({ client_id: clientId, redirect_uri: redirectUri, username: 'user1', password: 'password1' });
+        expect(login.status).to.equal(302);
+        const code = new URL(login.headers.get('location')).searchParams.get('code');
+        return await fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code, redirect_uri: redirectUri, client_id: clientId, client_secret: secret }),
+        });
+    }
+
+    it('Should list the configured clients without their secrets', async () => {
+        const { status, body } = await client.getClients();
+        expect(status).to.equal(200);
+        expect(body.map((c) => c.id)).to.include('client1');
+        expect(body.map((c) => c.id)).to.include('public1');
+        for (const c of body) {
+            expect(c).to.not.have.property('secret');
+        }
+    });
+
+    it('Should get a client without its secret', async () => {
+        const { status, body } = await client.getClientById('client1');
+        expect(status).to.equal(200);
+        expect(body).to.have.property('id', 'client1');
+        expect(body).to.have.property('redirect_uri', 'http://localhost:3000/callback');
+        expect(body).to.not.have.property('secret');
+    });
+
+    it('Should return 404 for an unknown client', async () => {
+        const get = await client.getClientById('unknown');
+        expect(get.status).to.equal(404);
+        expect(get.body).to.have.property('error', 'Client not found');
+
+        const del = await client.deleteClient('unknown');
+        expect(del.status).to.equal(404);
+
+        const rotate = await client.rotateClientSecret('unknown');
+        expect(rotate.status).to.equal(404);
+    });
+
+    it('Should create a client that can log in right away', async () => {
+        const { status, body } = await client.putClient('created1', {
+            secret: 'created_secret',
+            redirect_uri: 'http://localhost:4000/cb',
+            default_scopes: 'openid email',
+        });
+        expect(status).to.equal(201);
+        expect(body).to.have.property('id', 'created1');
+        expect(body).to.have.property('audience', 'created1');
+        expect(body).to.not.have.property('secret');
+
+        const response = await loginAndExchange('created1', 'http://localhost:4000/cb', 'created_secret');
+        expect(response.status).to.equal(200);
+        const tokens = await response.json();
+        const claims = JSON.parse(Buffer.from(tokens.access_token.split('.')[1], 'base64url').toString());
+        expect(claims).to.have.property('aud', 'created1');
+        expect(claims).to.have.property('scope', 'openid email');
+    });
+
+    it('Should apply a changed redirect URI to the authorize endpoint immediately', async () => {
+        expect((await authorizePage('client1', 'http://localhost:3000/new')).status).to.equal(400);
+
+        const { status, body } = await client.putClient('client1', { redirect_uris: ['http://localhost:3000/new'] });
+        expect(status).to.equal(200);
+        expect(body).to.have.property('redirect_uri', 'http://localhost:3000/callback');
+        expect(body.redirect_uris).to.deep.equal(['http://localhost:3000/new']);
+
+        expect((await authorizePage('client1', 'http://localhost:3000/new')).status).to.equal(200);
+        expect((await authorizePage('client1', 'http://localhost:3000/callback')).status).to.equal(200);
+    });
+
+    it('Should keep the secret when updating other fields', async () => {
+        await client.putClient('client1', { client_name: 'Renamed' });
+        const response = await loginAndExchange('client1', 'http://localhost:3000/callback', 'super_secret');
+        expect(response.status).to.equal(200);
+    });
+
+    it('Should rotate the secret', async () => {
+        const { status, body } = await client.rotateClientSecret('client1');
+        expect(status).to.equal(200);
+        expect(body).to.have.property('client_id', 'client1');
+        expect(body.secret).to.be.a('string');
+        expect(body.secret).to.not.equal('super_secret');
+
+        const oldSecret = await loginAndExchange('client1', 'http://localhost:3000/callback', 'super_secret');
+        expect(oldSecret.status).to.equal(401);
+
+        const newSecret = await loginAndExchange('client1', 'http://localhost:3000/callback', body.secret);
+        expect(newSecret.status).to.equal(200);
+    });
+
+    it('Should not rotate the secret of a public client', async () => {
+        const { status, body } = await client.rotateClientSecret('public1');
+        expect(status).to.equal(400);
+        expect(body.error).to.be.a('string');
+    });
+
+    describe('Validation', () => {
+
+        const invalid = [
+            ['no redirect URI', {}],
+            ['a relative redirect URI', { redirect_uri: '/callback' }],
+            ['an unknown auth method', { redirect_uri: 'http://localhost:4000/cb', token_endpoint_auth_method: 'tls_client_auth' }],
+            ['a secret method without a secret', { redirect_uri: 'http://localhost:4000/cb', token_endpoint_auth_method: 'client_secret_post' }],
+            ['private_key_jwt without keys', { redirect_uri: 'http://localhost:4000/cb', token_endpoint_auth_method: 'private_key_jwt' }],
+        ];
+
+        for (const [name, params] of invalid) {
+            it(`Should reject ${name}`, async () => {
+                const response = await client.putClient('invalid1', params);
+                expect(response.status).to.equal(400);
+                expect(response.body.error).to.be.a('string');
+                expect((await client.getClientById('invalid1')).status).to.equal(404);
+            });
+        }
+
+        it('Should leave the client unchanged when an update is invalid', async () => {
+            const response = await client.putClient('public1', { redirect_uris: ['http://localhost:3000/x#fragment'] });
+            expect(response.status).to.equal(400);
+            expect((await client.getClientById('public1')).body).to.not.have.property('redirect_uris');
+        });
+    });
+
+    it('Should delete a client and reject it afterwards', async () => {
+        const login = await client.oauth2AuthorizeSubmit({ client_id: 'created1', redirect_uri: 'http://localhost:4000/cb', username: 'user1', password: 'password1' });
+        const code = new URL(login.headers.get('location')).searchParams.get('code');
+
+        const { status, body } = await client.deleteClient('created1');
+        expect(status).to.equal(200);
+        expect(body).to.have.property('message', 'Client deleted');
+        expect((await client.getClientById('created1')).status).to.equal(404);
+
+        expect((await authorizePage('created1', 'http://localhost:4000/cb')).status).to.equal(400);
+        const token = await fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code, redirect_uri: 'http://localhost:4000/cb', client_id: 'created1', client_secret: 'created_secret' }),
+        });
+        expect(token.status).to.equal(401);
+    });
+});
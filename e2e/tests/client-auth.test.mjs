@@ -0,0 +1,262 @@
+import { expect } from 'chai';
+import crypto from 'crypto';
+import { IdpClient, launchSnapshot, signJwt, startWebhookServer, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('client-auth', () => {
+
+    const baseUrl = 'http://localhost:8104';
+    const tokenEndpoint = `${baseUrl}/oauth2/token`;
+    const client = new IdpClient(baseUrl);
+    const redirectUri = 'http://localhost:3000/callback';
+
+    // Private key of the EC key configured for pk-client
+    const pkClientKey = crypto.createPrivateKey({
+        format: 'jwk',
+        key: {
+            kty: 'EC',
+            crv: 'P-256',
+            x: 'AjIkOQ4aPWPn_kML9UHr7QHTkLpojgE_MXc_-TKcZEA',
+            y: 'HnKv3Z6658xSDLI5KPuiojyv624HqO0PWdyD-g0bPlg',
+            d: '6JysuFa9p5dmQYCUKsDKs-dWeB-6AZR4q7gmxNMvjOw',
+        },
+    });
+
+    // jwks-uri-client publishes this key at its JWKS URI
+    const rsaKeys = crypto.generateKeyPairSync('rsa', { modulusLength: 2048 });
+    const publishedKeys = [{ ...rsaKeys.publicKey.export({ format: 'jwk' }), kid: 'rsa-key-1', use: 'sig' }];
+    let jwksServer;
+
+    before(async () => {
+        jwksServer = await startWebhookServer(9091, () => ({
+            body: { keys: publishedKeys },
+        }));
+        await launchSnapshot('client-auth');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('client-auth');
+        await jwksServer.close();
+    });
+
+    async function authorizationCode(clientId) {
+        const response = await client.oauth2AuthorizeSubmit({ client_id: clientId, redirect_uri: redirectUri, username: 'user1', password: 'password1' });
+        expect(response.status).to.equal(302);
+        return new URL(response.headers.get('location')).searchParams.get('code');
+    }
+
+    async function token(clientId, params = {}, headers = {}) {
+        const code = await authorizationCode(clientId);
+        return await fetch(tokenEndpoint, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded', ...headers },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code, redirect_uri: redirectUri, ...params }),
+        });
+    }
+
+    function basic(id, secret) {
+        return { 'Authorization': `Basic ${Buffer.from(`${encodeURIComponent(id)}:${encodeURIComponent(secret)}`).toString('base64')}` };
+    }
+
+    function assertionClaims(clientId, overrides = {}) {
+        const now = Math.floor(Date.now() / 1000);
+        return { iss: clientId, sub: clientId, aud: tokenEndpoint, jti: crypto.randomUUID(), iat: now, exp: now + 60, ...overrides };
+    }
+
+    function assertionParams(assertion) {
+        return { client_assertion_type: 'urn:ietf:params:oauth:client-assertion-type:jwt-bearer', client_assertion: assertion };
+    }
+
+    async function expectSuccess(response) {
+        expect(response.status).to.equal(200);
+        expect(await response.json()).to.have.property('access_token');
+    }
+
+    async function expectError(response, status, error, description) {
+        expect(response.status).to.equal(status);
+        const body = await response.json();
+        expect(body).to.have.property('error', error);
+        if (description) {
+            expect(body.error_description).to.include(description);
+        }
+    }
+
+    it('Should advertise the supported auth methods in discovery', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config.token_endpoint_auth_methods_supported).to.deep.equal(['client_secret_basic', 'client_secret_post', 'client_secret_jwt', 'private_key_jwt', 'none']);
+        expect(config.token_endpoint_auth_signing_alg_values_supported).to.include('HS256');
+        expect(config.token_endpoint_auth_signing_alg_values_supported).to.include('RS256');
+        expect(config.token_endpoint_auth_signing_alg_values_supported).to.include('ES256');
+    });
+
+    describe('client_secret_basic', () => {
+
+        it('Should accept the form-encoded credentials in the Authorization header', async () => {
+            await expectSuccess(await token('basic-client', {}, basic('basic-client', 'basic:secret/with+chars')));
+        });
+
+        it('Should reject a wrong secret', async () => {
+            const response = await token('basic-client', {}, basic('basic-client', 'wrong'));
+            expect(response.headers.get('www-authenticate')).to.include('Basic');
+            await expectError(response, 401, 'invalid_client', 'Invalid client credentials');
+        });
+
+        it('Should reject the secret in the form', async () => {
+            await expectError(await token('basic-client', { client_id: 'basic-client', client_secret: 'basic:secret/with+chars' }), 401, 'invalid_client', 'not allowed');
+        });
+
+        it('Should reject a client_id that does not match the header', async () => {
+            await expectError(await token('basic-client', { client_id: 'post-client' }, basic('basic-client', 'basic:secret/with+chars')), 401, 'invalid_client');
+        });
+
+        it('Should reject more than one authentication method', async () => {
+            await expectError(await token('basic-client', { client_secret: 'basic:secret/with+chars' }, basic('basic-client', 'basic:secret/with+chars')), 400, 'invalid_request');
+        });
+    });
+
+    describe('client_secret_post', () => {
+
+        it('Should accept the secret in the form', async () => {
+            await expectSuccess(await token('post-client', { client_id: 'post-client', client_secret: 'post-secret' }));
+        });
+
+        it('Should reject the Authorization header', async () => {
+            await expectError(await token('post-client', {}, basic('post-client', 'post-secret')), 401, 'invalid_client', 'not allowed');
+        });
+    });
+
+    describe('Clients without a registered method', () => {
+
+        it('Should accept the secret in the form or the Authorization header', async () => {
+            await expectSuccess(await token('legacy-client', { client_id: 'legacy-client', client_secret: 'legacy-secret' }));
+            await expectSuccess(await token('legacy-client', {}, basic('legacy-client', 'legacy-secret')));
+        });
+
+        it('Should require the secret', async () => {
+            await expectError(await token('legacy-client', { client_id: 'legacy-client' }), 401, 'invalid_client');
+        });
+    });
+
+    describe('none', () => {
+
+        it('Should accept a public client by its client_id', async () => {
+            await expectSuccess(await token('public-client', { client_id: 'public-client' }));
+        });
+
+        it('Should reject a public client sending a secret', async () => {
+            await expectError(await token('public-client', { client_id: 'public-client', client_secret: 'anything' }), 401, 'invalid_client');
+        });
+
+        it('Should require a client_id', async () => {
+            await expectError(await token('public-client'), 401, 'invalid_client', 'Client authentication is required');
+        });
+    });
+
+    describe('client_secret_jwt', () => {
+
+        const secret = 'jwt-client-secret-with-at-least-32-bytes';
+
+        it('Should accept an assertion signed with the client secret', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client'), { alg: 'HS256', key: secret });
+            await expectSuccess(await token('jwt-client', assertionParams(assertion)));
+        });
+
+        it('Should accept the issuer as audience', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client', { aud: baseUrl }), { alg: 'HS512', key: secret });
+            await expectSuccess(await token('jwt-client', { client_id: 'jwt-client', ...assertionParams(assertion) }));
+        });
+
+        it('Should reject a replayed assertion', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client'), { alg: 'HS256', key: secret });
+            await expectSuccess(await token('jwt-client', assertionParams(assertion)));
+            await expectError(await token('jwt-client', assertionParams(assertion)), 401, 'invalid_client', 'already used');
+        });
+
+        it('Should reject an assertion signed with another secret', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client'), { alg: 'HS256', key: 'another-secret-with-at-least-32-bytes' });
+            await expectError(await token('jwt-client', assertionParams(assertion)), 401, 'invalid_client', 'Invalid client assertion');
+        });
+
+        it('Should reject another audience', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client', { aud: 'https://example.com/token' }), { alg: 'HS256', key: secret });
+            await expectError(await token('jwt-client', assertionParams(assertion)), 401, 'invalid_client', 'aud');
+        });
+
+        it('Should reject an expired assertion', async () => {
+            const now = Math.floor(Date.now() / 1000);
+            const assertion = signJwt(assertionClaims('jwt-client', { iat: now - 600, exp: now - 300 }), { alg: 'HS256', key: secret });
+            await expectError(await token('jwt-client', assertionParams(assertion)), 401, 'invalid_client', 'expired');
+        });
+
+        it('Should reject an assertion without jti', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client', { jti: undefined }), { alg: 'HS256', key: secret });
+            await expectError(await token('jwt-client', assertionParams(assertion)), 401, 'invalid_client', 'jti');
+        });
+
+        it('Should reject a wrong client_assertion_type', async () => {
+            const assertion = signJwt(assertionClaims('jwt-client'), { alg: 'HS256', key: secret });
+            await expectError(await token('jwt-client', { ...assertionParams(assertion), client_assertion_type: 'jwt' }), 400, 'invalid_request');
+        });
+
+        it('Should reject the client secret in the form', async () => {
+            await expectError(await token('jwt-client', { client_id: 'jwt-client', client_secret: secret }), 401, 'invalid_client', 'not allowed');
+        });
+    });
+
+    describe('private_key_jwt', () => {
+
+        it('Should accept an assertion signed with a key of the registered JWKS', async () => {
+            const assertion = signJwt(assertionClaims('pk-client'), { alg: 'ES256', key: pkClientKey, kid: 'pk-key-1' });
+            await expectSuccess(await token('pk-client', assertionParams(assertion)));
+        });
+
+        it('Should find the key without a kid', async () => {
+            const assertion = signJwt(assertionClaims('pk-client'), { alg: 'ES256', key: pkClientKey });
+            await expectSuccess(await token('pk-client', assertionParams(assertion)));
+        });
+
+        it('Should reject an assertion signed with another key', async () => {
+            const { privateKey } = crypto.generateKeyPairSync('ec', { namedCurve: 'P-256' });
+            const assertion = signJwt(assertionClaims('pk-client'), { alg: 'ES256', key: privateKey, kid: 'pk-key-1' });
+            await expectError(await token('pk-client', assertionParams(assertion)), 401, 'invalid_client', 'Invalid client assertion');
+        });
+
+        it('Should reject an assertion signed with the client secret algorithm', async () => {
+            const assertion = signJwt(assertionClaims('pk-client'), { alg: 'HS256', key: 'some-secret-with-at-least-32-bytes' });
+            await expectError(await token('pk-client', assertionParams(assertion)), 401, 'invalid_client', 'not allowed');
+        });
+
+        it('Should reject an assertion for another client', async () => {
+            const assertion = signJwt(assertionClaims('pk-client', { iss: 'jwks-uri-client' }), { alg: 'ES256', key: pkClientKey, kid: 'pk-key-1' });
+            await expectError(await token('pk-client', assertionParams(assertion)), 401, 'invalid_client', 'Invalid client assertion');
+        });
+
+        it('Should fetch the keys from the JWKS URI', async () => {
+            const assertion = signJwt(assertionClaims('jwks-uri-client'), { alg: 'RS256', key: rsaKeys.privateKey, kid: 'rsa-key-1' });
+            await expectSuccess(await token('jwks-uri-client', assertionParams(assertion)));
+            expect(jwksServer.events.map((e) => e.path)).to.include('/jwks.json');
+        });
+
+        it('Should cache the keys of the JWKS URI', async () => {
+            const fetched = jwksServer.events.length;
+            const assertion = signJwt(assertionClaims('jwks-uri-client'), { alg: 'RS256', key: rsaKeys.privateKey, kid: 'rsa-key-1' });
+            await expectSuccess(await token('jwks-uri-client', assertionParams(assertion)));
+            expect(jwksServer.events).to.have.lengthOf(fetched);
+        });
+
+        it('Should fetch the JWKS again for a new kid', async () => {
+            const rotatedKeys = crypto.generateKeyPairSync('rsa', { modulusLength: 2048 });
+            publishedKeys.push({ ...rotatedKeys.publicKey.export({ format: 'jwk' }), kid: 'rsa-key-2', use: 'sig' });
+
+            const fetched = jwksServer.events.length;
+            const assertion = signJwt(assertionClaims('jwks-uri-client'), { alg: 'RS256', key: rotatedKeys.privateKey, kid: 'rsa-key-2' });
+            await expectSuccess(await token('jwks-uri-client', assertionParams(assertion)));
+            expect(jwksServer.events).to.have.lengthOf(fetched + 1);
+        });
+
+        it('Should reject an unknown kid', async () => {
+            const assertion = signJwt(assertionClaims('jwks-uri-client'), { alg: 'RS256', key: rsaKeys.privateKey, kid: 'unknown' });
+            await expectError(await token('jwks-uri-client', assertionParams(assertion)), 401, 'invalid_client', 'No matching key');
+        });
+    });
+});
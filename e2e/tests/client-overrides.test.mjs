@@ -0,0 +1,146 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+function decodePayload(token) {
+    const parts = token.split('.');
+    return JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+}
+
+describe('client-overrides', () => {
+
+    const client = new IdpClient('http://localhost:8087');
+
+    before(async () => {
+        await launchSnapshot('client-overrides');
+        await waitAvailable('http://localhost:8087');
+    });
+
+    after(async () => {
+        await teardownSnapshot('client-overrides');
+    });
+
+    async function loginApi(clientId, extra = {}) {
+        const respInit = await client.loginInit({
+            username: 'user1',
+            password: 'password1',
+            client_id: clientId,
+            scopes: '',
+            ...extra,
+        });
+        return await client.loginComplete({
+            challenge_id: respInit.challenge_id,
+            challenge_data: 'XXXXXX',
+        });
+    }
+
+    describe('Clients without overrides', () => {
+
+        it('Should use global claim mappings, lifetimes and default scopes', async () => {
+            const respComplete = await loginApi('web-client');
+
+            const accessPayload = decodePayload(respComplete.access_token);
+            expect(accessPayload).to.have.property('roles', 'admin');
+            expect(accessPayload).to.not.have.property('device');
+            expect(accessPayload).to.have.property('scope', 'openid profile');
+            expect(accessPayload.exp - accessPayload.iat).to.equal(900);
+
+            const idPayload = decodePayload(respComplete.identity_token);
+            expect(idPayload).to.have.property('email', 'user1@example.com');
+            expect(idPayload).to.not.have.property('name');
+            expect(idPayload.exp - idPayload.iat).to.equal(900);
+        });
+    });
+
+    describe('Clients with overrides', () => {
+
+        it('Should use the client access token claim mapping', async () => {
+            const respComplete = await loginApi('mobile-client');
+
+            const accessPayload = decodePayload(respComplete.access_token);
+            expect(accessPayload).to.have.property('device', 'device-123');
+            expect(accessPayload).to.not.have.property('roles');
+        });
+
+        it('Should use the client identity token claim mapping', async () => {
+            const respComplete = await loginApi('mobile-client');
+
+            const idPayload = decodePayload(respComplete.identity_token);
+            expect(idPayload).to.have.property('name', 'User One');
+            expect(idPayload).to.have.property('roles', 'admin');
+            expect(idPayload).to.not.have.property('email');
+        });
+
+        it('Should use the client token lifetimes', async () => {
+            const respComplete = await loginApi('mobile-client');
+
+            const accessPayload = decodePayload(respComplete.access_token);
+            expect(accessPayload.exp - accessPayload.iat).to.equal(3600);
+
+            const idPayload = decodePayload(respComplete.identity_token);
+            expect(idPayload.exp - idPayload.iat).to.equal(7200);
+        });
+
+        it('Should use the client default scopes', async () => {
+            const respComplete = await loginApi('mobile-client');
+
+            const accessPayload = decodePayload(respComplete.access_token);
+            expect(accessPayload).to.have.property('scope', 'openid profile offline_access');
+        });
+
+        it('Explicit scopes should take precedence over client default scopes', async () => {
+            const respComplete = await loginApi('mobile-client', { scopes: 'openid' });
+
+            const accessPayload = decodePayload(respComplete.access_token);
+            expect(accessPayload).to.have.property('scope', 'openid');
+        });
+
+        it('Should use the client refresh token lifetime', async () => {
+            const respComplete = await loginApi('mobile-client', { issue_refresh_token: true });
+            expect(respComplete).to.have.property('refresh_token');
+
+            // Refresh token should work immediately
+            const respRefresh = await client.loginRefresh({
+                refresh_token: respComplete.refresh_token,
+            });
+            expect(respRefresh).to.have.property('refresh_token');
+
+            // Wait for the 2 second client refresh token lifetime to pass
+            await new Promise(resolve => setTimeout(resolve, 3000));
+
+            try {
+                await client.loginRefresh({
+                    refresh_token: respRefresh.refresh_token,
+                });
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('401');
+            }
+        });
+
+        it('OAuth2 token response should reflect the client access token lifetime', async () => {
+            const authResponse = await client.oauth2AuthorizeSubmit({
+                username: 'user1',
+                password: 'password1',
+                client_id: 'mobile-client',
+                redirect_uri: 'myapp://callback',
+            });
+            const location = authResponse.headers.get('location');
+            const url = new URL(location);
+            const code = url.searchParams.get('code');
+
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: code,
+                client_id: 'mobile-client',
+                client_secret: 'mobile_secret',
+                redirect_uri: 'myapp://callback',
+            });
+
+            expect(tokens).to.have.property('expires_in', 3600);
+
+            const accessPayload = decodePayload(tokens.access_token);
+            expect(accessPayload).to.have.property('device', 'device-123');
+            expect(accessPayload).to.have.property('scope', 'openid profile offline_access');
+        });
+    });
+});
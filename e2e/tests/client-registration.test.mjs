@@ -0,0 +1,210 @@
+import { expect } from 'chai';
+import crypto from 'crypto';
+import { IdpClient, launchSnapshot, signJwt, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('client-registration', () => {
+
+    const baseUrl = 'http://localhost:8105';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('client-registration');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('client-registration');
+    });
+
+    function register(metadata, token = 'initial-token') {
+        return client.registerClient(metadata, token);
+    }
+
+    async function loginAndExchange(clientId, redirectUri, credentials) {
+        const login = await client.oauth2AuthorizeSubmit({ client_id: clientId, redirect_uri: redirectUri, username: 'user1', password: 'password1' });
+        expect(login.status).to.equal(302);
+        const code = new URL(login.headers.get('location')).searchParams.get('code');
+        return await fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded', ...credentials.headers },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code, redirect_uri: redirectUri, ...credentials.params }),
+        });
+    }
+
+    it('Should advertise the registration endpoint', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config).to.have.property('registration_endpoint', `${baseUrl}/oauth2/register`);
+    });
+
+    it('Should require the initial access token', async () => {
+        const missing = await register({ redirect_uris: ['http://localhost:4000/cb'] }, null);
+        expect(missing.status).to.equal(401);
+        expect(missing.body).to.have.property('error', 'invalid_token');
+
+        const wrong = await register({ redirect_uris: ['http://localhost:4000/cb'] }, 'wrong');
+        expect(wrong.status).to.equal(401);
+    });
+
+    it('Should register a confidential client with the default metadata', async () => {
+        const response = await register({ redirect_uris: ['http://localhost:4000/cb', 'http://localhost:4000/other'], client_name: 'Test App', scope: 'openid email' });
+        expect(response.status).to.equal(201);
+        expect(response.body.client_id).to.be.a('string');
+        expect(response.body.client_secret).to.be.a('string');
+        expect(response.body.client_secret_expires_at).to.equal(0);
+        expect(response.body.client_id_issued_at).to.be.a('number');
+        expect(response.body.registration_access_token).to.be.a('string');
+        expect(response.body.registration_client_uri).to.equal(`${baseUrl}/oauth2/register/${response.body.client_id}`);
+        expect(response.body.token_endpoint_auth_method).to.equal('client_secret_basic');
+        expect(response.body.grant_types).to.deep.equal(['authorization_code']);
+        expect(response.body.response_types).to.deep.equal(['code']);
+        expect(response.body.client_name).to.equal('Test App');
+        expect(response.body.redirect_uris).to.deep.equal(['http://localhost:4000/cb', 'http://localhost:4000/other']);
+    });
+
+    it('Should log in to a registered client with any of its redirect URIs', async () => {
+        const { body } = await register({ redirect_uris: ['http://localhost:4000/cb', 'http://localhost:4000/other'], scope: 'openid email' });
+        const basic = { headers: { 'Authorization': `Basic ${Buffer.from(`${body.client_id}:${body.client_secret}`).toString('base64')}` } };
+
+        for (const redirectUri of body.redirect_uris) {
+            const response = await loginAndExchange(body.client_id, redirectUri, basic);
+            expect(response.status).to.equal(200);
+            const tokens = await response.json();
+            const claims = JSON.parse(Buffer.from(tokens.access_token.split('.')[1], 'base64url').toString());
+            expect(claims).to.have.property('aud', body.client_id);
+            expect(claims).to.have.property('scope', 'openid email');
+        }
+
+        const page = await fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams({ client_id: body.client_id, redirect_uri: 'http://localhost:4000/unregistered', response_type: 'code' })}`);
+        expect(page.status).to.equal(400);
+    });
+
+    it('Should register a public client without a secret', async () => {
+        const { status, body } = await register({ redirect_uris: ['http://localhost:4000/cb'], token_endpoint_auth_method: 'none' });
+        expect(status).to.equal(201);
+        expect(body).to.not.have.property('client_secret');
+
+        const response = await loginAndExchange(body.client_id, 'http://localhost:4000/cb', { params: { client_id: body.client_id } });
+        expect(response.status).to.equal(200);
+    });
+
+    it('Should register a private_key_jwt client with its JWKS', async () => {
+        const { privateKey, publicKey } = crypto.generateKeyPairSync('ec', { namedCurve: 'P-256' });
+        const { status, body } = await register({
+            redirect_uris: ['http://localhost:4000/cb'],
+            token_endpoint_auth_method: 'private_key_jwt',
+            jwks: { keys: [{ ...publicKey.export({ format: 'jwk' }), kid: 'k1' }] },
+        });
+        expect(status).to.equal(201);
+        expect(body).to.not.have.property('client_secret');
+
+        const now = Math.floor(Date.now() / 1000);
+        const assertion = signJwt({ iss: body.client_id, sub: body.client_id, aud: `${baseUrl}/oauth2/token`, jti: crypto.randomUUID(), exp: now + 60 }, { alg: 'ES256', key: privateKey, kid: 'k1' });
+        const response = await loginAndExchange(body.client_id, 'http://localhost:4000/cb', {
+            params: { client_assertion_type: 'urn:ietf:params:oauth:client-assertion-type:jwt-bearer', client_assertion: assertion },
+        });
+        expect(response.status).to.equal(200);
+    });
+
+    describe('Metadata validation', () => {
+
+        const invalid = [
+            ['no redirect URIs', { redirect_uris: [] }, 'invalid_redirect_uri'],
+            ['a relative redirect URI', { redirect_uris: ['/callback'] }, 'invalid_redirect_uri'],
+            ['a redirect URI with a fragment', { redirect_uris: ['http://localhost:4000/cb#x'] }, 'invalid_redirect_uri'],
+            ['a javascript redirect URI', { redirect_uris: ['javascript://localhost/%0aalert(1)'] }, 'invalid_redirect_uri'],
+            ['a data redirect URI', { redirect_uris: ['data:text/html,<script>alert(1)</script>'] }, 'invalid_redirect_uri'],
+            ['an opaque redirect URI', { redirect_uris: ['mailto:someone@example.com'] }, 'invalid_redirect_uri'],
+            ['an unknown auth method', { token_endpoint_auth_method: 'tls_client_auth' }, 'invalid_client_metadata'],
+            ['an unsupported grant type', { grant_types: ['password'] }, 'invalid_client_metadata'],
+            ['an unsupported response type', { response_types: ['code device'] }, 'invalid_client_metadata'],
+            ['an implicit response type without the implicit grant', { response_types: ['id_token'] }, 'invalid_client_metadata'],
+            ['private_key_jwt without keys', { token_endpoint_auth_method: 'private_key_jwt' }, 'invalid_client_metadata'],
+            ['jwks and jwks_uri', { token_endpoint_auth_method: 'private_key_jwt', jwks: { keys: [] }, jwks_uri: 'http://localhost:4000/jwks' }, 'invalid_client_metadata'],
+            ['an invalid key', { jwks: { keys: [{ kty: 'EC', crv: 'P-192', x: 'AA', y: 'AA' }] } }, 'invalid_client_metadata'],
+            ['a relative request URI', { request_uris: ['/request.jwt'] }, 'invalid_client_metadata'],
+        ];
+
+        for (const [name, metadata, error] of invalid) {
+            it(`Should reject ${name}`, async () => {
+                const response = await register({ redirect_uris: ['http://localhost:4000/cb'], ...metadata });
+                expect(response.status).to.equal(400);
+                expect(response.body).to.have.property('error', error);
+                expect(response.body.error_description).to.be.a('string');
+            });
+        }
+    });
+
+    describe('Client configuration endpoint', () => {
+
+        let registration;
+
+        before(async () => {
+            registration = (await register({ redirect_uris: ['http://localhost:4000/cb'], client_name: 'Managed App' })).body;
+        });
+
+        it('Should read the registration with the registration access token', async () => {
+            const response = await client.getRegisteredClient(registration.client_id, registration.registration_access_token);
+            expect(response.status).to.equal(200);
+            expect(response.body).to.deep.equal(registration);
+        });
+
+        it('Should reject a wrong registration access token', async () => {
+            const response = await client.getRegisteredClient(registration.client_id, 'wrong');
+            expect(response.status).to.equal(401);
+            expect(response.body).to.have.property('error', 'invalid_token');
+        });
+
+        it('Should not manage configured clients', async () => {
+            const response = await client.getRegisteredClient('client1', registration.registration_access_token);
+            expect(response.status).to.equal(401);
+        });
+
+        it('Should update the metadata', async () => {
+            const response = await client.updateRegisteredClient(registration.client_id, registration.registration_access_token, {
+                client_id: registration.client_id,
+                client_secret: registration.client_secret,
+                redirect_uris: ['http://localhost:5000/cb'],
+                client_name: 'Renamed App',
+                token_endpoint_auth_method: 'client_secret_post',
+            });
+            expect(response.status).to.equal(200);
+            expect(response.body).to.have.property('client_name', 'Renamed App');
+            expect(response.body).to.have.property('client_secret', registration.client_secret);
+            expect(response.body.redirect_uris).to.deep.equal(['http://localhost:5000/cb']);
+
+            const token = await loginAndExchange(registration.client_id, 'http://localhost:5000/cb', {
+                params: { client_id: registration.client_id, client_secret: registration.client_secret },
+            });
+            expect(token.status).to.equal(200);
+        });
+
+        it('Should reject an update for another client_id', async () => {
+            const response = await client.updateRegisteredClient(registration.client_id, registration.registration_access_token, {
+                client_id: 'client1',
+                redirect_uris: ['http://localhost:5000/cb'],
+            });
+            expect(response.status).to.equal(400);
+            expect(response.body).to.have.property('error', 'invalid_request');
+        });
+
+        it('Should reject invalid metadata on update', async () => {
+            const response = await client.updateRegisteredClient(registration.client_id, registration.registration_access_token, {
+                client_id: registration.client_id,
+                redirect_uris: [],
+            });
+            expect(response.status).to.equal(400);
+            expect(response.body).to.have.property('error', 'invalid_redirect_uri');
+        });
+
+        it('Should delete the client', async () => {
+            const response = await client.deleteRegisteredClient(registration.client_id, registration.registration_access_token);
+            expect(response.status).to.equal(204);
+
+            const again = await client.getRegisteredClient(registration.client_id, registration.registration_access_token);
+            expect(again.status).to.equal(401);
+
+            const page = await fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams({ client_id: registration.client_id, redirect_uri: 'http://localhost:5000/cb', response_type: 'code' })}`);
+            expect(page.status).to.equal(400);
+        });
+    });
+});
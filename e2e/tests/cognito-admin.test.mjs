@@ -0,0 +1,309 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+function decodePayload(token) {
+    const parts = token.split('.');
+    return JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+}
+
+describe('cognito-admin', () => {
+
+    const baseUrl = 'http://localhost:8093';
+    const client = new IdpClient(baseUrl);
+    const UserPoolId = 'local_pool';
+
+    before(async () => {
+        await launchSnapshot('cognito-admin');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('cognito-admin');
+    });
+
+    async function passwordAuth(username, password) {
+        return await client.cognito('InitiateAuth', {
+            AuthFlow: 'USER_PASSWORD_AUTH',
+            ClientId: 'client1',
+            AuthParameters: { USERNAME: username, PASSWORD: password },
+        });
+    }
+
+    describe('AdminGetUser', () => {
+
+        it('Should return the user', async () => {
+            const result = await client.cognito('AdminGetUser', { UserPoolId, Username: 'alice' });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('Username', 'alice');
+            expect(result.body).to.have.property('Enabled', true);
+            expect(result.body).to.have.property('UserStatus', 'CONFIRMED');
+            expect(result.body.UserAttributes).to.deep.include({ Name: 'sub', Value: '1' });
+            expect(result.body.UserAttributes).to.deep.include({ Name: 'email_verified', Value: 'true' });
+        });
+
+        it('Should find users by sub', async () => {
+            const result = await client.cognito('AdminGetUser', { UserPoolId, Username: '2' });
+            expect(result.body).to.have.property('Username', 'bob');
+        });
+
+        it('Should return UserNotFoundException for unknown users', async () => {
+            const result = await client.cognito('AdminGetUser', { UserPoolId, Username: 'nobody' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'UserNotFoundException');
+        });
+    });
+
+    describe('AdminCreateUser and AdminDeleteUser', () => {
+
+        // Keep the users listed by the later tests
+        after(async () => {
+            for (const Username of ['frank', 'grace']) {
+                await client.cognito('AdminDeleteUser', { UserPoolId, Username });
+            }
+        });
+
+        it('Should create a user', async () => {
+            const result = await client.cognito('AdminCreateUser', {
+                UserPoolId,
+                Username: 'dave',
+                TemporaryPassword: 'temp-password',
+                UserAttributes: [
+                    { Name: 'email', Value: 'dave@example.com' },
+                    { Name: 'email_verified', Value: 'true' },
+                ],
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body.User).to.have.property('Username', 'dave');
+            expect(result.body.User).to.have.property('Enabled', true);
+            expect(result.body.User).to.have.property('UserStatus', 'FORCE_CHANGE_PASSWORD');
+
+            const sub = result.body.User.Attributes.find(a => a.Name === 'sub');
+            expect(sub).to.exist;
+
+            const user = await client.getUserById(sub.Value);
+            expect(user.username).to.equal('dave');
+            expect(user.attributes).to.have.property('email_verified', true);
+
+            const login = await passwordAuth('dave', 'temp-password');
+            expect(login.status).to.equal(200);
+            expect(login.body).to.have.property('ChallengeName', 'NEW_PASSWORD_REQUIRED');
+        });
+
+        it('Should reject existing usernames', async () => {
+            const result = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'alice' });
+            expect(result.body).to.have.property('__type', 'UsernameExistsException');
+        });
+
+        it('Should reject setting sub', async () => {
+            const result = await client.cognito('AdminCreateUser', {
+                UserPoolId,
+                Username: 'eve',
+                UserAttributes: [{ Name: 'sub', Value: 'x' }],
+            });
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+        });
+
+        it('Should email the invitation with a generated temporary password', async () => {
+            const result = await client.cognito('AdminCreateUser', {
+                UserPoolId,
+                Username: 'frank',
+                UserAttributes: [{ Name: 'email', Value: 'frank@example.com' }],
+            });
+            expect(result.status).to.equal(200);
+
+            const mail = await client.getMail('frank@example.com');
+            expect(mail).to.have.lengthOf(1);
+            const password = mail[0].body.match(/temporary password is (\S+)/)[1];
+            const login = await passwordAuth('frank', password);
+            expect(login.body).to.have.property('ChallengeName', 'NEW_PASSWORD_REQUIRED');
+        });
+
+        it('Should resend the invitation with a new temporary password', async () => {
+            const first = (await client.getMail('frank@example.com'))[0].body.match(/temporary password is (\S+)/)[1];
+            const result = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'frank', MessageAction: 'RESEND' });
+            expect(result.status).to.equal(200);
+            expect(result.body.User).to.have.property('UserStatus', 'FORCE_CHANGE_PASSWORD');
+
+            const mail = await client.getMail('frank@example.com');
+            expect(mail).to.have.lengthOf(2);
+            const password = mail[1].body.match(/temporary password is (\S+)/)[1];
+            expect(password).to.not.equal(first);
+            expect((await passwordAuth('frank', first)).body).to.have.property('__type', 'NotAuthorizedException');
+            expect((await passwordAuth('frank', password)).body).to.have.property('ChallengeName', 'NEW_PASSWORD_REQUIRED');
+        });
+
+        it('Should not resend the invitation to users who changed their password', async () => {
+            const result = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'alice', MessageAction: 'RESEND' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'UnsupportedUserStateException');
+
+            const unknown = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'nobody', MessageAction: 'RESEND' });
+            expect(unknown.body).to.have.property('__type', 'UserNotFoundException');
+        });
+
+        it('Should not send the invitation with MessageAction SUPPRESS', async () => {
+            const result = await client.cognito('AdminCreateUser', {
+                UserPoolId,
+                Username: 'grace',
+                TemporaryPassword: 'temp-password',
+                MessageAction: 'SUPPRESS',
+                UserAttributes: [{ Name: 'email', Value: 'grace@example.com' }],
+            });
+            expect(result.status).to.equal(200);
+            expect(await client.getMail('grace@example.com')).to.have.lengthOf(0);
+        });
+
+        it('Should reject users the invitation cannot be sent to', async () => {
+            const result = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'heidi' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+
+            const invalid = await client.cognito('AdminCreateUser', { UserPoolId, Username: 'heidi', MessageAction: 'OTHER' });
+            expect(invalid.body).to.have.property('__type', 'InvalidParameterException');
+
+            const get = await client.cognito('AdminGetUser', { UserPoolId, Username: 'heidi' });
+            expect(get.body).to.have.property('__type', 'UserNotFoundException');
+        });
+
+        it('Should delete a user', async () => {
+            const result = await client.cognito('AdminDeleteUser', { UserPoolId, Username: 'dave' });
+            expect(result.status).to.equal(200);
+
+            const get = await client.cognito('AdminGetUser', { UserPoolId, Username: 'dave' });
+            expect(get.body).to.have.property('__type', 'UserNotFoundException');
+        });
+    });
+
+    describe('Attributes, passwords and status', () => {
+
+        it('AdminUpdateUserAttributes should update attributes', async () => {
+            const result = await client.cognito('AdminUpdateUserAttributes', {
+                UserPoolId,
+                Username: 'bob',
+                UserAttributes: [{ Name: 'name', Value: 'Robert' }, { Name: 'custom:team', Value: 'blue' }],
+            });
+            expect(result.status).to.equal(200);
+
+            const user = await client.getUserById('2');
+            expect(user.attributes).to.have.property('name', 'Robert');
+            expect(user.attributes).to.have.property('custom:team', 'blue');
+            expect(user.attributes).to.have.property('email', 'bob@example.org');
+        });
+
+        it('AdminDeleteUserAttributes should remove attributes', async () => {
+            await client.cognito('AdminDeleteUserAttributes', {
+                UserPoolId,
+                Username: 'bob',
+                UserAttributeNames: ['custom:team'],
+            });
+            const user = await client.getUserById('2');
+            expect(user.attributes).to.not.have.property('custom:team');
+        });
+
+        it('AdminSetUserPassword should change the password', async () => {
+            const result = await client.cognito('AdminSetUserPassword', {
+                UserPoolId,
+                Username: 'carol',
+                Password: 'new-password',
+                Permanent: true,
+            });
+            expect(result.status).to.equal(200);
+
+            expect((await passwordAuth('carol', 'password3')).body).to.have.property('__type', 'NotAuthorizedException');
+            expect((await passwordAuth('carol', 'new-password')).status).to.equal(200);
+        });
+
+        it('AdminDisableUser and AdminEnableUser should toggle the user', async () => {
+            await client.cognito('AdminDisableUser', { UserPoolId, Username: 'carol' });
+            const disabled = await client.cognito('AdminGetUser', { UserPoolId, Username: 'carol' });
+            expect(disabled.body).to.have.property('Enabled', false);
+            expect((await passwordAuth('carol', 'new-password')).body).to.have.property('message', 'User is disabled.');
+
+            await client.cognito('AdminEnableUser', { UserPoolId, Username: 'carol' });
+            expect((await passwordAuth('carol', 'new-password')).status).to.equal(200);
+        });
+    });
+
+    describe('ListUsers', () => {
+
+        it('Should list all users', async () => {
+            const result = await client.cognito('ListUsers', { UserPoolId });
+            expect(result.status).to.equal(200);
+            const usernames = result.body.Users.map(u => u.Username);
+            expect(usernames).to.include('alice');
+            expect(usernames).to.include('bob');
+            expect(usernames).to.include('carol');
+        });
+
+        it('Should filter by exact value', async () => {
+            const result = await client.cognito('ListUsers', { UserPoolId, Filter: 'email = "bob@example.org"' });
+            expect(result.body.Users.map(u => u.Username)).to.deep.equal(['bob']);
+        });
+
+        it('Should filter by prefix', async () => {
+            const result = await client.cognito('ListUsers', { UserPoolId, Filter: 'username ^= "ca"' });
+            expect(result.body.Users.map(u => u.Username)).to.deep.equal(['carol']);
+        });
+
+        it('Should paginate', async () => {
+            const first = await client.cognito('ListUsers', { UserPoolId, Limit: 2 });
+            expect(first.body.Users).to.have.lengthOf(2);
+            expect(first.body).to.have.property('PaginationToken');
+
+            const second = await client.cognito('ListUsers', { UserPoolId, Limit: 2, PaginationToken: first.body.PaginationToken });
+            expect(second.body.Users).to.have.lengthOf(1);
+            expect(second.body).to.not.have.property('PaginationToken');
+        });
+
+        it('Should only return requested attributes', async () => {
+            const result = await client.cognito('ListUsers', { UserPoolId, Filter: 'username = "alice"', AttributesToGet: ['email'] });
+            expect(result.body.Users[0].Attributes).to.deep.equal([{ Name: 'email', Value: 'alice@example.com' }]);
+        });
+
+        it('Should reject invalid filters', async () => {
+            const result = await client.cognito('ListUsers', { UserPoolId, Filter: 'email contains bob' });
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+        });
+    });
+
+    describe('Groups', () => {
+
+        it('Should include configured groups in tokens', async () => {
+            const login = await passwordAuth('alice', 'password1');
+            const access = decodePayload(login.body.AuthenticationResult.AccessToken);
+            const id = decodePayload(login.body.AuthenticationResult.IdToken);
+            expect(access['cognito:groups']).to.deep.equal(['admins']);
+            expect(id['cognito:groups']).to.deep.equal(['admins']);
+        });
+
+        it('Should not include the groups claim for users without groups', async () => {
+            const login = await passwordAuth('bob', 'password2');
+            const access = decodePayload(login.body.AuthenticationResult.AccessToken);
+            expect(access).to.not.have.property('cognito:groups');
+        });
+
+        it('AdminAddUserToGroup should add the user to the group', async () => {
+            await client.cognito('AdminAddUserToGroup', { UserPoolId, Username: 'bob', GroupName: 'editors' });
+            await client.cognito('AdminAddUserToGroup', { UserPoolId, Username: 'bob', GroupName: 'editors' });
+
+            const groups = await client.cognito('AdminListGroupsForUser', { UserPoolId, Username: 'bob' });
+            expect(groups.body.Groups.map(g => g.GroupName)).to.deep.equal(['editors']);
+
+            const login = await passwordAuth('bob', 'password2');
+            const access = decodePayload(login.body.AuthenticationResult.AccessToken);
+            expect(access['cognito:groups']).to.deep.equal(['editors']);
+        });
+
+        it('AdminRemoveUserFromGroup should remove the user from the group', async () => {
+            await client.cognito('AdminRemoveUserFromGroup', { UserPoolId, Username: 'bob', GroupName: 'editors' });
+
+            const groups = await client.cognito('AdminListGroupsForUser', { UserPoolId, Username: 'bob' });
+            expect(groups.body.Groups).to.deep.equal([]);
+        });
+
+        it('Should return UserNotFoundException for unknown users', async () => {
+            const result = await client.cognito('AdminAddUserToGroup', { UserPoolId, Username: 'nobody', GroupName: 'editors' });
+            expect(result.body).to.have.property('__type', 'UserNotFoundException');
+        });
+    });
+});
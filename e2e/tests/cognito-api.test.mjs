@@ -0,0 +1,383 @@
+import crypto from 'crypto';
+import { expect } from 'chai';
+import { IdpClient, generateTotp, launchSnapshot, srpPasswordClaim, srpStart, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+function decodePayload(token) {
+    const parts = token.split('.');
+    return JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+}
+
+function secretHash(username, clientId, clientSecret) {
+    return crypto.createHmac('sha256', clientSecret).update(username + clientId).digest('base64');
+}
+
+describe('cognito-api', () => {
+
+    const baseUrl = 'http://localhost:8092';
+    const client = new IdpClient(baseUrl);
+    const userPoolId = 'local_testpool';
+
+    before(async () => {
+        await launchSnapshot('cognito-api');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('cognito-api');
+    });
+
+    async function passwordAuth(username, password, clientId = 'public-client') {
+        return await client.cognito('InitiateAuth', {
+            AuthFlow: 'USER_PASSWORD_AUTH',
+            ClientId: clientId,
+            AuthParameters: { USERNAME: username, PASSWORD: password },
+        });
+    }
+
+    describe('Protocol', () => {
+
+        it('Should reject unknown operations', async () => {
+            const result = await client.cognito('DescribeUserPool', {});
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'UnknownOperationException');
+        });
+
+        it('Should reject unknown app clients', async () => {
+            const result = await passwordAuth('user1', 'password1', 'nope');
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'ResourceNotFoundException');
+        });
+    });
+
+    describe('USER_PASSWORD_AUTH', () => {
+
+        it('Should return an authentication result', async () => {
+            const result = await passwordAuth('user1', 'password1');
+            expect(result.status).to.equal(200);
+
+            const auth = result.body.AuthenticationResult;
+            expect(auth).to.have.property('AccessToken');
+            expect(auth).to.have.property('IdToken');
+            expect(auth).to.have.property('RefreshToken');
+            expect(auth).to.have.property('TokenType', 'Bearer');
+            expect(auth).to.have.property('ExpiresIn', 900);
+
+            const payload = decodePayload(auth.AccessToken);
+            expect(payload).to.have.property('sub', '1');
+            expect(payload).to.have.property('client_id', 'public-client');
+            expect(payload).to.have.property('scope', 'aws.cognito.signin.user.admin');
+        });
+
+        it('Should reject a wrong password', async () => {
+            const result = await passwordAuth('user1', 'wrong');
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(result.body).to.have.property('message', 'Incorrect username or password.');
+        });
+
+        it('Should reject unknown users', async () => {
+            const result = await passwordAuth('nobody', 'password1');
+            expect(result.body).to.have.property('__type', 'UserNotFoundException');
+        });
+
+        it('Should reject disabled users', async () => {
+            const result = await passwordAuth('disabled', 'password4');
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(result.body).to.have.property('message', 'User is disabled.');
+        });
+
+        it('Should require SECRET_HASH for clients with a secret', async () => {
+            const missing = await passwordAuth('user1', 'password1', 'secret-client');
+            expect(missing.body).to.have.property('__type', 'NotAuthorizedException');
+
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'secret-client',
+                AuthParameters: {
+                    USERNAME: 'user1',
+                    PASSWORD: 'password1',
+                    SECRET_HASH: secretHash('user1', 'secret-client', 'app_secret'),
+                },
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should require a TOTP code for users with a TOTP challenge', async () => {
+            const result = await passwordAuth('totpuser', 'password2');
+            expect(result.status).to.equal(200);
+            expect(result.body).to.not.have.property('AuthenticationResult');
+            expect(result.body).to.have.property('ChallengeName', 'SOFTWARE_TOKEN_MFA');
+            expect(result.body).to.have.property('Session');
+
+            const wrong = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'SOFTWARE_TOKEN_MFA',
+                ClientId: 'public-client',
+                Session: result.body.Session,
+                ChallengeResponses: { USERNAME: 'totpuser', SOFTWARE_TOKEN_MFA_CODE: '000000' },
+            });
+            expect(wrong.body).to.have.property('__type', 'CodeMismatchException');
+
+            const right = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'SOFTWARE_TOKEN_MFA',
+                ClientId: 'public-client',
+                Session: result.body.Session,
+                ChallengeResponses: { USERNAME: 'totpuser', SOFTWARE_TOKEN_MFA_CODE: generateTotp('JBSWY3DPEHPK3PXP') },
+            });
+            expect(right.status).to.equal(200);
+            expect(right.body.AuthenticationResult).to.have.property('AccessToken');
+        });
+    });
+
+    describe('CUSTOM_AUTH', () => {
+
+        it('Should issue a custom challenge and validate the answer', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'CUSTOM_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { USERNAME: 'customuser', PASSWORD: 'password3' },
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('ChallengeName', 'CUSTOM_CHALLENGE');
+            expect(result.body.ChallengeParameters).to.have.property('USERNAME', 'customuser');
+
+            const wrong = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'CUSTOM_CHALLENGE',
+                ClientId: 'public-client',
+                Session: result.body.Session,
+                ChallengeResponses: { USERNAME: 'customuser', ANSWER: 'nope' },
+            });
+            expect(wrong.body).to.have.property('__type', 'CodeMismatchException');
+
+            const right = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'CUSTOM_CHALLENGE',
+                ClientId: 'public-client',
+                Session: result.body.Session,
+                ChallengeResponses: { USERNAME: 'customuser', ANSWER: 'secret-answer' },
+            });
+            expect(right.status).to.equal(200);
+            expect(right.body.AuthenticationResult).to.have.property('RefreshToken');
+        });
+
+        it('Should require the password', async () => {
+            const missing = await client.cognito('InitiateAuth', {
+                AuthFlow: 'CUSTOM_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { USERNAME: 'customuser' },
+            });
+            expect(missing.status).to.equal(400);
+            expect(missing.body).to.not.have.property('Session');
+
+            const wrong = await client.cognito('InitiateAuth', {
+                AuthFlow: 'CUSTOM_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { USERNAME: 'customuser', PASSWORD: 'wrong' },
+            });
+            expect(wrong.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+
+        it('Should reject users without a challenge', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'CUSTOM_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { USERNAME: 'user1', PASSWORD: 'password1' },
+            });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(result.body).to.not.have.property('AuthenticationResult');
+        });
+
+        it('Should reject invalid sessions', async () => {
+            const result = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'CUSTOM_CHALLENGE',
+                ClientId: 'public-client',
+                Session: 'invalid',
+                ChallengeResponses: { USERNAME: 'customuser', ANSWER: 'secret-answer' },
+            });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+    });
+
+    describe('USER_SRP_AUTH', () => {
+
+        async function srpInitiate(username, clientId = 'public-client', extra = {}) {
+            const start = srpStart();
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_SRP_AUTH',
+                ClientId: clientId,
+                AuthParameters: { USERNAME: username, SRP_A: start.srpA, ...extra },
+            });
+            return { start, result };
+        }
+
+        async function srpRespond(start, result, password, clientId = 'public-client', extra = {}) {
+            return await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'PASSWORD_VERIFIER',
+                ClientId: clientId,
+                Session: result.body.Session,
+                ChallengeResponses: { ...srpPasswordClaim(start, userPoolId, result.body.ChallengeParameters, password), ...extra },
+            });
+        }
+
+        it('Should return a PASSWORD_VERIFIER challenge', async () => {
+            const { result } = await srpInitiate('user1');
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('ChallengeName', 'PASSWORD_VERIFIER');
+            expect(result.body).to.have.property('Session');
+            expect(result.body.ChallengeParameters).to.have.property('SALT');
+            expect(result.body.ChallengeParameters).to.have.property('SRP_B');
+            expect(result.body.ChallengeParameters).to.have.property('SECRET_BLOCK');
+            expect(result.body.ChallengeParameters).to.have.property('USER_ID_FOR_SRP', 'user1');
+        });
+
+        it('Should issue tokens for a valid password claim', async () => {
+            const { start, result } = await srpInitiate('user1');
+            const response = await srpRespond(start, result, 'password1');
+            expect(response.status).to.equal(200);
+            expect(response.body.AuthenticationResult).to.have.property('AccessToken');
+            expect(response.body.AuthenticationResult).to.have.property('RefreshToken');
+            expect(decodePayload(response.body.AuthenticationResult.AccessToken)).to.have.property('sub', '1');
+        });
+
+        it('Should reject a wrong password', async () => {
+            const { start, result } = await srpInitiate('user1');
+            const response = await srpRespond(start, result, 'wrong');
+            expect(response.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(response.body).to.have.property('message', 'Incorrect username or password.');
+        });
+
+        it('Should only accept a single password claim per session', async () => {
+            const { start, result } = await srpInitiate('user1');
+            await srpRespond(start, result, 'wrong');
+            const response = await srpRespond(start, result, 'password1');
+            expect(response.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+
+        it('Should reject an invalid SRP_A', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_SRP_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { USERNAME: 'user1', SRP_A: '0' },
+            });
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+        });
+
+        it('Should verify SECRET_HASH for clients with a secret', async () => {
+            const hash = secretHash('user1', 'secret-client', 'app_secret');
+            const { start, result } = await srpInitiate('user1', 'secret-client', { SECRET_HASH: hash });
+            expect(result.body).to.have.property('ChallengeName', 'PASSWORD_VERIFIER');
+
+            const response = await srpRespond(start, result, 'password1', 'secret-client', { SECRET_HASH: hash });
+            expect(response.status).to.equal(200);
+            expect(response.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should continue with the TOTP challenge after the password claim', async () => {
+            const { start, result } = await srpInitiate('totpuser');
+            const response = await srpRespond(start, result, 'password2');
+            expect(response.body).to.have.property('ChallengeName', 'SOFTWARE_TOKEN_MFA');
+
+            const mfa = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'SOFTWARE_TOKEN_MFA',
+                ClientId: 'public-client',
+                Session: response.body.Session,
+                ChallengeResponses: { USERNAME: 'totpuser', SOFTWARE_TOKEN_MFA_CODE: generateTotp('JBSWY3DPEHPK3PXP') },
+            });
+            expect(mfa.status).to.equal(200);
+            expect(mfa.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should support SRP_A as the first step of CUSTOM_AUTH', async () => {
+            const { start, result } = await srpInitiate('customuser', 'public-client', { CHALLENGE_NAME: 'SRP_A' });
+            expect(result.body).to.have.property('ChallengeName', 'PASSWORD_VERIFIER');
+
+            const response = await srpRespond(start, result, 'password3');
+            expect(response.body).to.have.property('ChallengeName', 'CUSTOM_CHALLENGE');
+
+            const custom = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'CUSTOM_CHALLENGE',
+                ClientId: 'public-client',
+                Session: response.body.Session,
+                ChallengeResponses: { USERNAME: 'customuser', ANSWER: 'secret-answer' },
+            });
+            expect(custom.status).to.equal(200);
+            expect(custom.body).to.have.property('AuthenticationResult');
+        });
+    });
+
+    describe('REFRESH_TOKEN_AUTH', () => {
+
+        it('Should issue new tokens without rotating the refresh token', async () => {
+            const login = await passwordAuth('user1', 'password1');
+            const refreshToken = login.body.AuthenticationResult.RefreshToken;
+
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'REFRESH_TOKEN_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { REFRESH_TOKEN: refreshToken },
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body.AuthenticationResult).to.have.property('AccessToken');
+            expect(result.body.AuthenticationResult).to.not.have.property('RefreshToken');
+
+            // The same refresh token can be used again
+            const again = await client.cognito('InitiateAuth', {
+                AuthFlow: 'REFRESH_TOKEN_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { REFRESH_TOKEN: refreshToken },
+            });
+            expect(again.status).to.equal(200);
+        });
+
+        it('Should reject invalid refresh tokens', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'REFRESH_TOKEN_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { REFRESH_TOKEN: 'invalid' },
+            });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+    });
+
+    describe('GetUser and GlobalSignOut', () => {
+
+        it('GetUser should return the user attributes', async () => {
+            const login = await passwordAuth('user1', 'password1');
+            const result = await client.cognito('GetUser', {
+                AccessToken: login.body.AuthenticationResult.AccessToken,
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('Username', 'user1');
+            expect(result.body.UserAttributes).to.deep.include({ Name: 'sub', Value: '1' });
+            expect(result.body.UserAttributes).to.deep.include({ Name: 'email', Value: 'user1@example.com' });
+            expect(result.body.UserAttributes).to.deep.include({ Name: 'email_verified', Value: 'true' });
+        });
+
+        it('GetUser should reject invalid access tokens', async () => {
+            const result = await client.cognito('GetUser', { AccessToken: 'invalid' });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+
+        it('GlobalSignOut should revoke access and refresh tokens', async () => {
+            const login = await passwordAuth('user1', 'password1');
+            const { AccessToken, RefreshToken } = login.body.AuthenticationResult;
+
+            const signOut = await client.cognito('GlobalSignOut', { AccessToken });
+            expect(signOut.status).to.equal(200);
+
+            const getUser = await client.cognito('GetUser', { AccessToken });
+            expect(getUser.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(getUser.body).to.have.property('message', 'Access Token has been revoked');
+
+            const refresh = await client.cognito('InitiateAuth', {
+                AuthFlow: 'REFRESH_TOKEN_AUTH',
+                ClientId: 'public-client',
+                AuthParameters: { REFRESH_TOKEN: RefreshToken },
+            });
+            expect(refresh.body).to.have.property('__type', 'NotAuthorizedException');
+
+            // Signing in again works
+            const again = await passwordAuth('user1', 'password1');
+            expect(again.status).to.equal(200);
+        });
+    });
+});
@@ -0,0 +1,201 @@
+import { expect } from 'chai';
+import { IdpClient, decodeJwt, generateTotp, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('consent', () => {
+
+    const baseUrl = 'http://localhost:8102';
+    const client = new IdpClient(baseUrl);
+
+    const oauthParams = {
+        client_id: 'consent-client',
+        redirect_uri: 'http://localhost:3000/callback',
+        scope: 'openid profile email',
+        state: 'state123',
+        nonce: 'nonce123',
+    };
+
+    before(async () => {
+        await launchSnapshot('consent');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('consent');
+    });
+
+    async function exchangeCode(response, clientId = 'consent-client') {
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.searchParams.get('state')).to.equal('state123');
+        return await client.oauth2Token({
+            grant_type: 'authorization_code',
+            code: location.searchParams.get('code'),
+            client_id: clientId,
+            redirect_uri: 'http://localhost:3000/callback',
+        });
+    }
+
+    // Logs in and returns the consent page
+    async function consentPage(username, password, params = {}) {
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, ...params, username, password });
+        expect(login.status).to.equal(200);
+        const html = await login.text();
+        expect(html).to.include('Authorize consent-client');
+        return html;
+    }
+
+    function submitConsent(html, decision, approvedScopes) {
+        const form = new URLSearchParams();
+        for (const name of ['authorization_request', 'session']) {
+            form.append(name, hiddenValue(html, name));
+        }
+        for (const scope of approvedScopes) {
+            form.append('approved_scope', scope);
+        }
+        form.append('decision', decision);
+        return client.oauth2ConsentSubmit(form);
+    }
+
+    it('Should skip the consent page for clients that do not require consent', async () => {
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, client_id: 'client1', username: 'alice', password: 'alice-password' });
+        const tokens = await exchangeCode(login, 'client1');
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid profile email');
+    });
+
+    it('Should list the requested scopes', async () => {
+        const html = await consentPage('alice', 'alice-password');
+        expect(html).to.include('name="approved_scope" value="profile"');
+        expect(html).to.include('name="approved_scope" value="email"');
+        expect(html).to.not.include('name="approved_scope" value="openid"');
+        expect(html).to.include('Your email address');
+    });
+
+    it('Should redirect with access_denied when the user declines', async () => {
+        const html = await consentPage('alice', 'alice-password');
+        const response = await submitConsent(html, 'deny', ['profile', 'email']);
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.origin + location.pathname).to.equal('http://localhost:3000/callback');
+        expect(location.searchParams.get('error')).to.equal('access_denied');
+        expect(location.searchParams.get('error_description')).to.equal('The user denied the request');
+        expect(location.searchParams.get('state')).to.equal('state123');
+        expect(location.searchParams.has('code')).to.equal(false);
+
+        const consents = await client.getConsents('1');
+        expect(consents.body).to.deep.equal([]);
+    });
+
+    it('Should redirect with access_denied when the user approves none of the scopes', async () => {
+        const html = await consentPage('alice', 'alice-password', { scope: 'profile email' });
+        const response = await submitConsent(html, 'allow', []);
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.searchParams.get('error')).to.equal('access_denied');
+        expect(location.searchParams.get('state')).to.equal('state123');
+        expect(location.searchParams.has('code')).to.equal(false);
+
+        const consents = await client.getConsents('1');
+        expect(consents.body).to.deep.equal([]);
+    });
+
+    it('Should grant only the approved scopes', async () => {
+        const html = await consentPage('alice', 'alice-password');
+        const tokens = await exchangeCode(await submitConsent(html, 'allow', ['profile']));
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid profile');
+        expect(decodeJwt(tokens.id_token)).to.have.property('nonce', 'nonce123');
+
+        const consents = await client.getConsents('1');
+        expect(consents.status).to.equal(200);
+        expect(consents.body).to.have.lengthOf(1);
+        expect(consents.body[0]).to.have.property('client_id', 'consent-client');
+        expect(consents.body[0].scopes).to.deep.equal(['openid', 'profile']);
+    });
+
+    it('Should remember granted scopes', async () => {
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, scope: 'openid profile', username: 'alice', password: 'alice-password' });
+        const tokens = await exchangeCode(login);
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid profile');
+    });
+
+    it('Should ask again for scopes that were not granted', async () => {
+        const html = await consentPage('alice', 'alice-password');
+        expect(html).to.include('previously allowed');
+
+        await exchangeCode(await submitConsent(html, 'allow', ['profile', 'email']));
+        const consents = await client.getConsents('1');
+        expect(consents.body[0].scopes).to.deep.equal(['openid', 'profile', 'email']);
+
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'alice', password: 'alice-password' });
+        expect(login.status).to.equal(302);
+    });
+
+    it('Should ask again with prompt=consent', async () => {
+        const html = await consentPage('alice', 'alice-password', { prompt: 'consent' });
+        await exchangeCode(await submitConsent(html, 'allow', ['profile', 'email']));
+    });
+
+    it('Should keep prompt=consent through the login page', async () => {
+        const page = await client.oauth2Authorize({ ...oauthParams, response_type: 'code', prompt: 'consent' });
+        const login = await client.oauth2AuthorizeSubmit({ authorization_request: hiddenValue(page, 'authorization_request'), username: 'alice', password: 'alice-password' });
+        expect(login.status).to.equal(200);
+        expect(await login.text()).to.include('Authorize consent-client');
+    });
+
+    it('Should honor configured grants', async () => {
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'bob', password: 'bob-password' });
+        await exchangeCode(login);
+    });
+
+    it('Should ask for consent after the TOTP code', async () => {
+        const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'totpuser', password: 'totp-password' });
+        const mfa = await login.text();
+        expect(mfa).to.include('name="mfa_code"');
+
+        const verified = await client.oauth2AuthorizeSubmit({ ...oauthParams, session: hiddenValue(mfa, 'session'), mfa_code: generateTotp('JBSWY3DPEHPK3PXP') });
+        expect(verified.status).to.equal(200);
+        const html = await verified.text();
+        expect(html).to.include('Authorize consent-client');
+
+        const tokens = await exchangeCode(await submitConsent(html, 'allow', ['email']));
+        const idToken = decodeJwt(tokens.id_token);
+        expect(idToken.amr).to.deep.equal(['pwd', 'otp']);
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid email');
+    });
+
+    it('Should only accept a consent session once', async () => {
+        const html = await consentPage('alice', 'alice-password', { prompt: 'consent' });
+        await exchangeCode(await submitConsent(html, 'allow', []));
+
+        const again = await submitConsent(html, 'allow', []);
+        expect(again.status).to.equal(400);
+        expect(await again.text()).to.include('The login has expired, please start over from the application');
+    });
+
+    it('Should revoke a grant and its refresh tokens', async () => {
+        const init = await client.loginInit({ username: 'bob', password: 'bob-password', client_id: 'consent-client', issue_refresh_token: true });
+        const tokens = await client.loginComplete({ challenge_id: init.challenge_id });
+
+        const revoked = await client.revokeConsent('2', 'consent-client');
+        expect(revoked.status).to.equal(204);
+        expect((await client.getConsents('2')).body).to.deep.equal([]);
+
+        const refresh = await fetch(`${baseUrl}/login/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: tokens.refresh_token }),
+        });
+        expect(refresh.status).to.equal(401);
+
+        await consentPage('bob', 'bob-password');
+    });
+
+    it('Should return 404 for unknown grants and users', async () => {
+        const missing = await client.revokeConsent('2', 'consent-client');
+        expect(missing.status).to.equal(404);
+        expect(missing.body).to.have.property('error', 'Consent not found');
+
+        const unknownUser = await client.getConsents('999');
+        expect(unknownUser.status).to.equal(404);
+        expect(unknownUser.body).to.have.property('error', 'User not found');
+    });
+});
@@ -0,0 +1,145 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, srpPasswordClaim, srpStart, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('hashed-passwords', () => {
+
+    const baseUrl = 'http://localhost:8096';
+    const client = new IdpClient(baseUrl);
+    const userPoolId = 'local_localidp';
+
+    before(async () => {
+        await launchSnapshot('hashed-passwords');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('hashed-passwords');
+    });
+
+    async function loginInit(username, password) {
+        const response = await fetch(`${baseUrl}/login/init`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password, client_id: 'client1' }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async function srpAuth(username, password) {
+        const start = srpStart();
+        const result = await client.cognito('InitiateAuth', {
+            AuthFlow: 'USER_SRP_AUTH',
+            ClientId: 'client1',
+            AuthParameters: { USERNAME: username, SRP_A: start.srpA },
+        });
+        if (result.status !== 200) {
+            return result;
+        }
+        return await client.cognito('RespondToAuthChallenge', {
+            ChallengeName: 'PASSWORD_VERIFIER',
+            ClientId: 'client1',
+            Session: result.body.Session,
+            ChallengeResponses: srpPasswordClaim(start, userPoolId, result.body.ChallengeParameters, password),
+        });
+    }
+
+    describe('Configured passwords', () => {
+
+        const cases = [
+            { username: 'plain', password: 'plain-pass' },
+            { username: 'bcrypt', password: 'bcrypt-pass' },
+            { username: 'argon2id', password: 'argon-pass' },
+            { username: 'django', password: 'django-pass' },
+            { username: 'aspnet-v3', password: 'aspnet-pass' },
+            { username: 'aspnet-v2', password: 'aspnet2-pass' },
+        ];
+
+        for (const { username, password } of cases) {
+            it(`Should log in the ${username} user with the correct password`, async () => {
+                const result = await loginInit(username, password);
+                expect(result.status).to.equal(200);
+                expect(result.body).to.have.property('challenge_id');
+            });
+
+            it(`Should reject the ${username} user with a wrong password`, async () => {
+                const result = await loginInit(username, 'wrong-pass');
+                expect(result.status).to.equal(401);
+            });
+        }
+
+        it('Should not accept the hash as the password', async () => {
+            const result = await loginInit('bcrypt', '$2b$10$OOCHlB2Hx/Og537rMo0vR.M.POVlHNQn3KdjlMQjAhQfiWlzDxpnG');
+            expect(result.status).to.equal(401);
+        });
+
+        it('Should log in with a hashed password on the OAuth2 login page', async () => {
+            const response = await client.oauth2AuthorizeSubmit({
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+                username: 'argon2id',
+                password: 'argon-pass',
+            });
+            expect(response.status).to.equal(302);
+            expect(response.headers.get('location')).to.include('code=');
+        });
+
+        it('Should log in with a hashed password in the Cognito API', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'django', PASSWORD: 'django-pass' },
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should reject SRP authentication for users with a configured hash', async () => {
+            const result = await srpAuth('bcrypt', 'bcrypt-pass');
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+    });
+
+    describe('User Management', () => {
+
+        it('PUT /users/{id} should create a user with a hashed password', async () => {
+            await client.putUser('new-user', { username: 'newuser', password: 'new-pass' });
+
+            const result = await loginInit('newuser', 'new-pass');
+            expect(result.status).to.equal(200);
+        });
+
+        it('PUT /users/{id} should hash a changed password', async () => {
+            const user = await client.putUser('2', { password: 'changed-pass' });
+            expect(user).to.not.have.property('password');
+
+            expect((await loginInit('bcrypt', 'changed-pass')).status).to.equal(200);
+            expect((await loginInit('bcrypt', 'bcrypt-pass')).status).to.equal(401);
+        });
+
+        it('PUT /users/{id} should store a pre-hashed password as it is', async () => {
+            const hash = 'pbkdf2_sha256$1000$somesalt$6q+q8XKQI98IZgTz/iXH3SMgJcrqGj6et3XeI3NAHL4=';
+            await client.putUser('hashed-user', { username: 'hasheduser', password: hash });
+            expect((await loginInit('hasheduser', 'django-pass')).status).to.equal(200);
+
+            const user = await client.putUser('hashed-user', { password: hash });
+            expect(user).to.not.have.property('password');
+            expect((await loginInit('hasheduser', 'django-pass')).status).to.equal(200);
+        });
+
+        it('Should allow SRP authentication once the password is set at runtime', async () => {
+            const result = await srpAuth('bcrypt', 'changed-pass');
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('AuthenticationResult');
+
+            const wrong = await srpAuth('bcrypt', 'bcrypt-pass');
+            expect(wrong.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+
+        it('Should allow SRP authentication for users with a plain text password', async () => {
+            const result = await srpAuth('plain', 'plain-pass');
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('AuthenticationResult');
+        });
+    });
+});
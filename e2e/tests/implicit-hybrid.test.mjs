@@ -0,0 +1,247 @@
+import { expect } from 'chai';
+import { createHash } from 'node:crypto';
+import { IdpClient, decodeJwt, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('implicit-hybrid', () => {
+
+    const baseUrl = 'http://localhost:8109';
+    const client = new IdpClient(baseUrl);
+    const redirectUri = 'http://localhost:3000/callback';
+
+    before(async () => {
+        await launchSnapshot('implicit-hybrid');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('implicit-hybrid');
+    });
+
+    function tokenHash(token) {
+        return createHash('sha256').update(token).digest().subarray(0, 16).toString('base64url');
+    }
+
+    function authorize(params) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams(params)}`, { redirect: 'manual' });
+    }
+
+    function login(params) {
+        return client.oauth2AuthorizeSubmit({
+            client_id: 'spa-client',
+            redirect_uri: redirectUri,
+            scope: 'openid profile email',
+            state: 'state123',
+            nonce: 'nonce123',
+            username: 'user1',
+            password: 'password1',
+            ...params,
+        });
+    }
+
+    // Returns the parameters of the authorization response in the fragment
+    function fragment(response) {
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.origin + location.pathname).to.equal(redirectUri);
+        expect(location.search).to.equal('');
+        return new URLSearchParams(location.hash.slice(1));
+    }
+
+    it('Should advertise the implicit and hybrid response types', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config.response_types_supported).to.deep.equal(['code', 'token', 'id_token', 'id_token token', 'code id_token', 'code token', 'code id_token token']);
+        expect(config.grant_types_supported).to.deep.equal(['authorization_code', 'implicit']);
+    });
+
+    it('Should show the login page for an allowed response type', async () => {
+        const page = await client.oauth2Authorize({ client_id: 'spa-client', redirect_uri: redirectUri, response_type: 'id_token token', nonce: 'nonce123' });
+        const params = fragment(await login({ authorization_request: hiddenValue(page, 'authorization_request') }));
+        expect(params.has('id_token')).to.equal(true);
+        expect(params.has('access_token')).to.equal(true);
+    });
+
+    describe('Implicit flow', () => {
+
+        it('Should return an access token in the fragment for response_type token', async () => {
+            const params = fragment(await login({ response_type: 'token' }));
+            expect(params.get('token_type')).to.equal('Bearer');
+            expect(params.get('expires_in')).to.equal('900');
+            expect(params.get('state')).to.equal('state123');
+            expect(params.has('id_token')).to.equal(false);
+            expect(params.has('code')).to.equal(false);
+            expect(decodeJwt(params.get('access_token'))).to.have.property('scope', 'openid profile email');
+
+            const userinfo = await client.getUserinfo(params.get('access_token'));
+            expect(userinfo).to.have.property('sub', '1');
+        });
+
+        it('Should return an ID token with the nonce for response_type id_token', async () => {
+            const params = fragment(await login({ response_type: 'id_token' }));
+            expect(params.has('access_token')).to.equal(false);
+            const claims = decodeJwt(params.get('id_token'));
+            expect(claims).to.have.property('nonce', 'nonce123');
+            expect(claims).to.have.property('aud', 'spa-client');
+            expect(claims).to.not.have.property('at_hash');
+        });
+
+        it('Should bind the access token to the ID token with at_hash', async () => {
+            const params = fragment(await login({ response_type: 'id_token token' }));
+            const claims = decodeJwt(params.get('id_token'));
+            expect(claims).to.have.property('at_hash', tokenHash(params.get('access_token')));
+            expect(claims).to.not.have.property('c_hash');
+        });
+
+        it('Should accept the values of the response type in any order', async () => {
+            const params = fragment(await login({ response_type: 'token id_token' }));
+            expect(params.has('access_token')).to.equal(true);
+            expect(params.has('id_token')).to.equal(true);
+        });
+
+        it('Should require a nonce when an ID token is returned', async () => {
+            const response = await authorize({ client_id: 'spa-client', redirect_uri: redirectUri, response_type: 'id_token', state: 'state123' });
+            const params = fragment(response);
+            expect(params.get('error')).to.equal('invalid_request');
+            expect(params.get('state')).to.equal('state123');
+
+            const submit = fragment(await login({ response_type: 'id_token token', nonce: '' }));
+            expect(submit.get('error')).to.equal('invalid_request');
+            expect(submit.has('access_token')).to.equal(false);
+        });
+
+        it('Should not require a nonce for response_type token', async () => {
+            const params = fragment(await login({ response_type: 'token', nonce: '' }));
+            expect(params.has('access_token')).to.equal(true);
+        });
+    });
+
+    describe('Hybrid flow', () => {
+
+        async function hybridLogin(responseType) {
+            const page = await login({ client_id: 'hybrid-client', response_type: responseType, prompt: 'consent' });
+            expect(page.status).to.equal(200);
+            const html = await page.text();
+
+            const form = new URLSearchParams();
+            for (const name of ['authorization_request', 'session']) {
+                form.append(name, hiddenValue(html, name));
+            }
+            form.append('approved_scope', 'profile');
+            form.append('approved_scope', 'email');
+            form.append('decision', 'allow');
+            return client.oauth2ConsentSubmit(form);
+        }
+
+        it('Should return a code and an ID token with c_hash for response_type code id_token', async () => {
+            const params = fragment(await hybridLogin('code id_token'));
+            const claims = decodeJwt(params.get('id_token'));
+            expect(claims).to.have.property('c_hash', tokenHash(params.get('code')));
+            expect(claims).to.have.property('nonce', 'nonce123');
+            expect(params.has('access_token')).to.equal(false);
+
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: params.get('code'),
+                client_id: 'hybrid-client',
+                client_secret: 'hybrid_secret',
+                redirect_uri: redirectUri,
+            });
+            expect(tokens).to.have.property('access_token');
+            expect(decodeJwt(tokens.id_token)).to.have.property('nonce', 'nonce123');
+        });
+
+        it('Should return a code and an access token for response_type code token', async () => {
+            const params = fragment(await hybridLogin('code token'));
+            expect(params.has('code')).to.equal(true);
+            expect(params.has('access_token')).to.equal(true);
+            expect(params.has('id_token')).to.equal(false);
+        });
+
+        it('Should return everything for response_type code id_token token', async () => {
+            const params = fragment(await hybridLogin('code id_token token'));
+            const claims = decodeJwt(params.get('id_token'));
+            expect(claims).to.have.property('c_hash', tokenHash(params.get('code')));
+            expect(claims).to.have.property('at_hash', tokenHash(params.get('access_token')));
+        });
+
+        it('Should keep the query for response_type code', async () => {
+            const response = await hybridLogin('code');
+            const location = new URL(response.headers.get('location'));
+            expect(location.hash).to.equal('');
+            expect(location.searchParams.has('code')).to.equal(true);
+        });
+
+        it('Should return a denied consent in the fragment', async () => {
+            const page = await login({ client_id: 'hybrid-client', response_type: 'code id_token', prompt: 'consent' });
+            const html = await page.text();
+            const form = new URLSearchParams();
+            for (const name of ['authorization_request', 'session']) {
+                form.append(name, hiddenValue(html, name));
+            }
+            form.append('decision', 'deny');
+            const params = fragment(await client.oauth2ConsentSubmit(form));
+            expect(params.get('error')).to.equal('access_denied');
+            expect(params.get('state')).to.equal('state123');
+        });
+    });
+
+    describe('Client response types', () => {
+
+        it('Should reject response types the client is not allowed to use', async () => {
+            const params = fragment(await authorize({ client_id: 'client1', redirect_uri: redirectUri, response_type: 'id_token token', nonce: 'nonce123', state: 'state123' }));
+            expect(params.get('error')).to.equal('unauthorized_client');
+            expect(params.get('state')).to.equal('state123');
+
+            const spa = await authorize({ client_id: 'spa-client', redirect_uri: redirectUri, response_type: 'code', state: 'state123' });
+            const location = new URL(spa.headers.get('location'));
+            expect(location.searchParams.get('error')).to.equal('unauthorized_client');
+        });
+
+        it('Should not issue tokens when the response type is changed on the login form', async () => {
+            const params = fragment(await login({ client_id: 'client1', response_type: 'token' }));
+            expect(params.get('error')).to.equal('unauthorized_client');
+            expect(params.has('access_token')).to.equal(false);
+        });
+
+        it('Should register clients for the implicit grant', async () => {
+            const registered = await client.registerClient({
+                redirect_uris: ['https://app.example.com/callback'],
+                token_endpoint_auth_method: 'none',
+                grant_types: ['implicit'],
+                response_types: ['id_token token'],
+            }, 'initial-token');
+            expect(registered.status).to.equal(201);
+            expect(registered.body.response_types).to.deep.equal(['id_token token']);
+
+            const mismatch = await client.registerClient({
+                redirect_uris: ['https://app.example.com/callback'],
+                grant_types: ['authorization_code'],
+                response_types: ['code id_token'],
+            }, 'initial-token');
+            expect(mismatch.status).to.equal(400);
+            expect(mismatch.body).to.have.property('error', 'invalid_client_metadata');
+
+            const hybrid = await client.registerClient({
+                redirect_uris: ['https://app.example.com/callback'],
+                grant_types: ['authorization_code', 'implicit'],
+                response_types: ['code id_token'],
+            }, 'initial-token');
+            expect(hybrid.status).to.equal(201);
+        });
+
+        it('Should set the response types through the admin API', async () => {
+            const updated = await client.putClient('admin-spa', {
+                redirect_uri: redirectUri,
+                token_endpoint_auth_method: 'none',
+                response_types: ['token'],
+            });
+            expect(updated.status).to.equal(201);
+            expect(updated.body.response_types).to.deep.equal(['token']);
+
+            const params = fragment(await login({ client_id: 'admin-spa', response_type: 'token' }));
+            expect(params.has('access_token')).to.equal(true);
+
+            const invalid = await client.putClient('admin-spa', { redirect_uri: redirectUri, response_types: ['device'] });
+            expect(invalid.status).to.equal(400);
+        });
+    });
+});
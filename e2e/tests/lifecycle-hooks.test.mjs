@@ -0,0 +1,181 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, startWebhookServer, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('lifecycle-hooks', () => {
+
+    const baseUrl = 'http://localhost:8090';
+    const client = new IdpClient(baseUrl);
+    let webhook;
+
+    before(async () => {
+        webhook = await startWebhookServer(9090, async (event) => {
+            if (event.trigger === 'pre_authentication' && event.user.username === 'blocked') {
+                return { body: { allow: false, message: 'Account is blocked by policy' } };
+            }
+            if (event.trigger === 'pre_sign_up' && event.user.attributes?.email?.endsWith('@denied.com')) {
+                return { body: { allow: false, message: 'Sign-ups from denied.com are not allowed' } };
+            }
+            // Post hooks are slow, which must not delay the requests notifying them
+            if (event.trigger.startsWith('post_')) {
+                await new Promise(resolve => setTimeout(resolve, 2000));
+            }
+            return { body: {} };
+        });
+        await launchSnapshot('lifecycle-hooks');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('lifecycle-hooks');
+        await webhook.close();
+    });
+
+    function eventsFor(trigger) {
+        return webhook.events.filter(e => e.event.trigger === trigger).map(e => e.event);
+    }
+
+    // Post hooks are called in the background, so their events arrive after the response
+    async function waitForEvents(trigger, timeoutMs = 5000) {
+        const deadline = Date.now() + timeoutMs;
+        while (eventsFor(trigger).length === 0 && Date.now() < deadline) {
+            await new Promise(resolve => setTimeout(resolve, 50));
+        }
+        return eventsFor(trigger);
+    }
+
+    describe('Authentication hooks', () => {
+
+        it('Login API should invoke pre and post authentication hooks', async () => {
+            webhook.events.length = 0;
+            const respInit = await client.loginInit({
+                username: 'user1',
+                password: 'password1',
+                client_id: 'client1',
+            });
+            expect(eventsFor('pre_authentication')).to.have.lengthOf(1);
+            expect(eventsFor('post_authentication')).to.have.lengthOf(0);
+
+            const started = Date.now();
+            await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: 'XXXXXX',
+            });
+            expect(Date.now() - started).to.be.lessThan(1500);
+
+            const [preEvent] = eventsFor('pre_authentication');
+            expect(preEvent).to.have.property('source', 'login_api');
+            expect(preEvent.user).to.have.property('username', 'user1');
+            expect(preEvent.client).to.have.property('id', 'client1');
+
+            const [postEvent] = await waitForEvents('post_authentication');
+            expect(postEvent).to.have.property('source', 'login_api');
+            expect(postEvent.user).to.have.property('id', '1');
+        });
+
+        it('Login API should surface the pre authentication deny message', async () => {
+            const response = await fetch(`${baseUrl}/login/init`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ username: 'blocked', password: 'password2', client_id: 'client1' }),
+            });
+            expect(response.status).to.equal(403);
+            const body = await response.json();
+            expect(body).to.have.property('error', 'Account is blocked by policy');
+        });
+
+        it('OAuth2 login should invoke pre and post authentication hooks', async () => {
+            webhook.events.length = 0;
+            const authResponse = await client.oauth2AuthorizeSubmit({
+                username: 'user1',
+                password: 'password1',
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+            expect(authResponse.status).to.equal(302);
+
+            const [preEvent] = eventsFor('pre_authentication');
+            expect(preEvent).to.have.property('source', 'oauth2');
+            const [postEvent] = await waitForEvents('post_authentication');
+            expect(postEvent).to.have.property('source', 'oauth2');
+            expect(postEvent.client).to.have.property('id', 'client1');
+        });
+
+        it('OAuth2 login should show the pre authentication deny message', async () => {
+            const authResponse = await client.oauth2AuthorizeSubmit({
+                username: 'blocked',
+                password: 'password2',
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+            expect(authResponse.status).to.equal(200);
+            const html = await authResponse.text();
+            expect(html).to.include('Account is blocked by policy');
+        });
+
+        it('Should not invoke hooks for invalid credentials', async () => {
+            webhook.events.length = 0;
+            try {
+                await client.loginInit({
+                    username: 'user1',
+                    password: 'wrong',
+                    client_id: 'client1',
+                });
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('401');
+            }
+            expect(webhook.events).to.have.lengthOf(0);
+        });
+    });
+
+    describe('Sign-up hooks', () => {
+
+        it('Creating a user should invoke pre sign-up and post confirmation hooks', async () => {
+            webhook.events.length = 0;
+            await client.putUser('new-user', {
+                username: 'newuser',
+                password: 'newpass',
+                attributes: { email: 'new@example.com' },
+            });
+
+            const [preEvent] = eventsFor('pre_sign_up');
+            expect(preEvent).to.have.property('source', 'admin');
+            expect(preEvent.user).to.have.property('username', 'newuser');
+            expect(preEvent.user.attributes).to.have.property('email', 'new@example.com');
+            expect(preEvent).to.not.have.property('client');
+
+            const [postEvent] = await waitForEvents('post_confirmation');
+            expect(postEvent.user).to.have.property('id', 'new-user');
+        });
+
+        it('Updating a user should not invoke sign-up hooks', async () => {
+            webhook.events.length = 0;
+            await client.putUser('new-user', {
+                attributes: { email: 'updated@example.com' },
+            });
+            expect(webhook.events).to.have.lengthOf(0);
+        });
+
+        it('Pre sign-up hook should be able to deny creating a user', async () => {
+            const response = await fetch(`${baseUrl}/users/denied-user`, {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    username: 'denied',
+                    password: 'pass',
+                    attributes: { email: 'someone@denied.com' },
+                }),
+            });
+            expect(response.status).to.equal(403);
+            const body = await response.json();
+            expect(body).to.have.property('error', 'Sign-ups from denied.com are not allowed');
+
+            try {
+                await client.getUserById('denied-user');
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('404');
+            }
+        });
+    });
+});
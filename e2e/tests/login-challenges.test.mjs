@@ -0,0 +1,235 @@
+import { expect } from 'chai';
+import { IdpClient, generateTotp, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('login-challenges', () => {
+
+    const baseUrl = 'http://localhost:8091';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('login-challenges');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('login-challenges');
+    });
+
+    async function completeRaw(challengeId, challengeData) {
+        const response = await fetch(`${baseUrl}/login/complete`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ challenge_id: challengeId, challenge_data: challengeData }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    describe('Any challenge', () => {
+
+        it('Should accept any challenge data', async () => {
+            const respInit = await client.loginInit({
+                username: 'anyuser',
+                password: 'password1',
+                client_id: 'client1',
+            });
+            expect(respInit).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: 'whatever',
+            });
+            expect(respComplete).to.have.property('access_token');
+        });
+    });
+
+    describe('Fixed code challenge', () => {
+
+        it('Should accept the configured code', async () => {
+            const respInit = await client.loginInit({
+                username: 'fixeduser',
+                password: 'password2',
+                client_id: 'client1',
+            });
+            expect(respInit).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: '424242',
+            });
+            expect(respComplete).to.have.property('access_token');
+        });
+
+        it('Should reject a wrong code with a distinct error', async () => {
+            const respInit = await client.loginInit({
+                username: 'fixeduser',
+                password: 'password2',
+                client_id: 'client1',
+            });
+
+            const result = await completeRaw(respInit.challenge_id, '000000');
+            expect(result.status).to.equal(401);
+            expect(result.body).to.have.property('error', 'Invalid challenge response');
+        });
+
+        it('Should allow retrying after a wrong code', async () => {
+            const respInit = await client.loginInit({
+                username: 'fixeduser',
+                password: 'password2',
+                client_id: 'client1',
+            });
+
+            const wrong = await completeRaw(respInit.challenge_id, '000000');
+            expect(wrong.status).to.equal(401);
+
+            const right = await completeRaw(respInit.challenge_id, '424242');
+            expect(right.status).to.equal(200);
+            expect(right.body).to.have.property('access_token');
+        });
+
+        it('Should invalidate the challenge after too many wrong attempts', async () => {
+            const respInit = await client.loginInit({
+                username: 'fixeduser',
+                password: 'password2',
+                client_id: 'client1',
+            });
+
+            const first = await completeRaw(respInit.challenge_id, '1');
+            expect(first.body).to.have.property('error', 'Invalid challenge response');
+            const second = await completeRaw(respInit.challenge_id, '2');
+            expect(second.body).to.have.property('error', 'Invalid challenge response');
+            const third = await completeRaw(respInit.challenge_id, '3');
+            expect(third.status).to.equal(401);
+            expect(third.body).to.have.property('error', 'Too many failed attempts');
+
+            // Even the right code no longer works
+            const right = await completeRaw(respInit.challenge_id, '424242');
+            expect(right.status).to.equal(401);
+            expect(right.body).to.have.property('error', 'Invalid challenge');
+        });
+    });
+
+    describe('TOTP challenge', () => {
+
+        it('Should report the SOFTWARE_TOKEN_MFA challenge type', async () => {
+            const respInit = await client.loginInit({
+                username: 'totpuser',
+                password: 'password3',
+                client_id: 'client1',
+            });
+            expect(respInit).to.have.property('challenge_type', 'SOFTWARE_TOKEN_MFA');
+        });
+
+        it('Should accept a valid TOTP code', async () => {
+            const respInit = await client.loginInit({
+                username: 'totpuser',
+                password: 'password3',
+                client_id: 'client1',
+            });
+
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: generateTotp('JBSWY3DPEHPK3PXP'),
+            });
+            expect(respComplete).to.have.property('access_token');
+        });
+
+        it('Should reject an outdated TOTP code', async () => {
+            const respInit = await client.loginInit({
+                username: 'totpuser',
+                password: 'password3',
+                client_id: 'client1',
+            });
+
+            const oldCode = generateTotp('JBSWY3DPEHPK3PXP', Date.now() - 10 * 60 * 1000);
+            const result = await completeRaw(respInit.challenge_id, oldCode);
+            expect(result.status).to.equal(401);
+            expect(result.body).to.have.property('error', 'Invalid challenge response');
+        });
+    });
+
+    describe('Misconfigured challenges', () => {
+
+        for (const [name, username, password] of [['an unknown challenge type', 'unknownchallenge', 'password4'], ['a fixed challenge without code', 'nocode', 'password5']]) {
+            it(`Should not accept any answer for ${name}`, async () => {
+                const respInit = await client.loginInit({ username, password, client_id: 'client1' });
+                for (const answer of ['', 'XXXXXX']) {
+                    const response = await completeRaw(respInit.challenge_id, answer);
+                    expect(response.status).to.equal(401);
+                }
+            });
+        }
+    });
+
+    describe('User management', () => {
+
+        it('Should not expose challenge secrets via /me', async () => {
+            const respInit = await client.loginInit({
+                username: 'fixeduser',
+                password: 'password2',
+                client_id: 'client1',
+            });
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: '424242',
+            });
+
+            const me = await client.getMe(respComplete.access_token);
+            expect(me).to.have.property('challenge_type', 'fixed');
+            expect(me).to.not.have.property('challenge_code');
+            expect(me).to.not.have.property('totp_secret');
+            expect(me).to.not.have.property('password');
+            expect(me).to.not.have.property('password_changed_at');
+        });
+
+        it('Should configure a challenge via PUT /users/{id}', async () => {
+            await client.putUser('1', {
+                challenge_type: 'fixed',
+                challenge_code: '999999',
+            });
+
+            const respInit = await client.loginInit({
+                username: 'anyuser',
+                password: 'password1',
+                client_id: 'client1',
+            });
+            const wrong = await completeRaw(respInit.challenge_id, 'whatever');
+            expect(wrong.status).to.equal(401);
+            const right = await completeRaw(respInit.challenge_id, '999999');
+            expect(right.status).to.equal(200);
+        });
+
+        it('Should not return secrets when updating a user', async () => {
+            const updated = await client.putUser('3', { challenge_type: 'totp', totp_secret: 'JBSWY3DPEHPK3PXP', password: 'password3' });
+            expect(updated).to.have.property('challenge_type', 'totp');
+            expect(updated).to.not.have.property('password');
+            expect(updated).to.not.have.property('totp_secret');
+            expect(updated).to.not.have.property('challenge_code');
+        });
+
+        it('Should reject challenges that cannot be answered', async () => {
+            for (const params of [{ challenge_type: 'bogus' }, { challenge_type: 'totp' }, { challenge_type: 'totp', totp_secret: 'not base32!' }]) {
+                const response = await fetch(`${baseUrl}/users/new-user`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ username: 'newuser', password: 'password6', ...params }),
+                });
+                expect(response.status).to.equal(400);
+                expect((await response.json()).error).to.be.a('string');
+            }
+
+            const noCode = await fetch(`${baseUrl}/users/2`, {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ challenge_type: 'fixed' }),
+            });
+            expect(noCode.status).to.equal(200);
+
+            const clearSecret = await fetch(`${baseUrl}/users/1`, {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ challenge_type: 'totp' }),
+            });
+            expect(clearSecret.status).to.equal(400);
+        });
+    });
+});
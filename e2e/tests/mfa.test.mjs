@@ -0,0 +1,307 @@
+import { expect } from 'chai';
+import { IdpClient, decodeJwt, generateTotp, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('mfa', () => {
+
+    const baseUrl = 'http://localhost:8099';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('mfa');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('mfa');
+    });
+
+    async function completeRaw(challengeId, challengeData) {
+        const response = await fetch(`${baseUrl}/login/complete`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ challenge_id: challengeId, challenge_data: challengeData }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    describe('TOTP enrollment API', () => {
+
+        let secret;
+
+        it('Should return a new secret, otpauth URI and QR code', async () => {
+            const result = await client.enrollTotp('2');
+            expect(result.status).to.equal(200);
+            expect(result.body.secret).to.match(/^[A-Z2-7]{32}$/);
+            expect(result.body.otpauth_uri).to.match(/^otpauth:\/\/totp\/.+:carol\?/);
+            expect(result.body.otpauth_uri).to.include(`secret=${result.body.secret}`);
+            expect(result.body.qr_code).to.match(/^data:image\/png;base64,/);
+
+            const png = Buffer.from(result.body.qr_code.split(',')[1], 'base64');
+            expect(png.subarray(1, 4).toString()).to.equal('PNG');
+            secret = result.body.secret;
+        });
+
+        it('Should not enable TOTP before the first code is verified', async () => {
+            const respInit = await client.loginInit({ username: 'carol', password: 'carol-password', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+        });
+
+        it('Should reject a wrong code', async () => {
+            const result = await client.verifyTotp('2', '000000');
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid code');
+        });
+
+        it('Should enable TOTP with a valid code', async () => {
+            const result = await client.verifyTotp('2', generateTotp(secret));
+            expect(result.status).to.equal(200);
+
+            const user = await client.getUserById('2');
+            expect(user).to.have.property('challenge_type', 'totp');
+
+            const respInit = await client.loginInit({ username: 'carol', password: 'carol-password', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'SOFTWARE_TOKEN_MFA');
+            const respComplete = await client.loginComplete({ challenge_id: respInit.challenge_id, challenge_data: generateTotp(secret) });
+            expect(decodeJwt(respComplete.identity_token).amr).to.deep.equal(['pwd', 'otp']);
+        });
+
+        it('Should reject verifying without an enrollment in progress', async () => {
+            const result = await client.verifyTotp('2', generateTotp(secret));
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'No TOTP enrollment in progress');
+        });
+
+        it('Should disable TOTP', async () => {
+            await client.disableTotp('2');
+            const respInit = await client.loginInit({ username: 'carol', password: 'carol-password', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+        });
+
+        it('Should return 404 for unknown users', async () => {
+            const result = await client.enrollTotp('unknown');
+            expect(result.status).to.equal(404);
+        });
+    });
+
+    describe('Login API', () => {
+
+        it('Should report only the password without MFA', async () => {
+            const respInit = await client.loginInit({ username: 'dave', password: 'dave-password', client_id: 'client1', issue_refresh_token: true });
+            const respComplete = await client.loginComplete({ challenge_id: respInit.challenge_id });
+            expect(decodeJwt(respComplete.identity_token).amr).to.deep.equal(['pwd']);
+        });
+
+        it('Should keep the authentication methods when refreshing tokens', async () => {
+            const respInit = await client.loginInit({ username: 'totpuser', password: 'totp-password', client_id: 'client1', issue_refresh_token: true });
+            const respComplete = await client.loginComplete({ challenge_id: respInit.challenge_id, challenge_data: generateTotp('JBSWY3DPEHPK3PXP') });
+            expect(decodeJwt(respComplete.identity_token).amr).to.deep.equal(['pwd', 'otp']);
+
+            const refreshed = await client.loginRefresh({ refresh_token: respComplete.refresh_token });
+            expect(decodeJwt(refreshed.identity_token).amr).to.deep.equal(['pwd', 'otp']);
+        });
+
+        it('Should make users that require MFA set up TOTP', async () => {
+            const respInit = await client.loginInit({ username: 'admin', password: 'admin-password', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'MFA_SETUP');
+            expect(respInit.totp_setup.secret).to.match(/^[A-Z2-7]+$/);
+            expect(respInit.totp_setup.otpauth_uri).to.match(/^otpauth:\/\/totp\//);
+            expect(respInit.totp_setup.qr_code).to.match(/^data:image\/png;base64,/);
+
+            const wrong = await completeRaw(respInit.challenge_id, '000000');
+            expect(wrong.status).to.equal(401);
+
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: generateTotp(respInit.totp_setup.secret),
+            });
+            expect(decodeJwt(respComplete.identity_token).amr).to.deep.equal(['pwd', 'otp']);
+
+            // The next login asks for the TOTP code
+            const nextInit = await client.loginInit({ username: 'admin', password: 'admin-password', client_id: 'client1' });
+            expect(nextInit).to.have.property('challenge_type', 'SOFTWARE_TOKEN_MFA');
+            expect(nextInit).to.not.have.property('totp_setup');
+        });
+
+        it('Should make users set up TOTP for clients that require MFA', async () => {
+            const respInit = await client.loginInit({ username: 'dave', password: 'dave-password', client_id: 'mfa-client' });
+            expect(respInit).to.have.property('challenge_type', 'MFA_SETUP');
+        });
+
+        it('Should update whether a user requires MFA', async () => {
+            const updated = await client.putUser('2', { mfa_required: true });
+            expect(updated).to.have.property('mfa_required', true);
+
+            const respInit = await client.loginInit({ username: 'carol', password: 'carol-password', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'MFA_SETUP');
+
+            await client.putUser('2', { mfa_required: false });
+        });
+    });
+
+    describe('OAuth2 login page', () => {
+
+        const oauthParams = {
+            client_id: 'client1',
+            redirect_uri: 'http://localhost:3000/callback',
+            scope: 'openid',
+            state: 'state123',
+            nonce: 'nonce123',
+        };
+
+        async function exchangeCode(response, clientId) {
+            expect(response.status).to.equal(302);
+            const location = new URL(response.headers.get('location'));
+            return await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: location.searchParams.get('code'),
+                client_id: clientId,
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+        }
+
+        it('Should report only the password without MFA', async () => {
+            const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'dave', password: 'dave-password' });
+            const tokens = await exchangeCode(login, 'client1');
+            expect(decodeJwt(tokens.id_token).amr).to.deep.equal(['pwd']);
+        });
+
+        it('Should ask users with TOTP for their code', async () => {
+            const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'totpuser', password: 'totp-password' });
+            expect(login.status).to.equal(200);
+            const html = await login.text();
+            expect(html).to.include('Two-factor authentication');
+            expect(html).to.include('name="mfa_code"');
+            const session = hiddenValue(html, 'session');
+
+            const wrong = await client.oauth2AuthorizeSubmit({ ...oauthParams, session, mfa_code: '000000' });
+            expect(wrong.status).to.equal(200);
+            expect(await wrong.text()).to.include('Invalid code');
+
+            const verified = await client.oauth2AuthorizeSubmit({ ...oauthParams, session, mfa_code: generateTotp('JBSWY3DPEHPK3PXP') });
+            const tokens = await exchangeCode(verified, 'client1');
+            const idToken = decodeJwt(tokens.id_token);
+            expect(idToken.amr).to.deep.equal(['pwd', 'otp']);
+            expect(idToken).to.have.property('nonce', 'nonce123');
+        });
+
+        it('Should start over after too many wrong codes', async () => {
+            const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'totpuser', password: 'totp-password' });
+            const mfa = await login.text();
+            const session = hiddenValue(mfa, 'session');
+            const authorization_request = hiddenValue(mfa, 'authorization_request');
+
+            let html;
+            for (let i = 0; i < 3; i++) {
+                const wrong = await client.oauth2AuthorizeSubmit({ authorization_request, session, mfa_code: '000000' });
+                html = await wrong.text();
+            }
+            expect(html).to.include('Too many failed attempts');
+
+            const retry = await client.oauth2AuthorizeSubmit({ authorization_request, session, mfa_code: generateTotp('JBSWY3DPEHPK3PXP') });
+            expect(await retry.text()).to.include('Your session has expired');
+        });
+
+        it('Should let users set up TOTP for clients that require MFA', async () => {
+            const mfaParams = { ...oauthParams, client_id: 'mfa-client' };
+            const login = await client.oauth2AuthorizeSubmit({ ...mfaParams, username: 'dave', password: 'dave-password' });
+            expect(login.status).to.equal(200);
+            const html = await login.text();
+            expect(html).to.include('Set up two-factor authentication');
+            expect(html).to.include('src="data:image/png;base64,');
+            const secret = html.match(/<code>([A-Z2-7]+)<\/code>/)[1];
+            const session = hiddenValue(html, 'session');
+
+            const verified = await client.oauth2AuthorizeSubmit({ ...mfaParams, session, mfa_code: generateTotp(secret) });
+            const tokens = await exchangeCode(verified, 'mfa-client');
+            expect(decodeJwt(tokens.id_token).amr).to.deep.equal(['pwd', 'otp']);
+
+            // TOTP is now enabled for all clients
+            const next = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'dave', password: 'dave-password' });
+            expect(await next.text()).to.include('Two-factor authentication');
+        });
+    });
+
+    describe('Cognito API', () => {
+
+        it('Should set up a software token during login', async () => {
+            const auth = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'erin', PASSWORD: 'erin-password' },
+            });
+            expect(auth.body).to.have.property('ChallengeName', 'MFA_SETUP');
+            expect(auth.body.ChallengeParameters).to.have.property('MFAS_CAN_SETUP', '["SOFTWARE_TOKEN_MFA"]');
+
+            const early = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'MFA_SETUP',
+                ClientId: 'client1',
+                Session: auth.body.Session,
+                ChallengeResponses: { USERNAME: 'erin' },
+            });
+            expect(early.body).to.have.property('__type', 'InvalidParameterException');
+
+            const associate = await client.cognito('AssociateSoftwareToken', { Session: auth.body.Session });
+            expect(associate.status).to.equal(200);
+            expect(associate.body.SecretCode).to.match(/^[A-Z2-7]+$/);
+
+            const wrong = await client.cognito('VerifySoftwareToken', { Session: associate.body.Session, UserCode: '000000' });
+            expect(wrong.body).to.have.property('__type', 'EnableSoftwareTokenMFAException');
+
+            const verify = await client.cognito('VerifySoftwareToken', {
+                Session: associate.body.Session,
+                UserCode: generateTotp(associate.body.SecretCode),
+            });
+            expect(verify.body).to.have.property('Status', 'SUCCESS');
+
+            const result = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'MFA_SETUP',
+                ClientId: 'client1',
+                Session: verify.body.Session,
+                ChallengeResponses: { USERNAME: 'erin' },
+            });
+            expect(result.body).to.have.property('AuthenticationResult');
+            expect(decodeJwt(result.body.AuthenticationResult.IdToken).amr).to.deep.equal(['pwd', 'otp']);
+        });
+
+        it('Should report MFA for software token logins', async () => {
+            const auth = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'totpuser', PASSWORD: 'totp-password' },
+            });
+            expect(auth.body).to.have.property('ChallengeName', 'SOFTWARE_TOKEN_MFA');
+
+            const result = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'SOFTWARE_TOKEN_MFA',
+                ClientId: 'client1',
+                Session: auth.body.Session,
+                ChallengeResponses: { USERNAME: 'totpuser', SOFTWARE_TOKEN_MFA_CODE: generateTotp('JBSWY3DPEHPK3PXP') },
+            });
+            expect(decodeJwt(result.body.AuthenticationResult.IdToken).amr).to.deep.equal(['pwd', 'otp']);
+        });
+
+        it('Should associate a software token for a signed in user', async () => {
+            const auth = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'carol', PASSWORD: 'carol-password' },
+            });
+            const accessToken = auth.body.AuthenticationResult.AccessToken;
+            expect(decodeJwt(auth.body.AuthenticationResult.IdToken).amr).to.deep.equal(['pwd']);
+
+            const associate = await client.cognito('AssociateSoftwareToken', { AccessToken: accessToken });
+            const verify = await client.cognito('VerifySoftwareToken', {
+                AccessToken: accessToken,
+                UserCode: generateTotp(associate.body.SecretCode),
+            });
+            expect(verify.body).to.have.property('Status', 'SUCCESS');
+
+            const next = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'carol', PASSWORD: 'carol-password' },
+            });
+            expect(next.body).to.have.property('ChallengeName', 'SOFTWARE_TOKEN_MFA');
+        });
+    });
+});
@@ -0,0 +1,164 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('oauth2-errors', () => {
+
+    const baseUrl = 'http://localhost:8103';
+    const client = new IdpClient(baseUrl);
+
+    const authorizeParams = {
+        client_id: 'client1',
+        redirect_uri: 'http://localhost:3000/callback',
+        response_type: 'code',
+        state: 'state123',
+    };
+
+    before(async () => {
+        await launchSnapshot('oauth2-errors');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('oauth2-errors');
+    });
+
+    function authorize(params) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams(params)}`, { redirect: 'manual' });
+    }
+
+    function token(params) {
+        return fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: new URLSearchParams(params),
+        });
+    }
+
+    function userinfo(authorization) {
+        return fetch(`${baseUrl}/userinfo`, { headers: authorization ? { 'Authorization': authorization } : {} });
+    }
+
+    async function authorizationCode(clientId = 'client1', redirectUri = 'http://localhost:3000/callback') {
+        const response = await client.oauth2AuthorizeSubmit({ client_id: clientId, redirect_uri: redirectUri, username: 'user1', password: 'password1' });
+        expect(response.status).to.equal(302);
+        return new URL(response.headers.get('location')).searchParams.get('code');
+    }
+
+    async function expectError(response, status, error, description) {
+        expect(response.status).to.equal(status);
+        expect(response.headers.get('content-type')).to.include('application/json');
+        expect(response.headers.get('cache-control')).to.equal('no-store');
+        const body = await response.json();
+        expect(body).to.have.property('error', error);
+        if (description) {
+            expect(body).to.have.property('error_description', description);
+        }
+    }
+
+    function expectRedirectError(response, error) {
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.origin + location.pathname).to.equal('http://localhost:3000/callback');
+        expect(location.searchParams.get('error')).to.equal(error);
+        expect(location.searchParams.get('error_description')).to.be.a('string');
+        expect(location.searchParams.get('state')).to.equal('state123');
+        expect(location.searchParams.has('code')).to.equal(false);
+    }
+
+    describe('Authorization endpoint', () => {
+
+        it('Should redirect unsupported_response_type with the state', async () => {
+            expectRedirectError(await authorize({ ...authorizeParams, response_type: 'device' }), 'unsupported_response_type');
+        });
+
+        it('Should redirect invalid_request when response_type is missing', async () => {
+            const { response_type, ...params } = authorizeParams;
+            expectRedirectError(await authorize(params), 'invalid_request');
+        });
+
+        it('Should redirect login_required for prompt=none', async () => {
+            expectRedirectError(await authorize({ ...authorizeParams, prompt: 'none' }), 'login_required');
+        });
+
+        it('Should not redirect to an unregistered redirect_uri', async () => {
+            const response = await authorize({ ...authorizeParams, redirect_uri: 'http://evil.example.com/callback' });
+            expect(response.status).to.equal(400);
+            expect(response.headers.get('location')).to.equal(null);
+            const html = await response.text();
+            expect(html).to.include('Invalid client_id or redirect_uri');
+            expect(html).to.include('invalid_request');
+        });
+
+        it('Should not redirect for an unknown client', async () => {
+            const response = await authorize({ ...authorizeParams, client_id: 'unknown', response_type: 'token' });
+            expect(response.status).to.equal(400);
+            expect(response.headers.get('location')).to.equal(null);
+        });
+    });
+
+    describe('Token endpoint', () => {
+
+        it('Should return unsupported_grant_type', async () => {
+            await expectError(await token({ grant_type: 'password', client_id: 'client1', client_secret: 'super_secret' }), 400, 'unsupported_grant_type');
+        });
+
+        it('Should return invalid_request without grant_type', async () => {
+            await expectError(await token({ client_id: 'client1', client_secret: 'super_secret' }), 400, 'invalid_request', 'grant_type is required');
+        });
+
+        it('Should return invalid_client with a WWW-Authenticate challenge', async () => {
+            const code = await authorizationCode();
+            const response = await token({ grant_type: 'authorization_code', code, client_id: 'client1', client_secret: 'wrong', redirect_uri: 'http://localhost:3000/callback' });
+            expect(response.headers.get('www-authenticate')).to.include('Basic');
+            await expectError(response, 401, 'invalid_client');
+        });
+
+        it('Should return invalid_client for an unknown client', async () => {
+            await expectError(await token({ grant_type: 'authorization_code', code: 'x', client_id: 'unknown' }), 401, 'invalid_client');
+        });
+
+        it('Should return invalid_request without a code', async () => {
+            await expectError(await token({ grant_type: 'authorization_code', client_id: 'client1', client_secret: 'super_secret' }), 400, 'invalid_request', 'code is required');
+        });
+
+        it('Should return invalid_grant for an unknown code', async () => {
+            await expectError(await token({ grant_type: 'authorization_code', code: 'invalid-code', client_id: 'client1', client_secret: 'super_secret', redirect_uri: 'http://localhost:3000/callback' }), 400, 'invalid_grant');
+        });
+
+        it('Should return invalid_grant for a mismatched redirect_uri', async () => {
+            const code = await authorizationCode();
+            await expectError(await token({ grant_type: 'authorization_code', code, client_id: 'client1', client_secret: 'super_secret', redirect_uri: 'http://localhost:3000/other' }), 400, 'invalid_grant', 'redirect_uri does not match the authorization request');
+        });
+
+        it('Should return invalid_grant for a code issued to another client', async () => {
+            const code = await authorizationCode();
+            await expectError(await token({ grant_type: 'authorization_code', code, client_id: 'client2', redirect_uri: 'http://localhost:3000/callback' }), 400, 'invalid_grant', 'The authorization code was issued to another client');
+        });
+
+        it('Should return invalid_grant for a code used twice', async () => {
+            const code = await authorizationCode();
+            const params = { grant_type: 'authorization_code', code, client_id: 'client1', client_secret: 'super_secret', redirect_uri: 'http://localhost:3000/callback' };
+            const first = await token(params);
+            expect(first.status).to.equal(200);
+            expect(first.headers.get('cache-control')).to.equal('no-store');
+            await expectError(await token(params), 400, 'invalid_grant');
+        });
+    });
+
+    describe('UserInfo endpoint', () => {
+
+        it('Should return a Bearer challenge without a token', async () => {
+            const response = await userinfo();
+            expect(response.status).to.equal(401);
+            expect(response.headers.get('www-authenticate')).to.include('Bearer');
+            expect(await response.json()).to.have.property('error', 'invalid_token');
+        });
+
+        it('Should return invalid_token for an invalid token', async () => {
+            const response = await userinfo('Bearer invalid-token');
+            expect(response.status).to.equal(401);
+            expect(response.headers.get('www-authenticate')).to.include('error="invalid_token"');
+            expect(await response.json()).to.deep.equal({ error: 'invalid_token', error_description: 'Invalid token' });
+        });
+    });
+});
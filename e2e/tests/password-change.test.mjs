@@ -0,0 +1,198 @@
+import crypto from 'crypto';
+import { expect } from 'chai';
+import { IdpClient, generateTotp, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('password-change', () => {
+
+    const client = new IdpClient('http://localhost:8094');
+
+    before(async () => {
+        await launchSnapshot('password-change');
+        await waitAvailable('http://localhost:8094');
+    });
+
+    after(async () => {
+        await teardownSnapshot('password-change');
+    });
+
+    async function loginComplete(params) {
+        const response = await fetch('http://localhost:8094/login/complete', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    describe('Login API', () => {
+
+        it('Should not require a password change for regular users', async () => {
+            const respInit = await client.loginInit({ username: 'regular', password: 'password5', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+        });
+
+        it('Should return a NEW_PASSWORD_REQUIRED challenge', async () => {
+            const respInit = await client.loginInit({ username: 'newbie', password: 'temporary1', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'NEW_PASSWORD_REQUIRED');
+        });
+
+        it('Should reject an empty new password', async () => {
+            const respInit = await client.loginInit({ username: 'newbie', password: 'temporary1', client_id: 'client1' });
+            const result = await loginComplete({ challenge_id: respInit.challenge_id, challenge_data: '' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error');
+        });
+
+        it('Should set the new password and issue tokens', async () => {
+            const respInit = await client.loginInit({ username: 'newbie', password: 'temporary1', client_id: 'client1' });
+            const respComplete = await client.loginComplete({ challenge_id: respInit.challenge_id, challenge_data: 'chosen-password1' });
+            expect(respComplete).to.have.property('access_token');
+
+            // The temporary password no longer works, and no further change is required
+            try {
+                await client.loginInit({ username: 'newbie', password: 'temporary1', client_id: 'client1' });
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('401');
+            }
+            const again = await client.loginInit({ username: 'newbie', password: 'chosen-password1', client_id: 'client1' });
+            expect(again).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+
+            const user = await client.getUserById('1');
+            expect(user).to.not.have.property('force_password_change');
+        });
+
+        it('Should continue with the user\'s challenge after the password change', async () => {
+            const respInit = await client.loginInit({ username: 'mfauser', password: 'temporary2', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'NEW_PASSWORD_REQUIRED');
+
+            const next = await client.loginComplete({ challenge_id: respInit.challenge_id, challenge_data: 'chosen-password2' });
+            expect(next).to.have.property('challenge_id', respInit.challenge_id);
+            expect(next).to.have.property('challenge_type', 'SOFTWARE_TOKEN_MFA');
+            expect(next).to.not.have.property('access_token');
+
+            const respComplete = await client.loginComplete({
+                challenge_id: respInit.challenge_id,
+                challenge_data: generateTotp('JBSWY3DPEHPK3PXP'),
+            });
+            expect(respComplete).to.have.property('access_token');
+        });
+    });
+
+    describe('OAuth2 login page', () => {
+
+        const form = {
+            client_id: 'client1',
+            redirect_uri: 'http://localhost:3000/callback',
+            scope: 'openid',
+            state: 'xyz',
+        };
+
+        function sessionFrom(html) {
+            return html.match(/name="session" value="([^"]+)"/)[1];
+        }
+
+        it('Should render the new password step', async () => {
+            const response = await client.oauth2AuthorizeSubmit({ ...form, username: 'webuser', password: 'temporary3' });
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Set a new password');
+            expect(html).to.include('name="new_password"');
+            expect(sessionFrom(html)).to.be.a('string');
+        });
+
+        it('Should reject mismatching passwords', async () => {
+            const first = await client.oauth2AuthorizeSubmit({ ...form, username: 'webuser', password: 'temporary3' });
+            const session = sessionFrom(await first.text());
+
+            const response = await client.oauth2AuthorizeSubmit({
+                ...form, session, new_password: 'chosen-password3', confirm_password: 'different',
+            });
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Passwords do not match');
+            expect(html).to.include('Set a new password');
+        });
+
+        it('Should reject invalid sessions', async () => {
+            const page = await client.oauth2Authorize({ ...form, response_type: 'code' });
+            const response = await client.oauth2AuthorizeSubmit({
+                authorization_request: page.match(/name="authorization_request" value="([^"]+)"/)[1], session: 'invalid', new_password: 'x', confirm_password: 'x',
+            });
+            const html = await response.text();
+            expect(html).to.include('Your session has expired');
+        });
+
+        it('Should set the new password and redirect with a code', async () => {
+            const first = await client.oauth2AuthorizeSubmit({ ...form, username: 'webuser', password: 'temporary3' });
+            const session = sessionFrom(await first.text());
+
+            const response = await client.oauth2AuthorizeSubmit({
+                ...form, session, new_password: 'chosen-password3', confirm_password: 'chosen-password3',
+            });
+            expect(response.status).to.equal(302);
+            const location = new URL(response.headers.get('location'));
+            expect(location.searchParams.get('state')).to.equal('xyz');
+
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: location.searchParams.get('code'),
+                client_id: 'client1',
+                client_secret: 'super_secret',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+            expect(tokens).to.have.property('access_token');
+
+            // The new password logs in directly
+            const again = await client.oauth2AuthorizeSubmit({ ...form, username: 'webuser', password: 'chosen-password3' });
+            expect(again.status).to.equal(302);
+        });
+    });
+
+    describe('Cognito API', () => {
+
+        it('Should report FORCE_CHANGE_PASSWORD and complete the challenge', async () => {
+            const status = await client.cognito('AdminGetUser', { UserPoolId: 'local_pool', Username: 'cognitouser' });
+            expect(status.body).to.have.property('UserStatus', 'FORCE_CHANGE_PASSWORD');
+
+            const SECRET_HASH = crypto.createHmac('sha256', 'super_secret').update('cognitouserclient1').digest('base64');
+
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'cognitouser', PASSWORD: 'temporary4', SECRET_HASH },
+            });
+            expect(result.body).to.have.property('ChallengeName', 'NEW_PASSWORD_REQUIRED');
+            expect(JSON.parse(result.body.ChallengeParameters.userAttributes)).to.have.property('email', 'cognito@example.com');
+
+            const response = await client.cognito('RespondToAuthChallenge', {
+                ChallengeName: 'NEW_PASSWORD_REQUIRED',
+                ClientId: 'client1',
+                Session: result.body.Session,
+                ChallengeResponses: {
+                    USERNAME: 'cognitouser',
+                    NEW_PASSWORD: 'chosen-password4',
+                    SECRET_HASH,
+                    'userAttributes.name': 'Cognito User',
+                    'userAttributes.email_verified': 'true',
+                },
+            });
+            expect(response.status).to.equal(200);
+            expect(response.body.AuthenticationResult).to.have.property('AccessToken');
+
+            const after = await client.cognito('AdminGetUser', { UserPoolId: 'local_pool', Username: 'cognitouser' });
+            expect(after.body).to.have.property('UserStatus', 'CONFIRMED');
+            expect(after.body.UserAttributes).to.deep.include({ Name: 'name', Value: 'Cognito User' });
+            expect(after.body.UserAttributes.map(attribute => attribute.Name)).to.not.include('email_verified');
+        });
+
+        it('AdminSetUserPassword without Permanent should force a password change', async () => {
+            await client.cognito('AdminSetUserPassword', { UserPoolId: 'local_pool', Username: 'regular', Password: 'temporary5' });
+            const status = await client.cognito('AdminGetUser', { UserPoolId: 'local_pool', Username: 'regular' });
+            expect(status.body).to.have.property('UserStatus', 'FORCE_CHANGE_PASSWORD');
+
+            const respInit = await client.loginInit({ username: 'regular', password: 'temporary5', client_id: 'client1' });
+            expect(respInit).to.have.property('challenge_type', 'NEW_PASSWORD_REQUIRED');
+        });
+    });
+});
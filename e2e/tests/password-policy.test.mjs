@@ -0,0 +1,189 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('password-policy', () => {
+
+    const baseUrl = 'http://localhost:8095';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('password-policy');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('password-policy');
+    });
+
+    async function putUser(id, body) {
+        const response = await fetch(`${baseUrl}/users/${id}`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async function loginInit(username, password) {
+        const response = await fetch(`${baseUrl}/login/init`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password, client_id: 'client1' }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+
+    describe('Password policy', () => {
+
+        const cases = [
+            ['Pa1!', 'at least 8 characters'],
+            ['Päß1!öü', 'at least 8 characters'],
+            ['password1!', 'uppercase'],
+            ['PASSWORD1!', 'lowercase'],
+            ['Password!!', 'number'],
+            ['Password11', 'symbol'],
+        ];
+
+        for (const [password, message] of cases) {
+            it(`Should reject "${password}" (${message})`, async () => {
+                const result = await putUser('10', { username: 'newuser', password });
+                expect(result.status).to.equal(400);
+                expect(result.body.error).to.include(message);
+            });
+        }
+
+        it('Should accept a password that satisfies the policy', async () => {
+            const result = await putUser('10', { username: 'newuser', password: 'Compliant1!' });
+            expect(result.status).to.equal(201);
+        });
+
+        it('Should not validate unchanged passwords when updating other fields', async () => {
+            const result = await putUser('10', { attributes: { email: 'new@example.com' } });
+            expect(result.status).to.equal(200);
+        });
+
+        it('Should reject reusing recent passwords', async () => {
+            expect((await putUser('10', { password: 'Compliant1!' })).body.error).to.include('used recently');
+
+            expect((await putUser('10', { password: 'Compliant2!' })).status).to.equal(200);
+            expect((await putUser('10', { password: 'Compliant1!' })).body.error).to.include('used recently');
+
+            // history_size 2 remembers the current and the previous password
+            expect((await putUser('10', { password: 'Compliant3!' })).status).to.equal(200);
+            expect((await putUser('10', { password: 'Compliant1!' })).status).to.equal(200);
+        });
+
+        it('Should require changing expired passwords', async () => {
+            const result = await loginInit('expired', 'Password2!');
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('challenge_type', 'NEW_PASSWORD_REQUIRED');
+
+            const weak = await fetch(`${baseUrl}/login/complete`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ challenge_id: result.body.challenge_id, challenge_data: 'weak' }),
+            });
+            expect(weak.status).to.equal(400);
+
+            const reused = await fetch(`${baseUrl}/login/complete`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ challenge_id: result.body.challenge_id, challenge_data: 'Password2!' }),
+            });
+            expect(reused.status).to.equal(400);
+
+            const respComplete = await client.loginComplete({ challenge_id: result.body.challenge_id, challenge_data: 'Renewed2!' });
+            expect(respComplete).to.have.property('access_token');
+
+            const again = await loginInit('expired', 'Renewed2!');
+            expect(again.body).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+        });
+
+        it('Should enforce the policy in the Cognito API', async () => {
+            const result = await client.cognito('AdminSetUserPassword', {
+                UserPoolId: 'local_pool',
+                Username: 'alice',
+                Password: 'weak',
+                Permanent: true,
+            });
+            expect(result.body).to.have.property('__type', 'InvalidPasswordException');
+        });
+    });
+
+    describe('Account lockout', () => {
+
+        it('Should lock the account after too many failed logins', async () => {
+            for (let i = 0; i < 3; i++) {
+                const result = await loginInit('locky', 'wrong');
+                expect(result.body).to.have.property('error', 'Invalid credentials');
+            }
+
+            // The correct password is rejected while the account is locked
+            const locked = await loginInit('locky', 'Password3!');
+            expect(locked.status).to.equal(401);
+            expect(locked.body).to.have.property('error', 'User is temporarily locked');
+
+            const user = await client.getUserById('3');
+            expect(user).to.have.property('locked_until');
+        });
+
+        it('Should unlock the account after the lockout duration', async () => {
+            await sleep(2100);
+            const result = await loginInit('locky', 'Password3!');
+            expect(result.status).to.equal(200);
+        });
+
+        it('Should reset the counter after a successful login', async () => {
+            await loginInit('locky', 'wrong');
+            await loginInit('locky', 'wrong');
+            await loginInit('locky', 'Password3!');
+            await loginInit('locky', 'wrong');
+
+            const result = await loginInit('locky', 'Password3!');
+            expect(result.status).to.equal(200);
+        });
+
+        it('Should unlock the account when the user is enabled', async () => {
+            for (let i = 0; i < 3; i++) {
+                await loginInit('locky', 'wrong');
+            }
+            expect((await loginInit('locky', 'Password3!')).body).to.have.property('error', 'User is temporarily locked');
+
+            await client.enableUser('3');
+            expect((await loginInit('locky', 'Password3!')).status).to.equal(200);
+        });
+
+        it('Should show the lockout on the OAuth2 login page', async () => {
+            const form = {
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+                username: 'weblocky',
+            };
+            for (let i = 0; i < 3; i++) {
+                const response = await client.oauth2AuthorizeSubmit({ ...form, password: 'wrong' });
+                expect(await response.text()).to.include('Invalid username or password');
+            }
+
+            const response = await client.oauth2AuthorizeSubmit({ ...form, password: 'Password4!' });
+            expect(response.status).to.equal(200);
+            expect(await response.text()).to.include('Account is temporarily locked');
+        });
+
+        it('Should lock the account in the Cognito API', async () => {
+            const auth = (password) => client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'cognitolocky', PASSWORD: password },
+            });
+            for (let i = 0; i < 3; i++) {
+                expect((await auth('wrong')).body).to.have.property('message', 'Incorrect username or password.');
+            }
+
+            const result = await auth('Password5!');
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+            expect(result.body).to.have.property('message', 'Password attempts exceeded');
+        });
+    });
+});
@@ -0,0 +1,288 @@
+import { expect } from 'chai';
+import { IdpClient, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('password-reset', () => {
+
+    const baseUrl = 'http://localhost:8098';
+    const client = new IdpClient(baseUrl);
+
+    before(async () => {
+        await launchSnapshot('password-reset');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('password-reset');
+    });
+
+    async function loginWithRefreshToken(username, password) {
+        const respInit = await client.loginInit({
+            username,
+            password,
+            client_id: 'client1',
+            issue_refresh_token: true,
+        });
+        return await client.loginComplete({ challenge_id: respInit.challenge_id });
+    }
+
+    async function loginInitStatus(username, password) {
+        const response = await fetch(`${baseUrl}/login/init`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password, client_id: 'client1' }),
+        });
+        return response.status;
+    }
+
+    async function latestMail(email) {
+        const messages = await client.getMail(email);
+        expect(messages.length).to.be.greaterThan(0);
+        return messages[messages.length - 1];
+    }
+
+    async function latestCode(email) {
+        const message = await latestMail(email);
+        return message.body.match(/password reset code is (\d{6})/)[1];
+    }
+
+    describe('Password reset API', () => {
+
+        it('Should email a reset code', async () => {
+            const result = await client.password('/forgot', { username: 'alice' });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('code_delivery_destination', 'a***@example.com');
+
+            const message = await latestMail('alice@example.com');
+            expect(message).to.have.property('from', 'idp@example.com');
+            expect(message).to.have.property('subject', 'Reset your password');
+            expect(message.body).to.match(/password reset code is \d{6}/);
+            expect(message.body).to.include(`${baseUrl}/oauth2/password/reset?`);
+        });
+
+        it('Should return 404 for unknown users', async () => {
+            const result = await client.password('/forgot', { username: 'unknown' });
+            expect(result.status).to.equal(404);
+        });
+
+        it('Should reject users without an email address', async () => {
+            const result = await client.password('/forgot', { username: 'noemail' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'User has no email address');
+        });
+
+        it('Should reject disabled users', async () => {
+            const result = await client.password('/forgot', { username: 'disabled' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'User is disabled');
+        });
+
+        it('Should reject a wrong code', async () => {
+            const result = await client.password('/reset', { username: 'alice', code: 'wrong', password: 'new-alice-password' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid password reset code');
+        });
+
+        it('Should enforce the password policy', async () => {
+            const code = await latestCode('alice@example.com');
+
+            const short = await client.password('/reset', { username: 'alice', code, password: 'short' });
+            expect(short.status).to.equal(400);
+            expect(short.body).to.have.property('error', 'Password must be at least 8 characters long');
+
+            const reused = await client.password('/reset', { username: 'alice', code, password: 'alice-password' });
+            expect(reused.status).to.equal(400);
+            expect(reused.body).to.have.property('error', 'Password has been used recently');
+        });
+
+        it('Should reset the password and revoke refresh tokens', async () => {
+            const tokens = await loginWithRefreshToken('alice', 'alice-password');
+            expect(tokens).to.have.property('refresh_token');
+
+            const code = await latestCode('alice@example.com');
+            const result = await client.password('/reset', { username: 'alice', code, password: 'new-alice-password' });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('message', 'Password reset');
+
+            expect(await loginInitStatus('alice', 'alice-password')).to.equal(401);
+            expect(await loginInitStatus('alice', 'new-alice-password')).to.equal(200);
+
+            try {
+                await client.loginRefresh({ refresh_token: tokens.refresh_token });
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('401');
+            }
+        });
+
+        it('Should not accept a code twice', async () => {
+            const code = await latestCode('alice@example.com');
+            const result = await client.password('/reset', { username: 'alice', code, password: 'other-alice-password' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid password reset code');
+        });
+
+        it('Should invalidate the code after too many wrong codes', async () => {
+            await client.password('/forgot', { username: 'alice' });
+            const code = await latestCode('alice@example.com');
+
+            for (let i = 0; i < 3; i++) {
+                const wrong = await client.password('/reset', { username: 'alice', code: 'wrong', password: 'other-alice-password' });
+                expect(wrong.status).to.equal(400);
+            }
+
+            const result = await client.password('/reset', { username: 'alice', code, password: 'other-alice-password' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid password reset code');
+        });
+    });
+
+    describe('Hosted password reset page', () => {
+
+        const oauthParams = {
+            client_id: 'client1',
+            redirect_uri: 'http://localhost:3000/callback',
+            state: 'state123',
+        };
+        let authorizationRequest;
+
+        before(async () => {
+            const html = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+            authorizationRequest = hiddenValue(html, 'authorization_request');
+        });
+
+        async function submit(form) {
+            const response = await fetch(`${baseUrl}/oauth2/password/forgot/submit`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+                body: new URLSearchParams({ authorization_request: authorizationRequest, ...form }),
+            });
+            return await response.text();
+        }
+
+        it('Should link the password reset page from the login form', async () => {
+            const html = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+            const request = hiddenValue(html, 'authorization_request');
+            expect(html).to.include(`/oauth2/password/forgot?authorization_request=${request}`);
+            expect(html).to.include('Forgot your password?');
+        });
+
+        it('Should render the request form', async () => {
+            const response = await fetch(`${baseUrl}/oauth2/password/forgot?authorization_request=${authorizationRequest}`);
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Send code');
+            expect(hiddenValue(html, 'authorization_request')).to.equal(authorizationRequest);
+        });
+
+        it('Should render the request form without a login to return to', async () => {
+            const response = await fetch(`${baseUrl}/oauth2/password/forgot?authorization_request=unknown`);
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Send code');
+            expect(html).to.not.include('/oauth2/authorize?');
+        });
+
+        it('Should show an error for unknown users', async () => {
+            const html = await submit({ username: 'unknown' });
+            expect(html).to.include('User not found');
+        });
+
+        it('Should send a code and ask for the new password', async () => {
+            const html = await submit({ username: 'bob' });
+            expect(html).to.include('Reset your password');
+            expect(html).to.include('b***@example.com');
+        });
+
+        it('Should show an error if the passwords do not match', async () => {
+            const code = await latestCode('bob@example.com');
+            const html = await submit({ username: 'bob', code, new_password: 'new-bob-password', confirm_password: 'other' });
+            expect(html).to.include('Passwords do not match');
+        });
+
+        it('Should reset the password with the emailed link and continue to login', async () => {
+            const message = await latestMail('bob@example.com');
+            const link = message.body.match(/(http:\/\/\S+\/oauth2\/password\/reset\?\S+)/)[1];
+            expect(link).to.include(`authorization_request=${authorizationRequest}`);
+            expect(link).to.not.include('state=');
+
+            const response = await fetch(link);
+            expect(response.status).to.equal(200);
+            const page = await response.text();
+            const code = await latestCode('bob@example.com');
+            expect(page).to.include(`value="${code}"`);
+
+            const html = await submit({ username: 'bob', code, new_password: 'new-bob-password', confirm_password: 'new-bob-password' });
+            expect(html).to.include('Password reset');
+            expect(html).to.include(`/oauth2/authorize?authorization_request=${authorizationRequest}`);
+
+            const login = await client.oauth2AuthorizeSubmit({ authorization_request: authorizationRequest, username: 'bob', password: 'new-bob-password' });
+            expect(login.status).to.equal(302);
+            expect(new URL(login.headers.get('location')).searchParams.get('state')).to.equal('state123');
+        });
+    });
+
+    describe('Cognito API', () => {
+
+        it('Should send a reset code', async () => {
+            const result = await client.cognito('ForgotPassword', { ClientId: 'client1', Username: 'carol' });
+            expect(result.status).to.equal(200);
+            expect(result.body.CodeDeliveryDetails).to.deep.equal({
+                AttributeName: 'email',
+                DeliveryMedium: 'EMAIL',
+                Destination: 'c***@example.com',
+            });
+        });
+
+        it('Should reject unknown users', async () => {
+            const result = await client.cognito('ForgotPassword', { ClientId: 'client1', Username: 'unknown' });
+            expect(result.body).to.have.property('__type', 'UserNotFoundException');
+        });
+
+        it('Should reject users without an email address', async () => {
+            const result = await client.cognito('ForgotPassword', { ClientId: 'client1', Username: 'noemail' });
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+        });
+
+        it('Should reject a wrong code', async () => {
+            const result = await client.cognito('ConfirmForgotPassword', {
+                ClientId: 'client1',
+                Username: 'carol',
+                ConfirmationCode: 'wrong',
+                Password: 'new-carol-password',
+            });
+            expect(result.body).to.have.property('__type', 'CodeMismatchException');
+        });
+
+        it('Should reject a password that violates the policy', async () => {
+            const result = await client.cognito('ConfirmForgotPassword', {
+                ClientId: 'client1',
+                Username: 'carol',
+                ConfirmationCode: await latestCode('carol@example.com'),
+                Password: 'short',
+            });
+            expect(result.body).to.have.property('__type', 'InvalidPasswordException');
+        });
+
+        it('Should reset the password', async () => {
+            const result = await client.cognito('ConfirmForgotPassword', {
+                ClientId: 'client1',
+                Username: 'carol',
+                ConfirmationCode: await latestCode('carol@example.com'),
+                Password: 'new-carol-password',
+            });
+            expect(result.status).to.equal(200);
+
+            const auth = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'carol', PASSWORD: 'new-carol-password' },
+            });
+            expect(auth.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should require the secret hash for clients with a secret', async () => {
+            const result = await client.cognito('ForgotPassword', { ClientId: 'secret-client', Username: 'carol' });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+    });
+});
@@ -0,0 +1,325 @@
+import { expect } from 'chai';
+import { IdpClient, decodeJwt, generateTotp, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('passwordless', () => {
+
+    const baseUrl = 'http://localhost:8101';
+    const client = new IdpClient(baseUrl);
+
+    const oauthParams = {
+        client_id: 'client1',
+        redirect_uri: 'http://localhost:3000/callback',
+        scope: 'openid profile email',
+        state: 'xyz',
+        nonce: 'n-0S6_WzA2Mj',
+    };
+
+    before(async () => {
+        await launchSnapshot('passwordless');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('passwordless');
+    });
+
+    async function latestMail(email) {
+        const messages = await client.getMail(email);
+        expect(messages.length).to.be.greaterThan(0);
+        return messages[messages.length - 1];
+    }
+
+    async function latestSms(phoneNumber) {
+        const messages = await client.getSms(phoneNumber);
+        expect(messages.length).to.be.greaterThan(0);
+        return messages[messages.length - 1];
+    }
+
+    function codeOf(message) {
+        return message.body.match(/sign-in code is (\d{6})/)[1];
+    }
+
+    function linkOf(message) {
+        return message.body.match(/(http:\/\/\S+\/passwordless\/callback\?token=[A-Za-z0-9_-]+)/)[1];
+    }
+
+    function sessionOf(html) {
+        return html.match(/name="session" value="([^"]+)"/)[1];
+    }
+
+    // Opens the passwordless page linked from the login page and returns its authorization request
+    async function passwordlessPage() {
+        const login = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+        const page = await fetch(`${baseUrl}${login.match(/href="(\/oauth2\/passwordless\?[^"]+)"/)[1]}`);
+        expect(page.status).to.equal(200);
+        const html = await page.text();
+        expect(html).to.include('name="delivery"');
+        return hiddenValue(html, 'authorization_request');
+    }
+
+    describe('Login API', () => {
+
+        it('Should email a code when logging in without a password', async () => {
+            const init = await client.passwordlessInit({ username: 'alice', client_id: 'client1' });
+            expect(init.status).to.equal(200);
+            expect(init.body).to.have.property('challenge_type', 'EMAIL_OTP');
+            expect(init.body).to.have.property('code_delivery_destination', 'a***@example.com');
+
+            const message = await latestMail('alice@example.com');
+            expect(message).to.have.property('subject', 'Your sign-in code');
+            expect(message.body).to.match(/sign-in code is \d{6}/);
+            expect(message.body).to.include(`${baseUrl}/passwordless/callback?token=`);
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, codeOf(message));
+            expect(complete.status).to.equal(200);
+            expect(complete.body).to.have.property('access_token');
+            const claims = decodeJwt(complete.body.identity_token);
+            expect(claims).to.have.property('sub', '1');
+            expect(claims.amr).to.deep.equal(['email']);
+        });
+
+        it('Should find the user by email address', async () => {
+            const init = await client.passwordlessInit({ username: 'Alice@Example.com', client_id: 'client1' });
+            expect(init.status).to.equal(200);
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, codeOf(await latestMail('alice@example.com')));
+            expect(complete.status).to.equal(200);
+            expect(decodeJwt(complete.body.identity_token)).to.have.property('sub', '1');
+        });
+
+        it('Should text a code to users without an email address', async () => {
+            const init = await client.passwordlessInit({ username: 'bob', client_id: 'client1' });
+            expect(init.status).to.equal(200);
+            expect(init.body).to.have.property('challenge_type', 'SMS_OTP');
+            expect(init.body).to.have.property('code_delivery_destination', '+*******0102');
+
+            const message = await latestSms('+15555550102');
+            expect(message.body).to.match(/^Your sign-in code is \d{6} or open http/);
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, codeOf(message));
+            expect(complete.status).to.equal(200);
+            expect(decodeJwt(complete.body.identity_token).amr).to.deep.equal(['sms']);
+        });
+
+        it('Should text a code when SMS delivery is requested', async () => {
+            const init = await client.passwordlessInit({ username: 'carol', client_id: 'client1', delivery: 'sms' });
+            expect(init.status).to.equal(200);
+            expect(init.body).to.have.property('challenge_type', 'SMS_OTP');
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, codeOf(await latestSms('+15555550103')));
+            expect(complete.status).to.equal(200);
+        });
+
+        it('Should reject an unknown delivery', async () => {
+            const init = await client.passwordlessInit({ username: 'carol', client_id: 'client1', delivery: 'pigeon' });
+            expect(init.status).to.equal(400);
+            expect(init.body).to.have.property('error', "Delivery must be 'email' or 'sms'");
+        });
+
+        it('Should reject users without an email address or phone number', async () => {
+            const init = await client.passwordlessInit({ username: 'nocontact', client_id: 'client1' });
+            expect(init.status).to.equal(400);
+            expect(init.body).to.have.property('error', 'User has no email address or phone number to send a code to');
+
+            const sms = await client.passwordlessInit({ username: 'alice', client_id: 'client1', delivery: 'sms' });
+            expect(sms.status).to.equal(400);
+            expect(sms.body).to.have.property('error', 'User has no phone number');
+        });
+
+        it('Should reject unknown and disabled users', async () => {
+            const unknown = await client.passwordlessInit({ username: 'nobody', client_id: 'client1' });
+            expect(unknown.status).to.equal(401);
+            expect(unknown.body).to.have.property('error', 'Invalid credentials');
+
+            const disabled = await client.passwordlessInit({ username: 'disabled', client_id: 'client1' });
+            expect(disabled.status).to.equal(401);
+            expect(disabled.body).to.have.property('error', 'User is disabled');
+        });
+
+        it('Should still log in with a password', async () => {
+            const init = await client.loginInit({ username: 'alice', password: 'alice-password', client_id: 'client1' });
+            expect(init).to.have.property('challenge_type', 'CUSTOM_CHALLENGE');
+
+            const complete = await client.loginComplete({ challenge_id: init.challenge_id });
+            expect(decodeJwt(complete.identity_token).amr).to.deep.equal(['pwd']);
+        });
+
+        it('Should limit the number of wrong codes', async () => {
+            const init = await client.passwordlessInit({ username: 'alice', client_id: 'client1' });
+            const code = codeOf(await latestMail('alice@example.com'));
+
+            const first = await client.passwordlessComplete(init.body.challenge_id, '000000');
+            expect(first.status).to.equal(401);
+            expect(first.body).to.have.property('error', 'Invalid code');
+            await client.passwordlessComplete(init.body.challenge_id, '000000');
+            const last = await client.passwordlessComplete(init.body.challenge_id, '000000');
+            expect(last.body).to.have.property('error', 'Too many failed attempts');
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, code);
+            expect(complete.status).to.equal(401);
+            expect(complete.body).to.have.property('error', 'Invalid challenge');
+        });
+
+        it('Should wait for the magic link without counting attempts', async () => {
+            const init = await client.passwordlessInit({ username: 'alice', client_id: 'client1', issue_refresh_token: true });
+            const link = linkOf(await latestMail('alice@example.com'));
+
+            for (let i = 0; i < 4; i++) {
+                const pending = await client.passwordlessComplete(init.body.challenge_id, '');
+                expect(pending.status).to.equal(401);
+                expect(pending.body).to.have.property('error', 'The magic link has not been opened yet');
+            }
+
+            const callback = await client.passwordlessCallback(link);
+            expect(callback.status).to.equal(200);
+            expect(await callback.text()).to.include('You are signed in');
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, '');
+            expect(complete.status).to.equal(200);
+            expect(complete.body).to.have.property('refresh_token');
+            expect(decodeJwt(complete.body.identity_token).amr).to.deep.equal(['email']);
+        });
+
+        it('Should continue with the TOTP challenge', async () => {
+            const init = await client.passwordlessInit({ username: 'totpuser', client_id: 'client1' });
+            expect(init.status).to.equal(200);
+
+            const code = await client.passwordlessComplete(init.body.challenge_id, codeOf(await latestMail('totp@example.com')));
+            expect(code.status).to.equal(200);
+            expect(code.body).to.deep.equal({ challenge_id: init.body.challenge_id, challenge_type: 'SOFTWARE_TOKEN_MFA' });
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, generateTotp('JBSWY3DPEHPK3PXP'));
+            expect(complete.status).to.equal(200);
+            expect(decodeJwt(complete.body.identity_token).amr).to.deep.equal(['email', 'otp']);
+        });
+
+        it('Should expire the code', async () => {
+            const init = await client.passwordlessInit({ username: 'alice', client_id: 'client1' });
+            const message = await latestMail('alice@example.com');
+
+            await new Promise(resolve => setTimeout(resolve, 6000));
+
+            const complete = await client.passwordlessComplete(init.body.challenge_id, codeOf(message));
+            expect(complete.status).to.equal(401);
+            expect(complete.body).to.have.property('error', 'Challenge expired');
+
+            const callback = await client.passwordlessCallback(linkOf(message));
+            expect(callback.status).to.equal(400);
+            expect(await callback.text()).to.include('This sign-in link is invalid or has expired');
+        });
+    });
+
+    describe('Hosted login page', () => {
+
+        it('Should link to the passwordless page', async () => {
+            const html = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+            expect(html).to.include('Sign in without a password');
+            expect(html).to.include('/oauth2/passwordless?authorization_request=');
+        });
+
+        it('Should reject an unknown authorization request', async () => {
+            const response = await fetch(`${baseUrl}/oauth2/passwordless?client_id=client1&redirect_uri=${encodeURIComponent(oauthParams.redirect_uri)}`);
+            expect(response.status).to.equal(400);
+            expect(await response.text()).to.include('The login has expired, please start over from the application');
+
+            const submit = await client.passwordlessSubmit({ ...oauthParams, authorization_request: 'unknown', username: 'alice' });
+            expect(submit.status).to.equal(400);
+        });
+
+        it('Should sign in with the emailed code', async () => {
+            const authorization_request = await passwordlessPage();
+            const start = await client.passwordlessSubmit({ authorization_request, username: 'alice' });
+            const html = await start.text();
+            expect(html).to.include('Enter the code we sent to a***@example.com');
+            const session = sessionOf(html);
+
+            const wrong = await client.passwordlessSubmit({ authorization_request, session, code: '000000' });
+            expect(await wrong.text()).to.include('Invalid code');
+
+            const submit = await client.passwordlessSubmit({ authorization_request, session, code: codeOf(await latestMail('alice@example.com')) });
+            expect(submit.status).to.equal(302);
+            const location = new URL(submit.headers.get('location'));
+            expect(location.searchParams.get('state')).to.equal('xyz');
+
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: location.searchParams.get('code'),
+                redirect_uri: oauthParams.redirect_uri,
+                client_id: 'client1',
+            });
+            const claims = decodeJwt(tokens.id_token);
+            expect(claims).to.have.property('sub', '1');
+            expect(claims).to.have.property('nonce', oauthParams.nonce);
+            expect(claims.amr).to.deep.equal(['email']);
+        });
+
+        it('Should sign in with the magic link', async () => {
+            await client.passwordlessSubmit({ authorization_request: await passwordlessPage(), username: 'bob' });
+            const link = linkOf(await latestSms('+15555550102'));
+
+            const callback = await client.passwordlessCallback(link);
+            expect(callback.status).to.equal(302);
+            const location = new URL(callback.headers.get('location'));
+            expect(location.origin + location.pathname).to.equal(oauthParams.redirect_uri);
+            expect(location.searchParams.get('state')).to.equal('xyz');
+            expect(location.searchParams.get('code')).to.be.a('string');
+
+            // The link can only be used once
+            const again = await client.passwordlessCallback(link);
+            expect(again.status).to.equal(400);
+        });
+
+        it('Should ask for the TOTP code after the emailed code', async () => {
+            const authorization_request = await passwordlessPage();
+            const start = await client.passwordlessSubmit({ authorization_request, username: 'totpuser' });
+            const session = sessionOf(await start.text());
+
+            const submit = await client.passwordlessSubmit({ authorization_request, session, code: codeOf(await latestMail('totp@example.com')) });
+            expect(submit.status).to.equal(200);
+            const html = await submit.text();
+            expect(html).to.include('name="mfa_code"');
+
+            const verified = await client.oauth2AuthorizeSubmit({ session: sessionOf(html), mfa_code: generateTotp('JBSWY3DPEHPK3PXP') });
+            expect(verified.status).to.equal(302);
+        });
+
+        it('Should limit the number of wrong codes', async () => {
+            const authorization_request = await passwordlessPage();
+            const start = await client.passwordlessSubmit({ authorization_request, username: 'carol' });
+            const session = sessionOf(await start.text());
+
+            await client.passwordlessSubmit({ authorization_request, session, code: '000000' });
+            await client.passwordlessSubmit({ authorization_request, session, code: '000000' });
+            const last = await client.passwordlessSubmit({ authorization_request, session, code: '000000' });
+            expect(await last.text()).to.include('Too many failed attempts, please request a new code');
+        });
+
+        it('Should show an error for unknown and disabled users', async () => {
+            const authorization_request = await passwordlessPage();
+            const unknown = await client.passwordlessSubmit({ authorization_request, username: 'nobody' });
+            expect(await unknown.text()).to.include('User not found');
+
+            const disabled = await client.passwordlessSubmit({ authorization_request, username: 'disabled' });
+            expect(await disabled.text()).to.include('User is disabled');
+        });
+    });
+
+    describe('SMS inbox', () => {
+
+        it('Should return a message by ID', async () => {
+            const [message] = await client.getSms('+15555550102');
+            const response = await fetch(`${baseUrl}/sms/${message.id}`);
+            expect(response.status).to.equal(200);
+            expect(await response.json()).to.deep.equal(message);
+
+            const missing = await fetch(`${baseUrl}/sms/unknown`);
+            expect(missing.status).to.equal(404);
+        });
+
+        it('Should clear the inbox', async () => {
+            const result = await client.clearSms();
+            expect(result).to.have.property('message', 'SMS inbox cleared');
+            expect(await client.getSms()).to.deep.equal([]);
+        });
+    });
+});
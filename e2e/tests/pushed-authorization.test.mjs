@@ -0,0 +1,164 @@
+import { expect } from 'chai';
+import { IdpClient, decodeJwt, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('pushed-authorization', () => {
+
+    const baseUrl = 'http://localhost:8107';
+    const client = new IdpClient(baseUrl);
+    const redirectUri = 'http://localhost:3000/callback';
+
+    before(async () => {
+        await launchSnapshot('pushed-authorization');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('pushed-authorization');
+    });
+
+    function basic(clientId, secret) {
+        return { 'Authorization': `Basic ${Buffer.from(`${clientId}:${secret}`).toString('base64')}` };
+    }
+
+    function authorize(params) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams(params)}`, { redirect: 'manual' });
+    }
+
+    function push(params, clientId = 'client1', secret = 'super_secret') {
+        return client.pushAuthorizationRequest(
+            { response_type: 'code', redirect_uri: redirectUri, ...params },
+            secret ? basic(clientId, secret) : {},
+        );
+    }
+
+    // Logs in on the login page and exchanges the code, returning the authorization response and the tokens
+    async function login(page, clientId = 'client1', secret = 'super_secret') {
+        const response = await client.oauth2AuthorizeSubmit({ authorization_request: hiddenValue(await page.text(), 'authorization_request'), username: 'user1', password: 'password1' });
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        const token = await fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded', ...basic(clientId, secret) },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code: location.searchParams.get('code'), redirect_uri: redirectUri }),
+        });
+        expect(token.status).to.equal(200);
+        return { location, tokens: await token.json() };
+    }
+
+    it('Should advertise the pushed authorization request endpoint', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config).to.have.property('pushed_authorization_request_endpoint', `${baseUrl}/oauth2/par`);
+    });
+
+    it('Should return a request URI for an authenticated client', async () => {
+        const response = await push({ scope: 'openid', state: 'xyz' });
+        expect(response.status).to.equal(201);
+        expect(response.headers.get('cache-control')).to.equal('no-store');
+        expect(response.body.request_uri).to.match(/^urn:ietf:params:oauth:request_uri:/);
+        expect(response.body.expires_in).to.equal(60);
+    });
+
+    it('Should accept client_secret_post and public clients', async () => {
+        const post = await client.pushAuthorizationRequest({ response_type: 'code', redirect_uri: redirectUri, client_id: 'client1', client_secret: 'super_secret' });
+        expect(post.status).to.equal(201);
+
+        const pub = await client.pushAuthorizationRequest({ response_type: 'code', redirect_uri: 'http://localhost:3000/public', client_id: 'public1' });
+        expect(pub.status).to.equal(201);
+    });
+
+    it('Should reject requests without valid client authentication', async () => {
+        const missing = await push({}, 'client1', null);
+        expect(missing.status).to.equal(401);
+        expect(missing.body).to.have.property('error', 'invalid_client');
+
+        const wrong = await push({}, 'client1', 'wrong');
+        expect(wrong.status).to.equal(401);
+        expect(wrong.body).to.have.property('error', 'invalid_client');
+    });
+
+    it('Should validate the pushed parameters', async () => {
+        const redirect = await push({ redirect_uri: 'http://localhost:3000/other' });
+        expect(redirect.status).to.equal(400);
+        expect(redirect.body).to.have.property('error', 'invalid_request');
+
+        const responseType = await push({ response_type: 'device' });
+        expect(responseType.status).to.equal(400);
+        expect(responseType.body).to.have.property('error', 'unsupported_response_type');
+
+        const nested = await push({ request_uri: 'urn:ietf:params:oauth:request_uri:abc' });
+        expect(nested.status).to.equal(400);
+        expect(nested.body).to.have.property('error', 'invalid_request');
+    });
+
+    it('Should show the login page with the pushed parameters', async () => {
+        const { body } = await push({ scope: 'openid email', state: 'pushed-state', nonce: 'pushed-nonce' });
+        const page = await authorize({ client_id: 'client1', request_uri: body.request_uri });
+        expect(page.status).to.equal(200);
+        const { location, tokens } = await login(page);
+        expect(location.searchParams.get('state')).to.equal('pushed-state');
+        expect(decodeJwt(tokens.id_token)).to.have.property('nonce', 'pushed-nonce');
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid email');
+    });
+
+    it('Should accept a request URI only once', async () => {
+        const { body } = await push({});
+        expect((await authorize({ client_id: 'client1', request_uri: body.request_uri })).status).to.equal(200);
+
+        const second = await authorize({ client_id: 'client1', request_uri: body.request_uri });
+        expect(second.status).to.equal(400);
+        expect(await second.text()).to.include('invalid_request_uri');
+    });
+
+    it('Should reject unknown request URIs and request URIs of other clients', async () => {
+        const unknown = await authorize({ client_id: 'client1', request_uri: 'urn:ietf:params:oauth:request_uri:unknown' });
+        expect(unknown.status).to.equal(400);
+        expect(await unknown.text()).to.include('invalid_request_uri');
+
+        const { body } = await push({});
+        const other = await authorize({ client_id: 'public1', request_uri: body.request_uri });
+        expect(other.status).to.equal(400);
+        expect(await other.text()).to.include('invalid_request_uri');
+    });
+
+    it('Should require pushed authorization requests for clients configured to', async () => {
+        const direct = await authorize({ client_id: 'par-client', redirect_uri: redirectUri, response_type: 'code', state: 'abc' });
+        expect(direct.status).to.equal(302);
+        const location = new URL(direct.headers.get('location'));
+        expect(location.searchParams.get('error')).to.equal('invalid_request');
+        expect(location.searchParams.get('state')).to.equal('abc');
+
+        const { body } = await push({}, 'par-client', 'par_secret');
+        const page = await authorize({ client_id: 'par-client', request_uri: body.request_uri });
+        expect(page.status).to.equal(200);
+    });
+
+    it('Should complete the authorization code flow', async () => {
+        const { body } = await push({ scope: 'openid email' }, 'par-client', 'par_secret');
+        const page = await authorize({ client_id: 'par-client', request_uri: body.request_uri });
+        expect(page.status).to.equal(200);
+
+        const { tokens } = await login(page, 'par-client', 'par_secret');
+        expect(decodeJwt(tokens.access_token)).to.have.property('scope', 'openid email');
+    });
+
+    it('Should not log in with parameters posted to the login form', async () => {
+        const login = await fetch(`${baseUrl}/oauth2/authorize/submit`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: new URLSearchParams({ client_id: 'par-client', redirect_uri: redirectUri, response_type: 'code', scope: 'openid', username: 'user1', password: 'password1' }),
+            redirect: 'manual',
+        });
+        expect(login.status).to.equal(400);
+        expect(await login.text()).to.include('The login has expired, please start over from the application');
+    });
+
+    it('Should let the admin API require pushed authorization requests', async () => {
+        const { status, body } = await client.putClient('public1', { require_pushed_authorization_requests: true });
+        expect(status).to.equal(200);
+        expect(body).to.have.property('require_pushed_authorization_requests', true);
+
+        const direct = await authorize({ client_id: 'public1', redirect_uri: 'http://localhost:3000/public', response_type: 'code' });
+        expect(direct.status).to.equal(302);
+        expect(new URL(direct.headers.get('location')).searchParams.get('error')).to.equal('invalid_request');
+    });
+});
@@ -0,0 +1,252 @@
+import { expect } from 'chai';
+import crypto from 'crypto';
+import http from 'http';
+import { IdpClient, hiddenValue, launchSnapshot, signJwt, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('request-objects', () => {
+
+    const baseUrl = 'http://localhost:8108';
+    const client = new IdpClient(baseUrl);
+    const redirectUri = 'http://localhost:3000/callback';
+
+    // Private key of the EC key configured for jar-client
+    const jarClientKey = crypto.createPrivateKey({
+        format: 'jwk',
+        key: {
+            kty: 'EC',
+            crv: 'P-256',
+            x: 'AjIkOQ4aPWPn_kML9UHr7QHTkLpojgE_MXc_-TKcZEA',
+            y: 'HnKv3Z6658xSDLI5KPuiojyv624HqO0PWdyD-g0bPlg',
+            d: '6JysuFa9p5dmQYCUKsDKs-dWeB-6AZR4q7gmxNMvjOw',
+        },
+    });
+
+    // Serves request objects passed by reference
+    const requestObjects = new Map();
+    const fetchedUrls = [];
+    let requestObjectServer;
+
+    before(async () => {
+        requestObjectServer = http.createServer((req, res) => {
+            fetchedUrls.push(req.url);
+            const requestObject = requestObjects.get(req.url);
+            res.writeHead(requestObject ? 200 : 404, { 'Content-Type': 'application/oauth-authz-req+jwt' });
+            res.end(requestObject ?? '');
+        });
+        await new Promise(resolve => requestObjectServer.listen(9092, '0.0.0.0', resolve));
+        await launchSnapshot('request-objects');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('request-objects');
+        await new Promise(resolve => requestObjectServer.close(resolve));
+    });
+
+    function requestObject(claims = {}, { alg = 'ES256', key = jarClientKey, kid = 'jar-key-1' } = {}) {
+        const now = Math.floor(Date.now() / 1000);
+        return signJwt({
+            iss: 'jar-client',
+            aud: baseUrl,
+            client_id: 'jar-client',
+            response_type: 'code',
+            redirect_uri: redirectUri,
+            scope: 'openid email',
+            state: 'signed-state',
+            nonce: 'signed-nonce',
+            iat: now,
+            exp: now + 60,
+            ...claims,
+        }, { alg, key, kid });
+    }
+
+    function authorize(params) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams(params)}`, { redirect: 'manual' });
+    }
+
+    // Logs in on the login page and returns the authorization response
+    async function login(page) {
+        const response = await client.oauth2AuthorizeSubmit({ authorization_request: hiddenValue(await page.text(), 'authorization_request'), username: 'user1', password: 'password1' });
+        expect(response.status).to.equal(302);
+        const location = new URL(response.headers.get('location'));
+        expect(location.origin + location.pathname).to.equal(redirectUri);
+        return location;
+    }
+
+    it('Should advertise request object support', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config).to.have.property('request_parameter_supported', true);
+        expect(config).to.have.property('request_uri_parameter_supported', true);
+        expect(config.request_object_signing_alg_values_supported).to.include('ES256');
+        expect(config.request_object_signing_alg_values_supported).to.include('RS256');
+        expect(config.request_object_signing_alg_values_supported).to.include('HS256');
+        expect(config.request_object_signing_alg_values_supported).to.not.include('none');
+    });
+
+    it('Should use the parameters of a signed request object', async () => {
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request: requestObject() });
+        expect(page.status).to.equal(200);
+        const location = await login(page);
+        expect(location.searchParams.get('state')).to.equal('signed-state');
+    });
+
+    it('Should let the request object override query parameters', async () => {
+        const page = await authorize({
+            client_id: 'jar-client',
+            response_type: 'code',
+            redirect_uri: 'http://localhost:3000/other',
+            state: 'query-state',
+            prompt: 'login',
+            request: requestObject(),
+        });
+        expect(page.status).to.equal(200);
+        const location = await login(page);
+        expect(location.searchParams.get('state')).to.equal('signed-state');
+    });
+
+    it('Should ignore query parameters missing from the request object', async () => {
+        const page = await authorize({
+            client_id: 'jar-client',
+            response_type: 'code',
+            response_mode: 'fragment',
+            prompt: 'none',
+            state: 'query-state',
+            request: requestObject({ state: undefined }),
+        });
+        expect(page.status).to.equal(200);
+        const location = await login(page);
+        expect(location.hash).to.equal('');
+        expect(location.searchParams.has('code')).to.equal(true);
+        expect(location.searchParams.has('state')).to.equal(false);
+    });
+
+    it('Should accept request objects signed with the client secret', async () => {
+        const request = requestObject({ iss: 'secret-client', client_id: 'secret-client' }, { alg: 'HS256', key: 'secret-client-secret-with-at-least-32-bytes' });
+        const page = await authorize({ client_id: 'secret-client', response_type: 'code', request });
+        expect(page.status).to.equal(200);
+    });
+
+    it('Should fetch request objects passed by reference', async () => {
+        requestObjects.set('/request.jwt', requestObject({ state: 'referenced-state' }));
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request_uri: 'http://host.docker.internal:9092/request.jwt' });
+        expect(page.status).to.equal(200);
+        expect((await login(page)).searchParams.get('state')).to.equal('referenced-state');
+    });
+
+    it('Should ignore the fragment of a request_uri', async () => {
+        requestObjects.set('/request.jwt', requestObject({ state: 'fragment-state' }));
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request_uri: 'http://host.docker.internal:9092/request.jwt#v2' });
+        expect(page.status).to.equal(200);
+        expect((await login(page)).searchParams.get('state')).to.equal('fragment-state');
+    });
+
+    it('Should only fetch request URIs registered for the client', async () => {
+        requestObjects.set('/unregistered.jwt', requestObject());
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request_uri: 'http://host.docker.internal:9092/unregistered.jwt' });
+        expect(page.status).to.equal(400);
+        expect(await page.text()).to.include('request_uri is not registered for the client');
+        expect(fetchedUrls).to.not.include('/unregistered.jwt');
+
+        const other = await authorize({ client_id: 'secret-client', response_type: 'code', request_uri: 'http://host.docker.internal:9092/request.jwt' });
+        expect(other.status).to.equal(400);
+        expect(await other.text()).to.include('invalid_request_uri');
+    });
+
+    it('Should reject invalid request URIs in the admin API', async () => {
+        const { status } = await client.putClient('secret-client', { request_uris: ['ftp://host.docker.internal/request.jwt'] });
+        expect(status).to.equal(400);
+    });
+
+    it('Should accept a request object with a jti only once', async () => {
+        const request = requestObject({ jti: crypto.randomUUID() });
+        const first = await authorize({ client_id: 'jar-client', response_type: 'code', request });
+        expect(first.status).to.equal(200);
+
+        const replayed = await authorize({ client_id: 'jar-client', response_type: 'code', request });
+        expect(replayed.status).to.equal(400);
+        expect(await replayed.text()).to.include('jti was already used');
+    });
+
+    it('Should reject a request_uri that cannot be fetched', async () => {
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request_uri: 'http://host.docker.internal:9092/missing.jwt' });
+        expect(page.status).to.equal(400);
+        expect(await page.text()).to.include('invalid_request_uri');
+    });
+
+    it('Should reject request and request_uri together', async () => {
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request: requestObject(), request_uri: 'http://host.docker.internal:9092/request.jwt' });
+        expect(page.status).to.equal(400);
+        expect(await page.text()).to.include('request and request_uri cannot both be used');
+    });
+
+    describe('Invalid request objects', () => {
+
+        const otherKey = crypto.generateKeyPairSync('ec', { namedCurve: 'P-256' }).privateKey;
+        const unsigned = `${Buffer.from(JSON.stringify({ alg: 'none' })).toString('base64url')}.${Buffer.from(JSON.stringify({ client_id: 'jar-client', redirect_uri: redirectUri })).toString('base64url')}.`;
+
+        const invalid = [
+            ['an unsigned request object', () => unsigned],
+            ['a request object signed with another key', () => requestObject({}, { key: otherKey })],
+            ['an expired request object', () => requestObject({ exp: Math.floor(Date.now() / 1000) - 120 })],
+            ['a request object without exp', () => requestObject({ exp: undefined })],
+            ['a request object that expires too far in the future', () => requestObject({ exp: Math.floor(Date.now() / 1000) + 7200 })],
+            ['a request object without iss', () => requestObject({ iss: undefined })],
+            ['a request object without aud', () => requestObject({ aud: undefined })],
+            ['a request object for another audience', () => requestObject({ aud: 'http://localhost:9999' })],
+            ['a request object issued by another client', () => requestObject({ iss: 'secret-client' })],
+            ['a request object with another client_id', () => requestObject({ client_id: 'secret-client' })],
+            ['a nested request_uri', () => requestObject({ request_uri: 'http://host.docker.internal:9092/request.jwt' })],
+            ['a malformed request object', () => 'not-a-jwt'],
+        ];
+
+        for (const [name, request] of invalid) {
+            it(`Should reject ${name}`, async () => {
+                const page = await authorize({ client_id: 'jar-client', response_type: 'code', redirect_uri: redirectUri, request: request() });
+                expect(page.status).to.equal(400);
+                expect(page.headers.get('location')).to.equal(null);
+                expect(await page.text()).to.include('invalid_request_object');
+            });
+        }
+    });
+
+    it('Should reject an unknown client', async () => {
+        const page = await authorize({ client_id: 'unknown', response_type: 'code', request: requestObject() });
+        expect(page.status).to.equal(400);
+    });
+
+    it('Should accept a request object at the pushed authorization request endpoint', async () => {
+        const basic = { 'Authorization': `Basic ${Buffer.from('jar-client:jar-client-secret-with-at-least-32-bytes').toString('base64')}` };
+        const pushed = await client.pushAuthorizationRequest({ client_id: 'jar-client', request: requestObject({ state: 'pushed-state' }) }, basic);
+        expect(pushed.status).to.equal(201);
+
+        const page = await authorize({ client_id: 'jar-client', request_uri: pushed.body.request_uri });
+        expect(page.status).to.equal(200);
+        expect((await login(page)).searchParams.get('state')).to.equal('pushed-state');
+
+        const invalid = await client.pushAuthorizationRequest({ client_id: 'jar-client', request: requestObject({}, { key: crypto.generateKeyPairSync('ec', { namedCurve: 'P-256' }).privateKey }) }, basic);
+        expect(invalid.status).to.equal(400);
+        expect(invalid.body).to.have.property('error', 'invalid_request_object');
+    });
+
+    it('Should complete the authorization code flow', async () => {
+        const page = await authorize({ client_id: 'jar-client', response_type: 'code', request: requestObject() });
+        expect(page.status).to.equal(200);
+
+        // Parameters posted with the login form do not replace the signed ones
+        const authorization_request = hiddenValue(await page.text(), 'authorization_request');
+        const submitted = await client.oauth2AuthorizeSubmit({ authorization_request, client_id: 'jar-client', redirect_uri: redirectUri, state: 'tampered-state', nonce: 'tampered-nonce', username: 'user1', password: 'password1' });
+        expect(submitted.status).to.equal(302);
+        const location = new URL(submitted.headers.get('location'));
+        expect(location.searchParams.get('state')).to.equal('signed-state');
+
+        const response = await fetch(`${baseUrl}/oauth2/token`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: new URLSearchParams({ grant_type: 'authorization_code', code: location.searchParams.get('code'), redirect_uri: redirectUri, client_id: 'jar-client', client_secret: 'jar-client-secret-with-at-least-32-bytes' }),
+        });
+        expect(response.status).to.equal(200);
+        const tokens = await response.json();
+        const idToken = JSON.parse(Buffer.from(tokens.id_token.split('.')[1], 'base64url').toString());
+        expect(idToken).to.have.property('nonce', 'signed-nonce');
+    });
+});
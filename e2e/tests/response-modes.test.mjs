@@ -0,0 +1,208 @@
+import { expect } from 'chai';
+import { createPublicKey, verify } from 'node:crypto';
+import { IdpClient, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('response-modes', () => {
+
+    const baseUrl = 'http://localhost:8110';
+    const client = new IdpClient(baseUrl);
+    const redirectUri = 'http://localhost:3000/callback';
+
+    before(async () => {
+        await launchSnapshot('response-modes');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('response-modes');
+    });
+
+    function authorize(params) {
+        return fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams(params)}`, { redirect: 'manual' });
+    }
+
+    function login(params) {
+        return client.oauth2AuthorizeSubmit({
+            client_id: 'client1',
+            redirect_uri: redirectUri,
+            response_type: 'code',
+            scope: 'openid profile',
+            state: 'state123',
+            nonce: 'nonce123',
+            username: 'user1',
+            password: 'password1',
+            ...params,
+        });
+    }
+
+    // Returns the parameters posted by the auto-submitting form
+    async function formPost(response, action = redirectUri) {
+        expect(response.status).to.equal(200);
+        expect(response.headers.get('cache-control')).to.equal('no-store');
+        const html = await response.text();
+        expect(html).to.include(`action="${action}"`);
+        expect(html).to.include('document.forms[0].submit()');
+        return new URLSearchParams([...html.matchAll(/name="([^"]+)" value="([^"]*)"/g)].map((match) => [match[1], match[2]]));
+    }
+
+    // Verifies a JWT secured authorization response with the IdP's keys and returns its claims
+    async function verifyResponse(token) {
+        const [header, payload, signature] = token.split('.');
+        const { kid, alg } = JSON.parse(Buffer.from(header, 'base64url').toString());
+        expect(alg).to.equal('RS256');
+        const jwks = await client.getJwks();
+        const jwk = jwks.keys.find((key) => key.kid === kid);
+        const key = createPublicKey({ key: jwk, format: 'jwk' });
+        expect(verify('sha256', Buffer.from(`${header}.${payload}`), key, Buffer.from(signature, 'base64url'))).to.equal(true);
+        return JSON.parse(Buffer.from(payload, 'base64url').toString());
+    }
+
+    function exchangeCode(code) {
+        return client.oauth2Token({
+            grant_type: 'authorization_code',
+            code,
+            client_id: 'client1',
+            client_secret: 'super_secret',
+            redirect_uri: redirectUri,
+        });
+    }
+
+    it('Should advertise the response modes', async () => {
+        const config = await client.getOpenIdConfiguration();
+        expect(config.response_modes_supported).to.deep.equal(['query', 'fragment', 'form_post', 'jwt', 'query.jwt', 'fragment.jwt', 'form_post.jwt']);
+        expect(config.authorization_signing_alg_values_supported).to.deep.equal(['RS256']);
+    });
+
+    it('Should keep the response mode through the login page', async () => {
+        const page = await client.oauth2Authorize({ client_id: 'client1', redirect_uri: redirectUri, response_type: 'code', response_mode: 'form_post' });
+        const params = await formPost(await login({ authorization_request: hiddenValue(page, 'authorization_request') }));
+        expect(params.has('code')).to.equal(true);
+    });
+
+    describe('Plain response modes', () => {
+
+        it('Should post the response with response_mode form_post', async () => {
+            const params = await formPost(await login({ response_mode: 'form_post' }));
+            expect(params.get('state')).to.equal('state123');
+            const tokens = await exchangeCode(params.get('code'));
+            expect(tokens).to.have.property('access_token');
+        });
+
+        it('Should post tokens with response_mode form_post', async () => {
+            const params = await formPost(await login({ client_id: 'spa-client', response_type: 'id_token token', response_mode: 'form_post' }));
+            expect(params.has('access_token')).to.equal(true);
+            expect(params.has('id_token')).to.equal(true);
+            expect(params.get('token_type')).to.equal('Bearer');
+        });
+
+        it('Should return the code in the fragment with response_mode fragment', async () => {
+            const response = await login({ response_mode: 'fragment' });
+            expect(response.status).to.equal(302);
+            const location = new URL(response.headers.get('location'));
+            expect(location.search).to.equal('');
+            const params = new URLSearchParams(location.hash.slice(1));
+            expect(params.get('state')).to.equal('state123');
+            expect(params.has('code')).to.equal(true);
+        });
+
+        it('Should keep the query of the redirect URI', async () => {
+            const response = await login({ redirect_uri: `${redirectUri}?tenant=acme` });
+            const location = new URL(response.headers.get('location'));
+            expect(location.searchParams.get('tenant')).to.equal('acme');
+            expect(location.searchParams.has('code')).to.equal(true);
+            expect(location.searchParams.get('state')).to.equal('state123');
+        });
+    });
+
+    describe('JWT secured responses', () => {
+
+        it('Should sign the response with response_mode query.jwt', async () => {
+            const response = await login({ response_mode: 'query.jwt' });
+            expect(response.status).to.equal(302);
+            const location = new URL(response.headers.get('location'));
+            expect([...location.searchParams.keys()]).to.deep.equal(['response']);
+
+            const claims = await verifyResponse(location.searchParams.get('response'));
+            expect(claims).to.have.property('iss', baseUrl);
+            expect(claims).to.have.property('aud', 'client1');
+            expect(claims).to.have.property('state', 'state123');
+            expect(claims.exp).to.be.greaterThan(Date.now() / 1000);
+            const tokens = await exchangeCode(claims.code);
+            expect(tokens).to.have.property('access_token');
+        });
+
+        it('Should use the default response mode of the response type with response_mode jwt', async () => {
+            const code = new URL((await login({ response_mode: 'jwt' })).headers.get('location'));
+            expect(code.searchParams.has('response')).to.equal(true);
+
+            const implicit = new URL((await login({ client_id: 'spa-client', response_type: 'id_token token', response_mode: 'jwt' })).headers.get('location'));
+            expect(implicit.search).to.equal('');
+            const claims = await verifyResponse(new URLSearchParams(implicit.hash.slice(1)).get('response'));
+            expect(claims).to.have.property('aud', 'spa-client');
+            expect(claims).to.have.property('access_token');
+            expect(claims).to.have.property('id_token');
+        });
+
+        it('Should sign the response with response_mode fragment.jwt', async () => {
+            const location = new URL((await login({ response_mode: 'fragment.jwt' })).headers.get('location'));
+            const claims = await verifyResponse(new URLSearchParams(location.hash.slice(1)).get('response'));
+            expect(claims).to.have.property('code');
+        });
+
+        it('Should post the signed response with response_mode form_post.jwt', async () => {
+            const params = await formPost(await login({ response_mode: 'form_post.jwt' }));
+            expect([...params.keys()]).to.deep.equal(['response']);
+            const claims = await verifyResponse(params.get('response'));
+            expect(claims).to.have.property('state', 'state123');
+            expect(claims).to.have.property('code');
+        });
+
+        it('Should sign error responses', async () => {
+            const response = await authorize({ client_id: 'client1', redirect_uri: redirectUri, response_type: 'code', response_mode: 'query.jwt', prompt: 'none', state: 'state123' });
+            const location = new URL(response.headers.get('location'));
+            const claims = await verifyResponse(location.searchParams.get('response'));
+            expect(claims).to.have.property('error', 'login_required');
+            expect(claims).to.have.property('state', 'state123');
+            expect(claims).to.not.have.property('code');
+        });
+    });
+
+    describe('Invalid response modes', () => {
+
+        it('Should reject an unknown response mode', async () => {
+            const response = await authorize({ client_id: 'client1', redirect_uri: redirectUri, response_type: 'code', response_mode: 'web_message', state: 'state123' });
+            expect(response.status).to.equal(302);
+            const location = new URL(response.headers.get('location'));
+            expect(location.searchParams.get('error')).to.equal('invalid_request');
+            expect(location.searchParams.get('state')).to.equal('state123');
+        });
+
+        it('Should not return tokens in the query', async () => {
+            for (const responseMode of ['query', 'query.jwt']) {
+                const response = await authorize({ client_id: 'spa-client', redirect_uri: redirectUri, response_type: 'id_token token', response_mode: responseMode, nonce: 'nonce123' });
+                const location = new URL(response.headers.get('location'));
+                expect(location.search).to.equal('');
+                expect(new URLSearchParams(location.hash.slice(1)).get('error')).to.equal('invalid_request');
+            }
+
+            const submit = await login({ client_id: 'spa-client', response_type: 'id_token token', response_mode: 'query' });
+            const location = new URL(submit.headers.get('location'));
+            const params = new URLSearchParams(location.hash.slice(1));
+            expect(params.get('error')).to.equal('invalid_request');
+            expect(params.has('access_token')).to.equal(false);
+        });
+
+        it('Should validate the response mode of pushed authorization requests', async () => {
+            const auth = { 'Authorization': `Basic ${Buffer.from('client1:super_secret').toString('base64')}` };
+            const invalid = await client.pushAuthorizationRequest({ response_type: 'code', redirect_uri: redirectUri, response_mode: 'web_message' }, auth);
+            expect(invalid.status).to.equal(400);
+            expect(invalid.body).to.have.property('error', 'invalid_request');
+
+            const pushed = await client.pushAuthorizationRequest({ response_type: 'code', redirect_uri: redirectUri, response_mode: 'form_post' }, auth);
+            expect(pushed.status).to.equal(201);
+            const page = await client.oauth2Authorize({ client_id: 'client1', request_uri: pushed.body.request_uri });
+            const params = await formPost(await login({ authorization_request: hiddenValue(page, 'authorization_request') }));
+            expect(params.has('code')).to.equal(true);
+        });
+    });
+});
@@ -0,0 +1,439 @@
+import { expect } from 'chai';
+import { IdpClient, hiddenValue, launchSnapshot, startSmtpServer, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+describe('sign-up', () => {
+
+    const baseUrl = 'http://localhost:8097';
+    const client = new IdpClient(baseUrl);
+    let smtpServer;
+
+    before(async () => {
+        smtpServer = await startSmtpServer(2525);
+        await launchSnapshot('sign-up');
+        await waitAvailable(baseUrl);
+    });
+
+    after(async () => {
+        await teardownSnapshot('sign-up');
+        await smtpServer.close();
+    });
+
+    async function loginInit(username, password) {
+        const response = await fetch(`${baseUrl}/login/init`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password, client_id: 'client1' }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async function latestMail(email) {
+        const messages = await client.getMail(email);
+        expect(messages.length).to.be.greaterThan(0);
+        return messages[messages.length - 1];
+    }
+
+    async function latestCode(email) {
+        const message = await latestMail(email);
+        return message.body.match(/confirmation code is (\d{6})/)[1];
+    }
+
+    const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+
+    describe('Sign-up API', () => {
+
+        it('Should create an unconfirmed user and email a confirmation code', async () => {
+            const result = await client.signUp('', {
+                username: 'alice',
+                password: 'alice-password',
+                attributes: { email: 'alice@example.com', name: 'Alice' },
+            });
+            expect(result.status).to.equal(201);
+            expect(result.body).to.have.property('username', 'alice');
+            expect(result.body).to.have.property('confirmed', false);
+            expect(result.body).to.have.property('code_delivery_destination', 'a***@example.com');
+
+            const message = await latestMail('alice@example.com');
+            expect(message).to.have.property('from', 'idp@example.com');
+            expect(message).to.have.property('subject', 'Your confirmation code');
+            expect(message.body).to.match(/confirmation code is \d{6}/);
+            expect(message.body).to.include(`${baseUrl}/oauth2/signup/confirm?`);
+
+            const user = await client.getUserById(result.body.user_id);
+            expect(user).to.have.property('unconfirmed', true);
+        });
+
+        it('Should not log in an unconfirmed user', async () => {
+            const result = await loginInit('alice', 'alice-password');
+            expect(result.status).to.equal(401);
+            expect(result.body).to.have.property('error', 'User is not confirmed');
+        });
+
+        it('Should reject a wrong confirmation code', async () => {
+            const result = await client.signUp('/confirm', { username: 'alice', code: 'wrong' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid confirmation code');
+        });
+
+        it('Should send a new code and invalidate the old one', async () => {
+            const oldCode = await latestCode('alice@example.com');
+
+            const result = await client.signUp('/resend', { username: 'alice' });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('code_delivery_destination', 'a***@example.com');
+
+            const messages = await client.getMail('alice@example.com');
+            expect(messages).to.have.lengthOf(2);
+
+            const newCode = await latestCode('alice@example.com');
+            expect(newCode).to.not.equal(oldCode);
+            const stale = await client.signUp('/confirm', { username: 'alice', code: oldCode });
+            expect(stale.status).to.equal(400);
+        });
+
+        it('Should confirm the user with the code', async () => {
+            const code = await latestCode('alice@example.com');
+            const result = await client.signUp('/confirm', { username: 'alice', code });
+            expect(result.status).to.equal(200);
+
+            const users = await client.getUsers();
+            const user = users.find(u => u.username === 'alice');
+            expect(user).to.not.have.property('unconfirmed');
+            expect(user.attributes).to.have.property('email_verified', true);
+            expect(user.attributes).to.have.property('name', 'Alice');
+
+            const login = await loginInit('alice', 'alice-password');
+            expect(login.status).to.equal(200);
+        });
+
+        it('Should not confirm a user twice', async () => {
+            const result = await client.signUp('/confirm', { username: 'alice', code: '123456' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'User is already confirmed');
+        });
+
+        it('Should invalidate the code after too many wrong codes', async () => {
+            await client.signUp('', { username: 'judy', password: 'judy-password', attributes: { email: 'judy@example.com' } });
+            const code = await latestCode('judy@example.com');
+
+            for (let i = 0; i < 3; i++) {
+                const wrong = await client.signUp('/confirm', { username: 'judy', code: 'wrong' });
+                expect(wrong.status).to.equal(400);
+            }
+
+            const result = await client.signUp('/confirm', { username: 'judy', code });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid confirmation code');
+
+            await client.signUp('/resend', { username: 'judy' });
+            const confirmed = await client.signUp('/confirm', { username: 'judy', code: await latestCode('judy@example.com') });
+            expect(confirmed.status).to.equal(200);
+        });
+
+        it('Should reject an existing username', async () => {
+            const result = await client.signUp('', {
+                username: 'existing',
+                password: 'some-password',
+                attributes: { email: 'other@example.com' },
+            });
+            expect(result.status).to.equal(409);
+        });
+
+        it('Should require an email address', async () => {
+            const result = await client.signUp('', { username: 'noemail', password: 'some-password' });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'An email address is required');
+        });
+
+        it('Should reject an invalid email address', async () => {
+            const result = await client.signUp('', {
+                username: 'bademail',
+                password: 'some-password',
+                attributes: { email: 'Bad <bad@example.com>' },
+            });
+            expect(result.status).to.equal(400);
+            expect(result.body).to.have.property('error', 'Invalid email address');
+        });
+
+        it('Should enforce the password policy', async () => {
+            const result = await client.signUp('', {
+                username: 'weak',
+                password: 'short',
+                attributes: { email: 'weak@example.com' },
+            });
+            expect(result.status).to.equal(400);
+            expect(result.body.error).to.include('at least 8 characters');
+        });
+    });
+
+    describe('Mailbox', () => {
+
+        it('Should return a message by ID', async () => {
+            const message = await latestMail('alice@example.com');
+            const response = await fetch(`${baseUrl}/mail/${message.id}`);
+            expect(response.status).to.equal(200);
+            expect(await response.json()).to.have.property('to', 'alice@example.com');
+        });
+
+        it('Should return 404 for unknown messages', async () => {
+            const response = await fetch(`${baseUrl}/mail/unknown`);
+            expect(response.status).to.equal(404);
+        });
+
+        it('Should relay messages to the SMTP server', async () => {
+            await sleep(200);
+            const relayed = smtpServer.messages.filter(m => m.to.includes('<alice@example.com>'));
+            expect(relayed).to.have.lengthOf(2);
+            expect(relayed[0].from).to.equal('<idp@example.com>');
+            expect(relayed[0].data).to.include('Subject: Your confirmation code');
+            expect(relayed[0].data).to.match(/confirmation code is \d{6}/);
+        });
+
+        it('Should clear the mailbox', async () => {
+            await client.clearMail();
+            const messages = await client.getMail();
+            expect(messages).to.have.lengthOf(0);
+        });
+    });
+
+    describe('Hosted sign-up page', () => {
+
+        const oauthParams = {
+            client_id: 'client1',
+            redirect_uri: 'http://localhost:3000/callback',
+            state: 'state123',
+        };
+        let authorizationRequest;
+
+        before(async () => {
+            const html = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+            authorizationRequest = hiddenValue(html, 'authorization_request');
+        });
+
+        it('Should link the sign-up page from the login form', async () => {
+            const html = await client.oauth2Authorize({ ...oauthParams, response_type: 'code' });
+            const request = hiddenValue(html, 'authorization_request');
+            expect(html).to.include(`/oauth2/signup?authorization_request=${request}`);
+            expect(html).to.not.include('/oauth2/signup?client_id');
+        });
+
+        it('Should render the sign-up form', async () => {
+            const response = await fetch(`${baseUrl}/oauth2/signup?authorization_request=${authorizationRequest}`);
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Sign up');
+            expect(html).to.include('confirm_password');
+            expect(hiddenValue(html, 'authorization_request')).to.equal(authorizationRequest);
+        });
+
+        it('Should render the sign-up form without a login to return to', async () => {
+            const response = await fetch(`${baseUrl}/oauth2/signup?authorization_request=unknown`);
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Sign up');
+            expect(html).to.not.include('/oauth2/authorize?');
+        });
+
+        async function submit(form) {
+            const response = await fetch(`${baseUrl}/oauth2/signup/submit`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+                body: new URLSearchParams({ authorization_request: authorizationRequest, ...form }),
+            });
+            return await response.text();
+        }
+
+        it('Should show an error if the passwords do not match', async () => {
+            const html = await submit({ username: 'bob', email: 'bob@example.com', password: 'bob-password', confirm_password: 'other' });
+            expect(html).to.include('Passwords do not match');
+        });
+
+        it('Should sign up and ask for the confirmation code', async () => {
+            const html = await submit({ username: 'bob', email: 'bob@example.com', password: 'bob-password', confirm_password: 'bob-password' });
+            expect(html).to.include('Confirm your account');
+            expect(html).to.include('b***@example.com');
+        });
+
+        it('Should show an error for a wrong code', async () => {
+            const html = await submit({ username: 'bob', code: 'wrong' });
+            expect(html).to.include('Invalid confirmation code');
+        });
+
+        it('Should confirm the account with the emailed link and continue to login', async () => {
+            const message = await latestMail('bob@example.com');
+            const link = message.body.match(/(http:\/\/\S+\/oauth2\/signup\/confirm\?\S+)/)[1];
+            expect(link).to.include(`authorization_request=${authorizationRequest}`);
+            expect(link).to.not.include('state=');
+
+            const response = await fetch(link);
+            expect(response.status).to.equal(200);
+            const html = await response.text();
+            expect(html).to.include('Account confirmed');
+            expect(html).to.include(`/oauth2/authorize?authorization_request=${authorizationRequest}`);
+
+            const login = await client.oauth2AuthorizeSubmit({ authorization_request: authorizationRequest, username: 'bob', password: 'bob-password' });
+            expect(login.status).to.equal(302);
+            expect(new URL(login.headers.get('location')).searchParams.get('state')).to.equal('state123');
+        });
+
+        it('Should confirm the account with the code from the form', async () => {
+            await submit({ username: 'carol', email: 'carol@example.com', password: 'carol-password', confirm_password: 'carol-password' });
+            const code = await latestCode('carol@example.com');
+
+            const html = await submit({ username: 'carol', code });
+            expect(html).to.include('Account confirmed');
+        });
+
+        it('Should tell unconfirmed users to confirm their account on login', async () => {
+            await submit({ username: 'dave', email: 'dave@example.com', password: 'dave-password', confirm_password: 'dave-password' });
+            const login = await client.oauth2AuthorizeSubmit({ ...oauthParams, username: 'dave', password: 'dave-password' });
+            expect(login.status).to.equal(200);
+            expect(await login.text()).to.include('Please confirm your account before logging in');
+        });
+    });
+
+    describe('Sign-up from a pushed authorization request', () => {
+
+        const authorization = { 'Authorization': `Basic ${Buffer.from('par-client:par_secret').toString('base64')}` };
+
+        it('Should return to the pushed login after signing up', async () => {
+            const pushed = await client.pushAuthorizationRequest({
+                response_type: 'code',
+                redirect_uri: 'http://localhost:3000/callback',
+                state: 'pushed-state',
+                prompt: 'login',
+            }, authorization);
+            expect(pushed.status).to.equal(201);
+
+            const page = await fetch(`${baseUrl}/oauth2/authorize?${new URLSearchParams({ client_id: 'par-client', request_uri: pushed.body.request_uri })}`);
+            expect(page.status).to.equal(200);
+            const loginHtml = await page.text();
+            const authorizationRequest = hiddenValue(loginHtml, 'authorization_request');
+            const signUpUrl = loginHtml.match(/href="(\/oauth2\/signup\?[^"]+)"/)[1].replaceAll('&amp;', '&');
+            expect(signUpUrl).to.equal(`/oauth2/signup?authorization_request=${authorizationRequest}`);
+
+            const signUpPage = await fetch(`${baseUrl}${signUpUrl}`);
+            const signUpHtml = await signUpPage.text();
+            expect(hiddenValue(signUpHtml, 'authorization_request')).to.equal(authorizationRequest);
+
+            const submit = (form) => fetch(`${baseUrl}/oauth2/signup/submit`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+                body: new URLSearchParams({ authorization_request: authorizationRequest, ...form }),
+            }).then((response) => response.text());
+            await submit({ username: 'frank', email: 'frank@example.com', password: 'frank-password', confirm_password: 'frank-password' });
+            const confirmed = await submit({ username: 'frank', code: await latestCode('frank@example.com') });
+            expect(confirmed).to.include('Account confirmed');
+
+            // The link back to the login resumes the pushed request instead of starting a new one
+            const loginUrl = confirmed.match(/href="(\/oauth2\/authorize\?[^"]+)"/)[1].replaceAll('&amp;', '&');
+            const returned = await fetch(`${baseUrl}${loginUrl}`);
+            expect(returned.status).to.equal(200);
+            expect(hiddenValue(await returned.text(), 'authorization_request')).to.equal(authorizationRequest);
+
+            const login = await client.oauth2AuthorizeSubmit({ authorization_request: authorizationRequest, username: 'frank', password: 'frank-password' });
+            expect(login.status).to.equal(302);
+            const location = new URL(login.headers.get('location'));
+            expect(location.searchParams.get('state')).to.equal('pushed-state');
+            expect(location.searchParams.has('code')).to.equal(true);
+        });
+    });
+
+    describe('Cognito API', () => {
+
+        it('Should sign up an unconfirmed user', async () => {
+            const result = await client.cognito('SignUp', {
+                ClientId: 'client1',
+                Username: 'erin',
+                Password: 'erin-password',
+                UserAttributes: [{ Name: 'email', Value: 'erin@example.com' }],
+            });
+            expect(result.status).to.equal(200);
+            expect(result.body).to.have.property('UserConfirmed', false);
+            expect(result.body).to.have.property('UserSub');
+            expect(result.body.CodeDeliveryDetails).to.deep.equal({
+                AttributeName: 'email',
+                DeliveryMedium: 'EMAIL',
+                Destination: 'e***@example.com',
+            });
+
+            const user = await client.cognito('AdminGetUser', { Username: 'erin' });
+            expect(user.body).to.have.property('UserStatus', 'UNCONFIRMED');
+        });
+
+        it('Should reject authentication of unconfirmed users', async () => {
+            const result = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'erin', PASSWORD: 'erin-password' },
+            });
+            expect(result.body).to.have.property('__type', 'UserNotConfirmedException');
+        });
+
+        it('Should reject a wrong confirmation code', async () => {
+            const result = await client.cognito('ConfirmSignUp', { ClientId: 'client1', Username: 'erin', ConfirmationCode: 'wrong' });
+            expect(result.body).to.have.property('__type', 'CodeMismatchException');
+        });
+
+        it('Should confirm the user', async () => {
+            const resend = await client.cognito('ResendConfirmationCode', { ClientId: 'client1', Username: 'erin' });
+            expect(resend.status).to.equal(200);
+            expect(resend.body.CodeDeliveryDetails).to.have.property('Destination', 'e***@example.com');
+
+            const code = await latestCode('erin@example.com');
+            const result = await client.cognito('ConfirmSignUp', { ClientId: 'client1', Username: 'erin', ConfirmationCode: code });
+            expect(result.status).to.equal(200);
+
+            const auth = await client.cognito('InitiateAuth', {
+                AuthFlow: 'USER_PASSWORD_AUTH',
+                ClientId: 'client1',
+                AuthParameters: { USERNAME: 'erin', PASSWORD: 'erin-password' },
+            });
+            expect(auth.body).to.have.property('AuthenticationResult');
+        });
+
+        it('Should reject resending a code to a confirmed user', async () => {
+            const result = await client.cognito('ResendConfirmationCode', { ClientId: 'client1', Username: 'erin' });
+            expect(result.body).to.have.property('__type', 'InvalidParameterException');
+        });
+
+        it('Should ignore verification flags when signing up', async () => {
+            const api = await client.signUp('', {
+                username: 'grace',
+                password: 'grace-password',
+                attributes: { email: 'grace@example.com', email_verified: true },
+            });
+            expect(api.status).to.equal(201);
+
+            const cognito = await client.cognito('SignUp', {
+                ClientId: 'client1',
+                Username: 'heidi',
+                Password: 'heidi-password',
+                UserAttributes: [
+                    { Name: 'email', Value: 'heidi@example.com' },
+                    { Name: 'email_verified', Value: 'true' },
+                    { Name: 'phone_number_verified', Value: 'true' },
+                ],
+            });
+            expect(cognito.status).to.equal(200);
+
+            for (const username of ['grace', 'heidi']) {
+                const user = await client.cognito('AdminGetUser', { Username: username });
+                const names = user.body.UserAttributes.map(attribute => attribute.Name);
+                expect(names).to.include('email');
+                expect(names).to.not.include('email_verified');
+                expect(names).to.not.include('phone_number_verified');
+            }
+        });
+
+        it('Should require the secret hash for clients with a secret', async () => {
+            const result = await client.cognito('SignUp', {
+                ClientId: 'secret-client',
+                Username: 'frank',
+                Password: 'frank-password',
+                UserAttributes: [{ Name: 'email', Value: 'frank@example.com' }],
+            });
+            expect(result.body).to.have.property('__type', 'NotAuthorizedException');
+        });
+    });
+});
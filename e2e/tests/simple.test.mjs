@@ -1,5 +1,5 @@
 import { expect } from 'chai';
-import { IdpClient, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+import { IdpClient, hiddenValue, launchSnapshot, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
 
 describe('simple', () => {
 
@@ -16,6 +16,21 @@ describe('simple', () => {
         await teardownSnapshot('simple');
     });
 
+    describe('Cognito API', () => {
+
+        it('Should be disabled by default', async () => {
+            const response = await fetch('http://localhost:8080/', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/x-amz-json-1.1',
+                    'X-Amz-Target': 'AWSCognitoIdentityProviderService.AdminCreateUser',
+                },
+                body: JSON.stringify({ Username: 'mallory', TemporaryPassword: 'password1' }),
+            });
+            expect(response.status).to.equal(404);
+        });
+    });
+
     describe('Health and Discovery', () => {
 
         it('GET /healthz should return OK', async () => {
@@ -67,6 +82,16 @@ describe('simple', () => {
             expect(html).to.include('password');
         });
 
+        it('GET /oauth2/authorize should not offer passkeys by default', async () => {
+            const html = await client.oauth2Authorize({
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+                response_type: 'code',
+            });
+            expect(html).to.not.include('passkey-form');
+            expect(html).to.not.include('webauthn_response');
+        });
+
         it('POST /oauth2/authorize/submit should redirect with code', async () => {
             const response = await client.oauth2AuthorizeSubmit({
                 username: 'user1',
@@ -265,15 +290,14 @@ describe('simple', () => {
                 response_type: 'code',
                 nonce: testNonce,
             });
-            expect(formHtml).to.include(testNonce);
+            // The nonce is kept with the authorization request, the form only refers to it
+            expect(formHtml).to.not.include(testNonce);
             
             // Submit the form (which should preserve nonce)
             const authResponse = await client.oauth2AuthorizeSubmit({
                 username: 'user1',
                 password: 'password1',
-                client_id: 'client1',
-                redirect_uri: 'http://localhost:3000/callback',
-                nonce: testNonce,
+                authorization_request: hiddenValue(formHtml, 'authorization_request'),
             });
             
             // Exchange code for tokens
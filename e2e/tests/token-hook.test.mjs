@@ -0,0 +1,139 @@
+import { expect } from 'chai';
+import { IdpClient, launchSnapshot, startWebhookServer, teardownSnapshot, waitAvailable } from "./utils/index.mjs";
+
+function decodePayload(token) {
+    const parts = token.split('.');
+    return JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+}
+
+describe('token-hook', () => {
+
+    const client = new IdpClient('http://localhost:8089');
+    let webhook;
+
+    before(async () => {
+        webhook = await startWebhookServer(9089, (event) => {
+            if (event.user.username === 'failing') {
+                return { status: 500, body: { message: 'boom' } };
+            }
+            if (event.token_use === 'access') {
+                return {
+                    body: {
+                        claims_to_add_or_override: {
+                            tenant: 'acme',
+                            roles: ['admin', 'editor'],
+                            sub: 'hijacked',
+                        },
+                        claims_to_suppress: ['email', 'iss'],
+                        groups_to_override: ['admins'],
+                    },
+                };
+            }
+            return {
+                body: {
+                    claims_to_add_or_override: {
+                        name: `${event.claims.name} (${event.client.id})`,
+                    },
+                },
+            };
+        });
+        await launchSnapshot('token-hook');
+        await waitAvailable('http://localhost:8089');
+    });
+
+    after(async () => {
+        await teardownSnapshot('token-hook');
+        await webhook.close();
+    });
+
+    async function login(username, password) {
+        const respInit = await client.loginInit({
+            username,
+            password,
+            client_id: 'client1',
+        });
+        return await client.loginComplete({
+            challenge_id: respInit.challenge_id,
+            challenge_data: 'XXXXXX',
+        });
+    }
+
+    describe('Pre token generation hook', () => {
+
+        it('Should send the proposed claims to the webhook', async () => {
+            webhook.events.length = 0;
+            await login('user1', 'password1');
+
+            const accessEvent = webhook.events.find(e => e.event.token_use === 'access');
+            expect(accessEvent).to.exist;
+            expect(accessEvent.path).to.equal('/pre-token');
+            expect(accessEvent.headers).to.have.property('x-hook-secret', 'hook-secret');
+            expect(accessEvent.event).to.have.property('trigger', 'pre_token_generation');
+            expect(accessEvent.event.user).to.have.property('username', 'user1');
+            expect(accessEvent.event.client).to.have.property('id', 'client1');
+            expect(accessEvent.event.scopes).to.include('openid');
+            expect(accessEvent.event.claims).to.have.property('email', 'user1@example.com');
+            expect(accessEvent.event.claims).to.have.property('sub', '1');
+
+            const idEvent = webhook.events.find(e => e.event.token_use === 'id');
+            expect(idEvent).to.exist;
+            expect(idEvent.event.claims).to.have.property('name', 'User One');
+        });
+
+        it('Should add, override and suppress access token claims', async () => {
+            const respComplete = await login('user1', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+
+            expect(payload).to.have.property('tenant', 'acme');
+            expect(payload.roles).to.deep.equal(['admin', 'editor']);
+            expect(payload).to.not.have.property('email');
+            expect(payload['cognito:groups']).to.deep.equal(['admins']);
+        });
+
+        it('Should not allow changing protected claims', async () => {
+            const respComplete = await login('user1', 'password1');
+            const payload = decodePayload(respComplete.access_token);
+
+            expect(payload).to.have.property('sub', '1');
+            expect(payload).to.have.property('iss');
+        });
+
+        it('Should customize identity token claims', async () => {
+            const respComplete = await login('user1', 'password1');
+            const payload = decodePayload(respComplete.identity_token);
+
+            expect(payload).to.have.property('name', 'User One (client1)');
+            expect(payload).to.have.property('email', 'user1@example.com');
+        });
+
+        it('Should apply to OAuth2 tokens', async () => {
+            const authResponse = await client.oauth2AuthorizeSubmit({
+                username: 'user1',
+                password: 'password1',
+                client_id: 'client1',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+            const location = authResponse.headers.get('location');
+            const code = new URL(location).searchParams.get('code');
+            const tokens = await client.oauth2Token({
+                grant_type: 'authorization_code',
+                code: code,
+                client_id: 'client1',
+                client_secret: 'super_secret',
+                redirect_uri: 'http://localhost:3000/callback',
+            });
+
+            const payload = decodePayload(tokens.access_token);
+            expect(payload).to.have.property('tenant', 'acme');
+        });
+
+        it('Should fail token generation when the webhook fails (fail closed)', async () => {
+            try {
+                await login('failing', 'password2');
+                expect.fail('Should have thrown an error');
+            } catch (err) {
+                expect(err.message).to.include('500');
+            }
+        });
+    });
+});
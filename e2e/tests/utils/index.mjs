@@ -1,6 +1,9 @@
 import path from 'path';
 import fs from 'fs';
 import cp from 'child_process';
+import crypto from 'crypto';
+import http from 'http';
+import net from 'net';
 import { z } from 'zod';
 
 export async function waitAvailable(baseUrl, timeoutMs = 120000, intervalMs = 1000) {
@@ -72,6 +75,326 @@ export async function teardownSnapshot (snapshotName) {
     });
 }
 
+/** RFC 6238 TOTP code generation for testing challenges */
+
+export function generateTotp(secret, timeMs = Date.now()) {
+    const alphabet = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ234567';
+    let bits = '';
+    for (const c of secret.replace(/=+$/, '').toUpperCase()) {
+        bits += alphabet.indexOf(c).toString(2).padStart(5, '0');
+    }
+    const key = Buffer.alloc(Math.floor(bits.length / 8));
+    for (let i = 0; i < key.length; i++) {
+        key[i] = parseInt(bits.substr(i * 8, 8), 2);
+    }
+    const counter = Buffer.alloc(8);
+    counter.writeBigUInt64BE(BigInt(Math.floor(timeMs / 30000)));
+    const hmac = crypto.createHmac('sha1', key).update(counter).digest();
+    const offset = hmac[hmac.length - 1] & 0x0f;
+    const value = hmac.readUInt32BE(offset) & 0x7fffffff;
+    return String(value % 1000000).padStart(6, '0');
+}
+
+/** Cognito SRP client for testing USER_SRP_AUTH, following amazon-cognito-identity-js */
+
+const SRP_N = BigInt('0x' +
+    'FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD' +
+    'EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED' +
+    'EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F' +
+    '83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B' +
+    'E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510' +
+    '15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7' +
+    'ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864D87602733EC86A64521F2B18177B200C' +
+    'BBE117577A615D6C770988C0BAD946E208E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF');
+const SRP_G = 2n;
+
+function srpModPow(base, exp, mod) {
+    let result = 1n;
+    base = ((base % mod) + mod) % mod;
+    while (exp > 0n) {
+        if (exp & 1n) result = (result * base) % mod;
+        base = (base * base) % mod;
+        exp >>= 1n;
+    }
+    return result;
+}
+
+function srpPadHex(n) {
+    let hex = n.toString(16);
+    if (hex.length % 2 !== 0) hex = '0' + hex;
+    if (/^[89a-f]/i.test(hex)) hex = '00' + hex;
+    return hex;
+}
+
+function srpHexHash(hex) {
+    return crypto.createHash('sha256').update(Buffer.from(hex, 'hex')).digest('hex');
+}
+
+function srpTimestamp(date = new Date()) {
+    const days = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
+    const months = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+    const pad = (n) => String(n).padStart(2, '0');
+    return `${days[date.getUTCDay()]} ${months[date.getUTCMonth()]} ${date.getUTCDate()} ` +
+        `${pad(date.getUTCHours())}:${pad(date.getUTCMinutes())}:${pad(date.getUTCSeconds())} UTC ${date.getUTCFullYear()}`;
+}
+
+/** Starts an SRP login, returning the client's secret and the SRP_A value to send */
+export function srpStart() {
+    const a = BigInt('0x' + crypto.randomBytes(128).toString('hex')) % SRP_N;
+    const A = srpModPow(SRP_G, a, SRP_N);
+    return { a, A, srpA: A.toString(16) };
+}
+
+/** Computes the PASSWORD_VERIFIER challenge responses for the challenge parameters returned by the server */
+export function srpPasswordClaim(start, userPoolId, challengeParameters, password, timestamp = srpTimestamp()) {
+    const poolName = userPoolId.split('_')[1];
+    const username = challengeParameters.USER_ID_FOR_SRP;
+    const B = BigInt('0x' + challengeParameters.SRP_B);
+    const salt = BigInt('0x' + challengeParameters.SALT);
+
+    const k = BigInt('0x' + srpHexHash(srpPadHex(SRP_N) + srpPadHex(SRP_G)));
+    const u = BigInt('0x' + srpHexHash(srpPadHex(start.A) + srpPadHex(B)));
+    const usernamePasswordHash = crypto.createHash('sha256').update(`${poolName}${username}:${password}`).digest('hex');
+    const x = BigInt('0x' + srpHexHash(srpPadHex(salt) + usernamePasswordHash));
+    const S = srpModPow(B - k * srpModPow(SRP_G, x, SRP_N), start.a + u * x, SRP_N);
+
+    const prk = crypto.createHmac('sha256', Buffer.from(srpPadHex(u), 'hex')).update(Buffer.from(srpPadHex(S), 'hex')).digest();
+    const key = crypto.createHmac('sha256', prk).update(Buffer.concat([Buffer.from('Caldera Derived Key'), Buffer.from([1])])).digest().subarray(0, 16);
+
+    const signature = crypto.createHmac('sha256', key).update(Buffer.concat([
+        Buffer.from(poolName),
+        Buffer.from(username),
+        Buffer.from(challengeParameters.SECRET_BLOCK, 'base64'),
+        Buffer.from(timestamp),
+    ])).digest('base64');
+
+    return {
+        USERNAME: username,
+        PASSWORD_CLAIM_SECRET_BLOCK: challengeParameters.SECRET_BLOCK,
+        PASSWORD_CLAIM_SIGNATURE: signature,
+        TIMESTAMP: timestamp,
+    };
+}
+
+/** Software WebAuthn authenticator for testing passkeys, with attestation "none" */
+
+function cborHead(major, value) {
+    if (value < 24) return Buffer.from([(major << 5) | value]);
+    if (value < 0x100) return Buffer.from([(major << 5) | 24, value]);
+    const head = Buffer.alloc(value < 0x10000 ? 3 : 5);
+    head[0] = (major << 5) | (value < 0x10000 ? 25 : 26);
+    if (value < 0x10000) head.writeUInt16BE(value, 1); else head.writeUInt32BE(value, 1);
+    return head;
+}
+
+/** Encodes integers, strings, buffers and maps as CBOR */
+export function cborEncode(value) {
+    if (Buffer.isBuffer(value)) return Buffer.concat([cborHead(2, value.length), value]);
+    if (typeof value === 'string') {
+        const bytes = Buffer.from(value, 'utf8');
+        return Buffer.concat([cborHead(3, bytes.length), bytes]);
+    }
+    if (typeof value === 'number') return value >= 0 ? cborHead(0, value) : cborHead(1, -1 - value);
+    const parts = [cborHead(5, value.size)];
+    for (const [key, item] of value) {
+        parts.push(cborEncode(key), cborEncode(item));
+    }
+    return Buffer.concat(parts);
+}
+
+function sha256(data) {
+    return crypto.createHash('sha256').update(data).digest();
+}
+
+/** Returns the COSE encoding of an ES256 or RS256 public key */
+export function coseKey(publicKey, algorithm) {
+    const jwk = publicKey.export({ format: 'jwk' });
+    if (algorithm === -257) {
+        return cborEncode(new Map([[1, 3], [3, -257], [-1, Buffer.from(jwk.n, 'base64url')], [-2, Buffer.from(jwk.e, 'base64url')]]));
+    }
+    return cborEncode(new Map([[1, 2], [3, -7], [-1, 1], [-2, Buffer.from(jwk.x, 'base64url')], [-3, Buffer.from(jwk.y, 'base64url')]]));
+}
+
+export class SoftwareAuthenticator {
+    constructor({ origin, rpId = 'localhost', backupEligible = false } = {}) {
+        this.origin = origin;
+        this.rpId = rpId;
+        this.backupEligible = backupEligible;
+        this.credentials = [];
+    }
+
+    /** Adds an existing credential, e.g. one configured for a user */
+    addCredential(id, privateKey, userHandle, signCount = 0) {
+        this.credentials.push({ id, privateKey, userHandle, signCount });
+    }
+
+    authenticatorData(signCount, credential = Buffer.alloc(0), overrides = {}) {
+        let flags = 0x01 | 0x04;
+        if (this.backupEligible) flags |= 0x08;
+        if (credential.length > 0) flags |= 0x40;
+        const counter = Buffer.alloc(4);
+        counter.writeUInt32BE(signCount);
+        return Buffer.concat([sha256(overrides.rpId ?? this.rpId), Buffer.from([overrides.flags ?? flags]), counter, credential]);
+    }
+
+    clientData(type, challenge, overrides = {}) {
+        return Buffer.from(JSON.stringify({
+            type,
+            challenge: overrides.challenge ?? challenge,
+            origin: overrides.origin ?? this.origin,
+            crossOrigin: false,
+        }));
+    }
+
+    /** Answers navigator.credentials.create() for the creation options returned by the server */
+    create(options, overrides = {}) {
+        const algorithm = overrides.algorithm ?? options.pubKeyCredParams[0].alg;
+        const { privateKey, publicKey } = algorithm === -257
+            ? crypto.generateKeyPairSync('rsa', { modulusLength: 2048 })
+            : crypto.generateKeyPairSync('ec', { namedCurve: 'P-256' });
+        const id = crypto.randomBytes(16);
+        const length = Buffer.alloc(2);
+        length.writeUInt16BE(id.length);
+
+        const publicKeyCose = overrides.publicKey ?? coseKey(publicKey, algorithm);
+        const authData = this.authenticatorData(0, Buffer.concat([Buffer.alloc(16), length, id, publicKeyCose]), overrides);
+        const attestationObject = cborEncode(new Map([['fmt', 'none'], ['attStmt', new Map()], ['authData', authData]]));
+
+        this.addCredential(id.toString('base64url'), privateKey, options.user.id);
+        return {
+            id: id.toString('base64url'),
+            rawId: id.toString('base64url'),
+            type: 'public-key',
+            authenticatorAttachment: 'platform',
+            response: {
+                clientDataJSON: this.clientData('webauthn.create', options.challenge, overrides).toString('base64url'),
+                attestationObject: attestationObject.toString('base64url'),
+                transports: ['internal'],
+            },
+            clientExtensionResults: {},
+        };
+    }
+
+    /** Answers navigator.credentials.get() for the request options, using the first allowed or discoverable credential */
+    get(options, overrides = {}) {
+        const allowed = options.allowCredentials.map((descriptor) => descriptor.id);
+        const credential = overrides.credential ?? this.credentials.find((c) => allowed.length === 0 || allowed.includes(c.id));
+        if (overrides.signCount === undefined) credential.signCount++;
+
+        const authData = this.authenticatorData(overrides.signCount ?? credential.signCount, undefined, overrides);
+        const clientData = this.clientData('webauthn.get', options.challenge, overrides);
+        const signature = crypto.sign('sha256', Buffer.concat([authData, sha256(clientData)]), overrides.privateKey ?? credential.privateKey);
+        return {
+            id: credential.id,
+            rawId: credential.id,
+            type: 'public-key',
+            authenticatorAttachment: 'platform',
+            response: {
+                clientDataJSON: clientData.toString('base64url'),
+                authenticatorData: authData.toString('base64url'),
+                signature: signature.toString('base64url'),
+                userHandle: credential.userHandle,
+            },
+            clientExtensionResults: {},
+        };
+    }
+}
+
+/** Signs a JWT with an HMAC secret (HS*) or a private key (RS*, ES*) */
+export function signJwt(payload, { alg, key, kid }) {
+    const header = { alg, typ: 'JWT', ...(kid ? { kid } : {}) };
+    const input = `${Buffer.from(JSON.stringify(header)).toString('base64url')}.${Buffer.from(JSON.stringify(payload)).toString('base64url')}`;
+    const hash = `sha${alg.slice(2)}`;
+    const signature = alg.startsWith('HS')
+        ? crypto.createHmac(hash, key).update(input).digest()
+        : crypto.sign(hash, Buffer.from(input), alg.startsWith('ES') ? { key, dsaEncoding: 'ieee-p1363' } : key);
+    return `${input}.${signature.toString('base64url')}`;
+}
+
+/** Returns the claims of a JWT without verifying it */
+export function decodeJwt(token) {
+    return JSON.parse(Buffer.from(token.split('.')[1], 'base64url').toString());
+}
+
+/** Returns the value of a hidden input of an HTML page */
+export function hiddenValue(html, name) {
+    return html.match(new RegExp(`name="${name}" value="([^"]*)"`))[1];
+}
+
+/** Webhook receiver for testing hooks */
+
+export async function startWebhookServer(port, handler) {
+    const events = [];
+    const server = http.createServer((req, res) => {
+        let body = '';
+        req.on('data', chunk => { body += chunk; });
+        req.on('end', async () => {
+            const event = body ? JSON.parse(body) : null;
+            events.push({ path: req.url, headers: req.headers, event });
+            const result = await handler(event, req);
+            const status = result?.status ?? 200;
+            res.writeHead(status, { 'Content-Type': 'application/json' });
+            res.end(result?.body !== undefined ? JSON.stringify(result.body) : '');
+        });
+    });
+    await new Promise(resolve => server.listen(port, '0.0.0.0', resolve));
+    return {
+        events,
+        close: () => new Promise(resolve => server.close(resolve)),
+    };
+}
+
+/** Starts a minimal SMTP server that records the messages it receives */
+export async function startSmtpServer(port) {
+    const messages = [];
+    const server = net.createServer(socket => {
+        let buffer = '';
+        let message = null;
+        let inData = false;
+        socket.write('220 localhost SMTP\r\n');
+        socket.on('data', chunk => {
+            buffer += chunk.toString();
+            let index;
+            while ((index = buffer.indexOf('\r\n')) >= 0) {
+                const line = buffer.slice(0, index);
+                buffer = buffer.slice(index + 2);
+                if (inData) {
+                    if (line === '.') {
+                        inData = false;
+                        messages.push(message);
+                        socket.write('250 OK\r\n');
+                    } else {
+                        message.data += line + '\n';
+                    }
+                    continue;
+                }
+                const command = line.toUpperCase();
+                if (command.startsWith('EHLO') || command.startsWith('HELO')) {
+                    socket.write('250 localhost\r\n');
+                } else if (command.startsWith('MAIL FROM:')) {
+                    message = { from: line.slice(10).trim(), to: [], data: '' };
+                    socket.write('250 OK\r\n');
+                } else if (command.startsWith('RCPT TO:')) {
+                    message.to.push(line.slice(8).trim());
+                    socket.write('250 OK\r\n');
+                } else if (command === 'DATA') {
+                    inData = true;
+                    socket.write('354 End data with <CR><LF>.<CR><LF>\r\n');
+                } else if (command === 'QUIT') {
+                    socket.end('221 Bye\r\n');
+                } else {
+                    socket.write('250 OK\r\n');
+                }
+            }
+        });
+    });
+    await new Promise(resolve => server.listen(port, '0.0.0.0', resolve));
+    return {
+        messages,
+        close: () => new Promise(resolve => server.close(resolve)),
+    };
+}
+
 /** Simple client for testing */
 
 // Request schemas
@@ -96,6 +419,12 @@ const Z_PutUserRequest = z.object({
     username: z.string().optional(),
     password: z.string().optional(),
     attributes: z.record(z.any(), z.any()).optional(),
+    challenge_type: z.string().optional(),
+    challenge_code: z.string().optional(),
+    totp_secret: z.string().optional(),
+    groups: z.array(z.string()).optional(),
+    force_password_change: z.boolean().optional(),
+    mfa_required: z.boolean().optional(),
 });
 
 export class IdpClient {
@@ -138,8 +467,24 @@ export class IdpClient {
         return await response.text();
     }
 
+    // Submits the login form. Forms without a session or authorization request first open the login page with their
+    // OAuth2 parameters, returning its response if it does not show the login form.
     async oauth2AuthorizeSubmit(formData) {
         const params = new URLSearchParams(formData);
+        if (!params.has('authorization_request') && !params.has('session')) {
+            const query = new URLSearchParams({ response_type: 'code' });
+            for (const name of ['client_id', 'redirect_uri', 'response_type', 'scope', 'state', 'nonce', 'response_mode', 'prompt']) {
+                if (params.has(name)) {
+                    query.set(name, params.get(name));
+                    params.delete(name);
+                }
+            }
+            const page = await fetch(`${this.baseUrl}/oauth2/authorize?${query}`, { redirect: 'manual' });
+            if (page.status !== 200) {
+                return page;
+            }
+            params.set('authorization_request', hiddenValue(await page.text(), 'authorization_request'));
+        }
         const response = await fetch(`${this.baseUrl}/oauth2/authorize/submit`, {
             method: 'POST',
             headers: {
@@ -151,6 +496,30 @@ export class IdpClient {
         return response;
     }
 
+    async pushAuthorizationRequest(formData, headers = {}) {
+        const response = await fetch(`${this.baseUrl}/oauth2/par`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/x-www-form-urlencoded',
+                ...headers,
+            },
+            body: new URLSearchParams(formData),
+        });
+        return { status: response.status, headers: response.headers, body: await response.json() };
+    }
+
+    async oauth2ConsentSubmit(formData) {
+        const response = await fetch(`${this.baseUrl}/oauth2/consent/submit`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/x-www-form-urlencoded',
+            },
+            body: new URLSearchParams(formData),
+            redirect: 'manual',
+        });
+        return response;
+    }
+
     async oauth2Token(formData) {
         const params = new URLSearchParams(formData);
         const response = await fetch(`${this.baseUrl}/oauth2/token`, {
@@ -233,6 +602,19 @@ export class IdpClient {
         return await response.json();
     }
 
+    // Cognito Identity Provider API
+    async cognito(action, params) {
+        const response = await fetch(`${this.baseUrl}/`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/x-amz-json-1.1',
+                'X-Amz-Target': `AWSCognitoIdentityProviderService.${action}`,
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
     // User Profile
     async getMe(accessToken) {
         const response = await fetch(`${this.baseUrl}/me`, {
@@ -309,4 +691,280 @@ export class IdpClient {
         }
         return await response.json();
     }
+
+    // TOTP enrollment
+    async enrollTotp(userId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/mfa/totp`, {
+            method: 'POST',
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async verifyTotp(userId, code) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/mfa/totp/verify`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ code }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async disableTotp(userId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/mfa/totp`, {
+            method: 'DELETE',
+        });
+        if (!response.ok) {
+            throw new Error(`Disable TOTP failed with status ${response.status}`);
+        }
+    }
+
+    // Consent grants
+    async getConsents(userId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/consents`);
+        return { status: response.status, body: await response.json() };
+    }
+
+    async revokeConsent(userId, clientId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/consents/${clientId}`, {
+            method: 'DELETE',
+        });
+        return { status: response.status, body: response.status === 204 ? null : await response.json() };
+    }
+
+    // Client Management
+    async getClients() {
+        const response = await fetch(`${this.baseUrl}/clients`);
+        return { status: response.status, body: await response.json() };
+    }
+
+    async getClientById(clientId) {
+        const response = await fetch(`${this.baseUrl}/clients/${clientId}`);
+        return { status: response.status, body: await response.json() };
+    }
+
+    async putClient(clientId, params) {
+        const response = await fetch(`${this.baseUrl}/clients/${clientId}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async deleteClient(clientId) {
+        const response = await fetch(`${this.baseUrl}/clients/${clientId}`, {
+            method: 'DELETE',
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async rotateClientSecret(clientId) {
+        const response = await fetch(`${this.baseUrl}/clients/${clientId}/secret`, {
+            method: 'POST',
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    // Dynamic client registration
+    async registerClient(metadata, token) {
+        const response = await fetch(`${this.baseUrl}/oauth2/register`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                ...(token ? { 'Authorization': `Bearer ${token}` } : {}),
+            },
+            body: JSON.stringify(metadata),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async getRegisteredClient(clientId, token) {
+        const response = await fetch(`${this.baseUrl}/oauth2/register/${clientId}`, {
+            headers: { 'Authorization': `Bearer ${token}` },
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async updateRegisteredClient(clientId, token, metadata) {
+        const response = await fetch(`${this.baseUrl}/oauth2/register/${clientId}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${token}`,
+            },
+            body: JSON.stringify(metadata),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async deleteRegisteredClient(clientId, token) {
+        const response = await fetch(`${this.baseUrl}/oauth2/register/${clientId}`, {
+            method: 'DELETE',
+            headers: { 'Authorization': `Bearer ${token}` },
+        });
+        return { status: response.status, body: response.status === 204 ? null : await response.json() };
+    }
+
+    // Passkeys
+    async webauthnRegister(userId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/webauthn/register`, {
+            method: 'POST',
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async webauthnRegisterVerify(userId, credential, name) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/webauthn/register/verify`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ credential, name }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async getWebauthnCredentials(userId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/webauthn/credentials`);
+        if (!response.ok) {
+            throw new Error(`Get passkeys failed with status ${response.status}`);
+        }
+        return await response.json();
+    }
+
+    async deleteWebauthnCredential(userId, credentialId) {
+        const response = await fetch(`${this.baseUrl}/users/${userId}/webauthn/credentials/${credentialId}`, {
+            method: 'DELETE',
+        });
+        return response.status;
+    }
+
+    async loginWebauthnInit(params) {
+        const response = await fetch(`${this.baseUrl}/login/webauthn/init`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async loginWebauthnComplete(challengeId, credential) {
+        const response = await fetch(`${this.baseUrl}/login/complete`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ challenge_id: challengeId, credential }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    // Passwordless login
+    async passwordlessInit(params) {
+        const response = await fetch(`${this.baseUrl}/login/init`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async passwordlessComplete(challengeId, code) {
+        const response = await fetch(`${this.baseUrl}/login/complete`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ challenge_id: challengeId, challenge_data: code }),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    async passwordlessSubmit(formData) {
+        const response = await fetch(`${this.baseUrl}/oauth2/passwordless/submit`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/x-www-form-urlencoded',
+            },
+            body: new URLSearchParams(formData),
+            redirect: 'manual',
+        });
+        return response;
+    }
+
+    async passwordlessCallback(link) {
+        return await fetch(link, { redirect: 'manual' });
+    }
+
+    // Sign-up
+    async signUp(path, params) {
+        const response = await fetch(`${this.baseUrl}/signup${path}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    // Password reset
+    async password(path, params) {
+        const response = await fetch(`${this.baseUrl}/password${path}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(params),
+        });
+        return { status: response.status, body: await response.json() };
+    }
+
+    // Captured mail
+    async getMail(to) {
+        const query = to ? `?${new URLSearchParams({ to })}` : '';
+        const response = await fetch(`${this.baseUrl}/mail${query}`);
+        if (!response.ok) {
+            throw new Error(`Get mail failed with status ${response.status}`);
+        }
+        return await response.json();
+    }
+
+    async clearMail() {
+        const response = await fetch(`${this.baseUrl}/mail`, {
+            method: 'DELETE',
+        });
+        if (!response.ok) {
+            throw new Error(`Clear mail failed with status ${response.status}`);
+        }
+        return await response.json();
+    }
+
+    // Captured SMS
+    async getSms(to) {
+        const query = to ? `?${new URLSearchParams({ to })}` : '';
+        const response = await fetch(`${this.baseUrl}/sms${query}`);
+        if (!response.ok) {
+            throw new Error(`Get SMS failed with status ${response.status}`);
+        }
+        return await response.json();
+    }
+
+    async clearSms() {
+        const response = await fetch(`${this.baseUrl}/sms`, {
+            method: 'DELETE',
+        });
+        if (!response.ok) {
+            throw new Error(`Clear SMS failed with status ${response.status}`);
+        }
+        return await response.json();
+    }
 }
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"net/http"
+)
+
+func GET_clients(w http.ResponseWriter, r *http.Request) {
+	allClients := []IdpClient{}
+	for _, client := range AppContext.Clients {
+		allClients = append(allClients, redactClient(client))
+	}
+	writeJSON(w, http.StatusOK, allClients)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func GET_clients_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientId := vars["id"]
+
+	_, existingClient := FindClientIndexById(clientId)
+	if existingClient == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Client not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, redactClient(*existingClient))
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+func GET_mail(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+
+	// Optionally filter by recipient
+	messages := []MailMessage{}
+	for _, message := range AppContext.Mailbox {
+		if to == "" || strings.EqualFold(message.To, to) {
+			messages = append(messages, message)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+}
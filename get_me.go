@@ -54,9 +54,6 @@ func GET_me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create response without password
-	response := *foundUser
-	response.Password = ""
-
-	writeJSON(w, http.StatusOK, response)
+	// Respond without the password and challenge secrets
+	writeJSON(w, http.StatusOK, redactUser(foundUser))
 }
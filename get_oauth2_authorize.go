@@ -3,6 +3,7 @@ package main
 import (
 	"html/template"
 	"net/http"
+	"time"
 )
 
 const loginFormTemplate = `
@@ -20,20 +21,62 @@ const loginFormTemplate = `
     </style>
 </head>
 <body>
+    {{if .MfaStep}}
+    <h2>{{if .TotpQrCode}}Set up two-factor authentication{{else}}Two-factor authentication{{end}}</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    {{if .TotpQrCode}}
+    <p>Scan this QR code with your authenticator app, then enter the code it shows for {{.Username}}.</p>
+    <p><img src="{{.TotpQrCode}}" alt="TOTP QR code"></p>
+    <p>Or enter this key manually: <code>{{.TotpSecret}}</code></p>
+    {{else}}
+    <p>Enter the code from your authenticator app for {{.Username}}.</p>
+    {{end}}
+    <form method="POST" action="/oauth2/authorize/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="session" value="{{.Session}}">
+
+        <div class="form-group">
+            <label for="mfa_code">Code:</label>
+            <input type="text" id="mfa_code" name="mfa_code" inputmode="numeric" autocomplete="one-time-code" required>
+        </div>
+
+        <button type="submit">Verify</button>
+    </form>
+    {{else if .Session}}
+    <h2>Set a new password</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>You must choose a new password for {{.Username}} before continuing.</p>
+    <form method="POST" action="/oauth2/authorize/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="session" value="{{.Session}}">
+
+        <div class="form-group">
+            <label for="new_password">New password:</label>
+            <input type="password" id="new_password" name="new_password" required>
+        </div>
+
+        <div class="form-group">
+            <label for="confirm_password">Confirm new password:</label>
+            <input type="password" id="confirm_password" name="confirm_password" required>
+        </div>
+
+        <button type="submit">Change password</button>
+    </form>
+    {{else}}
     <h2>Login</h2>
     {{if .Error}}
     <div class="error">{{.Error}}</div>
     {{end}}
     <form method="POST" action="/oauth2/authorize/submit">
-        <input type="hidden" name="client_id" value="{{.ClientID}}">
-        <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
-        <input type="hidden" name="scope" value="{{.Scope}}">
-        <input type="hidden" name="state" value="{{.State}}">
-        <input type="hidden" name="nonce" value="{{.Nonce}}">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
         
         <div class="form-group">
             <label for="username">Username:</label>
-            <input type="text" id="username" name="username" required>
+            <input type="text" id="username" name="username" autocomplete="username webauthn" required>
         </div>
         
         <div class="form-group">
@@ -50,73 +93,256 @@ const loginFormTemplate = `
         
         <button type="submit">Login</button>
     </form>
+    {{if .PasskeySession}}
+    <form id="passkey-form" method="POST" action="/oauth2/authorize/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="session" value="{{.PasskeySession}}">
+        <input type="hidden" name="webauthn_response" value="">
+    </form>
+    <p><button type="button" id="passkey-button" hidden>Sign in with a passkey</button></p>
+    <div class="error" id="passkey-error"></div>
+    <script>
+        (function () {
+            const options = {{.WebauthnOptions}};
+            const form = document.getElementById('passkey-form');
+            const button = document.getElementById('passkey-button');
+            const decode = (value) => Uint8Array.from(atob(value.replace(/-/g, '+').replace(/_/g, '/')), (c) => c.charCodeAt(0));
+            const encode = (buffer) => btoa(String.fromCharCode(...new Uint8Array(buffer))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+            let pending = null;
+
+            async function signIn(mediation) {
+                pending = new AbortController();
+                const credential = await navigator.credentials.get({
+                    mediation: mediation,
+                    signal: pending.signal,
+                    publicKey: {
+                        challenge: decode(options.challenge),
+                        timeout: options.timeout,
+                        rpId: options.rpId,
+                        allowCredentials: [],
+                        userVerification: options.userVerification,
+                    },
+                });
+                form.elements.webauthn_response.value = JSON.stringify({
+                    id: credential.id,
+                    rawId: encode(credential.rawId),
+                    type: credential.type,
+                    authenticatorAttachment: credential.authenticatorAttachment,
+                    response: {
+                        clientDataJSON: encode(credential.response.clientDataJSON),
+                        authenticatorData: encode(credential.response.authenticatorData),
+                        signature: encode(credential.response.signature),
+                        userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : undefined,
+                    },
+                });
+                form.submit();
+            }
+
+            if (!window.PublicKeyCredential) {
+                return;
+            }
+            button.hidden = false;
+            button.addEventListener('click', () => {
+                if (pending) {
+                    pending.abort();
+                }
+                signIn('optional').catch((err) => {
+                    if (err.name !== 'AbortError') {
+                        document.getElementById('passkey-error').textContent = 'Passkey sign-in was cancelled or failed';
+                    }
+                });
+            });
+
+            // Offer passkeys in the autofill of the username field
+            if (PublicKeyCredential.isConditionalMediationAvailable) {
+                PublicKeyCredential.isConditionalMediationAvailable().then((available) => {
+                    if (available) {
+                        signIn('conditional').catch(() => {});
+                    }
+                });
+            }
+        })();
+    </script>
+    {{end}}
+    {{if .PasswordlessUrl}}
+    <p><a href="{{.PasswordlessUrl}}">Sign in without a password</a></p>
+    {{end}}
+    {{if .ForgotPasswordUrl}}
+    <p><a href="{{.ForgotPasswordUrl}}">Forgot your password?</a></p>
+    {{end}}
+    {{if .SignUpUrl}}
+    <p>Don't have an account? <a href="{{.SignUpUrl}}">Sign up</a></p>
+    {{end}}
+    {{end}}
 </body>
 </html>
 `
 
 type loginFormData struct {
-	Error         string
-	ClientID      string
-	RedirectURI   string
-	Scope         string
-	State         string
-	Nonce         string
-	ShowChallenge bool
+	Error             string
+	Request           AuthorizationRequest
+	ShowChallenge     bool
+	Session           string
+	Username          string
+	SignUpUrl         string
+	ForgotPasswordUrl string
+	PasswordlessUrl   string
+	MfaStep           bool
+	TotpSecret        string
+	TotpQrCode        template.URL
+	PasskeySession    string
+	WebauthnOptions   *WebauthnRequestOptions
 }
 
 func GET_oauth2_authorize(w http.ResponseWriter, r *http.Request) {
-	// Get and validate required parameters
-	clientID := r.URL.Query().Get("client_id")
-	redirectURI := r.URL.Query().Get("redirect_uri")
-	responseType := r.URL.Query().Get("response_type")
-	scope := r.URL.Query().Get("scope")
-	state := r.URL.Query().Get("state")
-	nonce := r.URL.Query().Get("nonce")
-
-	// Validate response_type
-	if responseType != "code" {
-		http.Error(w, "response_type must be 'code'", http.StatusBadRequest)
+	// The hosted pages return to the login form of a request that was already validated
+	query := r.URL.Query()
+	if query.Has("authorization_request") {
+		request, exists := findAuthorizationRequest(query.Get("authorization_request"))
+		if !exists {
+			renderExpiredAuthorizationRequestPage(w)
+			return
+		}
+		renderLoginForm(w, loginFormData{
+			Request:       request,
+			ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+		})
 		return
 	}
 
-	// Validate client_id and redirect_uri
-	var foundClient *IdpClient
-	for i, client := range AppContext.Clients {
-		if client.Id == clientID && client.RedirectUri == redirectURI {
-			foundClient = &AppContext.Clients[i]
-			break
+	// A request_uri refers to parameters pushed by the client, which replace the ones of the request
+	pushed := query.Has("request_uri") && !usesRequestObject(query)
+	if pushed {
+		params, err := resolvePushedAuthorizationRequest(query)
+		if err != nil {
+			renderOAuth2ErrorPage(w, http.StatusBadRequest, OAuth2ErrorInvalidRequestUri, err.Error())
+			return
 		}
+		query = params
 	}
 
+	// A signed request object replaces the parameters of the request
+	if usesRequestObject(query) {
+		requestClient := FindClientById(query.Get("client_id"))
+		if requestClient == nil {
+			renderInvalidClientPage(w)
+			return
+		}
+		params, err := resolveRequestObject(requestClient, query)
+		if err != nil {
+			writeRequestObjectError(w, err)
+			return
+		}
+		query = params
+	}
+
+	// Get and validate required parameters
+	clientID := query.Get("client_id")
+	redirectURI := query.Get("redirect_uri")
+	responseType := query.Get("response_type")
+	responseMode := query.Get("response_mode")
+	scope := query.Get("scope")
+	state := query.Get("state")
+	nonce := query.Get("nonce")
+	prompt := query.Get("prompt")
+
+	// Validate client_id and redirect_uri, errors are only redirected to a registered redirect_uri
+	foundClient := FindClientByRedirectUri(clientID, redirectURI)
 	if foundClient == nil {
-		http.Error(w, "Invalid client_id or redirect_uri", http.StatusBadRequest)
+		renderInvalidClientPage(w)
+		return
+	}
+
+	// Clients that require pushed authorization requests cannot pass the parameters in the request
+	if foundClient.RequirePushedAuthorization && !pushed {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, OAuth2ErrorInvalidRequest, "The client must use a pushed authorization request")
+		return
+	}
+
+	// Validate response_type and response_mode
+	if responseType == "" {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, OAuth2ErrorInvalidRequest, "response_type is required")
+		return
+	}
+	if errorCode, description := checkResponseType(foundClient, responseType, nonce); errorCode != "" {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, errorCode, description)
+		return
+	}
+	if errorCode, description := checkResponseMode(responseType, responseMode); errorCode != "" {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, errorCode, description)
+		return
+	}
+
+	// The user always has to log in, so a login without user interaction cannot succeed
+	if promptIncludes(prompt, "none") {
+		redirectWithError(w, r, foundClient, redirectURI, responseType, responseMode, state, OAuth2ErrorLoginRequired, "The user must log in")
 		return
 	}
 
 	// Use default scopes if not provided
 	if scope == "" {
-		scope = AppConfig.OAuth2.DefaultScopes
+		scope = clientDefaultScopes(foundClient, AppConfig.OAuth2.DefaultScopes)
+	}
+
+	// The steps of the login refer to the validated request, so its parameters cannot be changed
+	request := storeAuthorizationRequest(AuthorizationRequest{
+		ClientId:     clientID,
+		RedirectUri:  redirectURI,
+		ResponseType: responseType,
+		ResponseMode: responseMode,
+		Scope:        scope,
+		State:        state,
+		Nonce:        nonce,
+		Prompt:       prompt,
+	})
+	renderLoginForm(w, loginFormData{
+		Request:       request,
+		ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+	})
+}
+
+// renderLoginForm parses and renders the login form template
+func renderLoginForm(w http.ResponseWriter, data loginFormData) {
+	request := data.Request
+
+	// Link to the hosted pages, which return to this login
+	if *AppConfig.SignUp.Enabled {
+		data.SignUpUrl = "/oauth2/signup?" + authorizationRequestParams(request).Encode()
+	}
+	if *AppConfig.PasswordReset.Enabled {
+		data.ForgotPasswordUrl = "/oauth2/password/forgot?" + authorizationRequestParams(request).Encode()
+	}
+	if *AppConfig.Passwordless.Enabled {
+		data.PasswordlessUrl = "/oauth2/passwordless?" + authorizationRequestParams(request).Encode()
+	}
+
+	// Each rendering of the login step gets its own passkey challenge
+	if *AppConfig.Webauthn.Enabled && !data.MfaStep && data.Session == "" {
+		session, options, err := newWebauthnLogin(nil)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.PasskeySession = generateRandomToken()
+		data.WebauthnOptions = options
+		storePendingLogin(data.PasskeySession, PendingLogin{
+			ClientId:             request.ClientId,
+			Scopes:               request.Scope,
+			CreatedAt:            time.Now(),
+			ChallengeName:        ChallengeNameWebauthn,
+			Webauthn:             session,
+			AuthorizationRequest: request.Id,
+		})
 	}
 
-	// Parse and render the template
 	tmpl, err := template.New("login").Parse(loginFormTemplate)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	data := loginFormData{
-		ClientID:      clientID,
-		RedirectURI:   redirectURI,
-		Scope:         scope,
-		State:         state,
-		Nonce:         nonce,
-		ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
-	}
-
 	w.Header().Set("Content-Type", "text/html")
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+const passwordResetFormTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Reset password</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .error { color: red; margin-bottom: 10px; }
+        .form-group { margin-bottom: 15px; }
+        label { display: block; margin-bottom: 5px; }
+        input[type="text"], input[type="password"] { width: 100%; padding: 8px; }
+        button { padding: 10px 20px; background: #007bff; color: white; border: none; cursor: pointer; }
+    </style>
+</head>
+<body>
+    {{if .Done}}
+    <h2>Password reset</h2>
+    <p>The password of {{.Username}} has been reset.</p>
+    {{if .LoginUrl}}
+    <p><a href="{{.LoginUrl}}">Continue to login</a></p>
+    {{end}}
+    {{else if .Username}}
+    <h2>Reset your password</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>Enter the code we sent to {{if .Destination}}{{.Destination}}{{else}}your email address{{end}} and choose a new password.</p>
+    <form method="POST" action="/oauth2/password/forgot/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="username" value="{{.Username}}">
+
+        <div class="form-group">
+            <label for="code">Code:</label>
+            <input type="text" id="code" name="code" value="{{.Code}}" autocomplete="one-time-code" required>
+        </div>
+
+        <div class="form-group">
+            <label for="new_password">New password:</label>
+            <input type="password" id="new_password" name="new_password" required>
+        </div>
+
+        <div class="form-group">
+            <label for="confirm_password">Confirm new password:</label>
+            <input type="password" id="confirm_password" name="confirm_password" required>
+        </div>
+
+        <button type="submit">Reset password</button>
+    </form>
+    {{else}}
+    <h2>Forgot your password?</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>Enter your username and we will email you a code to reset your password.</p>
+    <form method="POST" action="/oauth2/password/forgot/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+
+        <div class="form-group">
+            <label for="username">Username:</label>
+            <input type="text" id="username" name="username" required>
+        </div>
+
+        <button type="submit">Send code</button>
+    </form>
+    {{if .LoginUrl}}
+    <p><a href="{{.LoginUrl}}">Back to login</a></p>
+    {{end}}
+    {{end}}
+</body>
+</html>
+`
+
+type passwordResetFormData struct {
+	Error       string
+	Request     AuthorizationRequest
+	Username    string
+	Code        string
+	Destination string
+	Done        bool
+	LoginUrl    string
+}
+
+// newPasswordResetFormData finds the authorization request of the OAuth2 login the user returns to after resetting
+// their password. Without one, or once it expired, the page does not return to a login.
+func newPasswordResetFormData(values url.Values) passwordResetFormData {
+	request, _ := findReturnAuthorizationRequest(values)
+	return passwordResetFormData{Request: request}
+}
+
+func GET_oauth2_password_forgot(w http.ResponseWriter, r *http.Request) {
+	renderPasswordResetForm(w, newPasswordResetFormData(r.URL.Query()))
+}
+
+// renderPasswordResetForm parses and renders the password reset form template
+func renderPasswordResetForm(w http.ResponseWriter, data passwordResetFormData) {
+	data.LoginUrl = authorizationRequestLoginUrl(data.Request)
+
+	tmpl, err := template.New("password_reset").Parse(passwordResetFormTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+// GET_oauth2_password_reset handles the password reset link sent to users who forgot their password, asking them
+// for a new password with the code filled in
+func GET_oauth2_password_reset(w http.ResponseWriter, r *http.Request) {
+	data := newPasswordResetFormData(r.URL.Query())
+
+	data.Username = r.URL.Query().Get("username")
+	data.Code = r.URL.Query().Get("code")
+	if foundUser := FindUserByUsername(data.Username); foundUser != nil {
+		data.Destination = maskEmail(userEmail(foundUser))
+	}
+
+	renderPasswordResetForm(w, data)
+}
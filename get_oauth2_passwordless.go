@@ -0,0 +1,120 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+const passwordlessFormTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Sign in without a password</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .error { color: red; margin-bottom: 10px; }
+        .form-group { margin-bottom: 15px; }
+        label { display: block; margin-bottom: 5px; }
+        input[type="text"], select { width: 100%; padding: 8px; }
+        button { padding: 10px 20px; background: #007bff; color: white; border: none; cursor: pointer; }
+    </style>
+</head>
+<body>
+    {{if .Session}}
+    <h2>Enter your code</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>Enter the code we sent to {{.Destination}}{{if .MagicLink}}, or open the link in the message{{end}}.</p>
+    <form method="POST" action="/oauth2/passwordless/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="session" value="{{.Session}}">
+
+        <div class="form-group">
+            <label for="code">Code:</label>
+            <input type="text" id="code" name="code" inputmode="numeric" autocomplete="one-time-code" required>
+        </div>
+
+        <button type="submit">Sign in</button>
+    </form>
+    {{else}}
+    <h2>Sign in without a password</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>Enter your username or email address and we will send you a code to sign in with.</p>
+    <form method="POST" action="/oauth2/passwordless/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+
+        <div class="form-group">
+            <label for="username">Username or email:</label>
+            <input type="text" id="username" name="username" value="{{.Username}}" autocomplete="username" required>
+        </div>
+
+        <div class="form-group">
+            <label for="delivery">Send the code by:</label>
+            <select id="delivery" name="delivery">
+                <option value="">Email</option>
+                <option value="sms">Text message</option>
+            </select>
+        </div>
+
+        <button type="submit">Send code</button>
+    </form>
+    {{end}}
+    <p><a href="{{.LoginUrl}}">Back to login</a></p>
+</body>
+</html>
+`
+
+type passwordlessFormData struct {
+	Error       string
+	Request     AuthorizationRequest
+	Username    string
+	Session     string
+	Destination string
+	MagicLink   bool
+	LoginUrl    string
+}
+
+// newPasswordlessFormData finds the authorization request the user signs in to without a password, returning its
+// client if it is valid
+func newPasswordlessFormData(values url.Values) (passwordlessFormData, *IdpClient, bool) {
+	request, exists := findAuthorizationRequest(values.Get("authorization_request"))
+	if !exists {
+		return passwordlessFormData{}, nil, false
+	}
+	return passwordlessFormData{Request: request}, FindClientByRedirectUri(request.ClientId, request.RedirectUri), true
+}
+
+func GET_oauth2_passwordless(w http.ResponseWriter, r *http.Request) {
+	data, foundClient, exists := newPasswordlessFormData(r.URL.Query())
+	if !exists {
+		renderExpiredAuthorizationRequestPage(w)
+		return
+	}
+	if foundClient == nil {
+		renderInvalidClientPage(w)
+		return
+	}
+
+	renderPasswordlessForm(w, data)
+}
+
+// renderPasswordlessForm parses and renders the passwordless login form template
+func renderPasswordlessForm(w http.ResponseWriter, data passwordlessFormData) {
+	data.LoginUrl = authorizationRequestLoginUrl(data.Request)
+	data.MagicLink = *AppConfig.Passwordless.MagicLink
+
+	tmpl, err := template.New("passwordless").Parse(passwordlessFormTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
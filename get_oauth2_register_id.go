@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// GET_oauth2_register_id reads the registration of a client, see RFC 7592 section 2.1
+func GET_oauth2_register_id(w http.ResponseWriter, r *http.Request) {
+	_, client := findRegisteredClient(w, r)
+	if client == nil {
+		return
+	}
+
+	writeJSONNoStore(w, http.StatusOK, clientRegistrationResponse(client))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+const signUpFormTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Sign up</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .error { color: red; margin-bottom: 10px; }
+        .form-group { margin-bottom: 15px; }
+        label { display: block; margin-bottom: 5px; }
+        input[type="text"], input[type="email"], input[type="password"] { width: 100%; padding: 8px; }
+        button { padding: 10px 20px; background: #007bff; color: white; border: none; cursor: pointer; }
+    </style>
+</head>
+<body>
+    {{if .Confirmed}}
+    <h2>Account confirmed</h2>
+    <p>Your account {{.Username}} has been confirmed.</p>
+    {{if .LoginUrl}}
+    <p><a href="{{.LoginUrl}}">Continue to login</a></p>
+    {{end}}
+    {{else if .Username}}
+    <h2>Confirm your account</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <p>Enter the confirmation code we sent to {{if .Destination}}{{.Destination}}{{else}}your email address{{end}}.</p>
+    <form method="POST" action="/oauth2/signup/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="username" value="{{.Username}}">
+
+        <div class="form-group">
+            <label for="code">Confirmation code:</label>
+            <input type="text" id="code" name="code" autocomplete="one-time-code" required>
+        </div>
+
+        <button type="submit">Confirm</button>
+    </form>
+    {{else}}
+    <h2>Sign up</h2>
+    {{if .Error}}
+    <div class="error">{{.Error}}</div>
+    {{end}}
+    <form method="POST" action="/oauth2/signup/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+
+        <div class="form-group">
+            <label for="username">Username:</label>
+            <input type="text" id="username" name="username" required>
+        </div>
+
+        <div class="form-group">
+            <label for="email">Email:</label>
+            <input type="email" id="email" name="email"{{if .RequireEmail}} required{{end}}>
+        </div>
+
+        <div class="form-group">
+            <label for="password">Password:</label>
+            <input type="password" id="password" name="password" required>
+        </div>
+
+        <div class="form-group">
+            <label for="confirm_password">Confirm password:</label>
+            <input type="password" id="confirm_password" name="confirm_password" required>
+        </div>
+
+        <button type="submit">Sign up</button>
+    </form>
+    {{if .LoginUrl}}
+    <p>Already have an account? <a href="{{.LoginUrl}}">Log in</a></p>
+    {{end}}
+    {{end}}
+</body>
+</html>
+`
+
+type signUpFormData struct {
+	Error        string
+	Request      AuthorizationRequest
+	Username     string
+	Destination  string
+	Confirmed    bool
+	RequireEmail bool
+	LoginUrl     string
+}
+
+// newSignUpFormData finds the authorization request of the OAuth2 login the user returns to after signing up, along
+// with its client. Without one, or once it expired, the page does not return to a login.
+func newSignUpFormData(values url.Values) (signUpFormData, *IdpClient) {
+	request, client := findReturnAuthorizationRequest(values)
+	return signUpFormData{Request: request}, client
+}
+
+func GET_oauth2_signup(w http.ResponseWriter, r *http.Request) {
+	data, _ := newSignUpFormData(r.URL.Query())
+	renderSignUpForm(w, data)
+}
+
+// renderSignUpForm parses and renders the sign-up form template
+func renderSignUpForm(w http.ResponseWriter, data signUpFormData) {
+	data.RequireEmail = *AppConfig.SignUp.RequireVerification
+	data.LoginUrl = authorizationRequestLoginUrl(data.Request)
+
+	tmpl, err := template.New("signup").Parse(signUpFormTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
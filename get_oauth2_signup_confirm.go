@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+)
+
+// GET_oauth2_signup_confirm handles the confirmation link sent to users who signed up
+func GET_oauth2_signup_confirm(w http.ResponseWriter, r *http.Request) {
+	data, foundClient := newSignUpFormData(r.URL.Query())
+
+	// Without a code, the page asks for it
+	data.Username = r.URL.Query().Get("username")
+	code := r.URL.Query().Get("code")
+	if data.Username == "" || code == "" {
+		renderSignUpForm(w, data)
+		return
+	}
+
+	confirmSignUpForm(w, data, foundClient, code)
+}
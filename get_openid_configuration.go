@@ -6,28 +6,56 @@ import (
 )
 
 type OpenIDConfiguration struct {
-	Issuer                           string   `json:"issuer"`
-	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
-	TokenEndpoint                    string   `json:"token_endpoint"`
-	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
-	JwksURI                          string   `json:"jwks_uri"`
-	ResponseTypesSupported           []string `json:"response_types_supported"`
-	SubjectTypesSupported            []string `json:"subject_types_supported"`
-	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
-	GrantTypesSupported              []string `json:"grant_types_supported"`
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserinfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JwksURI                                    string   `json:"jwks_uri"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint"`
+	RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+	RequestUriParameterSupported               bool     `json:"request_uri_parameter_supported"`
+	RequestObjectSigningAlgValuesSupported     []string `json:"request_object_signing_alg_values_supported"`
+	AuthorizationSigningAlgValuesSupported     []string `json:"authorization_signing_alg_values_supported"`
 }
 
+// OAuth2ResponseTypes, OAuth2ResponseModes and OAuth2GrantTypes are the flows the authorization and token endpoints
+// support
+var (
+	OAuth2ResponseTypes = []string{"code", "token", "id_token", "id_token token", "code id_token", "code token", "code id_token token"}
+	OAuth2ResponseModes = []string{ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost, ResponseModeJwt, ResponseModeQueryJwt, ResponseModeFragmentJwt, ResponseModeFormPostJwt}
+	OAuth2GrantTypes    = []string{"authorization_code", "implicit"}
+)
+
 func GET_openid_configuration(w http.ResponseWriter, r *http.Request) {
 	config := OpenIDConfiguration{
-		Issuer:                           AppConfig.Issuer,
-		AuthorizationEndpoint:            AppConfig.BaseUrl + "/oauth2/authorize",
-		TokenEndpoint:                    AppConfig.BaseUrl + "/oauth2/token",
-		UserinfoEndpoint:                 AppConfig.BaseUrl + "/userinfo",
-		JwksURI:                          AppConfig.BaseUrl + "/.well-known/jwks.json",
-		ResponseTypesSupported:           []string{"code"},
-		SubjectTypesSupported:            []string{"public"},
-		IDTokenSigningAlgValuesSupported: []string{"RS256"},
-		GrantTypesSupported:              []string{"authorization_code"},
+		Issuer:                            AppConfig.Issuer,
+		AuthorizationEndpoint:             AppConfig.BaseUrl + "/oauth2/authorize",
+		TokenEndpoint:                     AppConfig.BaseUrl + "/oauth2/token",
+		UserinfoEndpoint:                  AppConfig.BaseUrl + "/userinfo",
+		JwksURI:                           AppConfig.BaseUrl + "/.well-known/jwks.json",
+		ResponseTypesSupported:            OAuth2ResponseTypes,
+		ResponseModesSupported:            OAuth2ResponseModes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		GrantTypesSupported:               OAuth2GrantTypes,
+		TokenEndpointAuthMethodsSupported: ClientAuthMethods,
+		TokenEndpointAuthSigningAlgValuesSupported: ClientAssertionAlgorithms,
+		PushedAuthorizationRequestEndpoint:         AppConfig.BaseUrl + "/oauth2/par",
+		RequestParameterSupported:                  true,
+		RequestUriParameterSupported:               true,
+		RequestObjectSigningAlgValuesSupported:     RequestObjectAlgorithms,
+		AuthorizationSigningAlgValuesSupported:     []string{"RS256"},
+	}
+	if *AppConfig.ClientRegistration.Enabled {
+		config.RegistrationEndpoint = AppConfig.BaseUrl + "/oauth2/register"
 	}
 
 	w.Header().Set("Content-Type", "application/json")
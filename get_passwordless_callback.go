@@ -0,0 +1,85 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+const passwordlessCallbackTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Sign in</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .error { color: red; margin-bottom: 10px; }
+    </style>
+</head>
+<body>
+    {{if .Error}}
+    <h2>Sign-in link</h2>
+    <div class="error">{{.Error}}</div>
+    {{else}}
+    <h2>You are signed in</h2>
+    <p>You can close this window and return to the app.</p>
+    {{end}}
+</body>
+</html>
+`
+
+type passwordlessCallbackData struct {
+	Error string
+}
+
+func GET_passwordless_callback(w http.ResponseWriter, r *http.Request) {
+	key, pendingLogin, exists := findPasswordlessLogin(r.URL.Query().Get("token"))
+	if !exists || pendingLoginExpired(pendingLogin) {
+		renderPasswordlessCallback(w, http.StatusBadRequest, passwordlessCallbackData{Error: "This sign-in link is invalid or has expired"})
+		return
+	}
+
+	// Logins started with the Login API are completed by the app, which no longer needs the code
+	if pendingLogin.AuthorizationRequest == "" {
+		pendingLogin.Passwordless.Confirmed = true
+		AppContext.PendingLogins[key] = pendingLogin
+		renderPasswordlessCallback(w, http.StatusOK, passwordlessCallbackData{})
+		return
+	}
+
+	// Logins started on the hosted page continue with the authorization request
+	delete(AppContext.PendingLogins, key)
+	request, exists := findAuthorizationRequest(pendingLogin.AuthorizationRequest)
+	if !exists {
+		renderPasswordlessCallback(w, http.StatusBadRequest, passwordlessCallbackData{Error: "This sign-in link is invalid or has expired"})
+		return
+	}
+	foundClient := FindClientByRedirectUri(request.ClientId, request.RedirectUri)
+
+	_, foundUser := FindUserIndexById(pendingLogin.UserId)
+	if foundClient == nil || foundUser == nil {
+		renderPasswordlessCallback(w, http.StatusBadRequest, passwordlessCallbackData{Error: "This sign-in link is invalid or has expired"})
+		return
+	}
+	if err := checkLoginAllowed(foundUser); err != nil {
+		renderPasswordlessCallback(w, http.StatusForbidden, passwordlessCallbackData{Error: err.Error()})
+		return
+	}
+
+	continueOAuth2Login(w, r, foundUser, foundClient, request, pendingLogin.Amr)
+}
+
+// renderPasswordlessCallback parses and renders the page shown after opening a magic link
+func renderPasswordlessCallback(w http.ResponseWriter, status int, data passwordlessCallbackData) {
+	tmpl, err := template.New("passwordless_callback").Parse(passwordlessCallbackTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Failed to render passwordless callback: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+func GET_sms(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+
+	// Optionally filter by recipient
+	messages := []SmsMessage{}
+	for _, message := range AppContext.SmsInbox {
+		if to == "" || message.To == to {
+			messages = append(messages, message)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func GET_sms_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	messageId := vars["id"]
+
+	for _, message := range AppContext.SmsInbox {
+		if message.Id == messageId {
+			writeJSON(w, http.StatusOK, message)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "Message not found"})
+}
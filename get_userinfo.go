@@ -11,33 +11,33 @@ func GET_userinfo(w http.ResponseWriter, r *http.Request) {
 	// Extract token from header
 	tokenString, err := extractTokenFromHeader(r)
 	if err != nil {
-		http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid authorization header")
 		return
 	}
 
 	// Validate token
 	token, err := validateAccessToken(tokenString)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid token")
 		return
 	}
 
 	// Verify token use
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid token claims")
 		return
 	}
 
 	if claims["token_use"] != TokenUseAccess {
-		http.Error(w, "Invalid token use", http.StatusUnauthorized)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid token use")
 		return
 	}
 
 	// Get user ID from token
 	userId, ok := claims["sub"].(string)
 	if !ok {
-		http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid user ID in token")
 		return
 	}
 
@@ -51,7 +51,7 @@ func GET_userinfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if foundUser == nil {
-		http.Error(w, "User not found", http.StatusInternalServerError)
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "User not found")
 		return
 	}
 
@@ -59,9 +59,19 @@ func GET_userinfo(w http.ResponseWriter, r *http.Request) {
 	response := make(map[string]interface{})
 	response["sub"] = foundUser.Id
 
-	// Add all user attributes
-	for k, v := range foundUser.Attributes {
-		response[k] = v
+	// Find client the token was issued to
+	clientId, _ := claims["client_id"].(string)
+	foundClient := FindClientById(clientId)
+
+	if claimMapping := clientUserinfoClaims(foundClient); claimMapping != nil && foundClient != nil {
+		// Map user attributes to claims if configured
+		scopes, _ := claims["scope"].(string)
+		applyClaimMappings(response, claimMapping, claimTemplateData(r, foundUser, foundClient, scopes))
+	} else {
+		// Add all user attributes
+		for k, v := range foundUser.Attributes {
+			response[k] = v
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
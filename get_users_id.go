@@ -14,13 +14,7 @@ func GET_users_id(w http.ResponseWriter, r *http.Request) {
 	_, existingUser := FindUserIndexById(userId)
 
 	if existingUser != nil {
-		responseUser := IdpUser{
-			Id:         existingUser.Id,
-			Username:   existingUser.Username,
-			Disabled:   existingUser.Disabled,
-			Attributes: existingUser.Attributes,
-		}
-		writeJSON(w, http.StatusOK, responseUser)
+		writeJSON(w, http.StatusOK, redactUser(existingUser))
 		return
 	}
 
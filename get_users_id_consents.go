@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func GET_users_id_consents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	consents := user.Consents
+	if consents == nil {
+		consents = []ConsentGrant{}
+	}
+
+	writeJSON(w, http.StatusOK, consents)
+}
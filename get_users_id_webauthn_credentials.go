@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func GET_users_id_webauthn_credentials(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	credentials := user.WebauthnCredentials
+	if credentials == nil {
+		credentials = []WebauthnCredential{}
+	}
+
+	writeJSON(w, http.StatusOK, credentials)
+}
@@ -3,8 +3,16 @@ module github.com/SIOCODE-Open/local-idp
 go 1.23.2
 
 require (
+	github.com/boombuler/barcode v1.0.1
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/goccy/go-yaml v1.17.1
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
+	golang.org/x/crypto v0.36.0
+)
+
+require (
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 )
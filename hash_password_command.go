@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runHashPasswordCommand prints the hash of a password, to be used as a user's password in the configuration file.
+// The password is read from the first argument, or from the standard input if there is none.
+func runHashPasswordCommand(args []string) int {
+	flags := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	algorithm := flags.String("algorithm", PasswordHashBcrypt, "Hash algorithm: bcrypt, argon2id or pbkdf2_sha256")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s hash-password [--algorithm bcrypt|argon2id|pbkdf2_sha256] [password]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var password string
+	switch flags.NArg() {
+	case 0:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+			return 1
+		}
+		password = strings.TrimRight(line, "\r\n")
+	case 1:
+		password = flags.Arg(0)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "Password must not be empty")
+		return 1
+	}
+	if *algorithm == PasswordHashPlaintext {
+		fmt.Fprintln(os.Stderr, "Unsupported hash algorithm plaintext")
+		return 2
+	}
+	if *algorithm == PasswordHashBcrypt && len(password) > bcryptMaxPasswordLength {
+		fmt.Fprintf(os.Stderr, "Password must be at most %d bytes long for bcrypt\n", bcryptMaxPasswordLength)
+		return 1
+	}
+
+	hashed, err := hashPassword(password, *algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error hashing password: %v\n", err)
+		return 2
+	}
+	fmt.Println(hashed)
+	return 0
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"time"
 
@@ -15,6 +16,8 @@ const (
 	ChallengeExpiry = 5 * time.Minute
 )
 
+var ErrTokenRevoked = errors.New("token has been revoked")
+
 func generateRandomToken() string {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -23,14 +26,14 @@ func generateRandomToken() string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-func generateAccessToken(user *IdpUser, client *IdpClient, scopes string) (string, error) {
+func generateAccessToken(r *http.Request, user *IdpUser, client *IdpClient, scopes string) (string, error) {
 	now := time.Now()
 	jwksKey := AppContext.JwksKeys[0]
-	expirationDuration := time.Duration(AppConfig.AccessTokenExpirationSeconds) * time.Second
+	expirationDuration := clientAccessTokenLifetime(client)
 
 	// Use provided scopes or fallback to default
 	if scopes == "" {
-		scopes = "openid profile"
+		scopes = clientDefaultScopes(client, "openid profile")
 	}
 
 	claims := jwt.MapClaims{
@@ -46,13 +49,19 @@ func generateAccessToken(user *IdpUser, client *IdpClient, scopes string) (strin
 		"jti":       generateRandomToken(),
 	}
 
+	// Add the user's groups
+	if len(user.Groups) > 0 {
+		claims[GroupsClaim] = user.Groups
+	}
+
 	// Map user attributes to claims if configured
-	if AppConfig.MapAccessTokenClaims != nil {
-		for claimName, attributeName := range AppConfig.MapAccessTokenClaims {
-			if attributeValue, exists := user.Attributes[attributeName]; exists {
-				claims[claimName] = attributeValue
-			}
-		}
+	if claimMapping := clientAccessTokenClaims(client); claimMapping != nil {
+		applyClaimMappings(claims, claimMapping, claimTemplateData(r, user, client, scopes))
+	}
+
+	// Let the pre token generation hook customize claims
+	if err := runPreTokenGenerationHook(TokenUseAccess, user, client, scopes, claims); err != nil {
+		return "", err
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
@@ -61,10 +70,16 @@ func generateAccessToken(user *IdpUser, client *IdpClient, scopes string) (strin
 	return token.SignedString(jwksKey.PrivateKey)
 }
 
-func generateIdentityToken(user *IdpUser, client *IdpClient, nonce string) (string, error) {
+func generateIdentityToken(r *http.Request, user *IdpUser, client *IdpClient, scopes string, nonce string, amr []string) (string, error) {
+	return generateIdentityTokenWithClaims(r, user, client, scopes, nonce, amr, nil)
+}
+
+// generateIdentityTokenWithClaims generates an ID token with additional claims, such as the hashes of the tokens it is
+// issued with
+func generateIdentityTokenWithClaims(r *http.Request, user *IdpUser, client *IdpClient, scopes string, nonce string, amr []string, extraClaims jwt.MapClaims) (string, error) {
 	now := time.Now()
 	jwksKey := AppContext.JwksKeys[0]
-	expirationDuration := time.Duration(AppConfig.AccessTokenExpirationSeconds) * time.Second
+	expirationDuration := clientIdentityTokenLifetime(client)
 	claims := jwt.MapClaims{
 		"sub":       user.Id,
 		"iss":       AppConfig.Issuer,
@@ -82,13 +97,19 @@ func generateIdentityToken(user *IdpUser, client *IdpClient, nonce string) (stri
 		claims["nonce"] = nonce
 	}
 
+	// Add the methods the user authenticated with
+	if len(amr) > 0 {
+		claims["amr"] = amr
+	}
+
+	// Add the user's groups
+	if len(user.Groups) > 0 {
+		claims[GroupsClaim] = user.Groups
+	}
+
 	// Map user attributes to claims if configured
-	if AppConfig.MapIdentityTokenClaims != nil {
-		for claimName, attributeName := range AppConfig.MapIdentityTokenClaims {
-			if attributeValue, exists := user.Attributes[attributeName]; exists {
-				claims[claimName] = attributeValue
-			}
-		}
+	if claimMapping := clientIdentityTokenClaims(client); claimMapping != nil {
+		applyClaimMappings(claims, claimMapping, claimTemplateData(r, user, client, scopes))
 	} else {
 		// Fallback: Add all user attributes if no mapping is configured
 		for k, v := range user.Attributes {
@@ -96,19 +117,99 @@ func generateIdentityToken(user *IdpUser, client *IdpClient, nonce string) (stri
 		}
 	}
 
+	// Add the claims that bind the token to the authorization response
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+
+	// Let the pre token generation hook customize claims
+	if err := runPreTokenGenerationHook(TokenUseId, user, client, scopes, claims); err != nil {
+		return "", err
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 	token.Header["kid"] = jwksKey.Kid
 
 	return token.SignedString(jwksKey.PrivateKey)
 }
 
+// issueRefreshToken stores a new refresh token for the user and client, valid for the client's refresh token lifetime.
+// Tokens issued with it keep the authentication methods of the login.
+func issueRefreshToken(user *IdpUser, client *IdpClient, scopes string, amr []string) string {
+	refreshToken := generateRandomToken()
+	AppContext.RefreshTokens[refreshToken] = IssuedRefreshToken{
+		UserId:    user.Id,
+		ClientId:  client.Id,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(clientRefreshTokenLifetime(client)),
+		Amr:       amr,
+	}
+	return refreshToken
+}
+
 func validateAccessToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
 		return &AppContext.JwksKeys[0].PrivateKey.PublicKey, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if isAccessTokenRevoked(token) {
+		return nil, ErrTokenRevoked
+	}
+	return token, nil
+}
+
+// revokeAccessTokens revokes the given access token and all tokens issued to its user before now
+func revokeAccessTokens(token *jwt.Token) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		expiresAt, _ := claims.GetExpirationTime()
+		if expiresAt != nil {
+			AppContext.RevokedAccessTokens[jti] = expiresAt.Time
+		}
+	}
+	if userId, ok := claims["sub"].(string); ok {
+		AppContext.SignedOutUsers[userId] = time.Now()
+	}
+}
+
+// isAccessTokenRevoked checks whether the token was revoked, or issued before its user signed out globally
+func isAccessTokenRevoked(token *jwt.Token) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		if _, revoked := AppContext.RevokedAccessTokens[jti]; revoked {
+			return true
+		}
+	}
+	if userId, ok := claims["sub"].(string); ok {
+		if signedOutAt, exists := AppContext.SignedOutUsers[userId]; exists {
+			issuedAt, _ := claims.GetIssuedAt()
+			if issuedAt != nil && issuedAt.Unix() < signedOutAt.Unix() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// revokeRefreshTokens removes all refresh tokens issued to the user
+func revokeRefreshTokens(userId string) {
+	for token, issued := range AppContext.RefreshTokens {
+		if issued.UserId == userId {
+			delete(AppContext.RefreshTokens, token)
+		}
+	}
 }
 
 func extractTokenFromHeader(r *http.Request) (string, error) {
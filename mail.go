@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sendMail captures an email in the mailbox and relays it to the configured SMTP server, if any
+func sendMail(to string, subject string, body string) {
+	message := MailMessage{
+		Id:        uuid.NewString(),
+		From:      AppConfig.Mail.From,
+		To:        to,
+		Subject:   subject,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+	AppContext.Mailbox = append(AppContext.Mailbox, message)
+	log.Printf("Sent mail %q to %s", subject, to)
+
+	// Relaying must not hold up the request, failures are only logged
+	if smtpConfig := AppConfig.Mail.Smtp; smtpConfig != nil && smtpConfig.Host != "" {
+		go func() {
+			if err := relayMail(smtpConfig, message); err != nil {
+				log.Printf("Failed to relay mail to %s: %v", to, err)
+			}
+		}()
+	}
+}
+
+// relayMail sends a captured email to an SMTP server
+func relayMail(smtpConfig *SmtpConfig, message MailMessage) error {
+	addr := net.JoinHostPort(smtpConfig.Host, strconv.Itoa(smtpConfig.Port))
+
+	var auth smtp.Auth
+	if smtpConfig.Username != "" {
+		auth = smtp.PlainAuth("", smtpConfig.Username, smtpConfig.Password, smtpConfig.Host)
+	}
+
+	var data strings.Builder
+	fmt.Fprintf(&data, "From: %s\r\n", message.From)
+	fmt.Fprintf(&data, "To: %s\r\n", message.To)
+	fmt.Fprintf(&data, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&data, "Date: %s\r\n", message.CreatedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&data, "Message-ID: <%s@local-idp>\r\n", message.Id)
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	data.WriteString("\r\n")
+	data.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(addr, auth, message.From, []string{message.To}, []byte(data.String()))
+}
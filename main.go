@@ -4,12 +4,18 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		os.Exit(runHashPasswordCommand(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.LUTC)
@@ -38,7 +44,16 @@ func main() {
 	if *AppConfig.OAuth2.Enabled {
 		router.HandleFunc("/oauth2/authorize", GET_oauth2_authorize).Methods("GET")
 		router.HandleFunc("/oauth2/authorize/submit", POST_oauth2_authorize_submit).Methods("POST")
+		router.HandleFunc("/oauth2/consent/submit", POST_oauth2_consent_submit).Methods("POST")
 		router.HandleFunc("/oauth2/token", POST_oauth2_token).Methods("POST")
+		router.HandleFunc("/oauth2/par", POST_oauth2_par).Methods("POST")
+		if *AppConfig.ClientRegistration.Enabled {
+			router.HandleFunc("/oauth2/register", POST_oauth2_register).Methods("POST")
+			router.HandleFunc("/oauth2/register/{id}", GET_oauth2_register_id).Methods("GET")
+			router.HandleFunc("/oauth2/register/{id}", PUT_oauth2_register_id).Methods("PUT")
+			router.HandleFunc("/oauth2/register/{id}", DELETE_oauth2_register_id).Methods("DELETE")
+			log.Printf("Dynamic client registration enabled")
+		}
 		log.Printf("OAuth2 endpoints enabled")
 	} else {
 		log.Printf("OAuth2 endpoints disabled")
@@ -54,6 +69,75 @@ func main() {
 		log.Printf("Login API endpoints disabled")
 	}
 
+	// Cognito Identity Provider compatible endpoint (conditional based on config)
+	if *AppConfig.CognitoApi.Enabled {
+		router.HandleFunc("/", POST_cognito).Methods("POST")
+		log.Printf("Cognito API endpoint enabled")
+	} else {
+		log.Printf("Cognito API endpoint disabled")
+	}
+
+	// Self-service sign-up endpoints (conditional based on config)
+	if *AppConfig.SignUp.Enabled {
+		router.HandleFunc("/signup", POST_signup).Methods("POST")
+		router.HandleFunc("/signup/confirm", POST_signup_confirm).Methods("POST")
+		router.HandleFunc("/signup/resend", POST_signup_resend).Methods("POST")
+		if *AppConfig.OAuth2.Enabled {
+			router.HandleFunc("/oauth2/signup", GET_oauth2_signup).Methods("GET")
+			router.HandleFunc("/oauth2/signup/submit", POST_oauth2_signup_submit).Methods("POST")
+			router.HandleFunc("/oauth2/signup/confirm", GET_oauth2_signup_confirm).Methods("GET")
+		}
+		log.Printf("Sign-up endpoints enabled")
+	} else {
+		log.Printf("Sign-up endpoints disabled")
+	}
+
+	// Password reset endpoints (conditional based on config)
+	if *AppConfig.PasswordReset.Enabled {
+		router.HandleFunc("/password/forgot", POST_password_forgot).Methods("POST")
+		router.HandleFunc("/password/reset", POST_password_reset).Methods("POST")
+		if *AppConfig.OAuth2.Enabled {
+			router.HandleFunc("/oauth2/password/forgot", GET_oauth2_password_forgot).Methods("GET")
+			router.HandleFunc("/oauth2/password/forgot/submit", POST_oauth2_password_forgot_submit).Methods("POST")
+			router.HandleFunc("/oauth2/password/reset", GET_oauth2_password_reset).Methods("GET")
+		}
+		log.Printf("Password reset endpoints enabled")
+	} else {
+		log.Printf("Password reset endpoints disabled")
+	}
+
+	// Passwordless login endpoints (conditional based on config)
+	if *AppConfig.Passwordless.Enabled {
+		router.HandleFunc("/passwordless/callback", GET_passwordless_callback).Methods("GET")
+		if *AppConfig.OAuth2.Enabled {
+			router.HandleFunc("/oauth2/passwordless", GET_oauth2_passwordless).Methods("GET")
+			router.HandleFunc("/oauth2/passwordless/submit", POST_oauth2_passwordless_submit).Methods("POST")
+		}
+		log.Printf("Passwordless login enabled")
+	} else {
+		log.Printf("Passwordless login disabled")
+	}
+
+	// Passkey login endpoint (conditional based on config)
+	if *AppConfig.Webauthn.Enabled {
+		if *AppConfig.LoginApi.Enabled {
+			router.HandleFunc("/login/webauthn/init", POST_login_webauthn_init).Methods("POST")
+		}
+		log.Printf("WebAuthn enabled for relying party %s", AppConfig.Webauthn.RpId)
+	} else {
+		log.Printf("WebAuthn disabled")
+	}
+
+	// Captured mail endpoints
+	router.HandleFunc("/mail", GET_mail).Methods("GET")
+	router.HandleFunc("/mail", DELETE_mail).Methods("DELETE")
+	router.HandleFunc("/mail/{id}", GET_mail_id).Methods("GET")
+
+	// Captured SMS endpoints
+	router.HandleFunc("/sms", GET_sms).Methods("GET")
+	router.HandleFunc("/sms", DELETE_sms).Methods("DELETE")
+	router.HandleFunc("/sms/{id}", GET_sms_id).Methods("GET")
+
 	// User profile endpoint
 	router.HandleFunc("/me", GET_me).Methods("GET")
 
@@ -61,10 +145,26 @@ func main() {
 	router.HandleFunc("/users/{id}", PUT_users_id).Methods("PUT")
 	router.HandleFunc("/users/{id}/disable", POST_users_id_disable).Methods("POST")
 	router.HandleFunc("/users/{id}/enable", POST_users_id_enable).Methods("POST")
+	router.HandleFunc("/users/{id}/mfa/totp", POST_users_id_mfa_totp).Methods("POST")
+	router.HandleFunc("/users/{id}/mfa/totp/verify", POST_users_id_mfa_totp_verify).Methods("POST")
+	router.HandleFunc("/users/{id}/mfa/totp", DELETE_users_id_mfa_totp).Methods("DELETE")
+	router.HandleFunc("/users/{id}/webauthn/register", POST_users_id_webauthn_register).Methods("POST")
+	router.HandleFunc("/users/{id}/webauthn/register/verify", POST_users_id_webauthn_register_verify).Methods("POST")
+	router.HandleFunc("/users/{id}/webauthn/credentials", GET_users_id_webauthn_credentials).Methods("GET")
+	router.HandleFunc("/users/{id}/webauthn/credentials/{credentialId}", DELETE_users_id_webauthn_credentials_id).Methods("DELETE")
+	router.HandleFunc("/users/{id}/consents", GET_users_id_consents).Methods("GET")
+	router.HandleFunc("/users/{id}/consents/{clientId}", DELETE_users_id_consents_id).Methods("DELETE")
 	router.HandleFunc("/users/{id}", DELETE_users_id).Methods("DELETE")
 	router.HandleFunc("/users/{id}", GET_users_id).Methods("GET")
 	router.HandleFunc("/users", GET_users).Methods("GET")
 
+	// Client management endpoints
+	router.HandleFunc("/clients/{id}", PUT_clients_id).Methods("PUT")
+	router.HandleFunc("/clients/{id}/secret", POST_clients_id_secret).Methods("POST")
+	router.HandleFunc("/clients/{id}", DELETE_clients_id).Methods("DELETE")
+	router.HandleFunc("/clients/{id}", GET_clients_id).Methods("GET")
+	router.HandleFunc("/clients", GET_clients).Methods("GET")
+
 	corsRouter := corsMiddleware(router)
 	loggedRouter := accessLogger(corsRouter)
 
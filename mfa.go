@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+)
+
+const ChallengeNameMfaSetup = "MFA_SETUP"
+
+// Authentication methods reported in the amr claim of identity tokens
+const (
+	AmrPassword = "pwd"
+	AmrOtp      = "otp"
+)
+
+const totpQrCodeSize = 200
+
+// TotpEnrollment is a new TOTP secret of a user, which is only enabled once they verify a code generated from it
+type TotpEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+	QrCode     string `json:"qr_code"`
+}
+
+// totpEnabled reports whether the user answers a TOTP challenge when logging in
+func totpEnabled(user *IdpUser) bool {
+	return user.ChallengeType == ChallengeTypeTotp && user.TotpSecret != ""
+}
+
+// mfaRequired reports whether the user or the client they log in to requires MFA
+func mfaRequired(user *IdpUser, client *IdpClient) bool {
+	return user.MfaRequired || (client != nil && client.MfaRequired)
+}
+
+// loginChallengeName returns the challenge the user has to answer after their password when logging in to the client,
+// and whether they have to answer one at all. Users that are required to use MFA without having enabled TOTP have to
+// set it up first.
+func loginChallengeName(user *IdpUser, client *IdpClient) (string, bool) {
+	if mfaRequired(user, client) && !totpEnabled(user) {
+		return ChallengeNameMfaSetup, true
+	}
+	return challengeName(user), user.ChallengeType == ChallengeTypeFixed || user.ChallengeType == ChallengeTypeTotp
+}
+
+// isMfaChallenge reports whether answering the challenge proves possession of the user's TOTP authenticator
+func isMfaChallenge(challengeName string) bool {
+	return challengeName == ChallengeNameSoftwareTokenMfa || challengeName == ChallengeNameMfaSetup
+}
+
+// completedAuthenticationMethods returns the authentication methods of a login after the user answered the challenge
+func completedAuthenticationMethods(amr []string, challengeName string) []string {
+	if !isMfaChallenge(challengeName) || slices.Contains(amr, AmrOtp) {
+		return amr
+	}
+	return append(append([]string{}, amr...), AmrOtp)
+}
+
+// validateLoginChallenge checks the answer to a login challenge, enabling TOTP for users that answer MFA setup
+func validateLoginChallenge(user *IdpUser, challengeName string, challengeData string) bool {
+	if challengeName == ChallengeNameMfaSetup {
+		return verifyTotpEnrollment(user, challengeData)
+	}
+	return validateChallengeResponse(user, challengeData)
+}
+
+// startTotpEnrollment generates a new TOTP secret for the user, replacing any enrollment that was not verified
+func startTotpEnrollment(user *IdpUser) (TotpEnrollment, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return TotpEnrollment{}, err
+	}
+	user.PendingTotpSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	return newTotpEnrollment(user, user.PendingTotpSecret)
+}
+
+// newTotpEnrollment returns the otpauth URI and QR code authenticator apps scan to add the secret
+func newTotpEnrollment(user *IdpUser, secret string) (TotpEnrollment, error) {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", AppConfig.Issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TotpDigits))
+	params.Set("period", fmt.Sprintf("%d", int(TotpPeriod.Seconds())))
+	label := url.PathEscape(AppConfig.Issuer) + ":" + url.PathEscape(user.Username)
+	uri := "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+
+	qrCode, err := qrCodePng(uri)
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+
+	return TotpEnrollment{
+		Secret:     secret,
+		OtpauthUri: uri,
+		QrCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	}, nil
+}
+
+// qrCodePng renders the content as a QR code PNG image
+func qrCodePng(content string) ([]byte, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, totpQrCodeSize, totpQrCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyTotpEnrollment checks a code generated from the user's new TOTP secret and enables TOTP if it is valid
+func verifyTotpEnrollment(user *IdpUser, code string) bool {
+	if user.PendingTotpSecret == "" || !validateTotpCode(user.PendingTotpSecret, code) {
+		return false
+	}
+
+	user.TotpSecret = user.PendingTotpSecret
+	user.PendingTotpSecret = ""
+	user.ChallengeType = ChallengeTypeTotp
+	return true
+}
+
+// disableTotp removes the user's TOTP secret, so they no longer answer a TOTP challenge
+func disableTotp(user *IdpUser) {
+	user.TotpSecret = ""
+	user.PendingTotpSecret = ""
+	if user.ChallengeType == ChallengeTypeTotp {
+		user.ChallengeType = ""
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// OAuth2 error codes, see RFC 6749 sections 4.1.2.1 and 5.2, RFC 6750 section 3.1, RFC 7591 section 3.2.2 and OpenID
+// Connect Core 3.1.2.6
+const (
+	OAuth2ErrorInvalidRequest          = "invalid_request"
+	OAuth2ErrorInvalidClient           = "invalid_client"
+	OAuth2ErrorInvalidGrant            = "invalid_grant"
+	OAuth2ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	OAuth2ErrorUnsupportedResponseType = "unsupported_response_type"
+	OAuth2ErrorUnauthorizedClient      = "unauthorized_client"
+	OAuth2ErrorAccessDenied            = "access_denied"
+	OAuth2ErrorServerError             = "server_error"
+	OAuth2ErrorLoginRequired           = "login_required"
+	OAuth2ErrorInvalidToken            = "invalid_token"
+	OAuth2ErrorInvalidRedirectUri      = "invalid_redirect_uri"
+	OAuth2ErrorInvalidClientMetadata   = "invalid_client_metadata"
+	OAuth2ErrorInvalidRequestUri       = "invalid_request_uri"
+	OAuth2ErrorInvalidRequestObject    = "invalid_request_object"
+)
+
+// OAuth2ErrorResponse is the JSON body of an OAuth2 error
+type OAuth2ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+const oauth2ErrorPageTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Sign-in error</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .error { color: red; margin-bottom: 10px; }
+    </style>
+</head>
+<body>
+    <h2>Sign-in error</h2>
+    <div class="error">{{.ErrorDescription}}</div>
+    <p>Error code: <code>{{.Error}}</code></p>
+</body>
+</html>
+`
+
+// writeOAuth2Error writes an error response of the token endpoint. Failed client authentication is answered with a
+// WWW-Authenticate challenge.
+func writeOAuth2Error(w http.ResponseWriter, status int, code string, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="local-idp"`)
+	}
+	writeJSONNoStore(w, status, OAuth2ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// writeBearerError rejects a request to a resource protected by an access token
+func writeBearerError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="local-idp", error=%q, error_description=%q`, code, description))
+	writeJSON(w, status, OAuth2ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// redirectWithError returns an authorization error to the client's redirect URI, with the response mode of the request
+func redirectWithError(w http.ResponseWriter, r *http.Request, client *IdpClient, redirectURI string, responseType string, responseMode string, state string, errorCode string, description string) {
+	params := url.Values{}
+	params.Set("error", errorCode)
+	params.Set("error_description", description)
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	redirectWithParams(w, r, client, redirectURI, responseType, responseMode, params)
+}
+
+// renderOAuth2ErrorPage shows an authorization error to the user. It is used when the redirect URI cannot be trusted,
+// in which case the error must not be sent to it.
+func renderOAuth2ErrorPage(w http.ResponseWriter, status int, code string, description string) {
+	tmpl, err := template.New("oauth2_error").Parse(oauth2ErrorPageTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, OAuth2ErrorResponse{Error: code, ErrorDescription: description}); err != nil {
+		log.Printf("Failed to render OAuth2 error page: %v", err)
+	}
+}
+
+// renderInvalidClientPage rejects a hosted page request for an unknown client or an unregistered redirect URI
+func renderInvalidClientPage(w http.ResponseWriter) {
+	renderOAuth2ErrorPage(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "Invalid client_id or redirect_uri")
+}
+
+// renderInvalidFormPage rejects a hosted page submission that could not be parsed
+func renderInvalidFormPage(w http.ResponseWriter) {
+	renderOAuth2ErrorPage(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "Invalid form data")
+}
+
+// writeJSONNoStore writes a JSON response that must not be cached, such as tokens
+func writeJSONNoStore(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, status, payload)
+}
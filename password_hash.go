@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	PasswordHashBcrypt       = "bcrypt"
+	PasswordHashArgon2id     = "argon2id"
+	PasswordHashPbkdf2Sha256 = "pbkdf2_sha256"
+	PasswordHashPlaintext    = "plaintext"
+)
+
+var PasswordHashAlgorithms = []string{PasswordHashBcrypt, PasswordHashArgon2id, PasswordHashPbkdf2Sha256, PasswordHashPlaintext}
+
+// Parameters used when hashing new passwords
+const (
+	argon2idMemory      = 64 * 1024
+	argon2idIterations  = 3
+	argon2idParallelism = 4
+	pbkdf2Iterations    = 600000
+)
+
+// bcrypt ignores everything after the first 72 bytes of a password
+const bcryptMaxPasswordLength = 72
+
+// hashPassword hashes a password with the given algorithm
+func hashPassword(password string, algorithm string) (string, error) {
+	switch algorithm {
+	case PasswordHashBcrypt:
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	case PasswordHashArgon2id:
+		salt := randomPasswordSalt()
+		key := argon2.IDKey([]byte(password), salt, argon2idIterations, argon2idMemory, argon2idParallelism, 32)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2idMemory, argon2idIterations, argon2idParallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case PasswordHashPbkdf2Sha256:
+		// Django's format, the salt is used as text
+		salt := base64.RawURLEncoding.EncodeToString(randomPasswordSalt())
+		key := pbkdf2.Key([]byte(password), []byte(salt), pbkdf2Iterations, sha256.Size, sha256.New)
+		return fmt.Sprintf("pbkdf2_sha256$%d$%s$%s", pbkdf2Iterations, salt, base64.StdEncoding.EncodeToString(key)), nil
+	case PasswordHashPlaintext:
+		return password, nil
+	}
+	return "", fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+}
+
+func randomPasswordSalt() []byte {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return salt
+}
+
+// storedPassword returns the value stored for a new password, hashed with the configured algorithm
+func storedPassword(password string) (string, error) {
+	return hashPassword(password, AppConfig.PasswordHashAlgorithm)
+}
+
+// isPasswordHash reports whether a stored password is a hash in one of the supported formats
+func isPasswordHash(stored string) bool {
+	return parsePasswordHash(stored) != nil
+}
+
+// passwordMatches reports whether the password matches a stored password, which is either a hash or plain text
+func passwordMatches(stored string, password string) bool {
+	if verify := parsePasswordHash(stored); verify != nil {
+		return verify(password)
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+// passwordVerifier checks a password against a parsed password hash
+type passwordVerifier func(password string) bool
+
+// parsePasswordHash parses a stored password hash, returning nil if it is not a hash in a supported format
+func parsePasswordHash(stored string) passwordVerifier {
+	switch {
+	case strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$"):
+		return func(password string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+		}
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return parseArgon2idHash(stored)
+	case strings.HasPrefix(stored, "pbkdf2_sha256$"):
+		return parseDjangoPbkdf2Hash(stored, sha256.New)
+	case strings.HasPrefix(stored, "pbkdf2_sha1$"):
+		return parseDjangoPbkdf2Hash(stored, sha1.New)
+	}
+	return parseAspNetIdentityHash(stored)
+}
+
+// parseArgon2idHash parses a hash in the PHC string format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func parseArgon2idHash(stored string) passwordVerifier {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return nil
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil
+	}
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil || iterations == 0 || parallelism == 0 {
+		return nil
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil
+	}
+
+	return func(password string) bool {
+		computed := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+}
+
+// parseDjangoPbkdf2Hash parses a hash in Django's format: pbkdf2_sha256$<iterations>$<salt>$<hash>
+func parseDjangoPbkdf2Hash(stored string, h func() hash.Hash) passwordVerifier {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 {
+		return nil
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return nil
+	}
+
+	return func(password string) bool {
+		computed := pbkdf2.Key([]byte(password), []byte(parts[2]), iterations, len(key), h)
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+}
+
+// parseAspNetIdentityHash parses a base64 encoded hash of ASP.NET Core Identity's PasswordHasher, in either the V2
+// format (PBKDF2 with HMAC-SHA1) or the V3 format (PBKDF2 with the PRF and iteration count in the header)
+func parseAspNetIdentityHash(stored string) passwordVerifier {
+	decoded, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil || len(decoded) == 0 {
+		return nil
+	}
+
+	var h func() hash.Hash
+	var iterations int
+	var salt, subkey []byte
+	switch decoded[0] {
+	case 0x00:
+		// 0x00 | salt (16 bytes) | subkey (32 bytes), 1000 iterations
+		if len(decoded) != 1+16+32 {
+			return nil
+		}
+		h, iterations, salt, subkey = sha1.New, 1000, decoded[1:17], decoded[17:]
+	case 0x01:
+		// 0x01 | prf | iterations | salt length | salt | subkey, integers are big endian uint32
+		if len(decoded) < 13 {
+			return nil
+		}
+		switch binary.BigEndian.Uint32(decoded[1:5]) {
+		case 0:
+			h = sha1.New
+		case 1:
+			h = sha256.New
+		case 2:
+			h = sha512.New
+		default:
+			return nil
+		}
+		iterations = int(binary.BigEndian.Uint32(decoded[5:9]))
+		saltLength := binary.BigEndian.Uint32(decoded[9:13])
+		if iterations <= 0 || saltLength < 16 || uint64(len(decoded)) < 13+uint64(saltLength)+16 {
+			return nil
+		}
+		salt, subkey = decoded[13:13+saltLength], decoded[13+saltLength:]
+	default:
+		return nil
+	}
+
+	return func(password string) bool {
+		computed := pbkdf2.Key([]byte(password), salt, iterations, len(subkey), h)
+		return subtle.ConstantTimeCompare(computed, subkey) == 1
+	}
+}
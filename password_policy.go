@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	ErrUserLocked         = errors.New("User is temporarily locked")
+)
+
+// validateNewPassword checks a password the user wants to set against the password policy, returning an error
+// describing why it is not acceptable
+func validateNewPassword(user *IdpUser, password string) error {
+	policy := AppConfig.PasswordPolicy
+
+	if password == "" {
+		return errors.New("Password must not be empty")
+	}
+	if AppConfig.PasswordHashAlgorithm == PasswordHashBcrypt && len(password) > bcryptMaxPasswordLength {
+		return fmt.Errorf("Password must be at most %d bytes long", bcryptMaxPasswordLength)
+	}
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters long", policy.MinLength)
+	}
+	if policy.RequireUppercase && !strings.ContainsFunc(password, unicode.IsUpper) {
+		return errors.New("Password must contain an uppercase letter")
+	}
+	if policy.RequireLowercase && !strings.ContainsFunc(password, unicode.IsLower) {
+		return errors.New("Password must contain a lowercase letter")
+	}
+	if policy.RequireNumbers && !strings.ContainsFunc(password, unicode.IsDigit) {
+		return errors.New("Password must contain a number")
+	}
+	if policy.RequireSymbols && !strings.ContainsFunc(password, isPasswordSymbol) {
+		return errors.New("Password must contain a symbol")
+	}
+
+	// The history includes the current password
+	if policy.HistorySize > 0 && user != nil {
+		if user.Password != "" && checkUserPassword(user, password) {
+			return errors.New("Password has been used recently")
+		}
+		for _, previous := range user.PasswordHistory {
+			if passwordMatches(previous, password) {
+				return errors.New("Password has been used recently")
+			}
+		}
+	}
+
+	return nil
+}
+
+func isPasswordSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// updateUserPassword replaces the user's password with its hash, remembering the previous one for the password history
+func updateUserPassword(user *IdpUser, password string) error {
+	hashed, err := storedPassword(password)
+	if err != nil {
+		return err
+	}
+
+	updateUserPasswordHash(user, hashed)
+	user.SrpCredentials = newSrpCredentials(user.Username, password)
+	return nil
+}
+
+// updateUserPasswordHash replaces the user's password with an already hashed one
+func updateUserPasswordHash(user *IdpUser, hashed string) {
+	if historySize := AppConfig.PasswordPolicy.HistorySize; historySize > 1 && user.Password != "" {
+		user.PasswordHistory = append([]string{user.Password}, user.PasswordHistory...)
+		if len(user.PasswordHistory) > historySize-1 {
+			user.PasswordHistory = user.PasswordHistory[:historySize-1]
+		}
+	}
+
+	now := time.Now()
+	user.Password = hashed
+	user.PasswordChangedAt = &now
+	user.SrpCredentials = nil
+}
+
+// setUserPassword sets a new password chosen by the user, completing any forced password change
+func setUserPassword(user *IdpUser, password string) error {
+	if err := updateUserPassword(user, password); err != nil {
+		return err
+	}
+	user.ForcePasswordChange = false
+	return nil
+}
+
+// passwordExpired reports whether the user's password is older than the policy's maximum age
+func passwordExpired(user *IdpUser) bool {
+	maxAgeDays := AppConfig.PasswordPolicy.MaxAgeDays
+	if maxAgeDays <= 0 || user.PasswordChangedAt == nil {
+		return false
+	}
+	return time.Since(*user.PasswordChangedAt) > time.Duration(maxAgeDays)*24*time.Hour
+}
+
+// passwordChangeRequired reports whether the user has to choose a new password before logging in
+func passwordChangeRequired(user *IdpUser) bool {
+	return user.ForcePasswordChange || passwordExpired(user)
+}
+
+// userLocked reports whether the user is locked out after too many failed logins
+func userLocked(user *IdpUser) bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// recordFailedLogin counts a failed login, locking the user once the configured number of attempts is reached
+func recordFailedLogin(user *IdpUser) {
+	maxAttempts := AppConfig.Lockout.MaxFailedAttempts
+	if maxAttempts <= 0 {
+		return
+	}
+
+	user.FailedLoginAttempts++
+	if user.FailedLoginAttempts >= maxAttempts {
+		lockedUntil := time.Now().Add(time.Duration(AppConfig.Lockout.DurationSeconds) * time.Second)
+		user.LockedUntil = &lockedUntil
+		user.FailedLoginAttempts = 0
+	}
+}
+
+// resetFailedLogins clears the user's failed login counter and lockout
+func resetFailedLogins(user *IdpUser) {
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+}
+
+// checkUserLogin checks the password of a login attempt, keeping track of failed attempts for the account lockout
+func checkUserLogin(user *IdpUser, password string) error {
+	if userLocked(user) {
+		return ErrUserLocked
+	}
+	if !checkUserPassword(user, password) {
+		recordFailedLogin(user)
+		return ErrInvalidCredentials
+	}
+	resetFailedLogins(user)
+	return nil
+}
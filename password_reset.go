@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidResetCode = errors.New("Invalid password reset code")
+	ErrExpiredResetCode = errors.New("Password reset code has expired")
+	ErrNoEmailAddress   = errors.New("User has no email address")
+)
+
+// checkPasswordResetAllowed reports why the user cannot reset their password, if they cannot
+func checkPasswordResetAllowed(user *IdpUser) error {
+	if user.Disabled {
+		return errors.New("User is disabled")
+	}
+	if user.Unconfirmed {
+		return ErrUserNotConfirmed
+	}
+	if userEmail(user) == "" {
+		return ErrNoEmailAddress
+	}
+	return nil
+}
+
+// sendPasswordResetCode generates a new password reset code for the user and emails it, along with a link to the
+// hosted reset page. The return parameters are passed on to the page to continue an OAuth2 login.
+func sendPasswordResetCode(user *IdpUser, returnParams url.Values) {
+	code := generateConfirmationCode()
+	expires := time.Now().Add(time.Duration(AppConfig.PasswordReset.CodeExpirationSeconds) * time.Second)
+	user.ResetCode = code
+	user.ResetCodeExpires = &expires
+	user.ResetCodeFailed = 0
+
+	body := fmt.Sprintf("Hello %s,\n\nYour password reset code is %s\n", user.Username, code)
+	if *AppConfig.OAuth2.Enabled {
+		params := url.Values{}
+		for key, values := range returnParams {
+			params[key] = values
+		}
+		params.Set("username", user.Username)
+		params.Set("code", code)
+		body += fmt.Sprintf("\nYou can also reset your password by opening this link:\n%s/oauth2/password/reset?%s\n", AppConfig.BaseUrl, params.Encode())
+	}
+	body += "\nIf you did not request a password reset, you can ignore this email.\n"
+
+	sendMail(userEmail(user), "Reset your password", body)
+}
+
+// checkPasswordResetCode checks a password reset code of the user. The code is invalidated after too many wrong codes.
+func checkPasswordResetCode(user *IdpUser, code string) error {
+	code = strings.TrimSpace(code)
+	if user.ResetCode == "" {
+		return ErrInvalidResetCode
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(user.ResetCode)) != 1 {
+		user.ResetCodeFailed++
+		if user.ResetCodeFailed >= AppConfig.LoginApi.MaxChallengeAttempts {
+			user.ResetCode = ""
+			user.ResetCodeExpires = nil
+			user.ResetCodeFailed = 0
+		}
+		return ErrInvalidResetCode
+	}
+	if user.ResetCodeExpires != nil && time.Now().After(*user.ResetCodeExpires) {
+		return ErrExpiredResetCode
+	}
+	return nil
+}
+
+// resetUserPassword sets the new password of a user who reset it with a valid code. The code can only be used once,
+// and the user's refresh tokens are revoked.
+func resetUserPassword(user *IdpUser, password string) error {
+	if err := setUserPassword(user, password); err != nil {
+		return err
+	}
+
+	user.ResetCode = ""
+	user.ResetCodeExpires = nil
+	user.ResetCodeFailed = 0
+	resetFailedLogins(user)
+	revokeRefreshTokens(user.Id)
+	return nil
+}
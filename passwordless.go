@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Challenges of passwordless logins, answered with the code sent to the user or by opening the magic link
+const (
+	ChallengeNameEmailOtp = "EMAIL_OTP"
+	ChallengeNameSmsOtp   = "SMS_OTP"
+)
+
+// Channels a passwordless code is delivered through
+const (
+	PasswordlessDeliveryEmail = "email"
+	PasswordlessDeliverySms   = "sms"
+)
+
+// Authentication methods reported in the amr claim of identity tokens for logins confirmed with a code sent by email or
+// SMS, which are distinct from the otp of TOTP codes
+const (
+	AmrEmail = "email"
+	AmrSms   = "sms"
+)
+
+var (
+	ErrInvalidPasswordlessCode     = errors.New("Invalid code")
+	ErrExpiredPasswordlessCode     = errors.New("Code has expired")
+	ErrMagicLinkNotOpened          = errors.New("The magic link has not been opened yet")
+	ErrInvalidPasswordlessDelivery = errors.New("Delivery must be 'email' or 'sms'")
+	ErrNoPasswordlessDestination   = errors.New("User has no email address or phone number to send a code to")
+)
+
+// isPasswordlessChallenge reports whether the challenge is answered with a code sent to the user
+func isPasswordlessChallenge(challengeName string) bool {
+	return challengeName == ChallengeNameEmailOtp || challengeName == ChallengeNameSmsOtp
+}
+
+// passwordlessAmr returns the authentication method of a passwordless login
+func passwordlessAmr(challengeName string) []string {
+	if challengeName == ChallengeNameSmsOtp {
+		return []string{AmrSms}
+	}
+	return []string{AmrEmail}
+}
+
+// findUserByLoginName returns the user with the given username, or else the user with the given email address
+func findUserByLoginName(name string) *IdpUser {
+	if user := FindUserByUsername(name); user != nil {
+		return user
+	}
+	if name == "" {
+		return nil
+	}
+	for i, u := range AppContext.Users {
+		if strings.EqualFold(userEmail(&u), name) {
+			return &AppContext.Users[i]
+		}
+	}
+	return nil
+}
+
+// passwordlessChallengeName returns the challenge of a passwordless login delivered through the requested channel.
+// Without one, the code is emailed to users that have an email address and sent by SMS to the others.
+func passwordlessChallengeName(user *IdpUser, delivery string) (string, error) {
+	switch delivery {
+	case PasswordlessDeliveryEmail:
+		if userEmail(user) == "" {
+			return "", errors.New("User has no email address")
+		}
+		return ChallengeNameEmailOtp, nil
+	case PasswordlessDeliverySms:
+		if userPhoneNumber(user) == "" {
+			return "", errors.New("User has no phone number")
+		}
+		return ChallengeNameSmsOtp, nil
+	case "":
+		if userEmail(user) != "" {
+			return ChallengeNameEmailOtp, nil
+		}
+		if userPhoneNumber(user) != "" {
+			return ChallengeNameSmsOtp, nil
+		}
+		return "", ErrNoPasswordlessDestination
+	default:
+		return "", ErrInvalidPasswordlessDelivery
+	}
+}
+
+// startPasswordlessLogin generates a code and, if enabled, a magic link for the user and sends them by email or SMS
+func startPasswordlessLogin(user *IdpUser, challengeName string) *PasswordlessSession {
+	session := &PasswordlessSession{
+		Code:      generateConfirmationCode(),
+		ExpiresAt: time.Now().Add(time.Duration(AppConfig.Passwordless.CodeExpirationSeconds) * time.Second),
+	}
+
+	link := ""
+	if *AppConfig.Passwordless.MagicLink {
+		session.LinkToken = generateRandomToken()
+		link = fmt.Sprintf("%s/passwordless/callback?token=%s", AppConfig.BaseUrl, session.LinkToken)
+	}
+
+	if challengeName == ChallengeNameSmsOtp {
+		session.Destination = maskPhoneNumber(userPhoneNumber(user))
+		body := fmt.Sprintf("Your sign-in code is %s", session.Code)
+		if link != "" {
+			body += fmt.Sprintf(" or open %s", link)
+		}
+		sendSms(userPhoneNumber(user), body)
+		return session
+	}
+
+	session.Destination = maskEmail(userEmail(user))
+	body := fmt.Sprintf("Hello %s,\n\nYour sign-in code is %s\n", user.Username, session.Code)
+	if link != "" {
+		body += fmt.Sprintf("\nYou can also sign in by opening this link:\n%s\n", link)
+	}
+	sendMail(userEmail(user), "Your sign-in code", body)
+	return session
+}
+
+// checkPasswordlessCode checks the code of a passwordless login, which is not needed once the magic link was opened
+func checkPasswordlessCode(session *PasswordlessSession, code string) error {
+	if session == nil {
+		return ErrInvalidPasswordlessCode
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return ErrExpiredPasswordlessCode
+	}
+	if session.Confirmed {
+		return nil
+	}
+	code = strings.TrimSpace(code)
+	if code == "" && session.LinkToken != "" {
+		return ErrMagicLinkNotOpened
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(session.Code)) != 1 {
+		return ErrInvalidPasswordlessCode
+	}
+	return nil
+}
+
+// findPasswordlessLogin returns the key of the pending login the magic link with the given token was sent for
+func findPasswordlessLogin(token string) (string, PendingLogin, bool) {
+	if token == "" {
+		return "", PendingLogin{}, false
+	}
+	for key, pendingLogin := range AppContext.PendingLogins {
+		if pendingLogin.Passwordless != nil && subtle.ConstantTimeCompare([]byte(pendingLogin.Passwordless.LinkToken), []byte(token)) == 1 {
+			return key, pendingLogin, true
+		}
+	}
+	return "", PendingLogin{}, false
+}
+
+// pendingLoginExpired reports whether the pending login can no longer be completed. Passwordless logins expire with
+// their code.
+func pendingLoginExpired(pendingLogin PendingLogin) bool {
+	if pendingLogin.Passwordless != nil {
+		return time.Now().After(pendingLogin.Passwordless.ExpiresAt)
+	}
+	return time.Since(pendingLogin.CreatedAt) > ChallengeExpiry
+}
+
+// storePendingLogin keeps a new pending login under the key, forgetting the ones that expired. Pending logins that are
+// never completed, like the passkey challenge of every rendered login form, would otherwise pile up.
+func storePendingLogin(key string, pendingLogin PendingLogin) {
+	for storedKey, stored := range AppContext.PendingLogins {
+		if pendingLoginExpired(stored) {
+			delete(AppContext.PendingLogins, storedKey)
+		}
+	}
+	AppContext.PendingLogins[key] = pendingLogin
+}
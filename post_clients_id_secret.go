@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type RotateClientSecretResponse struct {
+	ClientId string `json:"client_id"`
+	Secret   string `json:"secret"`
+}
+
+// POST_clients_id_secret replaces the client's secret, the previous one stops working immediately
+func POST_clients_id_secret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientId := vars["id"]
+
+	_, existingClient := FindClientIndexById(clientId)
+	if existingClient == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Client not found"})
+		return
+	}
+
+	// Clients registered for an authentication method without a secret do not get one
+	switch existingClient.TokenEndpointAuthMethod {
+	case ClientAuthMethodNone, ClientAuthMethodPrivateKeyJwt:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The client does not authenticate with a secret"})
+		return
+	}
+
+	existingClient.Secret = generateRandomToken()
+
+	writeJSONNoStore(w, http.StatusOK, RotateClientSecretResponse{ClientId: existingClient.Id, Secret: existingClient.Secret})
+}
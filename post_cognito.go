@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const CognitoTargetPrefix = "AWSCognitoIdentityProviderService."
+
+// Cognito error types returned in the "__type" field
+const (
+	CognitoInvalidParameter       = "InvalidParameterException"
+	CognitoNotAuthorized          = "NotAuthorizedException"
+	CognitoUserNotFound           = "UserNotFoundException"
+	CognitoUsernameExists         = "UsernameExistsException"
+	CognitoResourceNotFound       = "ResourceNotFoundException"
+	CognitoCodeMismatch           = "CodeMismatchException"
+	CognitoInvalidPassword        = "InvalidPasswordException"
+	CognitoExpiredCode            = "ExpiredCodeException"
+	CognitoUserNotConfirmed       = "UserNotConfirmedException"
+	CognitoUnsupportedUserState   = "UnsupportedUserStateException"
+	CognitoUserLambdaValidation   = "UserLambdaValidationException"
+	CognitoEnableSoftwareTokenMfa = "EnableSoftwareTokenMFAException"
+	CognitoUnknownOperation       = "UnknownOperationException"
+	CognitoInternalError          = "InternalErrorException"
+	CognitoSerializationException = "SerializationException"
+)
+
+type cognitoAction func(w http.ResponseWriter, r *http.Request, body []byte)
+
+var cognitoActions = map[string]cognitoAction{
+	"InitiateAuth":           cognitoInitiateAuth,
+	"RespondToAuthChallenge": cognitoRespondToAuthChallenge,
+	"GetUser":                cognitoGetUser,
+	"GlobalSignOut":          cognitoGlobalSignOut,
+	"SignUp":                 cognitoSignUp,
+	"ConfirmSignUp":          cognitoConfirmSignUp,
+	"ResendConfirmationCode": cognitoResendConfirmationCode,
+	"ForgotPassword":         cognitoForgotPassword,
+	"ConfirmForgotPassword":  cognitoConfirmForgotPassword,
+	"AssociateSoftwareToken": cognitoAssociateSoftwareToken,
+	"VerifySoftwareToken":    cognitoVerifySoftwareToken,
+
+	"AdminCreateUser":           cognitoAdminCreateUser,
+	"AdminDeleteUser":           cognitoAdminDeleteUser,
+	"AdminGetUser":              cognitoAdminGetUser,
+	"AdminUpdateUserAttributes": cognitoAdminUpdateUserAttributes,
+	"AdminDeleteUserAttributes": cognitoAdminDeleteUserAttributes,
+	"AdminDisableUser":          cognitoAdminDisableUser,
+	"AdminEnableUser":           cognitoAdminEnableUser,
+	"AdminSetUserPassword":      cognitoAdminSetUserPassword,
+	"ListUsers":                 cognitoListUsers,
+	"AdminAddUserToGroup":       cognitoAdminAddUserToGroup,
+	"AdminRemoveUserFromGroup":  cognitoAdminRemoveUserFromGroup,
+	"AdminListGroupsForUser":    cognitoAdminListGroupsForUser,
+}
+
+// writeCognitoError writes an error in the format of the Cognito Identity Provider JSON protocol
+func writeCognitoError(w http.ResponseWriter, status int, errorType string, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", errorType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  errorType,
+		"message": message,
+	})
+}
+
+// writeCognitoJSON writes a successful Cognito Identity Provider JSON protocol response
+func writeCognitoJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// decodeCognitoRequest decodes the request body of an action, writing an error response on failure
+func decodeCognitoRequest(w http.ResponseWriter, body []byte, req interface{}) bool {
+	if err := json.Unmarshal(body, req); err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoSerializationException, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+func POST_cognito(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	if !strings.HasPrefix(target, CognitoTargetPrefix) {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUnknownOperation, "Missing or unsupported X-Amz-Target header")
+		return
+	}
+
+	action, exists := cognitoActions[strings.TrimPrefix(target, CognitoTargetPrefix)]
+	if !exists {
+		writeCognitoError(w, http.StatusBadRequest, CognitoUnknownOperation, "Unsupported operation: "+target)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeCognitoError(w, http.StatusBadRequest, CognitoSerializationException, "Invalid request body")
+		return
+	}
+
+	action(w, r, body)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 )
@@ -21,12 +22,35 @@ func POST_login_complete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if challenge is expired
-	if time.Since(pendingLogin.CreatedAt) > ChallengeExpiry {
+	if pendingLoginExpired(pendingLogin) {
 		delete(AppContext.PendingLogins, req.ChallengeId)
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Challenge expired"})
 		return
 	}
 
+	// Passkey logins identify the user by the credential, limiting the number of attempts per challenge
+	userVerified := false
+	if pendingLogin.ChallengeName == ChallengeNameWebauthn {
+		user, amr, verified, err := verifyWebauthnLogin(pendingLogin.Webauthn, pendingLogin.UserId, req.Credential)
+		if err == nil {
+			err = checkLoginAllowed(user)
+		}
+		if err != nil {
+			pendingLogin.FailedAttempts++
+			if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+				delete(AppContext.PendingLogins, req.ChallengeId)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Too many failed attempts"})
+				return
+			}
+			AppContext.PendingLogins[req.ChallengeId] = pendingLogin
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+		pendingLogin.UserId = user.Id
+		pendingLogin.Amr = amr
+		userVerified = verified
+	}
+
 	// Find user
 	var foundUser *IdpUser
 	for i, user := range AppContext.Users {
@@ -55,14 +79,81 @@ func POST_login_complete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The challenge data of a forced password change is the new password, and that of MFA setup a code generated from
+	// the new TOTP secret
+	if pendingLogin.ChallengeName == ChallengeNameNewPassword {
+		if err := validateNewPassword(foundUser, req.ChallengeData); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := setUserPassword(foundUser, req.ChallengeData); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Continue with the user's challenge, if they have one
+		if continueLoginChallenge(w, req.ChallengeId, pendingLogin, foundUser, foundClient) {
+			return
+		}
+	} else if isPasswordlessChallenge(pendingLogin.ChallengeName) {
+		// The challenge data of a passwordless login is the code sent to the user, or empty once the magic link was
+		// opened. Waiting for the link does not count as a failed attempt.
+		if err := checkPasswordlessCode(pendingLogin.Passwordless, req.ChallengeData); err != nil {
+			if errors.Is(err, ErrInvalidPasswordlessCode) {
+				pendingLogin.FailedAttempts++
+				if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+					delete(AppContext.PendingLogins, req.ChallengeId)
+					writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Too many failed attempts"})
+					return
+				}
+				AppContext.PendingLogins[req.ChallengeId] = pendingLogin
+			}
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Users with MFA continue with their TOTP challenge
+		pendingLogin.Passwordless = nil
+		if challenge, _ := loginChallengeName(foundUser, foundClient); isMfaChallenge(challenge) && continueLoginChallenge(w, req.ChallengeId, pendingLogin, foundUser, foundClient) {
+			return
+		}
+	} else if pendingLogin.ChallengeName == ChallengeNameWebauthn {
+		// Let the pre authentication hook deny the login, now that the user is known
+		if err := runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceLoginApi, foundUser, foundClient)); err != nil {
+			delete(AppContext.PendingLogins, req.ChallengeId)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Passkeys that did not verify the user are a single factor, users that require MFA continue with TOTP
+		if mfaRequired(foundUser, foundClient) && !userVerified {
+			pendingLogin.Webauthn = nil
+			if continueLoginChallenge(w, req.ChallengeId, pendingLogin, foundUser, foundClient) {
+				return
+			}
+		}
+	} else if !validateLoginChallenge(foundUser, pendingLogin.ChallengeName, req.ChallengeData) {
+		// Validate challenge response, limiting the number of attempts per challenge
+		pendingLogin.FailedAttempts++
+		if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+			delete(AppContext.PendingLogins, req.ChallengeId)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Too many failed attempts"})
+			return
+		}
+		AppContext.PendingLogins[req.ChallengeId] = pendingLogin
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid challenge response"})
+		return
+	}
+
 	// Generate tokens
-	accessToken, err := generateAccessToken(foundUser, foundClient, pendingLogin.Scopes)
+	accessToken, err := generateAccessToken(r, foundUser, foundClient, pendingLogin.Scopes)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate access token"})
 		return
 	}
 
-	identityToken, err := generateIdentityToken(foundUser, foundClient, "")
+	amr := completedAuthenticationMethods(pendingLogin.Amr, pendingLogin.ChallengeName)
+	identityToken, err := generateIdentityToken(r, foundUser, foundClient, pendingLogin.Scopes, "", amr)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate identity token"})
 		return
@@ -75,19 +166,41 @@ func POST_login_complete(w http.ResponseWriter, r *http.Request) {
 
 	// Generate refresh token if requested
 	if pendingLogin.IssueRefreshToken {
-		refreshToken := generateRandomToken()
-		refreshExpirationDuration := time.Duration(AppConfig.RefreshTokenExpirationSeconds) * time.Second
-		AppContext.RefreshTokens[refreshToken] = IssuedRefreshToken{
-			UserId:    foundUser.Id,
-			ClientId:  foundClient.Id,
-			Scopes:    pendingLogin.Scopes,
-			ExpiresAt: time.Now().Add(refreshExpirationDuration),
-		}
-		response.RefreshToken = refreshToken
+		response.RefreshToken = issueRefreshToken(foundUser, foundClient, pendingLogin.Scopes, amr)
 	}
 
 	// Clean up pending login
 	delete(AppContext.PendingLogins, req.ChallengeId)
 
+	runPostHook(AppConfig.Hooks.PostAuthentication, newLifecycleHookEvent(HookPostAuthentication, HookSourceLoginApi, foundUser, foundClient))
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// continueLoginChallenge moves the pending login on to the challenge the user answers after their first factor,
+// reporting whether they have one
+func continueLoginChallenge(w http.ResponseWriter, challengeId string, pendingLogin PendingLogin, foundUser *IdpUser, foundClient *IdpClient) bool {
+	nextChallenge, ok := loginChallengeName(foundUser, foundClient)
+	if !ok {
+		return false
+	}
+
+	response := IdpInitLoginResponse{
+		ChallengeId:   challengeId,
+		ChallengeType: nextChallenge,
+	}
+	if nextChallenge == ChallengeNameMfaSetup {
+		enrollment, err := startTotpEnrollment(foundUser)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return true
+		}
+		response.TotpSetup = &enrollment
+	}
+
+	pendingLogin.ChallengeName = nextChallenge
+	pendingLogin.CreatedAt = time.Now()
+	AppContext.PendingLogins[challengeId] = pendingLogin
 	writeJSON(w, http.StatusOK, response)
+	return true
 }
@@ -40,46 +40,127 @@ func POST_login_init(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find user
-	var foundUser *IdpUser
-	for i, user := range AppContext.Users {
-		if user.Username == req.Username && user.Password == req.Password {
-			foundUser = &AppContext.Users[i]
-			break
-		}
+	// Determine scopes to use
+	scopes := req.Scopes
+	if scopes == "" {
+		// Use default scopes from the client, falling back to config
+		scopes = clientDefaultScopes(foundClient, AppConfig.LoginApi.DefaultScopes)
+	}
+
+	// Logins without a password are answered with a code sent to the user
+	if req.Password == "" && *AppConfig.Passwordless.Enabled {
+		initPasswordlessLogin(w, req, foundClient, scopes)
+		return
 	}
 
+	// Find user
+	foundUser := FindUserByUsername(req.Username)
 	if foundUser == nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 		return
 	}
 
+	if err := checkUserLogin(foundUser, req.Password); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+
 	if foundUser.Disabled {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "User is disabled"})
 		return
 	}
 
-	// Determine scopes to use
-	scopes := req.Scopes
-	if scopes == "" {
-		// Use default scopes from config
-		scopes = AppConfig.LoginApi.DefaultScopes
+	if foundUser.Unconfirmed {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": ErrUserNotConfirmed.Error()})
+		return
+	}
+
+	// Let the pre authentication hook deny the login
+	if err := runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceLoginApi, foundUser, foundClient)); err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Users that have to change their password do so before answering their challenge
+	challengeType, _ := loginChallengeName(foundUser, foundClient)
+	if passwordChangeRequired(foundUser) {
+		challengeType = ChallengeNameNewPassword
+	}
+
+	// Users that have to set up MFA receive a new TOTP secret
+	var totpSetup *TotpEnrollment
+	if challengeType == ChallengeNameMfaSetup {
+		enrollment, err := startTotpEnrollment(foundUser)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		totpSetup = &enrollment
 	}
 
 	// Generate challenge ID
 	challengeId := uuid.NewString()
 
 	// Store pending login
-	AppContext.PendingLogins[challengeId] = PendingLogin{
+	storePendingLogin(challengeId, PendingLogin{
 		UserId:            foundUser.Id,
 		ClientId:          foundClient.Id,
 		IssueRefreshToken: req.IssueRefreshToken,
 		Scopes:            scopes,
 		CreatedAt:         time.Now(),
-	}
+		ChallengeName:     challengeType,
+		Amr:               []string{AmrPassword},
+	})
 
 	// Return challenge ID
 	writeJSON(w, http.StatusOK, IdpInitLoginResponse{
-		ChallengeId: challengeId,
+		ChallengeId:   challengeId,
+		ChallengeType: challengeType,
+		TotpSetup:     totpSetup,
+	})
+}
+
+// initPasswordlessLogin sends a code to the user identified by their username or email address
+func initPasswordlessLogin(w http.ResponseWriter, req IdpInitLoginRequest, foundClient *IdpClient, scopes string) {
+	foundUser := findUserByLoginName(req.Username)
+	if foundUser == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := checkLoginAllowed(foundUser); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+
+	challengeType, err := passwordlessChallengeName(foundUser, req.Delivery)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Let the pre authentication hook deny the login
+	if err := runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceLoginApi, foundUser, foundClient)); err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	session := startPasswordlessLogin(foundUser, challengeType)
+	challengeId := uuid.NewString()
+	storePendingLogin(challengeId, PendingLogin{
+		UserId:            foundUser.Id,
+		ClientId:          foundClient.Id,
+		IssueRefreshToken: req.IssueRefreshToken,
+		Scopes:            scopes,
+		CreatedAt:         time.Now(),
+		ChallengeName:     challengeType,
+		Passwordless:      session,
+		Amr:               passwordlessAmr(challengeType),
+	})
+
+	writeJSON(w, http.StatusOK, IdpInitLoginResponse{
+		ChallengeId:             challengeId,
+		ChallengeType:           challengeType,
+		CodeDeliveryDestination: session.Destination,
 	})
 }
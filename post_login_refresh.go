@@ -56,27 +56,20 @@ func POST_login_refresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate new tokens
-	accessToken, err := generateAccessToken(foundUser, foundClient, refreshToken.Scopes)
+	accessToken, err := generateAccessToken(r, foundUser, foundClient, refreshToken.Scopes)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate access token"})
 		return
 	}
 
-	identityToken, err := generateIdentityToken(foundUser, foundClient, "")
+	identityToken, err := generateIdentityToken(r, foundUser, foundClient, refreshToken.Scopes, "", refreshToken.Amr)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate identity token"})
 		return
 	}
 
 	// Generate new refresh token
-	newRefreshToken := generateRandomToken()
-	refreshExpirationDuration := time.Duration(AppConfig.RefreshTokenExpirationSeconds) * time.Second
-	AppContext.RefreshTokens[newRefreshToken] = IssuedRefreshToken{
-		UserId:    foundUser.Id,
-		ClientId:  foundClient.Id,
-		Scopes:    refreshToken.Scopes,
-		ExpiresAt: time.Now().Add(refreshExpirationDuration),
-	}
+	newRefreshToken := issueRefreshToken(foundUser, foundClient, refreshToken.Scopes, refreshToken.Amr)
 
 	// Remove old refresh token
 	delete(AppContext.RefreshTokens, req.RefreshToken)
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// POST_login_webauthn_init starts a passkey login, returning the options to pass to navigator.credentials.get(). The
+// credential is sent to /login/complete. Without a username, any passkey of the relying party is accepted.
+func POST_login_webauthn_init(w http.ResponseWriter, r *http.Request) {
+	var req IdpInitWebauthnLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	// Get client ID from query parameter or request body
+	clientId := r.URL.Query().Get("client_id")
+	if clientId == "" {
+		clientId = req.ClientId
+	}
+
+	if clientId == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Client ID is required"})
+		return
+	}
+
+	// Validate client ID
+	var foundClient *IdpClient
+	for i, client := range AppContext.Clients {
+		if client.Id == clientId {
+			foundClient = &AppContext.Clients[i]
+			break
+		}
+	}
+
+	if foundClient == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid client ID"})
+		return
+	}
+
+	// Logins of a known user only allow their passkeys
+	var foundUser *IdpUser
+	if req.Username != "" {
+		foundUser = FindUserByUsername(req.Username)
+		if foundUser == nil || len(foundUser.WebauthnCredentials) == 0 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+			return
+		}
+	}
+
+	session, options, err := newWebauthnLogin(foundUser)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Determine scopes to use
+	scopes := req.Scopes
+	if scopes == "" {
+		scopes = clientDefaultScopes(foundClient, AppConfig.LoginApi.DefaultScopes)
+	}
+
+	pendingLogin := PendingLogin{
+		ClientId:          foundClient.Id,
+		IssueRefreshToken: req.IssueRefreshToken,
+		Scopes:            scopes,
+		CreatedAt:         time.Now(),
+		ChallengeName:     ChallengeNameWebauthn,
+		Webauthn:          session,
+	}
+	if foundUser != nil {
+		pendingLogin.UserId = foundUser.Id
+	}
+
+	challengeId := uuid.NewString()
+	storePendingLogin(challengeId, pendingLogin)
+
+	writeJSON(w, http.StatusOK, IdpInitLoginResponse{
+		ChallengeId:     challengeId,
+		ChallengeType:   ChallengeNameWebauthn,
+		WebauthnOptions: options,
+	})
+}
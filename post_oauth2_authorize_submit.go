@@ -1,122 +1,334 @@
 package main
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 func POST_oauth2_authorize_submit(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		renderInvalidFormPage(w)
 		return
 	}
 
 	// Get form data
 	username := r.Form.Get("username")
 	password := r.Form.Get("password")
-	clientID := r.Form.Get("client_id")
-	redirectURI := r.Form.Get("redirect_uri")
-	scope := r.Form.Get("scope")
-	state := r.Form.Get("state")
-	nonce := r.Form.Get("nonce")
 	challenge := r.Form.Get("challenge")
 
+	// The steps after the password carry the pending login's session
+	if session := r.Form.Get("session"); session != "" {
+		if r.Form.Has("webauthn_response") {
+			submitPasskey(w, r, session)
+		} else if r.Form.Has("mfa_code") {
+			submitMfaCode(w, r, session)
+		} else {
+			submitNewPassword(w, r, session)
+		}
+		return
+	}
+
+	// The form refers to the authorization request validated by the authorization endpoint
+	request, exists := findAuthorizationRequest(r.Form.Get("authorization_request"))
+	if !exists {
+		renderExpiredAuthorizationRequestPage(w)
+		return
+	}
+
 	// Validate challenge if required
 	if *AppConfig.OAuth2.RequireChallengeOnLogin && challenge == "" {
 		// Re-render form with error
-		tmpl, err := template.New("login").Parse(loginFormTemplate)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		data := loginFormData{
+		renderLoginForm(w, loginFormData{
 			Error:         "Challenge is required",
-			ClientID:      clientID,
-			RedirectURI:   redirectURI,
-			Scope:         scope,
-			State:         state,
-			Nonce:         nonce,
+			Request:       request,
 			ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
-		}
-
-		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, data); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		})
 		return
 	}
 
 	// Validate client_id and redirect_uri
-	var foundClient *IdpClient
-	for i, client := range AppContext.Clients {
-		if client.Id == clientID && client.RedirectUri == redirectURI {
-			foundClient = &AppContext.Clients[i]
-			break
-		}
-	}
-
+	foundClient := FindClientByRedirectUri(request.ClientId, request.RedirectUri)
 	if foundClient == nil {
-		http.Error(w, "Invalid client_id or redirect_uri", http.StatusBadRequest)
+		renderInvalidClientPage(w)
 		return
 	}
 
 	// Find and validate user
-	var foundUser *IdpUser
-	for i, user := range AppContext.Users {
-		if user.Username == username && user.Password == password {
-			foundUser = &AppContext.Users[i]
-			break
+	loginError := "Invalid username or password"
+	foundUser := FindUserByUsername(username)
+	if foundUser != nil {
+		if err := checkUserLogin(foundUser, password); err != nil {
+			if errors.Is(err, ErrUserLocked) {
+				loginError = "Account is temporarily locked, please try again later"
+			}
+			foundUser = nil
+		} else if foundUser.Unconfirmed {
+			loginError = "Please confirm your account before logging in"
+			foundUser = nil
 		}
 	}
 
 	if foundUser == nil || foundUser.Disabled {
 		// Re-render form with error
-		tmpl, err := template.New("login").Parse(loginFormTemplate)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+		renderLoginForm(w, loginFormData{
+			Error:         loginError,
+			Request:       request,
+			ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+		})
+		return
+	}
 
-		data := loginFormData{
-			Error:         "Invalid username or password",
-			ClientID:      clientID,
-			RedirectURI:   redirectURI,
-			Scope:         scope,
-			State:         state,
-			Nonce:         nonce,
+	// Let the pre authentication hook deny the login
+	if err := runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceOAuth2, foundUser, foundClient)); err != nil {
+		renderLoginForm(w, loginFormData{
+			Error:         err.Error(),
+			Request:       request,
 			ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+		})
+		return
+	}
+
+	// Users that have to change their password choose a new one before the code is issued
+	if passwordChangeRequired(foundUser) {
+		session := generateRandomToken()
+		storePendingLogin(session, PendingLogin{
+			UserId:               foundUser.Id,
+			ClientId:             request.ClientId,
+			Scopes:               request.Scope,
+			CreatedAt:            time.Now(),
+			ChallengeName:        ChallengeNameNewPassword,
+			AuthorizationRequest: request.Id,
+		})
+		renderLoginForm(w, loginFormData{
+			Request:  request,
+			Session:  session,
+			Username: foundUser.Username,
+		})
+		return
+	}
+
+	continueOAuth2Login(w, r, foundUser, foundClient, request, []string{AmrPassword})
+}
+
+// findLoginSession returns the pending login of a step of the login form along with its authorization request and
+// client, reporting whether the login can continue
+func findLoginSession(session string, valid func(PendingLogin) bool) (PendingLogin, AuthorizationRequest, *IdpClient, bool) {
+	pendingLogin, exists := AppContext.PendingLogins[session]
+	if !exists || !valid(pendingLogin) {
+		return pendingLogin, AuthorizationRequest{}, nil, false
+	}
+	request, exists := findAuthorizationRequest(pendingLogin.AuthorizationRequest)
+	if !exists {
+		return pendingLogin, request, nil, false
+	}
+	return pendingLogin, request, FindClientByRedirectUri(request.ClientId, request.RedirectUri), true
+}
+
+// submitNewPassword handles the new password step of the login form and issues the authorization code
+func submitNewPassword(w http.ResponseWriter, r *http.Request, session string) {
+	newPassword := r.Form.Get("new_password")
+
+	pendingLogin, request, foundClient, ok := findLoginSession(session, func(pendingLogin PendingLogin) bool {
+		return pendingLogin.ChallengeName == ChallengeNameNewPassword && time.Since(pendingLogin.CreatedAt) <= ChallengeExpiry
+	})
+	if !ok {
+		delete(AppContext.PendingLogins, session)
+		renderLoginSessionExpired(w, r, "Your session has expired, please log in again")
+		return
+	}
+
+	// Validate client_id and redirect_uri
+	_, foundUser := FindUserIndexById(pendingLogin.UserId)
+	if foundClient == nil || foundUser == nil {
+		renderInvalidClientPage(w)
+		return
+	}
+
+	// Re-render the new password step with an error
+	passwordError := ""
+	if newPassword != r.Form.Get("confirm_password") {
+		passwordError = "Passwords do not match"
+	} else if err := validateNewPassword(foundUser, newPassword); err != nil {
+		passwordError = err.Error()
+	}
+	if passwordError != "" {
+		renderLoginForm(w, loginFormData{
+			Error:    passwordError,
+			Request:  request,
+			Session:  session,
+			Username: foundUser.Username,
+		})
+		return
+	}
+
+	delete(AppContext.PendingLogins, session)
+	if err := setUserPassword(foundUser, newPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	continueOAuth2Login(w, r, foundUser, foundClient, request, []string{AmrPassword})
+}
+
+// continueOAuth2Login continues a login after the user's password or passwordless code was verified, asking for a TOTP
+// code if the user has TOTP enabled or has to set it up, or issuing the authorization code
+func continueOAuth2Login(w http.ResponseWriter, r *http.Request, foundUser *IdpUser, foundClient *IdpClient, request AuthorizationRequest, amr []string) {
+	challenge, _ := loginChallengeName(foundUser, foundClient)
+	if !isMfaChallenge(challenge) {
+		finishOAuth2Login(w, r, foundUser, foundClient, request, amr)
+		return
+	}
+
+	if challenge == ChallengeNameMfaSetup {
+		if _, err := startTotpEnrollment(foundUser); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+	}
 
-		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, data); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	session := generateRandomToken()
+	storePendingLogin(session, PendingLogin{
+		UserId:               foundUser.Id,
+		ClientId:             foundClient.Id,
+		Scopes:               request.Scope,
+		CreatedAt:            time.Now(),
+		ChallengeName:        challenge,
+		Amr:                  amr,
+		AuthorizationRequest: request.Id,
+	})
+	renderMfaForm(w, loginFormData{
+		Request:  request,
+		Session:  session,
+		Username: foundUser.Username,
+	}, foundUser, challenge)
+}
+
+// submitMfaCode handles the TOTP step of the login form and issues the authorization code
+func submitMfaCode(w http.ResponseWriter, r *http.Request, session string) {
+	pendingLogin, request, foundClient, ok := findLoginSession(session, func(pendingLogin PendingLogin) bool {
+		return isMfaChallenge(pendingLogin.ChallengeName) && time.Since(pendingLogin.CreatedAt) <= ChallengeExpiry
+	})
+	if !ok {
+		delete(AppContext.PendingLogins, session)
+		renderLoginSessionExpired(w, r, "Your session has expired, please log in again")
+		return
+	}
+
+	// Validate client_id and redirect_uri
+	_, foundUser := FindUserIndexById(pendingLogin.UserId)
+	if foundClient == nil || foundUser == nil {
+		renderInvalidClientPage(w)
+		return
+	}
+
+	// Limit the number of attempts per login
+	if !validateLoginChallenge(foundUser, pendingLogin.ChallengeName, r.Form.Get("mfa_code")) {
+		pendingLogin.FailedAttempts++
+		if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+			delete(AppContext.PendingLogins, session)
+			renderLoginForm(w, loginFormData{
+				Error:         "Too many failed attempts, please log in again",
+				Request:       request,
+				ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+			})
+			return
 		}
+		AppContext.PendingLogins[session] = pendingLogin
+		renderMfaForm(w, loginFormData{
+			Error:    "Invalid code",
+			Request:  request,
+			Session:  session,
+			Username: foundUser.Username,
+		}, foundUser, pendingLogin.ChallengeName)
+		return
+	}
+
+	delete(AppContext.PendingLogins, session)
+	finishOAuth2Login(w, r, foundUser, foundClient, request, completedAuthenticationMethods(pendingLogin.Amr, pendingLogin.ChallengeName))
+}
+
+// submitPasskey handles a passkey login from the login form and issues the authorization code. Passkey logins are only
+// asked for a TOTP code if MFA is required and the passkey did not verify the user.
+func submitPasskey(w http.ResponseWriter, r *http.Request, session string) {
+	// Each passkey challenge can only be answered once, the login form is rendered with a new one
+	pendingLogin, request, foundClient, ok := findLoginSession(session, func(pendingLogin PendingLogin) bool {
+		return pendingLogin.ChallengeName == ChallengeNameWebauthn && time.Since(pendingLogin.CreatedAt) <= ChallengeExpiry
+	})
+	delete(AppContext.PendingLogins, session)
+	if !ok {
+		renderLoginSessionExpired(w, r, "Your session has expired, please log in again")
 		return
 	}
 
-	// Generate authorization code
-	code := uuid.NewString()
+	// Validate client_id and redirect_uri
+	if foundClient == nil {
+		renderInvalidClientPage(w)
+		return
+	}
 
-	// Store pending authorization
-	AppContext.OauthPendingAuthCodes[code] = OauthPendingAuthorization{
-		Code:        code,
-		UserId:      foundUser.Id,
-		ClientId:    clientID,
-		RedirectUri: redirectURI,
-		Nonce:       nonce,
-		Scopes:      scope,
-		ExpiresAt:   time.Now().Add(10 * time.Minute), // 10 minute expiry
+	foundUser, amr, userVerified, err := verifyWebauthnLogin(pendingLogin.Webauthn, "", []byte(r.Form.Get("webauthn_response")))
+	if err == nil {
+		err = checkLoginAllowed(foundUser)
+	}
+	if err == nil {
+		// Let the pre authentication hook deny the login
+		err = runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceOAuth2, foundUser, foundClient))
+	}
+	if err != nil {
+		renderLoginForm(w, loginFormData{
+			Error:         err.Error(),
+			Request:       request,
+			ShowChallenge: *AppConfig.OAuth2.RequireChallengeOnLogin,
+		})
+		return
 	}
 
-	// Redirect to client with code
-	redirectURL := redirectURI + "?code=" + code
-	if state != "" {
-		redirectURL += "&state=" + state
+	// Passkeys that did not verify the user are a single factor, users that require MFA continue with TOTP
+	if mfaRequired(foundUser, foundClient) && !userVerified {
+		continueOAuth2Login(w, r, foundUser, foundClient, request, amr)
+		return
+	}
+	finishOAuth2Login(w, r, foundUser, foundClient, request, amr)
+}
+
+// renderMfaForm renders the TOTP step of the login form, showing the new secret to users that set up TOTP
+func renderMfaForm(w http.ResponseWriter, data loginFormData, foundUser *IdpUser, challenge string) {
+	data.MfaStep = true
+	if challenge == ChallengeNameMfaSetup {
+		enrollment, err := newTotpEnrollment(foundUser, foundUser.PendingTotpSecret)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.TotpSecret = enrollment.Secret
+		data.TotpQrCode = template.URL(enrollment.QrCode)
+	}
+	renderLoginForm(w, data)
+}
+
+// finishOAuth2Login issues the authorization code once the user is authenticated, asking them to approve the requested
+// scopes first if the client requires consent
+func finishOAuth2Login(w http.ResponseWriter, r *http.Request, foundUser *IdpUser, foundClient *IdpClient, request AuthorizationRequest, amr []string) {
+	if !consentRequired(foundUser, foundClient, request.Scope, request.Prompt) {
+		completeAuthorizationRequest(w, r, foundUser, foundClient, request, request.Scope, amr)
+		return
 	}
 
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	session := generateRandomToken()
+	storePendingLogin(session, PendingLogin{
+		UserId:               foundUser.Id,
+		ClientId:             foundClient.Id,
+		Scopes:               request.Scope,
+		CreatedAt:            time.Now(),
+		ChallengeName:        ChallengeNameConsent,
+		Amr:                  amr,
+		AuthorizationRequest: request.Id,
+	})
+	renderConsentForm(w, consentFormData{
+		Request:  request,
+		Session:  session,
+		Username: foundUser.Username,
+	}, foundUser)
 }
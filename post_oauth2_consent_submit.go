@@ -0,0 +1,142 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const consentFormTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Authorize {{.Request.ClientId}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .form-group { margin-bottom: 15px; }
+        label { display: block; margin-bottom: 5px; }
+        button { padding: 10px 20px; background: #007bff; color: white; border: none; cursor: pointer; }
+        button.secondary { background: #6c757d; }
+    </style>
+</head>
+<body>
+    <h2>Authorize {{.Request.ClientId}}</h2>
+    <p><strong>{{.Request.ClientId}}</strong> is requesting access to the account of {{.Username}}. Choose what to share:</p>
+    <form method="POST" action="/oauth2/consent/submit">
+        <input type="hidden" name="authorization_request" value="{{.Request.Id}}">
+        <input type="hidden" name="session" value="{{.Session}}">
+
+        {{range .Scopes}}
+        <div class="form-group">
+            <label>
+                {{if .Required}}
+                <input type="checkbox" checked disabled>
+                {{else}}
+                <input type="checkbox" name="approved_scope" value="{{.Name}}" checked>
+                {{end}}
+                {{.Description}} (<code>{{.Name}}</code>){{if .Granted}} - previously allowed{{end}}
+            </label>
+        </div>
+        {{end}}
+
+        <button type="submit" name="decision" value="allow">Allow</button>
+        <button type="submit" name="decision" value="deny" class="secondary">Deny</button>
+    </form>
+</body>
+</html>
+`
+
+// scopeDescriptions are shown on the consent page for the standard scopes
+var scopeDescriptions = map[string]string{
+	"openid":         "Sign you in",
+	"profile":        "Your profile information",
+	"email":          "Your email address",
+	"phone":          "Your phone number",
+	"address":        "Your address",
+	"offline_access": "Stay signed in",
+}
+
+type consentScope struct {
+	Name        string
+	Description string
+	Required    bool
+	Granted     bool
+}
+
+type consentFormData struct {
+	Request  AuthorizationRequest
+	Session  string
+	Username string
+	Scopes   []consentScope
+}
+
+func POST_oauth2_consent_submit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderInvalidFormPage(w)
+		return
+	}
+
+	session := r.Form.Get("session")
+
+	pendingLogin, request, foundClient, ok := findLoginSession(session, func(pendingLogin PendingLogin) bool {
+		return pendingLogin.ChallengeName == ChallengeNameConsent && !pendingLoginExpired(pendingLogin)
+	})
+	delete(AppContext.PendingLogins, session)
+	if !ok {
+		renderLoginSessionExpired(w, r, "Your session has expired, please log in again")
+		return
+	}
+
+	// Validate client_id and redirect_uri
+	_, foundUser := FindUserIndexById(pendingLogin.UserId)
+	if foundClient == nil || foundUser == nil {
+		renderInvalidClientPage(w)
+		return
+	}
+
+	if r.Form.Get("decision") != "allow" {
+		delete(AppContext.AuthorizationRequests, request.Id)
+		redirectWithError(w, r, foundClient, request.RedirectUri, request.ResponseType, request.ResponseMode, request.State, OAuth2ErrorAccessDenied, "The user denied the request")
+		return
+	}
+
+	// Only the approved scopes are granted and remembered
+	scope := approvedScopes(pendingLogin.Scopes, r.Form["approved_scope"])
+	if scope == "" && pendingLogin.Scopes != "" {
+		// Approving none of the scopes denies the request, the token endpoint would grant the defaults instead
+		delete(AppContext.AuthorizationRequests, request.Id)
+		redirectWithError(w, r, foundClient, request.RedirectUri, request.ResponseType, request.ResponseMode, request.State, OAuth2ErrorAccessDenied, "The user approved none of the requested scopes")
+		return
+	}
+	rememberConsent(foundUser, foundClient.Id, scope)
+	completeAuthorizationRequest(w, r, foundUser, foundClient, request, scope, pendingLogin.Amr)
+}
+
+// renderConsentForm lists the requested scopes on the consent page, marking the ones the user granted before
+func renderConsentForm(w http.ResponseWriter, data consentFormData, foundUser *IdpUser) {
+	grant := findConsentGrant(foundUser, data.Request.ClientId)
+	for _, name := range strings.Fields(data.Request.Scope) {
+		description, ok := scopeDescriptions[name]
+		if !ok {
+			description = name
+		}
+		data.Scopes = append(data.Scopes, consentScope{
+			Name:        name,
+			Description: description,
+			Required:    name == scopeOpenId,
+			Granted:     grant != nil && slices.Contains(grant.Scopes, name),
+		})
+	}
+
+	tmpl, err := template.New("consent").Parse(consentFormTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
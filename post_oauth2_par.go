@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+)
+
+type PushedAuthorizationResponse struct {
+	RequestUri string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// POST_oauth2_par accepts the parameters of an authorization request from an authenticated client, see RFC 9126
+func POST_oauth2_par(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "Invalid form data")
+		return
+	}
+
+	foundClient, err := authenticateClient(r)
+	if err != nil {
+		writeClientAuthenticationError(w, err)
+		return
+	}
+
+	// Pushed requests are checked like requests to the authorization endpoint, so errors reach the client directly
+	params := r.PostForm
+	if params.Has("request_uri") {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "request_uri cannot be pushed")
+		return
+	}
+	if params.Has("request") {
+		resolved, err := resolveRequestObject(foundClient, params)
+		if err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequestObject, err.Error())
+			return
+		}
+		params = resolved
+	}
+	redirectURI := params.Get("redirect_uri")
+	if FindClientByRedirectUri(foundClient.Id, redirectURI) == nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "Invalid redirect_uri")
+		return
+	}
+	responseType := params.Get("response_type")
+	if responseType == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "response_type is required")
+		return
+	}
+	if errorCode, description := checkResponseType(foundClient, responseType, params.Get("nonce")); errorCode != "" {
+		writeOAuth2Error(w, http.StatusBadRequest, errorCode, description)
+		return
+	}
+	if errorCode, description := checkResponseMode(responseType, params.Get("response_mode")); errorCode != "" {
+		writeOAuth2Error(w, http.StatusBadRequest, errorCode, description)
+		return
+	}
+
+	requestUri := pushAuthorizationRequest(foundClient, params)
+
+	writeJSONNoStore(w, http.StatusCreated, PushedAuthorizationResponse{
+		RequestUri: requestUri,
+		ExpiresIn:  int(PushedAuthorizationExpiry.Seconds()),
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+)
+
+func POST_oauth2_password_forgot_submit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderInvalidFormPage(w)
+		return
+	}
+
+	data := newPasswordResetFormData(r.Form)
+
+	// The reset step of the form submits the code along with the new password
+	if r.Form.Has("code") {
+		data.Username = r.Form.Get("username")
+		data.Code = r.Form.Get("code")
+		resetPasswordForm(w, data, r.Form.Get("new_password"), r.Form.Get("confirm_password"))
+		return
+	}
+
+	username := r.Form.Get("username")
+	foundUser := FindUserByUsername(username)
+	if username == "" {
+		data.Error = "Username is required"
+	} else if foundUser == nil {
+		data.Error = "User not found"
+	} else if err := checkPasswordResetAllowed(foundUser); err != nil {
+		data.Error = err.Error()
+	}
+	if data.Error != "" {
+		renderPasswordResetForm(w, data)
+		return
+	}
+
+	sendPasswordResetCode(foundUser, authorizationRequestParams(data.Request))
+
+	// Continue with the reset step
+	data.Username = foundUser.Username
+	data.Destination = maskEmail(userEmail(foundUser))
+	renderPasswordResetForm(w, data)
+}
+
+// resetPasswordForm sets the new password entered in the reset step of the form, with the code entered there or
+// given in the emailed link
+func resetPasswordForm(w http.ResponseWriter, data passwordResetFormData, password string, confirmPassword string) {
+	foundUser := FindUserByUsername(data.Username)
+	if foundUser == nil {
+		data.Error = ErrInvalidResetCode.Error()
+		renderPasswordResetForm(w, data)
+		return
+	}
+	data.Destination = maskEmail(userEmail(foundUser))
+
+	if err := checkPasswordResetCode(foundUser, data.Code); err != nil {
+		data.Error = err.Error()
+	} else if password == "" {
+		data.Error = "New password is required"
+	} else if password != confirmPassword {
+		data.Error = "Passwords do not match"
+	} else if err := validateNewPassword(foundUser, password); err != nil {
+		data.Error = err.Error()
+	}
+	if data.Error != "" {
+		renderPasswordResetForm(w, data)
+		return
+	}
+
+	if err := resetUserPassword(foundUser, password); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.Done = true
+	renderPasswordResetForm(w, data)
+}
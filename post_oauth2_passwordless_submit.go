@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+func POST_oauth2_passwordless_submit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderInvalidFormPage(w)
+		return
+	}
+
+	data, foundClient, exists := newPasswordlessFormData(r.Form)
+	if !exists {
+		renderExpiredAuthorizationRequestPage(w)
+		return
+	}
+	if foundClient == nil {
+		renderInvalidClientPage(w)
+		return
+	}
+
+	// The code step of the form carries the pending login's session
+	if session := r.Form.Get("session"); session != "" {
+		submitPasswordlessCode(w, r, data, foundClient, session)
+		return
+	}
+
+	data.Username = r.Form.Get("username")
+	foundUser := findUserByLoginName(data.Username)
+	challengeName := ""
+	var err error
+	if data.Username == "" {
+		data.Error = "Username is required"
+	} else if foundUser == nil {
+		data.Error = "User not found"
+	} else if err = checkLoginAllowed(foundUser); err != nil {
+		data.Error = err.Error()
+	} else if challengeName, err = passwordlessChallengeName(foundUser, r.Form.Get("delivery")); err != nil {
+		data.Error = err.Error()
+	} else if err = runPreHook(AppConfig.Hooks.PreAuthentication, newLifecycleHookEvent(HookPreAuthentication, HookSourceOAuth2, foundUser, foundClient)); err != nil {
+		// Let the pre authentication hook deny the login
+		data.Error = err.Error()
+	}
+	if data.Error != "" {
+		renderPasswordlessForm(w, data)
+		return
+	}
+
+	// Keep the authorization request to continue with when the magic link is opened
+	passwordless := startPasswordlessLogin(foundUser, challengeName)
+	data.Session = generateRandomToken()
+	data.Destination = passwordless.Destination
+	storePendingLogin(data.Session, PendingLogin{
+		UserId:               foundUser.Id,
+		ClientId:             foundClient.Id,
+		Scopes:               data.Request.Scope,
+		CreatedAt:            time.Now(),
+		ChallengeName:        challengeName,
+		Passwordless:         passwordless,
+		Amr:                  passwordlessAmr(challengeName),
+		AuthorizationRequest: data.Request.Id,
+	})
+
+	// Continue with the code step
+	renderPasswordlessForm(w, data)
+}
+
+// submitPasswordlessCode handles the code step of the passwordless form, limiting the number of attempts per login
+func submitPasswordlessCode(w http.ResponseWriter, r *http.Request, data passwordlessFormData, foundClient *IdpClient, session string) {
+	pendingLogin, exists := AppContext.PendingLogins[session]
+	if !exists || !isPasswordlessChallenge(pendingLogin.ChallengeName) || pendingLogin.AuthorizationRequest != data.Request.Id || pendingLoginExpired(pendingLogin) {
+		delete(AppContext.PendingLogins, session)
+		data.Error = "Your code has expired, please request a new one"
+		renderPasswordlessForm(w, data)
+		return
+	}
+
+	_, foundUser := FindUserIndexById(pendingLogin.UserId)
+	if foundUser == nil {
+		http.Error(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	if err := checkPasswordlessCode(pendingLogin.Passwordless, r.Form.Get("code")); err != nil {
+		if errors.Is(err, ErrInvalidPasswordlessCode) {
+			pendingLogin.FailedAttempts++
+			if pendingLogin.FailedAttempts >= AppConfig.LoginApi.MaxChallengeAttempts {
+				delete(AppContext.PendingLogins, session)
+				data.Error = "Too many failed attempts, please request a new code"
+				renderPasswordlessForm(w, data)
+				return
+			}
+			AppContext.PendingLogins[session] = pendingLogin
+		}
+		data.Error = err.Error()
+		data.Session = session
+		data.Destination = pendingLogin.Passwordless.Destination
+		renderPasswordlessForm(w, data)
+		return
+	}
+
+	delete(AppContext.PendingLogins, session)
+	continueOAuth2Login(w, r, foundUser, foundClient, data.Request, pendingLogin.Amr)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// POST_oauth2_register registers a client, see RFC 7591
+func POST_oauth2_register(w http.ResponseWriter, r *http.Request) {
+	// Registration is open unless an initial access token is configured
+	if initialAccessToken := AppConfig.ClientRegistration.InitialAccessToken; initialAccessToken != "" && !bearerTokenMatches(r, initialAccessToken) {
+		writeBearerError(w, http.StatusUnauthorized, OAuth2ErrorInvalidToken, "Invalid initial access token")
+		return
+	}
+
+	var metadata ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidClientMetadata, "Invalid request")
+		return
+	}
+	if !checkClientMetadata(w, &metadata) {
+		return
+	}
+
+	client := IdpClient{
+		Id:                      uuid.NewString(),
+		RegistrationAccessToken: generateRandomToken(),
+		ClientIdIssuedAt:        time.Now().Unix(),
+	}
+	client.Audience = client.Id
+	applyClientMetadata(&client, metadata)
+	AppContext.Clients = append(AppContext.Clients, client)
+
+	writeJSONNoStore(w, http.StatusCreated, clientRegistrationResponse(&client))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+)
+
+func POST_oauth2_signup_submit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderInvalidFormPage(w)
+		return
+	}
+
+	data, foundClient := newSignUpFormData(r.Form)
+
+	// The confirmation step of the form submits the code
+	if r.Form.Has("code") {
+		data.Username = r.Form.Get("username")
+		confirmSignUpForm(w, data, foundClient, r.Form.Get("code"))
+		return
+	}
+
+	username := r.Form.Get("username")
+	password := r.Form.Get("password")
+	attributes := map[string]interface{}{}
+	if email := r.Form.Get("email"); email != "" {
+		attributes["email"] = email
+	}
+
+	// Validate the new user
+	if username == "" || password == "" {
+		data.Error = "Username and password are required"
+	} else if FindUserByUsername(username) != nil {
+		data.Error = "User already exists"
+	} else if password != r.Form.Get("confirm_password") {
+		data.Error = "Passwords do not match"
+	} else if err := validateNewPassword(nil, password); err != nil {
+		data.Error = err.Error()
+	} else if err := validateSignUpEmail(attributes); err != nil {
+		data.Error = err.Error()
+	}
+	if data.Error != "" {
+		renderSignUpForm(w, data)
+		return
+	}
+
+	newUser, err := newSignUpUser(username, password, attributes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Let the pre sign-up hook deny creating the user
+	if err := runPreHook(AppConfig.Hooks.PreSignUp, newLifecycleHookEvent(HookPreSignUp, HookSourceOAuth2, &newUser, foundClient)); err != nil {
+		data.Error = err.Error()
+		renderSignUpForm(w, data)
+		return
+	}
+
+	user := addSignUpUser(newUser, HookSourceOAuth2, foundClient, authorizationRequestParams(data.Request))
+
+	// Unconfirmed users continue with the confirmation step
+	data.Username = user.Username
+	data.Confirmed = !user.Unconfirmed
+	data.Destination = maskEmail(userEmail(user))
+	renderSignUpForm(w, data)
+}
+
+// confirmSignUpForm confirms a user with the code entered in the sign-up form or given in the emailed link
+func confirmSignUpForm(w http.ResponseWriter, data signUpFormData, foundClient *IdpClient, code string) {
+	foundUser := FindUserByUsername(data.Username)
+	if foundUser == nil {
+		data.Error = ErrInvalidConfirmationCode.Error()
+		renderSignUpForm(w, data)
+		return
+	}
+	data.Destination = maskEmail(userEmail(foundUser))
+
+	if err := confirmUser(foundUser, code, HookSourceOAuth2, foundClient); err != nil && err != ErrUserAlreadyConfirmed {
+		data.Error = err.Error()
+		renderSignUpForm(w, data)
+		return
+	}
+
+	data.Confirmed = true
+	renderSignUpForm(w, data)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 )
@@ -15,61 +14,58 @@ type TokenResponse struct {
 
 func POST_oauth2_token(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "Invalid form data")
 		return
 	}
 
 	// Get and validate required parameters
 	grantType := r.Form.Get("grant_type")
 	code := r.Form.Get("code")
-	clientID := r.Form.Get("client_id")
-	clientSecret := r.Form.Get("client_secret")
 	redirectURI := r.Form.Get("redirect_uri")
 
 	// Validate grant_type
+	if grantType == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "grant_type is required")
+		return
+	}
 	if grantType != "authorization_code" {
-		http.Error(w, "grant_type must be 'authorization_code'", http.StatusBadRequest)
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorUnsupportedGrantType, "grant_type must be 'authorization_code'")
 		return
 	}
 
-	// Validate client credentials
-	var foundClient *IdpClient
-	for i, client := range AppContext.Clients {
-		if client.Id == clientID {
-			// If client has a secret configured, validate it
-			if client.Secret != "" {
-				if client.Secret != clientSecret {
-					continue
-				}
-			}
-			// Client matched (either secret validated or public client)
-			foundClient = &AppContext.Clients[i]
-			break
-		}
+	// Authenticate the client with its token endpoint auth method
+	foundClient, err := authenticateClient(r)
+	if err != nil {
+		writeClientAuthenticationError(w, err)
+		return
 	}
 
-	if foundClient == nil {
-		http.Error(w, "Invalid client credentials", http.StatusUnauthorized)
+	if code == "" {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "code is required")
 		return
 	}
 
 	// Find and validate authorization code
 	authCode, exists := AppContext.OauthPendingAuthCodes[code]
 	if !exists {
-		http.Error(w, "Invalid authorization code", http.StatusBadRequest)
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidGrant, "Invalid authorization code")
 		return
 	}
 
 	// Check if code is expired
 	if time.Now().After(authCode.ExpiresAt) {
 		delete(AppContext.OauthPendingAuthCodes, code)
-		http.Error(w, "Authorization code expired", http.StatusBadRequest)
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidGrant, "Authorization code expired")
 		return
 	}
 
 	// Validate client_id and redirect_uri match
-	if authCode.ClientId != clientID || authCode.RedirectUri != redirectURI {
-		http.Error(w, "Invalid client_id or redirect_uri", http.StatusBadRequest)
+	if authCode.ClientId != foundClient.Id {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidGrant, "The authorization code was issued to another client")
+		return
+	}
+	if authCode.RedirectUri != redirectURI {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidGrant, "redirect_uri does not match the authorization request")
 		return
 	}
 
@@ -83,20 +79,20 @@ func POST_oauth2_token(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if foundUser == nil {
-		http.Error(w, "User not found", http.StatusInternalServerError)
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidGrant, "User not found")
 		return
 	}
 
 	// Generate tokens
-	accessToken, err := generateAccessToken(foundUser, foundClient, authCode.Scopes)
+	accessToken, err := generateAccessToken(r, foundUser, foundClient, authCode.Scopes)
 	if err != nil {
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+		writeOAuth2Error(w, http.StatusInternalServerError, OAuth2ErrorServerError, "Failed to generate access token")
 		return
 	}
 
-	idToken, err := generateIdentityToken(foundUser, foundClient, authCode.Nonce)
+	idToken, err := generateIdentityToken(r, foundUser, foundClient, authCode.Scopes, authCode.Nonce, authCode.Amr)
 	if err != nil {
-		http.Error(w, "Failed to generate ID token", http.StatusInternalServerError)
+		writeOAuth2Error(w, http.StatusInternalServerError, OAuth2ErrorServerError, "Failed to generate ID token")
 		return
 	}
 
@@ -108,9 +104,8 @@ func POST_oauth2_token(w http.ResponseWriter, r *http.Request) {
 		AccessToken: accessToken,
 		IDToken:     idToken,
 		TokenType:   "Bearer",
-		ExpiresIn:   AppConfig.AccessTokenExpirationSeconds,
+		ExpiresIn:   int(clientAccessTokenLifetime(foundClient).Seconds()),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSONNoStore(w, http.StatusOK, response)
 }
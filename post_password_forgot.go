@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func POST_password_forgot(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	foundUser := FindUserByUsername(req.Username)
+	if foundUser == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	if err := checkPasswordResetAllowed(foundUser); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	sendPasswordResetCode(foundUser, nil)
+
+	writeJSON(w, http.StatusOK, map[string]string{"code_delivery_destination": maskEmail(userEmail(foundUser))})
+}
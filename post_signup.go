@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func POST_signup(w http.ResponseWriter, r *http.Request) {
+	var req SignUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Username and password are required"})
+		return
+	}
+
+	// The client is optional, it is passed on to the hooks
+	var foundClient *IdpClient
+	if req.ClientId != "" {
+		foundClient = FindClientById(req.ClientId)
+		if foundClient == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid client ID"})
+			return
+		}
+	}
+
+	if FindUserByUsername(req.Username) != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "User already exists"})
+		return
+	}
+	if err := validateNewPassword(nil, req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := validateSignUpEmail(req.Attributes); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	newUser, err := newSignUpUser(req.Username, req.Password, req.Attributes)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Let the pre sign-up hook deny creating the user
+	if err := runPreHook(AppConfig.Hooks.PreSignUp, newLifecycleHookEvent(HookPreSignUp, HookSourceSignUp, &newUser, foundClient)); err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	user := addSignUpUser(newUser, HookSourceSignUp, foundClient, nil)
+
+	response := SignUpResponse{
+		UserId:    user.Id,
+		Username:  user.Username,
+		Confirmed: !user.Unconfirmed,
+	}
+	if user.Unconfirmed {
+		response.CodeDeliveryDestination = maskEmail(userEmail(user))
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
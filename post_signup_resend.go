@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func POST_signup_resend(w http.ResponseWriter, r *http.Request) {
+	var req ResendConfirmationCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	foundUser := FindUserByUsername(req.Username)
+	if foundUser == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	if !foundUser.Unconfirmed {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": ErrUserAlreadyConfirmed.Error()})
+		return
+	}
+	if userEmail(foundUser) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "User has no email address"})
+		return
+	}
+
+	sendConfirmationCode(foundUser, nil)
+
+	writeJSON(w, http.StatusOK, map[string]string{"code_delivery_destination": maskEmail(userEmail(foundUser))})
+}
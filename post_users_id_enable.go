@@ -17,5 +17,6 @@ func POST_users_id_enable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user.Disabled = false
+	resetFailedLogins(user)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func POST_users_id_mfa_totp_verify(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+
+	var req VerifyTotpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	_, user := FindUserIndexById(userId)
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	if user.PendingTotpSecret == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "No TOTP enrollment in progress"})
+		return
+	}
+	if !verifyTotpEnrollment(user, req.Code) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "TOTP enabled"})
+}
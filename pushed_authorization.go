@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PushedRequestUriPrefix starts the request URIs returned by the pushed authorization request endpoint, see RFC 9126
+// section 2.2
+const PushedRequestUriPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedAuthorizationExpiry is how long a pushed authorization request can be used
+const PushedAuthorizationExpiry = 60 * time.Second
+
+var (
+	ErrInvalidPushedRequestUri = errors.New("Invalid or expired request_uri")
+	ErrPushedRequestUriClient  = errors.New("The request_uri was issued to another client")
+)
+
+// Parameters of the pushed authorization request endpoint that authenticate the client, and are not part of the
+// authorization request
+var clientAuthenticationParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+// pushAuthorizationRequest stores the parameters of an authorization request and returns the request URI to use them
+func pushAuthorizationRequest(client *IdpClient, form url.Values) string {
+	params := url.Values{}
+	for key, values := range form {
+		params[key] = values
+	}
+	for _, key := range clientAuthenticationParams {
+		params.Del(key)
+	}
+	params.Set("client_id", client.Id)
+
+	// Forget requests once they expired
+	now := time.Now()
+	for requestUri, pushed := range AppContext.PushedAuthorizations {
+		if now.After(pushed.ExpiresAt) {
+			delete(AppContext.PushedAuthorizations, requestUri)
+		}
+	}
+
+	requestUri := PushedRequestUriPrefix + generateRandomToken()
+	AppContext.PushedAuthorizations[requestUri] = PushedAuthorizationRequest{
+		ClientId:  client.Id,
+		Params:    params,
+		ExpiresAt: now.Add(PushedAuthorizationExpiry),
+	}
+	return requestUri
+}
+
+// resolvePushedAuthorizationRequest returns the parameters pushed for the request URI of an authorization request. A
+// request URI can be used once.
+func resolvePushedAuthorizationRequest(query url.Values) (url.Values, error) {
+	requestUri := query.Get("request_uri")
+	pushed, exists := AppContext.PushedAuthorizations[requestUri]
+	if !exists || !strings.HasPrefix(requestUri, PushedRequestUriPrefix) {
+		return nil, ErrInvalidPushedRequestUri
+	}
+	if pushed.ClientId != query.Get("client_id") {
+		return nil, ErrPushedRequestUriClient
+	}
+
+	delete(AppContext.PushedAuthorizations, requestUri)
+	if time.Now().After(pushed.ExpiresAt) {
+		return nil, ErrInvalidPushedRequestUri
+	}
+	return pushed.Params, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type PutClientRequest struct {
+	Secret                         string                  `json:"secret"`
+	RedirectUri                    string                  `json:"redirect_uri"`
+	RedirectUris                   []string                `json:"redirect_uris"`
+	Audience                       string                  `json:"audience"`
+	DefaultScopes                  string                  `json:"default_scopes"`
+	AccessTokenExpirationSeconds   int                     `json:"access_token_expiration_seconds"`
+	IdentityTokenExpirationSeconds int                     `json:"identity_token_expiration_seconds"`
+	RefreshTokenExpirationSeconds  int                     `json:"refresh_token_expiration_seconds"`
+	MapAccessTokenClaims           map[string]ClaimMapping `json:"map_access_token_claims"`
+	MapIdentityTokenClaims         map[string]ClaimMapping `json:"map_identity_token_claims"`
+	MapUserinfoClaims              map[string]ClaimMapping `json:"map_userinfo_claims"`
+	MfaRequired                    *bool                   `json:"mfa_required"`
+	RequireConsent                 *bool                   `json:"require_consent"`
+	TokenEndpointAuthMethod        string                  `json:"token_endpoint_auth_method"`
+	Jwks                           *ClientJwks             `json:"jwks"`
+	JwksUri                        string                  `json:"jwks_uri"`
+	ClientName                     string                  `json:"client_name"`
+	RequirePushedAuthorization     *bool                   `json:"require_pushed_authorization_requests"`
+	ResponseTypes                  []string                `json:"response_types"`
+	RequestUris                    []string                `json:"request_uris"`
+}
+
+func PUT_clients_id(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientId := vars["id"]
+
+	var req PutClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	// Changes are made to a copy, so that an invalid request leaves the client as it was
+	index, existingClient := FindClientIndexById(clientId)
+	client := IdpClient{Id: clientId, Audience: clientId}
+	if existingClient != nil {
+		client = *existingClient
+	}
+
+	if req.Secret != "" {
+		client.Secret = req.Secret
+	}
+	if req.RedirectUri != "" {
+		client.RedirectUri = req.RedirectUri
+	}
+	if req.RedirectUris != nil {
+		client.RedirectUris = req.RedirectUris
+	}
+	if req.Audience != "" {
+		client.Audience = req.Audience
+	}
+	if req.DefaultScopes != "" {
+		client.DefaultScopes = req.DefaultScopes
+	}
+	if req.AccessTokenExpirationSeconds != 0 {
+		client.AccessTokenExpirationSeconds = req.AccessTokenExpirationSeconds
+	}
+	if req.IdentityTokenExpirationSeconds != 0 {
+		client.IdentityTokenExpirationSeconds = req.IdentityTokenExpirationSeconds
+	}
+	if req.RefreshTokenExpirationSeconds != 0 {
+		client.RefreshTokenExpirationSeconds = req.RefreshTokenExpirationSeconds
+	}
+	if req.MapAccessTokenClaims != nil {
+		client.MapAccessTokenClaims = req.MapAccessTokenClaims
+	}
+	if req.MapIdentityTokenClaims != nil {
+		client.MapIdentityTokenClaims = req.MapIdentityTokenClaims
+	}
+	if req.MapUserinfoClaims != nil {
+		client.MapUserinfoClaims = req.MapUserinfoClaims
+	}
+	if req.MfaRequired != nil {
+		client.MfaRequired = *req.MfaRequired
+	}
+	if req.RequireConsent != nil {
+		client.RequireConsent = req.RequireConsent
+	}
+	if req.TokenEndpointAuthMethod != "" {
+		client.TokenEndpointAuthMethod = req.TokenEndpointAuthMethod
+	}
+	if req.Jwks != nil {
+		client.Jwks = req.Jwks
+		client.JwksUri = ""
+	}
+	if req.JwksUri != "" {
+		client.JwksUri = req.JwksUri
+		if req.Jwks == nil {
+			client.Jwks = nil
+		}
+	}
+	if req.ClientName != "" {
+		client.ClientName = req.ClientName
+	}
+	if req.RequirePushedAuthorization != nil {
+		client.RequirePushedAuthorization = *req.RequirePushedAuthorization
+	}
+	if req.ResponseTypes != nil {
+		client.ResponseTypes = req.ResponseTypes
+	}
+	if req.RequestUris != nil {
+		client.RequestUris = req.RequestUris
+	}
+
+	if err := validateClient(&client); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if existingClient != nil {
+		AppContext.Clients[index] = client
+		writeJSON(w, http.StatusOK, redactClient(client))
+		return
+	}
+
+	AppContext.Clients = append(AppContext.Clients, client)
+	writeJSON(w, http.StatusCreated, redactClient(client))
+}
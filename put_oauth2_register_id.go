@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PUT_oauth2_register_id replaces the metadata of a registered client, see RFC 7592 section 2.2
+func PUT_oauth2_register_id(w http.ResponseWriter, r *http.Request) {
+	_, client := findRegisteredClient(w, r)
+	if client == nil {
+		return
+	}
+
+	var req ClientUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidClientMetadata, "Invalid request")
+		return
+	}
+	if req.ClientId != client.Id {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "client_id does not match the registered client")
+		return
+	}
+	if req.ClientSecret != "" && !clientSecretMatches(client, req.ClientSecret) {
+		writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrorInvalidRequest, "client_secret does not match the registered client")
+		return
+	}
+	if !checkClientMetadata(w, &req.ClientMetadata) {
+		return
+	}
+
+	applyClientMetadata(client, req.ClientMetadata)
+
+	writeJSONNoStore(w, http.StatusOK, clientRegistrationResponse(client))
+}
@@ -8,9 +8,15 @@ import (
 )
 
 type PutUserRequest struct {
-	Username   string                 `json:"username"`
-	Password   string                 `json:"password"`
-	Attributes map[string]interface{} `json:"attributes"`
+	Username            string                 `json:"username"`
+	Password            string                 `json:"password"`
+	Attributes          map[string]interface{} `json:"attributes"`
+	ChallengeType       string                 `json:"challenge_type"`
+	ChallengeCode       string                 `json:"challenge_code"`
+	TotpSecret          string                 `json:"totp_secret"`
+	Groups              []string               `json:"groups"`
+	ForcePasswordChange *bool                  `json:"force_password_change"`
+	MfaRequired         *bool                  `json:"mfa_required"`
 }
 
 func PUT_users_id(w http.ResponseWriter, r *http.Request) {
@@ -26,38 +32,107 @@ func PUT_users_id(w http.ResponseWriter, r *http.Request) {
 	// Find existing user
 	_, existingUser := FindUserIndexById(userId)
 
+	// The challenge must be answerable with the resulting challenge code or TOTP secret
+	challenge := IdpUser{ChallengeType: req.ChallengeType, ChallengeCode: req.ChallengeCode, TotpSecret: req.TotpSecret}
+	if existingUser != nil {
+		if challenge.ChallengeType == "" {
+			challenge.ChallengeType = existingUser.ChallengeType
+		}
+		if challenge.ChallengeCode == "" {
+			challenge.ChallengeCode = existingUser.ChallengeCode
+		}
+		if challenge.TotpSecret == "" {
+			challenge.TotpSecret = existingUser.TotpSecret
+		}
+	}
+	if err := validateUserChallenge(&challenge); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Passwords that are already hashed are stored as they are, others are validated against the password policy
+	passwordHashed := isPasswordHash(req.Password)
+	if req.Password != "" && !passwordHashed {
+		if err := validateNewPassword(existingUser, req.Password); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
 	if existingUser != nil {
 		// Update existing user
 		if req.Username != "" {
 			existingUser.Username = req.Username
 		}
-		if req.Password != "" {
-			existingUser.Password = req.Password
+		if passwordHashed {
+			updateUserPasswordHash(existingUser, req.Password)
+		} else if req.Password != "" {
+			if err := updateUserPassword(existingUser, req.Password); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
 		}
 		if req.Attributes != nil {
 			existingUser.Attributes = req.Attributes
 		}
-		writeJSON(w, http.StatusOK, existingUser)
+		if req.ChallengeType != "" {
+			existingUser.ChallengeType = req.ChallengeType
+		}
+		if req.ChallengeCode != "" {
+			existingUser.ChallengeCode = req.ChallengeCode
+		}
+		if req.TotpSecret != "" {
+			existingUser.TotpSecret = req.TotpSecret
+		}
+		if req.Groups != nil {
+			existingUser.Groups = req.Groups
+		}
+		if req.ForcePasswordChange != nil {
+			existingUser.ForcePasswordChange = *req.ForcePasswordChange
+		}
+		if req.MfaRequired != nil {
+			existingUser.MfaRequired = *req.MfaRequired
+		}
+		writeJSON(w, http.StatusOK, redactUser(existingUser))
 		return
 	}
 
 	// Create new user
 	newUser := IdpUser{
-		Id:         userId,
-		Username:   req.Username,
-		Password:   req.Password,
-		Disabled:   false,
-		Attributes: req.Attributes,
+		Id:            userId,
+		Username:      req.Username,
+		Disabled:      false,
+		Attributes:    req.Attributes,
+		ChallengeType: req.ChallengeType,
+		ChallengeCode: req.ChallengeCode,
+		TotpSecret:    req.TotpSecret,
+		Groups:        req.Groups,
+	}
+	if req.ForcePasswordChange != nil {
+		newUser.ForcePasswordChange = *req.ForcePasswordChange
+	}
+	if req.MfaRequired != nil {
+		newUser.MfaRequired = *req.MfaRequired
 	}
 
-	AppContext.Users = append(AppContext.Users, newUser)
+	if passwordHashed {
+		updateUserPasswordHash(&newUser, req.Password)
+	} else if req.Password != "" {
+		if err := updateUserPassword(&newUser, req.Password); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 
-	responseUser := IdpUser{
-		Id:         newUser.Id,
-		Username:   newUser.Username,
-		Disabled:   newUser.Disabled,
-		Attributes: newUser.Attributes,
+	// Let the pre sign-up hook deny creating the user
+	if err := runPreHook(AppConfig.Hooks.PreSignUp, newLifecycleHookEvent(HookPreSignUp, HookSourceAdmin, &newUser, nil)); err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
 	}
 
-	writeJSON(w, http.StatusCreated, responseUser)
+	AppContext.Users = append(AppContext.Users, newUser)
+
+	runPostHook(AppConfig.Hooks.PostConfirmation, newLifecycleHookEvent(HookPostConfirmation, HookSourceAdmin, &newUser, nil))
+
+	writeJSON(w, http.StatusCreated, redactUser(&newUser))
 }
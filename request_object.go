@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequestObjectAlgorithms are the algorithms request objects can be signed with, using the client secret or the
+// client's keys like client assertions
+var RequestObjectAlgorithms = ClientAssertionAlgorithms
+
+var (
+	requestUriHttpClient     = &http.Client{Timeout: 5 * time.Second}
+	requestObjectMaxSize     = int64(64 * 1024)
+	requestObjectMaxLifetime = time.Hour
+)
+
+var (
+	ErrRequestAndRequestUri = errors.New("request and request_uri cannot both be used")
+	ErrInvalidRequestObject = errors.New("Invalid request object")
+	ErrInvalidRequestUri    = errors.New("Invalid request_uri")
+)
+
+// Claims of a request object that describe the JWT itself, and are not authorization request parameters
+var requestObjectJwtClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti", "sub"}
+
+// usesRequestObject reports whether the authorization request passes its parameters in a request object, either by
+// value or by reference. Request URIs of pushed authorization requests are not request objects.
+func usesRequestObject(params url.Values) bool {
+	return params.Has("request") || params.Has("request_uri") && !strings.HasPrefix(params.Get("request_uri"), PushedRequestUriPrefix)
+}
+
+// resolveRequestObject verifies the client's request object, see RFC 9101 and OpenID Connect Core 6. Only its claims
+// are used, the other parameters of the request are ignored apart from client_id (RFC 9101 section 5).
+func resolveRequestObject(client *IdpClient, params url.Values) (url.Values, error) {
+	requestObject := params.Get("request")
+	if params.Has("request_uri") {
+		if params.Has("request") {
+			return nil, ErrRequestAndRequestUri
+		}
+		fetched, err := fetchRequestObject(client, params.Get("request_uri"))
+		if err != nil {
+			return nil, err
+		}
+		requestObject = fetched
+	}
+
+	claims, err := verifyRequestObject(client, requestObject)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := url.Values{"client_id": {client.Id}}
+	for key, value := range claims {
+		if slices.Contains(requestObjectJwtClaims, key) {
+			continue
+		}
+		if key == "request" || key == "request_uri" {
+			return nil, fmt.Errorf("%w: %s cannot be nested", ErrInvalidRequestObject, key)
+		}
+		resolved.Set(key, requestObjectParam(value))
+	}
+	return resolved, nil
+}
+
+// verifyRequestObject checks the signature of a request object, that it was issued by the client for this server and
+// that it is not replayed
+func verifyRequestObject(client *IdpClient, requestObject string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.NewParser(jwt.WithValidMethods(RequestObjectAlgorithms), jwt.WithLeeway(30*time.Second), jwt.WithExpirationRequired()).ParseWithClaims(requestObject, claims, func(token *jwt.Token) (interface{}, error) {
+		if slices.Contains(ClientSecretJwtAlgorithms, token.Method.Alg()) {
+			if client.Secret == "" {
+				return nil, ErrInvalidClientCredentials
+			}
+			return []byte(client.Secret), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return findClientPublicKey(client, kid, token.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequestObject, err)
+	}
+
+	// The client_id and iss claims name the client, the audience is the issuer
+	if clientId, exists := claims["client_id"]; exists && clientId != client.Id {
+		return nil, fmt.Errorf("%w: client_id does not match", ErrInvalidRequestObject)
+	}
+	if issuer, _ := claims.GetIssuer(); issuer != client.Id {
+		return nil, fmt.Errorf("%w: iss must be the client_id", ErrInvalidRequestObject)
+	}
+	if audience, _ := claims.GetAudience(); !slices.Contains(audience, AppConfig.Issuer) {
+		return nil, fmt.Errorf("%w: aud must be %s", ErrInvalidRequestObject, AppConfig.Issuer)
+	}
+	expiresAt, _ := claims.GetExpirationTime()
+	if time.Until(expiresAt.Time) > requestObjectMaxLifetime {
+		return nil, fmt.Errorf("%w: exp must be within %s", ErrInvalidRequestObject, requestObjectMaxLifetime)
+	}
+
+	// Request objects with a jti can only be used once
+	if jti, _ := claims["jti"].(string); jti != "" {
+		now := time.Now()
+		for key, expiry := range AppContext.UsedRequestObjects {
+			if now.After(expiry) {
+				delete(AppContext.UsedRequestObjects, key)
+			}
+		}
+		key := client.Id + ":" + jti
+		if _, used := AppContext.UsedRequestObjects[key]; used {
+			return nil, fmt.Errorf("%w: jti was already used", ErrInvalidRequestObject)
+		}
+		AppContext.UsedRequestObjects[key] = expiresAt.Time.Add(30 * time.Second)
+	}
+	return claims, nil
+}
+
+// validateRequestUris checks the request URIs a client registers for its request objects
+func validateRequestUris(uris []string) error {
+	for _, uri := range uris {
+		if parsed, err := url.Parse(uri); err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" || parsed.Fragment != "" {
+			return fmt.Errorf("Invalid request_uri %q", uri)
+		}
+	}
+	return nil
+}
+
+// fetchRequestObject downloads a request object passed by reference. Only the client's registered request URIs are
+// fetched, so the server cannot be made to request arbitrary URLs. Their fragment is ignored, see OpenID Connect Core
+// 6.2.
+func fetchRequestObject(client *IdpClient, requestUri string) (string, error) {
+	parsed, err := url.Parse(requestUri)
+	if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", ErrInvalidRequestUri
+	}
+	parsed.Fragment = ""
+	requestUri = parsed.String()
+	if !slices.Contains(client.RequestUris, requestUri) {
+		return "", fmt.Errorf("%w: request_uri is not registered for the client", ErrInvalidRequestUri)
+	}
+
+	response, err := requestUriHttpClient.Get(requestUri)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRequestUri, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d", ErrInvalidRequestUri, response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, requestObjectMaxSize))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRequestUri, err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// requestObjectParam converts a request object claim to a request parameter. Objects, such as the claims parameter,
+// are passed on as JSON.
+func requestObjectParam(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// writeRequestObjectError rejects an authorization request whose request object could not be used. The redirect URI
+// of such a request cannot be trusted, so the error is shown to the user.
+func writeRequestObjectError(w http.ResponseWriter, err error) {
+	code := OAuth2ErrorInvalidRequestObject
+	if errors.Is(err, ErrInvalidRequestUri) {
+		code = OAuth2ErrorInvalidRequestUri
+	}
+	if errors.Is(err, ErrRequestAndRequestUri) {
+		code = OAuth2ErrorInvalidRequest
+	}
+	renderOAuth2ErrorPage(w, http.StatusBadRequest, code, err.Error())
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Response modes of the authorization response, see OAuth 2.0 Multiple Response Type Encoding Practices, OAuth 2.0 Form
+// Post Response Mode and JWT Secured Authorization Response Mode (JARM)
+const (
+	ResponseModeQuery       = "query"
+	ResponseModeFragment    = "fragment"
+	ResponseModeFormPost    = "form_post"
+	ResponseModeJwt         = "jwt"
+	ResponseModeQueryJwt    = "query.jwt"
+	ResponseModeFragmentJwt = "fragment.jwt"
+	ResponseModeFormPostJwt = "form_post.jwt"
+
+	// AuthorizationResponseExpiry is how long a JWT secured authorization response can be used
+	AuthorizationResponseExpiry = 10 * time.Minute
+)
+
+const formPostTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Submit this form</title>
+</head>
+<body onload="document.forms[0].submit()">
+    <form method="post" action="{{.RedirectURI}}">
+        {{range $name, $values := .Params}}{{range $values}}
+        <input type="hidden" name="{{$name}}" value="{{.}}">
+        {{end}}{{end}}
+        <noscript>
+            <p>JavaScript is disabled, please continue manually.</p>
+            <button type="submit">Continue</button>
+        </noscript>
+    </form>
+</body>
+</html>
+`
+
+type formPostData struct {
+	RedirectURI string
+	Params      url.Values
+}
+
+// responseUsesFragment reports whether the authorization response is returned in the fragment of the redirect URI by
+// default, which is the case for response types other than code
+func responseUsesFragment(responseType string) bool {
+	normalized := normalizeResponseType(responseType)
+	return normalized != ResponseTypeCode && slices.Contains(OAuth2ResponseTypes, normalized)
+}
+
+// checkResponseMode validates the response mode of an authorization request, returning the error code and description
+// if it cannot be used. Responses with tokens must not be returned in the query, where they would be logged.
+func checkResponseMode(responseType string, responseMode string) (string, string) {
+	if responseMode == "" {
+		return "", ""
+	}
+	if !slices.Contains(OAuth2ResponseModes, responseMode) {
+		return OAuth2ErrorInvalidRequest, "response_mode must be one of: " + strings.Join(OAuth2ResponseModes, ", ")
+	}
+	if (responseMode == ResponseModeQuery || responseMode == ResponseModeQueryJwt) && responseUsesFragment(responseType) {
+		return OAuth2ErrorInvalidRequest, "response_mode '" + responseMode + "' cannot be used with response_type '" + normalizeResponseType(responseType) + "'"
+	}
+	return "", ""
+}
+
+// resolveResponseMode returns the response mode the authorization response is sent with. Without a valid response mode,
+// or with jwt, the default of the response type is used.
+func resolveResponseMode(responseType string, responseMode string) string {
+	if errorCode, _ := checkResponseMode(responseType, responseMode); errorCode != "" {
+		responseMode = ""
+	}
+
+	switch responseMode {
+	case "":
+		if responseUsesFragment(responseType) {
+			return ResponseModeFragment
+		}
+		return ResponseModeQuery
+	case ResponseModeJwt:
+		if responseUsesFragment(responseType) {
+			return ResponseModeFragmentJwt
+		}
+		return ResponseModeQueryJwt
+	default:
+		return responseMode
+	}
+}
+
+// generateAuthorizationResponseToken signs the parameters of an authorization response for the client, see JARM
+// section 2.1
+func generateAuthorizationResponseToken(client *IdpClient, params url.Values) (string, error) {
+	now := time.Now()
+	jwksKey := AppContext.JwksKeys[0]
+	claims := jwt.MapClaims{
+		"iss": AppConfig.Issuer,
+		"aud": client.Id,
+		"iat": now.Unix(),
+		"exp": now.Add(AuthorizationResponseExpiry).Unix(),
+	}
+	for key := range params {
+		claims[key] = params.Get(key)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = jwksKey.Kid
+
+	return token.SignedString(jwksKey.PrivateKey)
+}
+
+// redirectWithParams returns the parameters of an authorization response to the client's redirect URI, with the
+// response mode of the request
+func redirectWithParams(w http.ResponseWriter, r *http.Request, client *IdpClient, redirectURI string, responseType string, responseMode string, params url.Values) {
+	mode := resolveResponseMode(responseType, responseMode)
+
+	// JWT secured responses pass the signed parameters as the response parameter
+	if strings.HasSuffix(mode, ".jwt") {
+		response, err := generateAuthorizationResponseToken(client, params)
+		if err != nil {
+			renderOAuth2ErrorPage(w, http.StatusInternalServerError, OAuth2ErrorServerError, "Failed to sign the authorization response")
+			return
+		}
+		params = url.Values{"response": {response}}
+		mode = strings.TrimSuffix(mode, ".jwt")
+	}
+
+	if mode == ResponseModeFormPost {
+		renderFormPost(w, redirectURI, params)
+		return
+	}
+
+	// Registered redirect URIs have no fragment, but may have a query the response is added to
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		renderInvalidClientPage(w)
+		return
+	}
+	if mode == ResponseModeFragment {
+		target.Fragment = ""
+		http.Redirect(w, r, target.String()+"#"+params.Encode(), http.StatusFound)
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// renderFormPost returns the authorization response in a form that the browser posts to the redirect URI, see OAuth
+// 2.0 Form Post Response Mode
+func renderFormPost(w http.ResponseWriter, redirectURI string, params url.Values) {
+	tmpl, err := template.New("form_post").Parse(formPostTemplate)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The page contains the response, so it must not be cached
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := tmpl.Execute(w, formPostData{RedirectURI: redirectURI, Params: params}); err != nil {
+		log.Printf("Failed to render form post response: %v", err)
+	}
+}
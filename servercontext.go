@@ -5,15 +5,56 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"math/big"
+	"net/url"
 	"time"
 )
 
 type PendingLogin struct {
-	UserId            string
-	ClientId          string
-	IssueRefreshToken bool
-	Scopes            string
-	CreatedAt         time.Time
+	UserId               string
+	ClientId             string
+	IssueRefreshToken    bool
+	Scopes               string
+	CreatedAt            time.Time
+	FailedAttempts       int
+	ChallengeName        string
+	Srp                  *SrpSession
+	Webauthn             *WebauthnSession
+	Passwordless         *PasswordlessSession
+	Amr                  []string
+	AuthorizationRequest string
+}
+
+// SrpSession holds the server side state of a Cognito SRP password verifier challenge
+type SrpSession struct {
+	A            *big.Int
+	B            *big.Int
+	SmallB       *big.Int
+	Verifier     *big.Int
+	SecretBlock  []byte
+	UserIdForSrp string
+}
+
+// SrpCredentials is the SRP verifier of a user's password, which is kept because hashed passwords cannot be used to
+// compute it during a login
+type SrpCredentials struct {
+	UserIdForSrp string
+	Salt         *big.Int
+	Verifier     *big.Int
+}
+
+// WebauthnSession holds the challenge of a WebAuthn registration or authentication ceremony
+type WebauthnSession struct {
+	Challenge string
+	CreatedAt time.Time
+}
+
+// PasswordlessSession holds the code and magic link sent for a passwordless login
+type PasswordlessSession struct {
+	Code        string
+	LinkToken   string
+	Destination string
+	ExpiresAt   time.Time
+	Confirmed   bool
 }
 
 type IssuedRefreshToken struct {
@@ -21,6 +62,7 @@ type IssuedRefreshToken struct {
 	ClientId  string
 	Scopes    string
 	ExpiresAt time.Time
+	Amr       []string
 }
 
 type OauthPendingAuthorization struct {
@@ -31,6 +73,22 @@ type OauthPendingAuthorization struct {
 	Nonce       string
 	Scopes      string
 	ExpiresAt   time.Time
+	Amr         []string
+}
+
+// CachedClientJwks holds the keys fetched from a client's jwks_uri
+type CachedClientJwks struct {
+	JwksUri   string
+	Keys      []ClientJwk
+	FetchedAt time.Time
+}
+
+// PushedAuthorizationRequest holds the parameters of an authorization request pushed by a client, until the request
+// URI it was given is used at the authorization endpoint
+type PushedAuthorizationRequest struct {
+	ClientId  string
+	Params    url.Values
+	ExpiresAt time.Time
 }
 
 type AppServerContext struct {
@@ -40,6 +98,15 @@ type AppServerContext struct {
 	PendingLogins         map[string]PendingLogin
 	RefreshTokens         map[string]IssuedRefreshToken
 	OauthPendingAuthCodes map[string]OauthPendingAuthorization
+	RevokedAccessTokens   map[string]time.Time
+	SignedOutUsers        map[string]time.Time
+	Mailbox               []MailMessage
+	SmsInbox              []SmsMessage
+	UsedClientAssertions  map[string]time.Time
+	UsedRequestObjects    map[string]time.Time
+	ClientJwksCache       map[string]CachedClientJwks
+	PushedAuthorizations  map[string]PushedAuthorizationRequest
+	AuthorizationRequests map[string]AuthorizationRequest
 }
 
 var AppContext *AppServerContext
@@ -87,5 +154,14 @@ func NewAppContext() *AppServerContext {
 		PendingLogins:         make(map[string]PendingLogin),
 		RefreshTokens:         make(map[string]IssuedRefreshToken),
 		OauthPendingAuthCodes: make(map[string]OauthPendingAuthorization),
+		RevokedAccessTokens:   make(map[string]time.Time),
+		SignedOutUsers:        make(map[string]time.Time),
+		Mailbox:               []MailMessage{},
+		SmsInbox:              []SmsMessage{},
+		UsedClientAssertions:  make(map[string]time.Time),
+		UsedRequestObjects:    make(map[string]time.Time),
+		ClientJwksCache:       make(map[string]CachedClientJwks),
+		PushedAuthorizations:  make(map[string]PushedAuthorizationRequest),
+		AuthorizationRequests: make(map[string]AuthorizationRequest),
 	}
 }
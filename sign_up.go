@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidConfirmationCode = errors.New("Invalid confirmation code")
+	ErrExpiredConfirmationCode = errors.New("Confirmation code has expired")
+	ErrUserAlreadyConfirmed    = errors.New("User is already confirmed")
+	ErrUserNotConfirmed        = errors.New("User is not confirmed")
+)
+
+// userEmail returns the user's email attribute
+func userEmail(user *IdpUser) string {
+	email, _ := user.Attributes["email"].(string)
+	return email
+}
+
+// validateSignUpEmail checks the email address of a user signing up, which is required if the confirmation code
+// has to be sent to it
+func validateSignUpEmail(attributes map[string]interface{}) error {
+	email, _ := attributes["email"].(string)
+	if email == "" {
+		if *AppConfig.SignUp.RequireVerification {
+			return errors.New("An email address is required")
+		}
+		return nil
+	}
+
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
+
+// serverManagedAttribute reports whether an attribute is only set by the server or through the admin APIs, like the
+// verification flags that are set when a user confirms their email address
+func serverManagedAttribute(name string) bool {
+	return name == "sub" || strings.HasSuffix(name, "_verified")
+}
+
+// newSignUpUser creates a user signing up themselves, who has to confirm their email address if verification is
+// required. Server managed attributes are dropped. The user is not stored yet.
+func newSignUpUser(username string, password string, attributes map[string]interface{}) (IdpUser, error) {
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	for name := range attributes {
+		if serverManagedAttribute(name) {
+			delete(attributes, name)
+		}
+	}
+
+	user := IdpUser{
+		Id:          uuid.NewString(),
+		Username:    username,
+		Attributes:  attributes,
+		Unconfirmed: *AppConfig.SignUp.RequireVerification,
+	}
+	if err := updateUserPassword(&user, password); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// addSignUpUser stores a user who signed up, sending them a confirmation code or confirming them right away
+func addSignUpUser(user IdpUser, source string, client *IdpClient, returnParams url.Values) *IdpUser {
+	AppContext.Users = append(AppContext.Users, user)
+	added := &AppContext.Users[len(AppContext.Users)-1]
+
+	if added.Unconfirmed {
+		sendConfirmationCode(added, returnParams)
+	} else {
+		runPostHook(AppConfig.Hooks.PostConfirmation, newLifecycleHookEvent(HookPostConfirmation, source, added, client))
+	}
+	return added
+}
+
+// sendConfirmationCode generates a new confirmation code for the user and emails it, along with a link to the
+// hosted confirmation page. The return parameters are passed on to the page to continue an OAuth2 login.
+func sendConfirmationCode(user *IdpUser, returnParams url.Values) {
+	code := generateConfirmationCode()
+	expires := time.Now().Add(time.Duration(AppConfig.SignUp.CodeExpirationSeconds) * time.Second)
+	user.ConfirmationCode = code
+	user.ConfirmationExpires = &expires
+	user.ConfirmationFailed = 0
+
+	body := fmt.Sprintf("Hello %s,\n\nYour confirmation code is %s\n", user.Username, code)
+	if *AppConfig.OAuth2.Enabled {
+		params := url.Values{}
+		for key, values := range returnParams {
+			params[key] = values
+		}
+		params.Set("username", user.Username)
+		params.Set("code", code)
+		body += fmt.Sprintf("\nYou can also confirm your account by opening this link:\n%s/oauth2/signup/confirm?%s\n", AppConfig.BaseUrl, params.Encode())
+	}
+
+	sendMail(userEmail(user), "Your confirmation code", body)
+}
+
+// generateConfirmationCode returns a random 6 digit code
+func generateConfirmationCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// confirmUser checks a confirmation code and marks the user and their email address as confirmed. The code is
+// invalidated after too many wrong codes.
+func confirmUser(user *IdpUser, code string, source string, client *IdpClient) error {
+	if !user.Unconfirmed {
+		return ErrUserAlreadyConfirmed
+	}
+	code = strings.TrimSpace(code)
+	if user.ConfirmationCode == "" {
+		return ErrInvalidConfirmationCode
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(user.ConfirmationCode)) != 1 {
+		user.ConfirmationFailed++
+		if user.ConfirmationFailed >= AppConfig.LoginApi.MaxChallengeAttempts {
+			user.ConfirmationCode = ""
+			user.ConfirmationExpires = nil
+			user.ConfirmationFailed = 0
+		}
+		return ErrInvalidConfirmationCode
+	}
+	if user.ConfirmationExpires != nil && time.Now().After(*user.ConfirmationExpires) {
+		return ErrExpiredConfirmationCode
+	}
+
+	user.Unconfirmed = false
+	user.ConfirmationCode = ""
+	user.ConfirmationExpires = nil
+	user.ConfirmationFailed = 0
+	if user.Attributes == nil {
+		user.Attributes = map[string]interface{}{}
+	}
+	if userEmail(user) != "" {
+		user.Attributes["email_verified"] = true
+	}
+
+	runPostHook(AppConfig.Hooks.PostConfirmation, newLifecycleHookEvent(HookPostConfirmation, source, user, client))
+	return nil
+}
+
+// maskEmail hides most of an email address, the way it is reported as the code delivery destination
+func maskEmail(email string) string {
+	at := strings.Index(email, "@")
+	if at < 1 {
+		return email
+	}
+	return email[:1] + "***" + email[at:]
+}
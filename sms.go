@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sendSms captures a text message in the SMS inbox
+func sendSms(to string, body string) {
+	AppContext.SmsInbox = append(AppContext.SmsInbox, SmsMessage{
+		Id:        uuid.NewString(),
+		To:        to,
+		Body:      body,
+		CreatedAt: time.Now(),
+	})
+	log.Printf("Sent SMS to %s", to)
+}
+
+// userPhoneNumber returns the user's phone_number attribute
+func userPhoneNumber(user *IdpUser) string {
+	phoneNumber, _ := user.Attributes["phone_number"].(string)
+	return phoneNumber
+}
+
+// maskPhoneNumber hides all but the last four digits of a phone number, the way it is reported as the code delivery
+// destination
+func maskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 4 {
+		return phoneNumber
+	}
+	masked := []byte(phoneNumber[:len(phoneNumber)-4])
+	for i := range masked {
+		if masked[i] != '+' {
+			masked[i] = '*'
+		}
+	}
+	return string(masked) + phoneNumber[len(phoneNumber)-4:]
+}
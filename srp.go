@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// SRP-6a group parameters used by Cognito (the 3072-bit group of RFC 5054)
+const srpNHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+	"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+	"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+	"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+	"43DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+
+const srpInfoBits = "Caldera Derived Key"
+
+var (
+	srpN, _ = new(big.Int).SetString(srpNHex, 16)
+	srpG    = big.NewInt(2)
+	srpK    = srpHexToInt(srpHexHash(srpPadHex(srpN) + srpPadHex(srpG)))
+)
+
+// srpPadHex returns the hex representation of n the way Cognito clients hash it: an even number of digits, with a
+// leading zero byte if the most significant bit is set
+func srpPadHex(n *big.Int) string {
+	s := n.Text(16)
+	if len(s)%2 != 0 {
+		s = "0" + s
+	}
+	if strings.ContainsRune("89abcdef", rune(s[0])) {
+		s = "00" + s
+	}
+	return s
+}
+
+// srpHash returns the hex encoded SHA-256 of data
+func srpHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// srpHexHash returns the hex encoded SHA-256 of the bytes encoded by hexStr
+func srpHexHash(hexStr string) string {
+	b, _ := hex.DecodeString(hexStr)
+	return srpHash(b)
+}
+
+func srpHexToInt(hexStr string) *big.Int {
+	n, _ := new(big.Int).SetString(hexStr, 16)
+	return n
+}
+
+// srpRandomInt returns a random positive integer of the given number of bytes
+func srpRandomInt(size int) *big.Int {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// srpPrivateKey computes x = H(salt | H(poolName | username | ":" | password))
+func srpPrivateKey(poolName string, username string, password string, salt *big.Int) *big.Int {
+	usernamePasswordHash := srpHash([]byte(poolName + username + ":" + password))
+	return srpHexToInt(srpHexHash(srpPadHex(salt) + usernamePasswordHash))
+}
+
+// srpVerifier computes the password verifier v = g^x mod N
+func srpVerifier(x *big.Int) *big.Int {
+	return new(big.Int).Exp(srpG, x, srpN)
+}
+
+// srpServerPublicKey computes B = (k*v + g^b) mod N
+func srpServerPublicKey(v *big.Int, b *big.Int) *big.Int {
+	kv := new(big.Int).Mul(srpK, v)
+	gb := new(big.Int).Exp(srpG, b, srpN)
+	return kv.Add(kv, gb).Mod(kv, srpN)
+}
+
+// srpScramblingParameter computes u = H(A | B)
+func srpScramblingParameter(A *big.Int, B *big.Int) *big.Int {
+	return srpHexToInt(srpHexHash(srpPadHex(A) + srpPadHex(B)))
+}
+
+// srpServerSecret computes the shared secret S = (A * v^u)^b mod N
+func srpServerSecret(A *big.Int, v *big.Int, u *big.Int, b *big.Int) *big.Int {
+	vu := new(big.Int).Exp(v, u, srpN)
+	base := vu.Mul(vu, A).Mod(vu, srpN)
+	return base.Exp(base, b, srpN)
+}
+
+// srpAuthenticationKey derives the 16 byte key used to sign the password claim from S and u using HKDF
+func srpAuthenticationKey(S *big.Int, u *big.Int) []byte {
+	ikm, _ := hex.DecodeString(srpPadHex(S))
+	salt, _ := hex.DecodeString(srpPadHex(u))
+
+	prk := hmac.New(sha256.New, salt)
+	prk.Write(ikm)
+
+	mac := hmac.New(sha256.New, prk.Sum(nil))
+	mac.Write([]byte(srpInfoBits))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:16]
+}
+
+// srpPasswordClaimSignature computes the signature a client proves knowledge of the password with
+func srpPasswordClaimSignature(key []byte, poolName string, userIdForSrp string, secretBlock []byte, timestamp string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(poolName))
+	mac.Write([]byte(userIdForSrp))
+	mac.Write(secretBlock)
+	mac.Write([]byte(timestamp))
+	return mac.Sum(nil)
+}
@@ -1,5 +1,23 @@
 package main
 
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChallengeTypeAny   = "any"
+	ChallengeTypeFixed = "fixed"
+	ChallengeTypeTotp  = "totp"
+)
+
+const (
+	ChallengeNameCustom           = "CUSTOM_CHALLENGE"
+	ChallengeNameSoftwareTokenMfa = "SOFTWARE_TOKEN_MFA"
+	ChallengeNameNewPassword      = "NEW_PASSWORD_REQUIRED"
+)
+
 // FindUserIndexById returns the index and pointer to a user in AppContext.Users if found
 func FindUserIndexById(id string) (int, *IdpUser) {
 	for i, u := range AppContext.Users {
@@ -9,3 +27,106 @@ func FindUserIndexById(id string) (int, *IdpUser) {
 	}
 	return -1, nil
 }
+
+// RemoveUserAt removes the user at the given index from AppContext.Users
+func RemoveUserAt(index int) {
+	// Remove user by swapping with last element and truncating
+	AppContext.Users[index] = AppContext.Users[len(AppContext.Users)-1]
+	AppContext.Users = AppContext.Users[:len(AppContext.Users)-1]
+}
+
+// challengeName returns the name of the challenge the user has to answer in the Login API
+func challengeName(user *IdpUser) string {
+	if user.ChallengeType == ChallengeTypeTotp {
+		return ChallengeNameSoftwareTokenMfa
+	}
+	return ChallengeNameCustom
+}
+
+// hasLoginChallenge reports whether the user has a configured challenge they can answer
+func hasLoginChallenge(user *IdpUser) bool {
+	return (user.ChallengeType == ChallengeTypeFixed || user.ChallengeType == ChallengeTypeTotp) && validateUserChallenge(user) == nil
+}
+
+// validateChallengeResponse checks the challenge data submitted by the user against their challenge type. Challenges
+// that are unknown or miss their code or secret are never answered.
+func validateChallengeResponse(user *IdpUser, challengeData string) bool {
+	switch user.ChallengeType {
+	case "", ChallengeTypeAny:
+		return true
+	case ChallengeTypeFixed:
+		return user.ChallengeCode != "" && subtle.ConstantTimeCompare([]byte(user.ChallengeCode), []byte(challengeData)) == 1
+	case ChallengeTypeTotp:
+		return user.TotpSecret != "" && validateTotpCode(user.TotpSecret, challengeData)
+	default:
+		return false
+	}
+}
+
+// validateUserChallenge checks that the user's challenge type is known and has the code or secret it is answered with
+func validateUserChallenge(user *IdpUser) error {
+	switch user.ChallengeType {
+	case "", ChallengeTypeAny:
+		return nil
+	case ChallengeTypeFixed:
+		if user.ChallengeCode == "" {
+			return errors.New("challenge_type fixed requires a challenge_code")
+		}
+		return nil
+	case ChallengeTypeTotp:
+		if user.TotpSecret == "" {
+			return errors.New("challenge_type totp requires a totp_secret")
+		}
+		if _, err := decodeTotpSecret(user.TotpSecret); err != nil {
+			return errors.New("totp_secret must be base32 encoded")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unsupported challenge_type %q", user.ChallengeType)
+	}
+}
+
+// redactUser returns the user without passwords, challenge codes, secrets and credentials, for the admin API
+func redactUser(user *IdpUser) IdpUser {
+	return IdpUser{
+		Id:                  user.Id,
+		Username:            user.Username,
+		Disabled:            user.Disabled,
+		Attributes:          user.Attributes,
+		Groups:              user.Groups,
+		ForcePasswordChange: user.ForcePasswordChange,
+		LockedUntil:         user.LockedUntil,
+		Unconfirmed:         user.Unconfirmed,
+		ChallengeType:       user.ChallengeType,
+		MfaRequired:         user.MfaRequired,
+	}
+}
+
+// FindUserByUsername returns a pointer to a user in AppContext.Users with the given username if found
+func FindUserByUsername(username string) *IdpUser {
+	for i, u := range AppContext.Users {
+		if u.Username == username {
+			return &AppContext.Users[i]
+		}
+	}
+	return nil
+}
+
+// checkLoginAllowed reports why the user cannot log in without a password, if they cannot
+func checkLoginAllowed(user *IdpUser) error {
+	if user.Disabled {
+		return errors.New("User is disabled")
+	}
+	if user.Unconfirmed {
+		return ErrUserNotConfirmed
+	}
+	if userLocked(user) {
+		return ErrUserLocked
+	}
+	return nil
+}
+
+// checkUserPassword reports whether the password matches the user's password
+func checkUserPassword(user *IdpUser, password string) bool {
+	return passwordMatches(user.Password, password)
+}
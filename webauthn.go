@@ -0,0 +1,558 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const ChallengeNameWebauthn = "WEB_AUTHN"
+
+// Authentication methods of passkey logins, depending on whether the passkey can be synced to other devices
+const (
+	AmrHardwareKey = "hwk"
+	AmrSoftwareKey = "swk"
+)
+
+// COSE algorithms of the passkeys users can register
+const (
+	CoseAlgorithmES256 = -7
+	CoseAlgorithmRS256 = -257
+)
+
+const (
+	coseKeyTypeEc2 = 2
+	coseKeyTypeRsa = 3
+	coseCurveP256  = 1
+)
+
+const (
+	webauthnKeyType = "public-key"
+	webauthnCreate  = "webauthn.create"
+	webauthnGet     = "webauthn.get"
+)
+
+const (
+	WebauthnUserVerificationRequired    = "required"
+	WebauthnUserVerificationPreferred   = "preferred"
+	WebauthnUserVerificationDiscouraged = "discouraged"
+)
+
+// Flags of the authenticator data
+const (
+	authenticatorFlagUserPresent        = 0x01
+	authenticatorFlagUserVerified       = 0x04
+	authenticatorFlagBackupEligible     = 0x08
+	authenticatorFlagAttestedCredential = 0x40
+)
+
+var (
+	ErrInvalidWebauthnResponse   = errors.New("Invalid WebAuthn response")
+	ErrWebauthnChallengeExpired  = errors.New("WebAuthn challenge has expired")
+	ErrNoWebauthnRegistration    = errors.New("No passkey registration in progress")
+	ErrUnknownWebauthnCredential = errors.New("Unknown passkey")
+	ErrWebauthnCredentialExists  = errors.New("Passkey is already registered")
+	ErrUnsupportedPublicKey      = errors.New("Unsupported passkey algorithm, only ES256 and RS256 are supported")
+	ErrInvalidWebauthnSignature  = errors.New("Invalid passkey signature")
+)
+
+// WebauthnCreationOptions are the options of navigator.credentials.create() for registering a passkey, in their JSON
+// form
+type WebauthnCreationOptions struct {
+	Rp                     WebauthnRelyingParty           `json:"rp"`
+	User                   WebauthnUserEntity             `json:"user"`
+	Challenge              string                         `json:"challenge"`
+	PubKeyCredParams       []WebauthnCredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int                            `json:"timeout"`
+	ExcludeCredentials     []WebauthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebauthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+type WebauthnRelyingParty struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebauthnUserEntity struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebauthnCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type WebauthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	Id         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type WebauthnAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// WebauthnRequestOptions are the options of navigator.credentials.get() for logging in with a passkey, in their JSON
+// form
+type WebauthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int                            `json:"timeout"`
+	RpId             string                         `json:"rpId"`
+	AllowCredentials []WebauthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebauthnCredentialResponse is a credential returned by navigator.credentials.create() or get(), in its JSON form
+type WebauthnCredentialResponse struct {
+	Id       string `json:"id"`
+	RawId    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject,omitempty"`
+		Transports        []string `json:"transports,omitempty"`
+		AuthenticatorData string   `json:"authenticatorData,omitempty"`
+		Signature         string   `json:"signature,omitempty"`
+		UserHandle        string   `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+type webauthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type webauthnAttestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type authenticatorData struct {
+	RpIdHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialId []byte
+	PublicKey    []byte
+}
+
+type coseKeyHeader struct {
+	Kty int `cbor:"1,keyasint"`
+	Alg int `cbor:"3,keyasint"`
+}
+
+type coseEc2Key struct {
+	Crv int    `cbor:"-1,keyasint"`
+	X   []byte `cbor:"-2,keyasint"`
+	Y   []byte `cbor:"-3,keyasint"`
+}
+
+type coseRsaKey struct {
+	N []byte `cbor:"-1,keyasint"`
+	E []byte `cbor:"-2,keyasint"`
+}
+
+// decodeBase64Url decodes base64url data with or without padding
+func decodeBase64Url(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// newWebauthnSession generates the random challenge of a WebAuthn ceremony
+func newWebauthnSession() (*WebauthnSession, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return &WebauthnSession{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func webauthnTimeout() time.Duration {
+	return time.Duration(AppConfig.Webauthn.TimeoutSeconds) * time.Second
+}
+
+// webauthnCredentialDescriptors lists the user's passkeys, for excluding or allowing them in a ceremony
+func webauthnCredentialDescriptors(user *IdpUser) []WebauthnCredentialDescriptor {
+	descriptors := []WebauthnCredentialDescriptor{}
+	if user == nil {
+		return descriptors
+	}
+	for _, credential := range user.WebauthnCredentials {
+		descriptors = append(descriptors, WebauthnCredentialDescriptor{
+			Type:       webauthnKeyType,
+			Id:         credential.Id,
+			Transports: credential.Transports,
+		})
+	}
+	return descriptors
+}
+
+// findWebauthnCredential returns a passkey and the user it is registered to
+func findWebauthnCredential(id string) (*IdpUser, *WebauthnCredential) {
+	for i := range AppContext.Users {
+		user := &AppContext.Users[i]
+		for j := range user.WebauthnCredentials {
+			if user.WebauthnCredentials[j].Id == id {
+				return user, &user.WebauthnCredentials[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// startWebauthnRegistration starts registering a passkey for the user, replacing any registration that was not
+// finished. Passkeys are discoverable credentials, so they can be used without entering the username.
+func startWebauthnRegistration(user *IdpUser) (WebauthnCreationOptions, error) {
+	session, err := newWebauthnSession()
+	if err != nil {
+		return WebauthnCreationOptions{}, err
+	}
+	user.PendingWebauthn = session
+
+	displayName := user.Username
+	if name, ok := user.Attributes["name"].(string); ok && name != "" {
+		displayName = name
+	}
+
+	return WebauthnCreationOptions{
+		Rp: WebauthnRelyingParty{
+			Id:   AppConfig.Webauthn.RpId,
+			Name: AppConfig.Webauthn.RpName,
+		},
+		User: WebauthnUserEntity{
+			Id:          base64.RawURLEncoding.EncodeToString([]byte(user.Id)),
+			Name:        user.Username,
+			DisplayName: displayName,
+		},
+		Challenge: session.Challenge,
+		PubKeyCredParams: []WebauthnCredentialParameters{
+			{Type: webauthnKeyType, Alg: CoseAlgorithmES256},
+			{Type: webauthnKeyType, Alg: CoseAlgorithmRS256},
+		},
+		Timeout:            int(webauthnTimeout().Milliseconds()),
+		ExcludeCredentials: webauthnCredentialDescriptors(user),
+		AuthenticatorSelection: WebauthnAuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   AppConfig.Webauthn.UserVerification,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// finishWebauthnRegistration verifies the credential created for the user's registration and stores the passkey.
+// Attestation statements are not verified, as passkeys are registered with attestation "none".
+func finishWebauthnRegistration(user *IdpUser, data []byte, name string) (*WebauthnCredential, error) {
+	session := user.PendingWebauthn
+	if session == nil {
+		return nil, ErrNoWebauthnRegistration
+	}
+	if time.Since(session.CreatedAt) > webauthnTimeout() {
+		user.PendingWebauthn = nil
+		return nil, ErrWebauthnChallengeExpired
+	}
+
+	var response WebauthnCredentialResponse
+	if err := json.Unmarshal(data, &response); err != nil || response.Type != webauthnKeyType {
+		return nil, ErrInvalidWebauthnResponse
+	}
+
+	clientData, err := decodeBase64Url(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	if err := checkWebauthnClientData(clientData, webauthnCreate, session.Challenge); err != nil {
+		return nil, err
+	}
+
+	attestationData, err := decodeBase64Url(response.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	var attestation webauthnAttestationObject
+	if err := cbor.Unmarshal(attestationData, &attestation); err != nil {
+		return nil, ErrInvalidWebauthnResponse
+	}
+
+	authData, err := parseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.CredentialId == nil {
+		return nil, ErrInvalidWebauthnResponse
+	}
+
+	_, algorithm, err := parseCosePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(authData.CredentialId)
+	if owner, _ := findWebauthnCredential(id); owner != nil {
+		return nil, ErrWebauthnCredentialExists
+	}
+
+	now := time.Now()
+	user.WebauthnCredentials = append(user.WebauthnCredentials, WebauthnCredential{
+		Id:             id,
+		PublicKey:      base64.RawURLEncoding.EncodeToString(authData.PublicKey),
+		Algorithm:      algorithm,
+		SignCount:      authData.SignCount,
+		Transports:     response.Response.Transports,
+		BackupEligible: authData.Flags&authenticatorFlagBackupEligible != 0,
+		Name:           name,
+		CreatedAt:      &now,
+	})
+	user.PendingWebauthn = nil
+	return &user.WebauthnCredentials[len(user.WebauthnCredentials)-1], nil
+}
+
+// newWebauthnLogin starts a passkey login. Logins of a known user only allow their passkeys, other logins let the
+// browser offer any passkey of the relying party.
+func newWebauthnLogin(user *IdpUser) (*WebauthnSession, *WebauthnRequestOptions, error) {
+	session, err := newWebauthnSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, &WebauthnRequestOptions{
+		Challenge:        session.Challenge,
+		Timeout:          int(webauthnTimeout().Milliseconds()),
+		RpId:             AppConfig.Webauthn.RpId,
+		AllowCredentials: webauthnCredentialDescriptors(user),
+		UserVerification: AppConfig.Webauthn.UserVerification,
+	}, nil
+}
+
+// verifyWebauthnLogin verifies a passkey assertion for the session's challenge and returns the user the passkey is
+// registered to, along with the authentication methods of the login and whether the authenticator verified the user.
+// If userId is set, only that user's passkeys are accepted.
+func verifyWebauthnLogin(session *WebauthnSession, userId string, data []byte) (*IdpUser, []string, bool, error) {
+	if session == nil {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+	if time.Since(session.CreatedAt) > webauthnTimeout() {
+		return nil, nil, false, ErrWebauthnChallengeExpired
+	}
+
+	var response WebauthnCredentialResponse
+	if err := json.Unmarshal(data, &response); err != nil || response.Type != webauthnKeyType {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+
+	rawId := response.RawId
+	if rawId == "" {
+		rawId = response.Id
+	}
+	credentialId, err := decodeBase64Url(rawId)
+	if err != nil {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+	user, credential := findWebauthnCredential(base64.RawURLEncoding.EncodeToString(credentialId))
+	if user == nil || (userId != "" && user.Id != userId) {
+		return nil, nil, false, ErrUnknownWebauthnCredential
+	}
+	if response.Response.UserHandle != "" {
+		userHandle, err := decodeBase64Url(response.Response.UserHandle)
+		if err != nil || string(userHandle) != user.Id {
+			return nil, nil, false, ErrUnknownWebauthnCredential
+		}
+	}
+
+	clientData, err := decodeBase64Url(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+	if err := checkWebauthnClientData(clientData, webauthnGet, session.Challenge); err != nil {
+		return nil, nil, false, err
+	}
+
+	rawAuthData, err := decodeBase64Url(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err := checkAuthenticatorData(authData); err != nil {
+		return nil, nil, false, err
+	}
+
+	signature, err := decodeBase64Url(response.Response.Signature)
+	if err != nil {
+		return nil, nil, false, ErrInvalidWebauthnResponse
+	}
+	if err := verifyWebauthnSignature(credential, rawAuthData, clientData, signature); err != nil {
+		return nil, nil, false, err
+	}
+
+	// A signature counter that does not increase indicates a cloned authenticator
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return nil, nil, false, errors.New("Passkey signature counter did not increase")
+	}
+
+	now := time.Now()
+	credential.SignCount = authData.SignCount
+	credential.LastUsedAt = &now
+
+	amr := AmrHardwareKey
+	if authData.Flags&authenticatorFlagBackupEligible != 0 {
+		amr = AmrSoftwareKey
+	}
+	return user, []string{amr}, authData.Flags&authenticatorFlagUserVerified != 0, nil
+}
+
+// checkWebauthnClientData checks the ceremony type, challenge and origin the browser signed
+func checkWebauthnClientData(data []byte, ceremony string, challenge string) error {
+	var clientData webauthnClientData
+	if err := json.Unmarshal(data, &clientData); err != nil {
+		return ErrInvalidWebauthnResponse
+	}
+	if clientData.Type != ceremony {
+		return ErrInvalidWebauthnResponse
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(clientData.Challenge, "=")), []byte(challenge)) != 1 {
+		return errors.New("WebAuthn challenge does not match")
+	}
+	if !slices.Contains(AppConfig.Webauthn.Origins, clientData.Origin) {
+		return errors.New("WebAuthn origin is not allowed")
+	}
+	return nil
+}
+
+// parseAuthenticatorData parses the authenticator data, including the credential of a registration
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	authData := &authenticatorData{
+		RpIdHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.Flags&authenticatorFlagAttestedCredential == 0 {
+		return authData, nil
+	}
+
+	// The AAGUID is followed by the length of the credential ID, the ID and the COSE public key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	authData.CredentialId = rest[:idLength]
+
+	var publicKey cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest[idLength:], &publicKey); err != nil {
+		return nil, ErrInvalidWebauthnResponse
+	}
+	authData.PublicKey = publicKey
+	return authData, nil
+}
+
+// checkAuthenticatorData checks the relying party ID and that the user was present and, if required, verified
+func checkAuthenticatorData(authData *authenticatorData) error {
+	rpIdHash := sha256.Sum256([]byte(AppConfig.Webauthn.RpId))
+	if subtle.ConstantTimeCompare(authData.RpIdHash, rpIdHash[:]) != 1 {
+		return errors.New("WebAuthn relying party ID does not match")
+	}
+	if authData.Flags&authenticatorFlagUserPresent == 0 {
+		return errors.New("User presence is required")
+	}
+	if AppConfig.Webauthn.UserVerification == WebauthnUserVerificationRequired && authData.Flags&authenticatorFlagUserVerified == 0 {
+		return errors.New("User verification is required")
+	}
+	return nil
+}
+
+// parseCosePublicKey parses an ES256 or RS256 COSE public key
+func parseCosePublicKey(data []byte) (crypto.PublicKey, int, error) {
+	var header coseKeyHeader
+	if err := cbor.Unmarshal(data, &header); err != nil {
+		return nil, 0, ErrUnsupportedPublicKey
+	}
+
+	switch {
+	case header.Alg == CoseAlgorithmES256 && header.Kty == coseKeyTypeEc2:
+		var key coseEc2Key
+		if err := cbor.Unmarshal(data, &key); err != nil || key.Crv != coseCurveP256 {
+			return nil, 0, ErrUnsupportedPublicKey
+		}
+		point := append(append([]byte{4}, key.X...), key.Y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, 0, ErrUnsupportedPublicKey
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(key.X),
+			Y:     new(big.Int).SetBytes(key.Y),
+		}, header.Alg, nil
+	case header.Alg == CoseAlgorithmRS256 && header.Kty == coseKeyTypeRsa:
+		var key coseRsaKey
+		if err := cbor.Unmarshal(data, &key); err != nil || len(key.N) == 0 || len(key.E) == 0 || len(key.E) > 4 {
+			return nil, 0, ErrUnsupportedPublicKey
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(key.N),
+			E: int(new(big.Int).SetBytes(key.E).Int64()),
+		}, header.Alg, nil
+	}
+	return nil, 0, ErrUnsupportedPublicKey
+}
+
+// verifyWebauthnSignature verifies the passkey's signature over the authenticator data and the client data hash
+func verifyWebauthnSignature(credential *WebauthnCredential, authData []byte, clientData []byte, signature []byte) error {
+	keyData, err := decodeBase64Url(credential.PublicKey)
+	if err != nil {
+		return ErrUnsupportedPublicKey
+	}
+	publicKey, _, err := parseCosePublicKey(keyData)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidWebauthnSignature
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HookPreSignUp          = "pre_sign_up"
+	HookPostConfirmation   = "post_confirmation"
+	HookPreAuthentication  = "pre_authentication"
+	HookPostAuthentication = "post_authentication"
+	HookPreTokenGeneration = "pre_token_generation"
+	DefaultWebhookTimeout  = 5 * time.Second
+	GroupsClaim            = "cognito:groups"
+)
+
+const (
+	HookSourceLoginApi = "login_api"
+	HookSourceOAuth2   = "oauth2"
+	HookSourceAdmin    = "admin"
+	HookSourceCognito  = "cognito"
+	HookSourceSignUp   = "sign_up"
+)
+
+// Claims that a pre token generation hook is not allowed to add, override or suppress
+var protectedClaims = map[string]bool{
+	"iss":       true,
+	"sub":       true,
+	"aud":       true,
+	"exp":       true,
+	"iat":       true,
+	"auth_time": true,
+	"token_use": true,
+	"jti":       true,
+	"nonce":     true,
+	"at_hash":   true,
+	"c_hash":    true,
+}
+
+type WebhookUser struct {
+	Id         string                 `json:"id"`
+	Username   string                 `json:"username"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Groups     []string               `json:"groups,omitempty"`
+}
+
+type WebhookClient struct {
+	Id       string `json:"id"`
+	Audience string `json:"audience"`
+}
+
+type LifecycleHookEvent struct {
+	Trigger string         `json:"trigger"`
+	Source  string         `json:"source"`
+	User    WebhookUser    `json:"user"`
+	Client  *WebhookClient `json:"client,omitempty"`
+}
+
+type LifecycleHookResponse struct {
+	Allow   *bool  `json:"allow,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type PreTokenGenerationEvent struct {
+	Trigger  string                 `json:"trigger"`
+	TokenUse string                 `json:"token_use"`
+	User     WebhookUser            `json:"user"`
+	Client   WebhookClient          `json:"client"`
+	Scopes   []string               `json:"scopes"`
+	Groups   []string               `json:"groups"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+type PreTokenGenerationResponse struct {
+	ClaimsToAddOrOverride map[string]interface{} `json:"claims_to_add_or_override,omitempty"`
+	ClaimsToSuppress      []string               `json:"claims_to_suppress,omitempty"`
+	GroupsToOverride      *[]string              `json:"groups_to_override,omitempty"`
+}
+
+func newWebhookUser(user *IdpUser) WebhookUser {
+	return WebhookUser{
+		Id:         user.Id,
+		Username:   user.Username,
+		Attributes: user.Attributes,
+		Groups:     user.Groups,
+	}
+}
+
+func newWebhookClient(client *IdpClient) WebhookClient {
+	if client == nil {
+		return WebhookClient{}
+	}
+	return WebhookClient{
+		Id:       client.Id,
+		Audience: client.Audience,
+	}
+}
+
+// callWebhook POSTs the payload as JSON to the webhook and decodes the JSON response, if any, into response
+func callWebhook(hook *WebhookConfig, payload interface{}, response interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	timeout := DefaultWebhookTimeout
+	if hook.TimeoutMs > 0 {
+		timeout = time.Duration(hook.TimeoutMs) * time.Millisecond
+	}
+
+	httpClient := &http.Client{Timeout: timeout}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	if response == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// newLifecycleHookEvent creates the event payload for a user lifecycle hook
+func newLifecycleHookEvent(trigger string, source string, user *IdpUser, client *IdpClient) LifecycleHookEvent {
+	event := LifecycleHookEvent{
+		Trigger: trigger,
+		Source:  source,
+		User:    newWebhookUser(user),
+	}
+	if client != nil {
+		webhookClient := newWebhookClient(client)
+		event.Client = &webhookClient
+	}
+	return event
+}
+
+// runPreHook calls a pre hook, returning an error carrying the message to surface to the caller if the
+// operation is denied
+func runPreHook(hook *WebhookConfig, event LifecycleHookEvent) error {
+	if hook == nil || hook.Url == "" {
+		return nil
+	}
+
+	var response LifecycleHookResponse
+	if err := callWebhook(hook, event, &response); err != nil {
+		if hook.FailOpen {
+			log.Printf("Hook %s failed, continuing: %v", event.Trigger, err)
+			return nil
+		}
+		log.Printf("Hook %s failed: %v", event.Trigger, err)
+		return fmt.Errorf("%s hook failed", event.Trigger)
+	}
+
+	if response.Allow != nil && !*response.Allow {
+		if response.Message != "" {
+			return errors.New(response.Message)
+		}
+		return fmt.Errorf("%s hook denied the request", event.Trigger)
+	}
+	return nil
+}
+
+// runPostHook notifies a post hook of an event. The hook is called in the background, so it does not hold up the
+// request, and failures are only logged.
+func runPostHook(hook *WebhookConfig, event LifecycleHookEvent) {
+	if hook == nil || hook.Url == "" {
+		return
+	}
+
+	// The event is encoded right away, since the user may change while the hook is called
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Hook %s failed: %v", event.Trigger, err)
+		return
+	}
+	go func() {
+		if err := callWebhook(hook, json.RawMessage(payload), nil); err != nil {
+			log.Printf("Hook %s failed: %v", event.Trigger, err)
+		}
+	}()
+}
+
+// claimGroups returns the groups currently present in the claims
+func claimGroups(claims map[string]interface{}) []string {
+	groups := []string{}
+	switch v := claims[GroupsClaim].(type) {
+	case []string:
+		groups = append(groups, v...)
+	case []interface{}:
+		for _, g := range v {
+			groups = append(groups, fmt.Sprint(g))
+		}
+	}
+	return groups
+}
+
+// runPreTokenGenerationHook lets the configured webhook add, override or suppress claims and groups of a token
+func runPreTokenGenerationHook(tokenUse string, user *IdpUser, client *IdpClient, scopes string, claims map[string]interface{}) error {
+	hook := AppConfig.Hooks.PreTokenGeneration
+	if hook == nil || hook.Url == "" {
+		return nil
+	}
+
+	event := PreTokenGenerationEvent{
+		Trigger:  HookPreTokenGeneration,
+		TokenUse: tokenUse,
+		User:     newWebhookUser(user),
+		Client:   newWebhookClient(client),
+		Scopes:   strings.Fields(scopes),
+		Groups:   claimGroups(claims),
+		Claims:   claims,
+	}
+
+	var response PreTokenGenerationResponse
+	if err := callWebhook(hook, event, &response); err != nil {
+		if hook.FailOpen {
+			log.Printf("Pre token generation hook failed, continuing: %v", err)
+			return nil
+		}
+		log.Printf("Pre token generation hook failed: %v", err)
+		return fmt.Errorf("pre token generation hook failed: %w", err)
+	}
+
+	for name, value := range response.ClaimsToAddOrOverride {
+		if protectedClaims[name] {
+			log.Printf("Pre token generation hook cannot override claim %q", name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	for _, name := range response.ClaimsToSuppress {
+		if protectedClaims[name] {
+			log.Printf("Pre token generation hook cannot suppress claim %q", name)
+			continue
+		}
+		delete(claims, name)
+	}
+
+	if response.GroupsToOverride != nil {
+		if len(*response.GroupsToOverride) == 0 {
+			delete(claims, GroupsClaim)
+		} else {
+			claims[GroupsClaim] = *response.GroupsToOverride
+		}
+	}
+
+	return nil
+}